@@ -0,0 +1,203 @@
+package KeyValor
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+
+	"KeyValor/config"
+	"KeyValor/constants"
+	"KeyValor/dbops"
+	"KeyValor/internal/storage/storagecommon"
+)
+
+// Stats are the statistics of a database, for monitoring.
+type Stats struct {
+	// Keys is the number of keys, including the expired keys that the compaction didn't
+	// delete yet; KeysWithExpiry is how many of them have an expiry
+	Keys           int
+	KeysWithExpiry int
+
+	// DataFiles is the number of data files, and DiskBytes the size of the data files and index
+	DataFiles int
+	DiskBytes int64
+
+	// ChangesSinceCheckpoint is the number of writes since the index was last persisted,
+	// periodically (every SyncWriteInterval), by the compaction, or by Checkpoint
+	ChangesSinceCheckpoint int64
+	LastCheckpoint         time.Time
+	Checkpoints            int64
+
+	LastCompaction time.Time
+	Compactions    int64
+	FileRotations  int64
+}
+
+// Stats returns the statistics of the database (without those of its namespaces).
+func (db *KeyValorDatabase) Stats() Stats {
+	return Stats(db.storage.Stats())
+}
+
+// Checkpoint syncs the data files and persists the index, like the periodic index flushes
+// (every SyncWriteInterval), so that the data written so far survives a crash.
+func (db *KeyValorDatabase) Checkpoint() error {
+	return db.storage.Checkpoint()
+}
+
+// Clear deletes every key of the database (but not its namespaces), and its data files.
+// It fails with constants.ErrStoreIsBusy while read-only processes are attached.
+func (db *KeyValorDatabase) Clear() error {
+	return db.intercept(dbops.OpClear, true, nil, func() error {
+		db.Lock()
+		defer db.Unlock()
+
+		return db.storage.Clear()
+	})
+}
+
+// Config returns a copy of the options of the database.
+func (db *KeyValorDatabase) Config() config.DBCfgOpts {
+	db.RLock()
+	defer db.RUnlock()
+
+	return *db.cfg.Clone()
+}
+
+// Configure changes options of the open database: the intervals of the background tasks
+// (WithSyncWriteInterval, WithCompactInterval, WithCheckFileSizeInterval,
+// WithActiveExpireInterval), WithMaxActiveFileSize, WithSyncPolicy and WithDefaultTTL. The
+// other options can't change once the database is open: Configure fails with
+// constants.ErrNotReconfigurable if they do, and changes nothing.
+// The namespaces already open keep their options.
+func (db *KeyValorDatabase) Configure(options ...Option) error {
+	db.Lock()
+	defer db.Unlock()
+
+	cfg := db.cfg.Clone()
+	for _, option := range options {
+		option(cfg)
+	}
+
+	if cfg.Directory != db.cfg.Directory ||
+		cfg.Compression != db.cfg.Compression ||
+		cfg.ReadOnly != db.cfg.ReadOnly ||
+		cfg.LockMode != db.cfg.LockMode ||
+		len(cfg.Interceptors) != len(db.cfg.Interceptors) ||
+		(cfg.ExpiryListener == nil) != (db.cfg.ExpiryListener == nil) ||
+		(cfg.LatencyListener == nil) != (db.cfg.LatencyListener == nil) {
+		return constants.ErrNotReconfigurable
+	}
+
+	return db.storage.Reconfigure(cfg)
+}
+
+// Move moves key, with its value of any data type and its expiry, to the database target.
+// It returns false, and moves nothing, if key doesn't exist or target already has it.
+// The write to target goes through its interceptors, as a SetWithExpiry of key. Both
+// databases are write-locked, in a fixed order. If key can't be deleted from db once it was
+// written to target, the write is rolled back; the error wraps constants.ErrKeyDuplicated
+// if the rollback fails too, and key is then in both databases.
+func (db *KeyValorDatabase) Move(key string, target *KeyValorDatabase) (moved bool, err error) {
+	if db == target {
+		return false, constants.ErrSameDatabase
+	}
+
+	err = db.intercept(dbops.OpMove, true, []string{key}, func() error {
+		return target.interceptCall(dbops.OpSetWithExpiry, true, []string{key}, func() error {
+			unlock := lockBoth(db, target)
+			defer unlock()
+
+			value, expiry, err := db.storage.GetWithExpiry(key)
+			if storagecommon.IsMissingKey(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			// target stores the elements of a list with its own
+			if value, err = db.lists.inline(value); err != nil {
+				return err
+			}
+
+			_, _, err = target.storage.GetWithExpiry(key)
+			if err == nil {
+				return nil
+			}
+			if !storagecommon.IsMissingKey(err) {
+				return err
+			}
+
+			if err := target.storage.SetWithExpiry(key, value, expiry); err != nil {
+				return err
+			}
+			if err := db.storage.Delete(key); err != nil {
+				if rollbackErr := target.storage.Delete(key); rollbackErr != nil {
+					return fmt.Errorf("%w: %w", constants.ErrKeyDuplicated, errors.Join(err, rollbackErr))
+				}
+				return err
+			}
+			moved = true
+			target.watches.touch([]string{key})
+			return nil
+		})
+	})
+	return moved, err
+}
+
+// CopyTo copies the value of key and its expiry to destination in the target database, and
+// returns whether it did: it doesn't if destination exists there, unless replace is set.
+// The write to target goes through its interceptors, as a SetWithExpiry of destination.
+// Both databases are locked during the copy.
+func (db *KeyValorDatabase) CopyTo(key string, target *KeyValorDatabase, destination string, replace bool) (copied bool, err error) {
+	if db == target {
+		return db.Copy(key, destination, replace)
+	}
+
+	err = db.intercept(dbops.OpCopyTo, false, []string{key}, func() error {
+		return target.interceptCall(dbops.OpSetWithExpiry, true, []string{destination}, func() error {
+			unlock := lockBoth(db, target)
+			defer unlock()
+
+			value, expiry, err := db.storage.GetWithExpiry(key)
+			if err != nil {
+				return err
+			}
+			if value, err = db.lists.inline(value); err != nil {
+				return err
+			}
+
+			if !replace {
+				_, _, err = target.storage.GetWithExpiry(destination)
+				if err == nil {
+					return nil
+				}
+				if !storagecommon.IsMissingKey(err) {
+					return err
+				}
+			}
+
+			if err := target.storage.SetWithExpiry(destination, value, expiry); err != nil {
+				return err
+			}
+			copied = true
+			target.watches.touch([]string{destination})
+			return nil
+		})
+	})
+	return copied, err
+}
+
+// lockBoth write-locks two databases, in the order of their addresses so that two calls
+// locking the same databases never deadlock, and returns the function unlocking them.
+func lockBoth(a, b *KeyValorDatabase) (unlock func()) {
+	if uintptr(unsafe.Pointer(a)) > uintptr(unsafe.Pointer(b)) {
+		a, b = b, a
+	}
+	a.Lock()
+	b.Lock()
+	return func() {
+		b.Unlock()
+		a.Unlock()
+	}
+}
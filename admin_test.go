@@ -0,0 +1,385 @@
+package KeyValor
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"KeyValor/config"
+	"KeyValor/constants"
+	"KeyValor/dbops"
+)
+
+func TestStatsAndCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewKeyValorDB(WithDirectory(dir))
+	require.NoError(t, err)
+
+	require.NoError(t, db.Set("a", []byte("1")))
+	require.NoError(t, db.SetEx("b", []byte("2"), 100))
+	require.NoError(t, db.SetEx("c", []byte("3"), 100))
+	require.NoError(t, db.Persist("c"))
+	require.NoError(t, db.Delete("a"))
+
+	stats := db.Stats()
+	require.Equal(t, 2, stats.Keys)
+	require.Equal(t, 1, stats.KeysWithExpiry)
+	require.EqualValues(t, 5, stats.ChangesSinceCheckpoint)
+	require.Equal(t, 1, stats.DataFiles)
+	require.Positive(t, stats.DiskBytes)
+
+	before := stats.LastCheckpoint
+	require.NoError(t, db.Checkpoint())
+	stats = db.Stats()
+	require.Zero(t, stats.ChangesSinceCheckpoint)
+	require.EqualValues(t, 1, stats.Checkpoints)
+	require.True(t, stats.LastCheckpoint.After(before))
+	require.NoError(t, db.Shutdown())
+
+	// the expiries are kept in the index
+	db, err = NewKeyValorDB(WithDirectory(dir))
+	require.NoError(t, err)
+	defer db.Shutdown()
+	require.Equal(t, 1, db.Stats().KeysWithExpiry)
+}
+
+func TestShutdownWithoutCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewKeyValorDB(WithDirectory(dir))
+	require.NoError(t, err)
+
+	require.NoError(t, db.Set("a", []byte("1")))
+	require.NoError(t, db.Checkpoint())
+	require.NoError(t, db.Set("b", []byte("2")))
+	require.NoError(t, db.ShutdownWithoutCheckpoint())
+
+	// the database reopens as of its checkpoint
+	db, err = NewKeyValorDB(WithDirectory(dir))
+	require.NoError(t, err)
+	require.True(t, db.Exists("a"))
+	require.False(t, db.Exists("b"))
+
+	require.NoError(t, db.Set("b", []byte("2")))
+	require.NoError(t, db.Shutdown())
+	db, err = NewKeyValorDB(WithDirectory(dir))
+	require.NoError(t, err)
+	defer db.Shutdown()
+	require.True(t, db.Exists("b"))
+}
+
+func TestClear(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewKeyValorDB(WithDirectory(dir))
+	require.NoError(t, err)
+
+	users, err := db.Namespace("users")
+	require.NoError(t, err)
+	require.NoError(t, users.Set("u", []byte("1")))
+
+	require.NoError(t, db.Set("a", []byte("1")))
+	require.NoError(t, db.Set("b", []byte("2")))
+	w := db.Watch("a")
+	defer w.Close()
+
+	require.NoError(t, db.Clear())
+	require.True(t, w.Dirty())
+	require.Equal(t, 0, db.Stats().Keys)
+	require.Equal(t, 1, db.Stats().DataFiles)
+	require.False(t, db.Exists("a"))
+
+	// the database is still usable, and the namespaces are left alone
+	require.NoError(t, db.Set("c", []byte("3")))
+	require.True(t, users.Exists("u"))
+	require.NoError(t, db.Shutdown())
+
+	db, err = NewKeyValorDB(WithDirectory(dir))
+	require.NoError(t, err)
+	defer db.Shutdown()
+	keys, err := db.AllKeys()
+	require.NoError(t, err)
+	require.Equal(t, []string{"c"}, keys)
+
+	// it isn't possible while read-only processes are attached
+	reader, err := NewKeyValorDB(WithDirectory(dir), WithReadOnly())
+	require.NoError(t, err)
+	require.ErrorIs(t, db.Clear(), constants.ErrStoreIsBusy)
+	require.ErrorIs(t, reader.Clear(), constants.ErrReadOnly)
+	require.NoError(t, reader.Shutdown())
+}
+
+func TestConfigure(t *testing.T) {
+	db, err := NewKeyValorDB(WithDirectory(t.TempDir()))
+	require.NoError(t, err)
+	defer db.Shutdown()
+
+	require.NoError(t, db.Configure(WithDefaultTTL(time.Hour), WithSyncWriteInterval(10*time.Millisecond)))
+	require.Equal(t, time.Hour, db.Config().DefaultTTL)
+
+	require.NoError(t, db.Set("a", []byte("1")))
+	ttl, err := db.TTL("a")
+	require.NoError(t, err)
+	require.EqualValues(t, 3600, ttl)
+
+	// the index flush runs at its new interval
+	require.Eventually(t, func() bool { return db.Stats().Checkpoints > 0 }, time.Second, 10*time.Millisecond)
+
+	// every write is synced
+	require.NoError(t, db.Configure(WithSyncPolicy(config.SyncAlways)))
+	require.Equal(t, config.SyncAlways, db.Config().SyncPolicy)
+	require.NoError(t, db.Set("b", []byte("2")))
+
+	require.ErrorIs(t, db.Configure(WithCompression(config.CompressionFlate)), constants.ErrNotReconfigurable)
+	require.ErrorIs(t, db.Configure(WithDirectory(t.TempDir())), constants.ErrNotReconfigurable)
+	require.Equal(t, config.CompressionNone, db.Config().Compression)
+}
+
+func TestCompressionIsFixed(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewKeyValorDB(WithDirectory(dir), WithCompression(config.CompressionFlate))
+	require.NoError(t, err)
+	require.NoError(t, db.Set("s", []byte("hello world")))
+	require.NoError(t, db.UpdateList("l", func(l *List) error {
+		l.PushRight([]byte("a"))
+		return nil
+	}))
+	require.NoError(t, db.Shutdown())
+
+	// reopening with another codec fails, rather than decoding the data with it
+	_, err = NewKeyValorDB(WithDirectory(dir))
+	require.ErrorIs(t, err, constants.ErrCompressionMismatch)
+	_, err = NewKeyValorDB(WithDirectory(dir), WithReadOnly())
+	require.ErrorIs(t, err, constants.ErrCompressionMismatch)
+
+	// the elements of the lists, stored apart, have their codec too
+	require.FileExists(t, filepath.Join(dir, LISTS_DIR, OPTIONS_FILENAME))
+
+	db, err = NewKeyValorDB(WithDirectory(dir), WithCompression(config.CompressionFlate))
+	require.NoError(t, err)
+	defer db.Shutdown()
+
+	val, err := db.Get("s")
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(val))
+	l, err := db.GetList("l")
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("a")}, l.Range(0, -1))
+}
+
+func TestExpiryListener(t *testing.T) {
+	for name, option := range map[string]Option{
+		"active expiry": WithActiveExpireInterval(10 * time.Millisecond),
+		"compaction":    WithCompactInterval(10 * time.Millisecond),
+	} {
+		t.Run(name, func(t *testing.T) {
+			expired := make(chan []string, 10)
+			db, err := NewKeyValorDB(WithDirectory(t.TempDir()), WithActiveExpireInterval(time.Hour), option,
+				WithExpiryListener(func(keys []string) { expired <- keys }))
+			require.NoError(t, err)
+			defer db.Shutdown()
+
+			require.NoError(t, db.SetWithExpiry("a", []byte("1"), time.Now().Add(50*time.Millisecond)))
+			require.NoError(t, db.SetWithExpiry("b", []byte("2"), time.Now().Add(time.Hour)))
+			require.NoError(t, db.Set("c", []byte("3")))
+
+			select {
+			case keys := <-expired:
+				require.Equal(t, []string{"a"}, keys)
+			case <-time.After(5 * time.Second):
+				t.Fatal("no key expired")
+			}
+			require.Equal(t, 2, db.Stats().Keys)
+			require.Equal(t, 1, db.Stats().KeysWithExpiry)
+		})
+	}
+}
+
+func TestLatencyListener(t *testing.T) {
+	events := make(chan string, 100)
+	db, err := NewKeyValorDB(WithDirectory(t.TempDir()),
+		WithCompactInterval(10*time.Millisecond),
+		WithCheckFileSizeInterval(10*time.Millisecond),
+		WithSyncWriteInterval(10*time.Millisecond),
+		WithActiveExpireInterval(10*time.Millisecond),
+		WithLatencyListener(func(event string, duration time.Duration) {
+			select {
+			case events <- event:
+			default:
+			}
+		}))
+	require.NoError(t, err)
+	defer db.Shutdown()
+	require.NoError(t, db.SetWithExpiry("a", []byte("1"), time.Now().Add(time.Hour)))
+
+	// every background task reports its runs
+	seen := make(map[string]bool)
+	timeout := time.After(5 * time.Second)
+	for len(seen) < 4 {
+		select {
+		case event := <-events:
+			seen[event] = true
+		case <-timeout:
+			t.Fatalf("only %v were reported", seen)
+		}
+	}
+	require.Equal(t, map[string]bool{
+		config.LatencyCompaction:   true,
+		config.LatencyFileRotation: true,
+		config.LatencyIndexFlush:   true,
+		config.LatencyExpireCycle:  true,
+	}, seen)
+
+	require.ErrorIs(t, db.Configure(WithLatencyListener(nil)), constants.ErrNotReconfigurable)
+}
+
+func TestMove(t *testing.T) {
+	source, err := NewKeyValorDB(WithDirectory(t.TempDir()))
+	require.NoError(t, err)
+	defer source.Shutdown()
+	target, err := NewKeyValorDB(WithDirectory(t.TempDir()))
+	require.NoError(t, err)
+	defer target.Shutdown()
+
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+	require.NoError(t, source.SetWithExpiry("a", []byte("1"), expiry))
+	require.NoError(t, source.UpdateHash("h", func(h *Hash) error {
+		h.Set("f", []byte("v"))
+		return nil
+	}))
+	require.NoError(t, target.Set("b", []byte("2")))
+	require.NoError(t, source.Set("b", []byte("3")))
+	w := target.Watch("a")
+	defer w.Close()
+
+	moved, err := source.Move("a", target)
+	require.NoError(t, err)
+	require.True(t, moved)
+	require.False(t, source.Exists("a"))
+	value, gotExpiry, err := target.GetWithExpiry("a")
+	require.NoError(t, err)
+	require.Equal(t, "1", string(value))
+	require.True(t, expiry.Equal(gotExpiry))
+	require.True(t, w.Dirty())
+
+	// any data type moves
+	moved, err = source.Move("h", target)
+	require.NoError(t, err)
+	require.True(t, moved)
+	h, err := target.GetHash("h")
+	require.NoError(t, err)
+	require.Equal(t, 1, h.Len())
+
+	// nothing moves when the key is missing, or already in the target
+	moved, err = source.Move("nope", target)
+	require.NoError(t, err)
+	require.False(t, moved)
+	moved, err = source.Move("b", target)
+	require.NoError(t, err)
+	require.False(t, moved)
+	value, err = source.Get("b")
+	require.NoError(t, err)
+	require.Equal(t, "3", string(value))
+
+	_, err = source.Move("b", source)
+	require.ErrorIs(t, err, constants.ErrSameDatabase)
+
+	// the writes to the target go through its interceptors
+	errDenied := errors.New("denied")
+	var calls []string
+	guarded, err := NewKeyValorDB(WithDirectory(t.TempDir()), WithInterceptors(func(call *dbops.Call, next dbops.Invoker) error {
+		calls = append(calls, call.Op+" "+call.Keys[0])
+		if call.Write && call.Keys[0] == "b" {
+			return errDenied
+		}
+		return next()
+	}))
+	require.NoError(t, err)
+	defer guarded.Shutdown()
+
+	_, err = source.Move("b", guarded)
+	require.ErrorIs(t, err, errDenied)
+	require.True(t, source.Exists("b"))
+	_, err = source.CopyTo("b", guarded, "b", false)
+	require.ErrorIs(t, err, errDenied)
+	require.False(t, guarded.Exists("b"))
+	copied, err := source.CopyTo("b", guarded, "c", false)
+	require.NoError(t, err)
+	require.True(t, copied)
+	require.Equal(t, []string{"SetWithExpiry b", "SetWithExpiry b", "Exists b", "SetWithExpiry c"}, calls)
+}
+
+func TestRenameAndCopy(t *testing.T) {
+	db, err := NewKeyValorDB(WithDirectory(t.TempDir()))
+	require.NoError(t, err)
+	defer db.Shutdown()
+	other, err := NewKeyValorDB(WithDirectory(t.TempDir()))
+	require.NoError(t, err)
+	defer other.Shutdown()
+
+	expiry := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	require.NoError(t, db.SetWithExpiry("a", []byte("1"), expiry))
+	require.NoError(t, db.Set("b", []byte("2")))
+	w := db.Watch("b")
+	defer w.Close()
+
+	// the renamed key keeps its expiry, and overwrites the new key
+	require.NoError(t, db.Rename("a", "b"))
+	require.False(t, db.Exists("a"))
+	value, gotExpiry, err := db.GetWithExpiry("b")
+	require.NoError(t, err)
+	require.Equal(t, "1", string(value))
+	require.True(t, expiry.Equal(gotExpiry))
+	require.True(t, w.Dirty())
+	pttl, err := db.PTTL("b")
+	require.NoError(t, err)
+	require.InDelta(t, time.Hour.Milliseconds(), pttl, 1000)
+
+	require.NoError(t, db.Rename("b", "b"))
+	require.ErrorIs(t, db.Rename("a", "c"), constants.ErrKeyMissing)
+
+	// copies keep the expiry, and only replace an existing key if asked to
+	copied, err := db.Copy("b", "c", false)
+	require.NoError(t, err)
+	require.True(t, copied)
+	_, gotExpiry, err = db.GetWithExpiry("c")
+	require.NoError(t, err)
+	require.True(t, expiry.Equal(gotExpiry))
+
+	require.NoError(t, db.Set("d", []byte("4")))
+	copied, err = db.Copy("b", "d", false)
+	require.NoError(t, err)
+	require.False(t, copied)
+	copied, err = db.Copy("b", "d", true)
+	require.NoError(t, err)
+	require.True(t, copied)
+	value, err = db.Get("d")
+	require.NoError(t, err)
+	require.Equal(t, "1", string(value))
+
+	_, err = db.Copy("b", "b", true)
+	require.ErrorIs(t, err, constants.ErrSameKey)
+
+	// any data type is copied, to another database too
+	require.NoError(t, db.UpdateHash("h", func(h *Hash) error {
+		h.Set("f", []byte("v"))
+		return nil
+	}))
+	copied, err = db.CopyTo("h", other, "h2", false)
+	require.NoError(t, err)
+	require.True(t, copied)
+	h, err := other.GetHash("h2")
+	require.NoError(t, err)
+	require.Equal(t, 1, h.Len())
+	require.True(t, db.Exists("h"))
+
+	// an expired key is missing
+	require.NoError(t, db.SetWithExpiry("old", []byte("v"), time.Now().Add(-time.Second)))
+	require.Error(t, db.Rename("old", "new"))
+	_, err = db.PTTL("old")
+	require.ErrorIs(t, err, constants.ErrKeyIsExpired)
+	pttl, err = db.PTTL("h")
+	require.NoError(t, err)
+	require.Equal(t, int64(-1), pttl)
+}
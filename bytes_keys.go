@@ -0,0 +1,167 @@
+package KeyValor
+
+import (
+	"time"
+
+	"KeyValor/dbops"
+	"KeyValor/internal/utils/dataconvutils"
+)
+
+var _ dbops.BytesKeyOperations = (*BytesKeyDatabase)(nil)
+
+// BytesKeyDatabase is a []byte-keyed view of a KeyValorDatabase (or of a Namespace),
+// for binary keys such as encoded tuples and UUIDs. It shares the data and the locks
+// of the database it was created from: a key set through the view is the same key
+// as string(key) in the string-keyed API.
+//
+// The view never retains a key slice: the caller may reuse or modify it as soon as a
+// method returns. Writes copy the key exactly once, into the index. Lookups don't copy it
+// (the storage only reads it, under its lock), unless the database has interceptors: the
+// keys of dbops.Call are copies, since an interceptor may keep them after the call.
+type BytesKeyDatabase struct {
+	db *KeyValorDatabase
+}
+
+// BytesKeys returns the []byte-keyed view of the database.
+func (db *KeyValorDatabase) BytesKeys() *BytesKeyDatabase {
+	return &BytesKeyDatabase{db: db}
+}
+
+// Get retrieves the value associated with the given key.
+func (bdb *BytesKeyDatabase) Get(key []byte) ([]byte, error) {
+	return bdb.db.Get(bdb.lookupKey(key))
+}
+
+// GetWithExpiry retrieves the value associated with the given key, and its expiry time.
+func (bdb *BytesKeyDatabase) GetWithExpiry(key []byte) ([]byte, time.Time, error) {
+	return bdb.db.GetWithExpiry(bdb.lookupKey(key))
+}
+
+// MGet retrieves the values associated with the given keys.
+func (bdb *BytesKeyDatabase) MGet(keys [][]byte) ([]dbops.Value, error) {
+	return bdb.db.MGet(bdb.lookupKeys(keys))
+}
+
+// Exists checks if a key exists.
+func (bdb *BytesKeyDatabase) Exists(key []byte) bool {
+	return bdb.db.Exists(bdb.lookupKey(key))
+}
+
+// TTL returns the remaining time to live of a key, in seconds.
+func (bdb *BytesKeyDatabase) TTL(key []byte) (int64, error) {
+	return bdb.db.TTL(bdb.lookupKey(key))
+}
+
+// PTTL returns the remaining time to live of a key, in milliseconds.
+func (bdb *BytesKeyDatabase) PTTL(key []byte) (int64, error) {
+	return bdb.db.PTTL(bdb.lookupKey(key))
+}
+
+// AllKeys returns every key in the database.
+func (bdb *BytesKeyDatabase) AllKeys() ([][]byte, error) {
+	keys, err := bdb.db.AllKeys()
+	if err != nil {
+		return nil, err
+	}
+	return toBytesKeys(keys), nil
+}
+
+// Keys returns the keys matching a Redis glob-style pattern.
+func (bdb *BytesKeyDatabase) Keys(pattern string) ([][]byte, error) {
+	keys, err := bdb.db.Keys(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return toBytesKeys(keys), nil
+}
+
+// Scan returns about count keys matching a Redis glob-style pattern, from cursor on,
+// and the cursor of the next keys (as in KeyValorDatabase.Scan).
+func (bdb *BytesKeyDatabase) Scan(cursor uint64, pattern string, count int) ([][]byte, uint64, error) {
+	keys, next, err := bdb.db.Scan(cursor, pattern, count)
+	if err != nil {
+		return nil, 0, err
+	}
+	return toBytesKeys(keys), next, nil
+}
+
+// Set inserts or updates a key-value pair.
+func (bdb *BytesKeyDatabase) Set(key []byte, value []byte) error {
+	return bdb.db.Set(string(key), value)
+}
+
+// Delete removes a key-value pair.
+func (bdb *BytesKeyDatabase) Delete(key []byte) error {
+	return bdb.db.Delete(string(key))
+}
+
+// SetEx inserts or updates a key-value pair, that expires after ttlSeconds.
+func (bdb *BytesKeyDatabase) SetEx(key []byte, value []byte, ttlSeconds int64) error {
+	return bdb.db.SetEx(string(key), value, ttlSeconds)
+}
+
+// SetWithExpiry inserts or updates a key-value pair, that expires at the given time.
+func (bdb *BytesKeyDatabase) SetWithExpiry(key []byte, value []byte, expiry time.Time) error {
+	return bdb.db.SetWithExpiry(string(key), value, expiry)
+}
+
+// Expire sets the expiry time of a key.
+func (bdb *BytesKeyDatabase) Expire(key []byte, expireTime *time.Time) error {
+	return bdb.db.Expire(string(key), expireTime)
+}
+
+// Persist removes the expiry time of a key.
+func (bdb *BytesKeyDatabase) Persist(key []byte) error {
+	return bdb.db.Persist(string(key))
+}
+
+// Incr increments the integer value of a key by one.
+func (bdb *BytesKeyDatabase) Incr(key []byte) error {
+	return bdb.db.Incr(string(key))
+}
+
+// Decr decrements the integer value of a key by one.
+func (bdb *BytesKeyDatabase) Decr(key []byte) error {
+	return bdb.db.Decr(string(key))
+}
+
+// Rename renames a key, overwriting newKey if it exists. Both keys are copied: the old key
+// is written again, in its tombstone.
+func (bdb *BytesKeyDatabase) Rename(key, newKey []byte) error {
+	return bdb.db.Rename(string(key), string(newKey))
+}
+
+// Copy copies a key and its expiry to destination, unless it exists and replace isn't set.
+func (bdb *BytesKeyDatabase) Copy(key, destination []byte, replace bool) (bool, error) {
+	return bdb.db.Copy(bdb.lookupKey(key), string(destination), replace)
+}
+
+// lookupKey returns key as the string of a lookup: a view of key, without copying it, unless
+// the interceptors of the database will see it.
+func (bdb *BytesKeyDatabase) lookupKey(key []byte) string {
+	if bdb.db.interceptor != nil {
+		return string(key)
+	}
+	return dataconvutils.UnsafeString(key)
+}
+
+// lookupKeys is lookupKey, for several keys.
+func (bdb *BytesKeyDatabase) lookupKeys(keys [][]byte) []string {
+	if bdb.db.interceptor != nil {
+		strs := make([]string, len(keys))
+		for i, key := range keys {
+			strs[i] = string(key)
+		}
+		return strs
+	}
+	return dataconvutils.UnsafeStrings(keys)
+}
+
+// toBytesKeys copies keys out of the index, so that callers can't modify them in place.
+func toBytesKeys(keys []string) [][]byte {
+	bytesKeys := make([][]byte, len(keys))
+	for i, key := range keys {
+		bytesKeys[i] = []byte(key)
+	}
+	return bytesKeys
+}
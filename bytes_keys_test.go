@@ -0,0 +1,68 @@
+package KeyValor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"KeyValor/dbops"
+)
+
+func TestBytesKeys(t *testing.T) {
+	db, err := NewKeyValorDB(WithDirectory(t.TempDir()))
+	require.NoError(t, err)
+	defer db.Shutdown()
+
+	bdb := db.BytesKeys()
+
+	// binary keys, including bytes that aren't valid UTF-8
+	key := []byte{0x00, 0xff, 0x10, 0x80}
+	require.NoError(t, bdb.Set(key, []byte("v1")))
+
+	// the caller can reuse the key buffer once Set returns
+	key[3] = 0x81
+	require.NoError(t, bdb.Set(key, []byte("v2")))
+
+	val, err := bdb.Get([]byte{0x00, 0xff, 0x10, 0x80})
+	require.NoError(t, err)
+	require.Equal(t, "v1", string(val))
+
+	// both views see the same keys
+	val, err = db.Get(string(key))
+	require.NoError(t, err)
+	require.Equal(t, "v2", string(val))
+
+	values, err := bdb.MGet([][]byte{key, []byte("missing")})
+	require.NoError(t, err)
+	require.Equal(t, "v2", string(values[0].Val))
+	require.Error(t, values[1].Err)
+
+	keys, err := bdb.AllKeys()
+	require.NoError(t, err)
+	require.ElementsMatch(t, [][]byte{{0x00, 0xff, 0x10, 0x80}, {0x00, 0xff, 0x10, 0x81}}, keys)
+
+	require.NoError(t, bdb.Delete(key))
+	require.False(t, bdb.Exists(key))
+	require.True(t, bdb.Exists([]byte{0x00, 0xff, 0x10, 0x80}))
+
+	// the keys seen by the interceptors are copies, which they may keep
+	var seen []string
+	idb, err := NewKeyValorDB(WithDirectory(t.TempDir()), WithInterceptors(func(call *dbops.Call, next dbops.Invoker) error {
+		seen = append(seen, call.Keys...)
+		return next()
+	}))
+	require.NoError(t, err)
+	defer idb.Shutdown()
+
+	ibdb := idb.BytesKeys()
+	buf := []byte("k1")
+	require.NoError(t, ibdb.Set(buf, []byte("v")))
+	require.True(t, ibdb.Exists(buf))
+	_, err = ibdb.MGet([][]byte{buf})
+	require.NoError(t, err)
+	_, err = ibdb.Copy(buf, []byte("k2"), false)
+	require.NoError(t, err)
+	require.NoError(t, ibdb.Rename(buf, []byte("k3")))
+	copy(buf, "xx")
+	require.Equal(t, []string{"k1", "k1", "k1", "k1", "k2", "k1", "k3"}, seen)
+}
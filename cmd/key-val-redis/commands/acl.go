@@ -0,0 +1,495 @@
+package commands
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"KeyValor/internal/utils/globutils"
+)
+
+const (
+	NoAuthErrorMsg        = "NOAUTH Authentication required."
+	NoPermCommandErrorMsg = "NOPERM User %s has no permissions to run the '%s' command"
+	NoPermKeyErrorMsg     = "NOPERM No permissions to access a key"
+
+	defaultUserName = "default"
+)
+
+// aclUser is a user of the Redis-6-style ACLs: its passwords, the commands it may run, and
+// the keys these commands may access.
+type aclUser struct {
+	name    string
+	enabled bool
+	// noPass accepts any password; otherwise, passwords holds the SHA-256 of the valid ones
+	noPass    bool
+	passwords map[string]struct{}
+
+	allKeys     bool
+	keyPatterns []string
+
+	// commands holds the allowed commands, as "command" or "command|subcommand" for the
+	// commands with subcommands (see commandSpecs)
+	commands map[string]bool
+	// commandRules are the rules that built commands, for ACL LIST
+	commandRules []string
+}
+
+// newACLUser returns a user like ACL SETUSER creates it: disabled, without passwords,
+// commands nor keys.
+func newACLUser(name string) *aclUser {
+	return &aclUser{
+		name:      name,
+		passwords: make(map[string]struct{}),
+		commands:  make(map[string]bool),
+	}
+}
+
+// newDefaultUser returns the default user of a server without ACLs, allowed to do anything
+// without a password.
+func newDefaultUser() *aclUser {
+	u := newACLUser(defaultUserName)
+	for _, rule := range []string{"on", "nopass", "allkeys", "+@all"} {
+		if err := u.apply(rule); err != nil {
+			panic(err)
+		}
+	}
+	return u
+}
+
+// clone returns a copy of u, that rules can be applied to without changing u.
+func (u *aclUser) clone() *aclUser {
+	c := *u
+	c.passwords = make(map[string]struct{}, len(u.passwords))
+	for hash := range u.passwords {
+		c.passwords[hash] = struct{}{}
+	}
+	c.keyPatterns = append([]string(nil), u.keyPatterns...)
+	c.commands = make(map[string]bool, len(u.commands))
+	for command := range u.commands {
+		c.commands[command] = true
+	}
+	c.commandRules = append([]string(nil), u.commandRules...)
+	return &c
+}
+
+// apply applies one rule of ACL SETUSER (or of the ACL file) to u.
+func (u *aclUser) apply(rule string) error {
+	lower := strings.ToLower(rule)
+
+	switch {
+	case lower == "on":
+		u.enabled = true
+	case lower == "off":
+		u.enabled = false
+	case lower == "nopass":
+		u.noPass = true
+		u.passwords = make(map[string]struct{})
+	case lower == "resetpass":
+		u.noPass = false
+		u.passwords = make(map[string]struct{})
+	case rule[0] == '>':
+		u.noPass = false
+		u.passwords[hashPassword(rule[1:])] = struct{}{}
+	case rule[0] == '<':
+		delete(u.passwords, hashPassword(rule[1:]))
+	case rule[0] == '#':
+		hash := rule[1:]
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != 2*sha256.Size || strings.ToLower(hash) != hash {
+			return errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		u.noPass = false
+		u.passwords[hash] = struct{}{}
+	case rule[0] == '!':
+		delete(u.passwords, rule[1:])
+	case lower == "allkeys" || rule == "~*":
+		u.allKeys = true
+		u.keyPatterns = nil
+	case lower == "resetkeys":
+		u.allKeys = false
+		u.keyPatterns = nil
+	case rule[0] == '~':
+		if u.allKeys {
+			return errors.New("Adding a pattern after the * pattern (or the 'allkeys' flag) is not valid and does not have any effect. Try 'resetkeys' to start with an empty list of patterns")
+		}
+		u.keyPatterns = append(u.keyPatterns, rule[1:])
+	case lower == "allcommands":
+		return u.apply("+@all")
+	case lower == "nocommands":
+		return u.apply("-@all")
+	case rule[0] == '+' || rule[0] == '-':
+		return u.applyCommandRule(lower)
+	case lower == "reset":
+		*u = *newACLUser(u.name)
+	default:
+		return errors.New("Syntax error")
+	}
+	return nil
+}
+
+// applyCommandRule applies +command, -command, +command|subcommand, +@category or -@category.
+func (u *aclUser) applyCommandRule(rule string) error {
+	allow := rule[0] == '+'
+
+	var commands []string
+	if category, ok := strings.CutPrefix(rule[1:], "@"); ok {
+		commands = categoryCommands(category)
+		if len(commands) == 0 {
+			return errors.New("Unknown command category")
+		}
+	} else {
+		commands = commandNames(rule[1:])
+		if len(commands) == 0 {
+			return errors.New("Unknown command")
+		}
+	}
+
+	for _, command := range commands {
+		if allow {
+			u.commands[command] = true
+		} else {
+			delete(u.commands, command)
+		}
+	}
+
+	if rule == "+@all" || rule == "-@all" {
+		u.commandRules = nil
+	}
+	u.commandRules = append(u.commandRules, rule)
+	return nil
+}
+
+// categoryCommands returns the commands (and subcommands) of a category, or all of them for "all".
+func categoryCommands(category string) []string {
+	var commands []string
+	for name, spec := range commandSpecs {
+		if spec.subcommands == nil {
+			if category == "all" || hasCategory(spec, category) {
+				commands = append(commands, name)
+			}
+			continue
+		}
+		for sub, subSpec := range spec.subcommands {
+			if category == "all" || hasCategory(subSpec, category) {
+				commands = append(commands, name+"|"+sub)
+			}
+		}
+	}
+	return commands
+}
+
+// commandNames returns what a command rule (without its '+' or '-') allows or forbids:
+// the command, all its subcommands, or one of them.
+func commandNames(command string) []string {
+	name, sub, isSub := strings.Cut(command, "|")
+
+	spec, ok := commandSpecs[name]
+	switch {
+	case !ok:
+		return nil
+	case isSub:
+		if _, ok := spec.subcommands[sub]; !ok {
+			return nil
+		}
+		return []string{command}
+	case spec.subcommands != nil:
+		var commands []string
+		for sub := range spec.subcommands {
+			commands = append(commands, name+"|"+sub)
+		}
+		return commands
+	default:
+		return []string{name}
+	}
+}
+
+func hasCategory(spec commandSpec, category string) bool {
+	for _, c := range spec.categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// describe returns the line of ACL LIST describing u.
+func (u *aclUser) describe() string {
+	parts := []string{"user", u.name, "off"}
+	if u.enabled {
+		parts[2] = "on"
+	}
+
+	if u.noPass {
+		parts = append(parts, "nopass")
+	}
+	hashes := make([]string, 0, len(u.passwords))
+	for hash := range u.passwords {
+		hashes = append(hashes, "#"+hash)
+	}
+	sort.Strings(hashes)
+	parts = append(parts, hashes...)
+
+	if u.allKeys {
+		parts = append(parts, "~*")
+	} else {
+		for _, pattern := range u.keyPatterns {
+			parts = append(parts, "~"+pattern)
+		}
+	}
+
+	if len(u.commandRules) == 0 || u.commandRules[0] != "+@all" && u.commandRules[0] != "-@all" {
+		parts = append(parts, "-@all")
+	}
+	parts = append(parts, u.commandRules...)
+
+	return strings.Join(parts, " ")
+}
+
+// checkPassword returns whether password is one of the passwords of u.
+func (u *aclUser) checkPassword(password string) bool {
+	if u.noPass {
+		return true
+	}
+
+	hash := hashPassword(password)
+	valid := false
+	for h := range u.passwords {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// aclRegistry holds the users. Their rules can change while they are connected:
+// they are read and changed under the registry's lock.
+type aclRegistry struct {
+	sync.RWMutex
+	users map[string]*aclUser
+}
+
+// newACLRegistry returns a registry of the default user alone, without password.
+func newACLRegistry() *aclRegistry {
+	return &aclRegistry{users: map[string]*aclUser{defaultUserName: newDefaultUser()}}
+}
+
+// defaultUserIfNoPass returns the default user if a new client is authenticated as it
+// without AUTH, nil otherwise.
+func (r *aclRegistry) defaultUserIfNoPass() *aclUser {
+	r.RLock()
+	defer r.RUnlock()
+
+	if u := r.users[defaultUserName]; u.enabled && u.noPass {
+		return u
+	}
+	return nil
+}
+
+// authenticate returns the user, if it is enabled and password is valid.
+func (r *aclRegistry) authenticate(name, password string) *aclUser {
+	r.RLock()
+	defer r.RUnlock()
+
+	u, ok := r.users[name]
+	if !ok || !u.enabled || !u.checkPassword(password) {
+		return nil
+	}
+	return u
+}
+
+// check returns the error replied to user if it may not run the command args, "" if it may.
+// The user is re-resolved by name: NoAuthErrorMsg is returned once it was disabled, deleted,
+// or replaced by another ACL file, so that its clients must authenticate again. Commands
+// without a spec are denied.
+func (r *aclRegistry) check(user *aclUser, commandName string, args [][]byte) string {
+	r.RLock()
+	defer r.RUnlock()
+
+	if r.users[user.name] != user || !user.enabled {
+		return NoAuthErrorMsg
+	}
+
+	spec, ok := commandSpecs[commandName]
+	if !ok {
+		return fmt.Sprintf(NoPermCommandErrorMsg, user.name, commandName)
+	}
+
+	command := commandName
+	if spec.subcommands != nil {
+		if len(args) < 2 {
+			return ""
+		}
+		sub := strings.ToLower(string(args[1]))
+		subSpec, ok := spec.subcommands[sub]
+		if !ok {
+			// the command replies with its unknown subcommand error
+			return ""
+		}
+		command, spec = commandName+"|"+sub, subSpec
+	}
+
+	if !user.commands[command] {
+		return fmt.Sprintf(NoPermCommandErrorMsg, user.name, command)
+	}
+	if user.allKeys {
+		return ""
+	}
+	for _, key := range spec.keys(args) {
+		if !matchesAny(user.keyPatterns, string(key)) {
+			return NoPermKeyErrorMsg
+		}
+	}
+	return ""
+}
+
+func matchesAny(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if globutils.Match(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// setUser applies rules to the user name, creating it if needed. No rule is applied if one
+// of them is invalid. Connected clients of the user get the new rules immediately, and must
+// authenticate again if it is disabled.
+func (r *aclRegistry) setUser(name string, rules []string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	u, exists := r.users[name]
+	if !exists {
+		u = newACLUser(name)
+	}
+
+	updated := u.clone()
+	for _, rule := range rules {
+		if rule == "" {
+			return fmt.Errorf("Error in ACL SETUSER modifier '%s': Syntax error", rule)
+		}
+		if err := updated.apply(rule); err != nil {
+			return fmt.Errorf("Error in ACL SETUSER modifier '%s': %w", rule, err)
+		}
+	}
+
+	*u = *updated
+	r.users[name] = u
+	return nil
+}
+
+// delUser deletes the users, and returns how many existed. The default user can't be deleted.
+// The clients of a deleted user must authenticate again (see check).
+func (r *aclRegistry) delUser(names []string) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	for _, name := range names {
+		if name == defaultUserName {
+			return 0, errors.New("The 'default' user cannot be removed")
+		}
+	}
+
+	deleted := 0
+	for _, name := range names {
+		if _, ok := r.users[name]; ok {
+			delete(r.users, name)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// list returns the descriptions of the users, sorted by name.
+func (r *aclRegistry) list() []string {
+	r.RLock()
+	defer r.RUnlock()
+
+	lines := make([]string, 0, len(r.users))
+	for _, u := range r.users {
+		lines = append(lines, u.describe())
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// requirePass makes the default user require password, like requirepass in redis.conf.
+func (r *aclRegistry) requirePass(password string) {
+	if err := r.setUser(defaultUserName, []string{"resetpass", ">" + password}); err != nil {
+		panic(err)
+	}
+}
+
+// LoadACLFile loads the users of the server from an ACL file, in the format of Redis' aclfile:
+// one "user <name> <rule> ..." line per user, blank lines and '#' comments. A default user that
+// the file doesn't define keeps its current rules. Nothing is loaded if the file has an error.
+func (srv *Server) LoadACLFile(path string) error {
+	return srv.acl.load(path)
+}
+
+// load is LoadACLFile.
+func (r *aclRegistry) load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r.RLock()
+	users := map[string]*aclUser{defaultUserName: r.users[defaultUserName].clone()}
+	r.RUnlock()
+
+	defined := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] != "user" || len(fields) < 2 {
+			return fmt.Errorf("%s:%d: lines must start with 'user <name>'", path, lineNumber)
+		}
+
+		name := fields[1]
+		if defined[name] {
+			return fmt.Errorf("%s:%d: user '%s' is defined twice", path, lineNumber, name)
+		}
+		defined[name] = true
+
+		u := newACLUser(name)
+		for _, rule := range fields[2:] {
+			if err := u.apply(rule); err != nil {
+				return fmt.Errorf("%s:%d: error in rule '%s': %w", path, lineNumber, rule, err)
+			}
+		}
+		users[name] = u
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	// the connected clients keep their users, with the rules of the file
+	for name, u := range users {
+		if current, ok := r.users[name]; ok {
+			*current = *u
+			users[name] = current
+		}
+	}
+	r.users = users
+	return nil
+}
@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+)
+
+const (
+	AuthNotConfiguredErrorMsg = "ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?"
+	HelloNoAuthErrorMsg       = "NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time"
+)
+
+// Auth implements AUTH [username] password: the default user is assumed without username.
+var Auth CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	acl := serverOf(conn).acl
+	var username, password string
+	switch len(args) {
+	case 2:
+		if acl.defaultUserIfNoPass() != nil {
+			conn.WriteError(AuthNotConfiguredErrorMsg)
+			return
+		}
+		username, password = defaultUserName, string(args[1])
+	case 3:
+		username, password = string(args[1]), string(args[2])
+	default:
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	user := acl.authenticate(username, password)
+	if user == nil {
+		conn.WriteError(WrongPassErrorMsg)
+		return
+	}
+
+	sessionOf(conn).authenticate(user)
+	conn.WriteString("OK")
+}
+
+// ACL implements ACL WHOAMI, LIST, SETUSER and DELUSER.
+var ACL CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	acl := serverOf(conn).acl
+	switch subcommand := strings.ToLower(string(args[1])); {
+	case subcommand == "whoami" && len(args) == 2:
+		conn.WriteBulkString(sessionOf(conn).user.name)
+
+	case subcommand == "list" && len(args) == 2:
+		users := acl.list()
+		conn.WriteArray(len(users))
+		for _, user := range users {
+			conn.WriteBulkString(user)
+		}
+
+	case subcommand == "setuser" && len(args) >= 3:
+		rules := make([]string, 0, len(args)-3)
+		for _, rule := range args[3:] {
+			rules = append(rules, string(rule))
+		}
+
+		if err := acl.setUser(string(args[2]), rules); err != nil {
+			conn.WriteError("ERR " + err.Error())
+			return
+		}
+		conn.WriteString("OK")
+
+	case subcommand == "deluser" && len(args) >= 3:
+		names := make([]string, 0, len(args)-2)
+		for _, name := range args[2:] {
+			names = append(names, string(name))
+		}
+
+		deleted, err := acl.delUser(names)
+		if err != nil {
+			conn.WriteError("ERR " + err.Error())
+			return
+		}
+		conn.WriteInt(deleted)
+
+	default:
+		conn.WriteError(fmt.Sprintf(UnknownSubcommandErrorMsg, string(args[1]), "ACL"))
+	}
+}
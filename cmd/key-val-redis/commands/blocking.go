@@ -0,0 +1,250 @@
+package commands
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+)
+
+const (
+	TimeoutNotFloatErrorMsg   = "ERR timeout is not a float or out of range"
+	TimeoutNegativeErrorMsg   = "ERR timeout is negative"
+	TimeoutOutOfRangeErrorMsg = "ERR timeout is out of range"
+)
+
+// waiterKey identifies a key of a database, that clients can block on.
+type waiterKey struct {
+	db  *KeyValor.KeyValorDatabase
+	key string
+}
+
+// waiterQueues are the clients blocked on each key (by BLPOP, BLMOVE, ...), in FIFO order.
+type waiterQueues struct {
+	sync.Mutex
+	queues map[waiterKey][]*waiter
+	// seq is the seq of the last waiter
+	seq uint64
+}
+
+// waiter is a blocked client, signaled on ch when it should try again. seq orders the waiters by
+// the time they blocked: a waiter that tries again without being served (another client took
+// the element) gets back to its place in the queues, ahead of those that blocked after it.
+type waiter struct {
+	ch  chan struct{}
+	seq uint64
+}
+
+func newWaiterQueues() *waiterQueues {
+	return &waiterQueues{queues: make(map[waiterKey][]*waiter)}
+}
+
+// newWaiter returns a waiter, queued after those already returned.
+func (wq *waiterQueues) newWaiter() *waiter {
+	wq.Lock()
+	defer wq.Unlock()
+
+	wq.seq++
+	return &waiter{ch: make(chan struct{}, 1), seq: wq.seq}
+}
+
+// add queues the waiter w on each of the keys, in the order of their seq.
+func (wq *waiterQueues) add(db *KeyValor.KeyValorDatabase, keys []string, w *waiter) {
+	wq.Lock()
+	defer wq.Unlock()
+
+	for _, key := range keys {
+		wk := waiterKey{db: db, key: key}
+		queue := wq.queues[wk]
+		i := len(queue)
+		for i > 0 && queue[i-1].seq > w.seq {
+			i--
+		}
+		wq.queues[wk] = slices.Insert(queue, i, w)
+	}
+}
+
+// remove removes the waiter w from the queues of the keys.
+func (wq *waiterQueues) remove(db *KeyValor.KeyValorDatabase, keys []string, w *waiter) {
+	wq.Lock()
+	defer wq.Unlock()
+
+	for _, key := range keys {
+		wk := waiterKey{db: db, key: key}
+
+		queue := wq.queues[wk][:0]
+		for _, other := range wq.queues[wk] {
+			if other != w {
+				queue = append(queue, other)
+			}
+		}
+
+		if len(queue) == 0 {
+			delete(wq.queues, wk)
+		} else {
+			wq.queues[wk] = queue
+		}
+	}
+}
+
+// wakeListWaiters wakes the clients of the server of conn blocked on key, e.g. by BLPOP, once
+// a list was moved, renamed or copied there.
+func wakeListWaiters(conn redcon.Conn, db *KeyValor.KeyValorDatabase, key string) {
+	var length int
+	err := db.ViewList(key, func(l *KeyValor.List) error {
+		length = l.Len()
+		return nil
+	})
+	if err == nil && length > 0 {
+		serverOf(conn).listWaiters.wake(db, key, length)
+	}
+}
+
+// wake dequeues and signals the first n waiters of key, e.g. after n elements were pushed to it.
+func (wq *waiterQueues) wake(db *KeyValor.KeyValorDatabase, key string, n int) {
+	wq.Lock()
+	defer wq.Unlock()
+
+	wk := waiterKey{db: db, key: key}
+	queue := wq.queues[wk]
+	if len(queue) == 0 {
+		return
+	}
+
+	n = min(n, len(queue))
+	for _, w := range queue[:n] {
+		select {
+		case w.ch <- struct{}{}:
+		default:
+		}
+	}
+
+	if n == len(queue) {
+		delete(wq.queues, wk)
+	} else {
+		wq.queues[wk] = queue[n:]
+	}
+}
+
+// wakeAll dequeues and signals all the waiters of the database db, e.g. once SWAPDB moved it
+// to another index: they try again on the database at the index they selected.
+func (wq *waiterQueues) wakeAll(db *KeyValor.KeyValorDatabase) {
+	wq.Lock()
+	defer wq.Unlock()
+
+	for wk, queue := range wq.queues {
+		if wk.db != db {
+			continue
+		}
+		for _, w := range queue {
+			select {
+			case w.ch <- struct{}{}:
+			default:
+			}
+		}
+		delete(wq.queues, wk)
+	}
+}
+
+// len returns the number of waiters blocked on key.
+func (wq *waiterQueues) len(db *KeyValor.KeyValorDatabase, key string) int {
+	wq.Lock()
+	defer wq.Unlock()
+
+	return len(wq.queues[waiterKey{db: db, key: key}])
+}
+
+// blockOnKeys calls try with mu locked until it serves the client (or fails), waiting for
+// elements to be pushed to one of the keys in between, at most for timeout (0 blocks forever).
+// It returns false if the timeout expired. Inside EXEC, it doesn't block: try is called once.
+// The time it waits is added to the blocked time of the session, not counted by SLOWLOG.
+// try is given db, then the database selected by the client once it waited, since SWAPDB may
+// have swapped it.
+func blockOnKeys(
+	conn redcon.Conn,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+	keys []string,
+	timeout time.Duration,
+	try func(db *KeyValor.KeyValorDatabase) (bool, error),
+) (bool, error) {
+	s := sessionOf(conn)
+	if s.executing {
+		mu.Lock()
+		defer mu.Unlock()
+		return try(db)
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	// the blocked clients stop waiting when the server shuts down
+	listWaiters, closing := s.server.listWaiters, s.server.closing
+	w := listWaiters.newWaiter()
+	for blocked := false; ; blocked = true {
+		mu.Lock()
+		if blocked {
+			db = s.databases.Get(s.db)
+		}
+		served, err := try(db)
+		if served || err != nil {
+			mu.Unlock()
+			return served, err
+		}
+		// registered before releasing mu, so that no push can be missed
+		listWaiters.add(db, keys, w)
+		mu.Unlock()
+
+		if !blocked {
+			s.server.stats.blockedClients.Add(1)
+			defer s.server.stats.blockedClients.Add(-1)
+		}
+
+		waiting := time.Now()
+		select {
+		case <-w.ch:
+			s.blocked += time.Since(waiting)
+			listWaiters.remove(db, keys, w)
+		case <-closing:
+			s.blocked += time.Since(waiting)
+			listWaiters.remove(db, keys, w)
+			return false, nil
+		case <-expired:
+			s.blocked += time.Since(waiting)
+			listWaiters.remove(db, keys, w)
+			select {
+			case <-w.ch:
+				// woken up just as the timeout expired: don't lose the pushed element
+				mu.Lock()
+				defer mu.Unlock()
+				return try(s.databases.Get(s.db))
+			default:
+				return false, nil
+			}
+		}
+	}
+}
+
+// parseTimeout parses the timeout of a blocking command, in seconds.
+func parseTimeout(arg []byte) (time.Duration, string) {
+	seconds, ok := parseFloat(arg)
+	if !ok {
+		return 0, TimeoutNotFloatErrorMsg
+	}
+	if seconds < 0 {
+		return 0, TimeoutNegativeErrorMsg
+	}
+	if seconds > float64(math.MaxInt64)/float64(time.Second) {
+		return 0, TimeoutOutOfRangeErrorMsg
+	}
+	// a positive timeout must not round down to 0, which blocks forever
+	return max(time.Duration(seconds*float64(time.Second)), time.Duration(math.Ceil(seconds))), ""
+}
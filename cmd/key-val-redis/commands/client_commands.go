@@ -0,0 +1,350 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+)
+
+const (
+	ProtocolNotIntegerErrorMsg = "ERR Protocol version is not an integer or out of range"
+	NoProtoErrorMsg            = "NOPROTO unsupported protocol version"
+	HelloOptionErrorMsg        = "ERR Syntax error in HELLO option '%s'"
+	WrongPassErrorMsg          = "WRONGPASS invalid username-password pair or user is disabled."
+	ClientNameErrorMsg         = "ERR Client names cannot contain spaces, newlines or special characters."
+	ClientLibErrorMsg          = "ERR %s cannot contain spaces, newlines or special characters."
+	UnrecognizedOptionErrorMsg = "ERR Unrecognized option '%s'"
+	NoSuchClientErrorMsg       = "ERR No such client"
+	InvalidClientIDErrorMsg    = "ERR client-id should be greater than 0"
+	UnknownClientTypeErrorMsg  = "ERR Unknown client type '%s'"
+
+	// redisCompatibleVersion is the Redis version HELLO reports, whose commands we implement
+	redisCompatibleVersion = "7.2.0"
+)
+
+// Hello implements HELLO [protover [AUTH username password] [SETNAME clientname]]:
+// it switches the client to RESP2 or RESP3, and replies with a map describing the server.
+var Hello CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	s := sessionOf(conn)
+	protocol := s.protocol
+
+	if len(args) >= 2 {
+		version, ok := parseInt(args[1])
+		if !ok {
+			conn.WriteError(ProtocolNotIntegerErrorMsg)
+			return
+		}
+		if version != 2 && version != 3 {
+			conn.WriteError(NoProtoErrorMsg)
+			return
+		}
+		protocol = int(version)
+	}
+
+	var name []byte
+	setName := false
+	var user *aclUser
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToLower(string(args[i])); {
+		case option == "auth" && i+2 < len(args):
+			if user = serverOf(conn).acl.authenticate(string(args[i+1]), string(args[i+2])); user == nil {
+				conn.WriteError(WrongPassErrorMsg)
+				return
+			}
+			i += 2
+		case option == "setname" && i+1 < len(args):
+			name, setName = args[i+1], true
+			if !validClientName(name) {
+				conn.WriteError(ClientNameErrorMsg)
+				return
+			}
+			i++
+		default:
+			conn.WriteError(fmt.Sprintf(HelloOptionErrorMsg, string(args[i])))
+			return
+		}
+	}
+
+	if user == nil && s.user == nil {
+		conn.WriteError(HelloNoAuthErrorMsg)
+		return
+	}
+
+	s.protocol = protocol
+	if user != nil {
+		s.authenticate(user)
+	}
+	if setName {
+		s.updateInfo(func(info *clientInfo) { info.name = string(name) })
+	}
+
+	writeMap(conn, 7)
+	conn.WriteBulkString("server")
+	conn.WriteBulkString("redis")
+	conn.WriteBulkString("version")
+	conn.WriteBulkString(redisCompatibleVersion)
+	conn.WriteBulkString("proto")
+	conn.WriteInt(protocol)
+	conn.WriteBulkString("id")
+	conn.WriteInt64(s.id)
+	conn.WriteBulkString("mode")
+	conn.WriteBulkString("standalone")
+	conn.WriteBulkString("role")
+	conn.WriteBulkString("master")
+	conn.WriteBulkString("modules")
+	conn.WriteArray(0)
+}
+
+// Client implements CLIENT ID, SETNAME, GETNAME, SETINFO, LIST, INFO and KILL.
+var Client CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	s := sessionOf(conn)
+
+	switch subcommand := strings.ToLower(string(args[1])); {
+	case subcommand == "id" && len(args) == 2:
+		conn.WriteInt64(s.id)
+
+	case subcommand == "setname" && len(args) == 3:
+		if !validClientName(args[2]) {
+			conn.WriteError(ClientNameErrorMsg)
+			return
+		}
+		s.updateInfo(func(info *clientInfo) { info.name = string(args[2]) })
+		conn.WriteString("OK")
+
+	case subcommand == "getname" && len(args) == 2:
+		if name := s.currentInfo().name; name != "" {
+			conn.WriteBulkString(name)
+		} else {
+			writeNull(conn)
+		}
+
+	case subcommand == "setinfo" && len(args) == 4:
+		attribute := strings.ToLower(string(args[2]))
+		if attribute != "lib-name" && attribute != "lib-ver" {
+			conn.WriteError(fmt.Sprintf(UnrecognizedOptionErrorMsg, string(args[2])))
+			return
+		}
+		if !validClientName(args[3]) {
+			conn.WriteError(fmt.Sprintf(ClientLibErrorMsg, attribute))
+			return
+		}
+		s.updateInfo(func(info *clientInfo) {
+			if attribute == "lib-name" {
+				info.libName = string(args[3])
+			} else {
+				info.libVer = string(args[3])
+			}
+		})
+		conn.WriteString("OK")
+
+	case subcommand == "info" && len(args) == 2:
+		writeVerbatim(conn, s.describe())
+
+	case subcommand == "list":
+		sessions, errMsg := filterClients(s.server, args[2:])
+		if errMsg != "" {
+			conn.WriteError(errMsg)
+			return
+		}
+
+		var list strings.Builder
+		for _, other := range sessions {
+			list.WriteString(other.describe())
+		}
+		writeVerbatim(conn, list.String())
+
+	case subcommand == "kill" && len(args) == 3:
+		// the old form, CLIENT KILL addr
+		for _, other := range s.server.clients.sessions() {
+			if other.currentInfo().addr == string(args[2]) {
+				conn.WriteString("OK")
+				killClient(conn, s, other)
+				return
+			}
+		}
+		conn.WriteError(NoSuchClientErrorMsg)
+
+	case subcommand == "kill" && len(args) > 3:
+		targets, errMsg := clientsToKill(s, args[2:])
+		if errMsg != "" {
+			conn.WriteError(errMsg)
+			return
+		}
+
+		conn.WriteInt(len(targets))
+		for _, target := range targets {
+			killClient(conn, s, target)
+		}
+
+	default:
+		conn.WriteError(fmt.Sprintf(UnknownSubcommandErrorMsg, string(args[1]), "CLIENT"))
+	}
+}
+
+// describe returns the line of CLIENT LIST describing the client of s.
+func (s *session) describe() string {
+	info := s.currentInfo()
+	now := time.Now()
+
+	flags := ""
+	if info.sub+info.psub > 0 {
+		flags += "P"
+	}
+	if info.multi >= 0 {
+		flags += "x"
+	}
+	if info.monitor {
+		flags += "O"
+	}
+	if flags == "" {
+		flags = "N"
+	}
+
+	return fmt.Sprintf("id=%d addr=%s laddr=%s name=%s age=%d idle=%d flags=%s db=%d sub=%d psub=%d multi=%d cmd=%s user=%s lib-name=%s lib-ver=%s\n",
+		s.id, info.addr, info.laddr, info.name,
+		int64(now.Sub(info.created).Seconds()), int64(now.Sub(info.lastActive).Seconds()),
+		flags, info.db, info.sub, info.psub, info.multi, info.lastCommand, info.user, info.libName, info.libVer)
+}
+
+// filterClients returns the clients of srv matching the filters of CLIENT LIST:
+// [TYPE normal|pubsub] [ID client-id [client-id ...]].
+func filterClients(srv *Server, filters [][]byte) ([]*session, string) {
+	var clientType string
+	var ids map[int64]bool
+
+	for i := 0; i < len(filters); i++ {
+		switch filter := strings.ToLower(string(filters[i])); {
+		case filter == "type" && i+1 < len(filters):
+			clientType = strings.ToLower(string(filters[i+1]))
+			if clientType != "normal" && clientType != "pubsub" && clientType != "master" && clientType != "replica" {
+				return nil, fmt.Sprintf(UnknownClientTypeErrorMsg, string(filters[i+1]))
+			}
+			i++
+		case filter == "id" && i+1 < len(filters):
+			ids = make(map[int64]bool)
+			for _, arg := range filters[i+1:] {
+				id, ok := parseInt(arg)
+				if !ok || id <= 0 {
+					return nil, InvalidClientIDErrorMsg
+				}
+				ids[id] = true
+			}
+			i = len(filters)
+		default:
+			return nil, SyntaxErrorMsg
+		}
+	}
+
+	sessions := make([]*session, 0)
+	for _, s := range srv.clients.sessions() {
+		info := s.currentInfo()
+		pubsub := info.sub+info.psub > 0
+
+		switch {
+		case ids != nil && !ids[s.id]:
+		case clientType == "normal" && pubsub, clientType == "pubsub" && !pubsub:
+		case clientType == "master", clientType == "replica":
+		default:
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions, ""
+}
+
+// clientsToKill returns the clients matching the filters of CLIENT KILL: [ID client-id]
+// [USER username] [ADDR ip:port] [LADDR ip:port] [SKIPME yes|no]. The client itself is
+// skipped by default.
+func clientsToKill(self *session, filters [][]byte) ([]*session, string) {
+	if len(filters)%2 != 0 {
+		return nil, SyntaxErrorMsg
+	}
+
+	var id int64
+	var user, addr, laddr string
+	skipMe := true
+
+	for i := 0; i < len(filters); i += 2 {
+		value := string(filters[i+1])
+
+		switch strings.ToLower(string(filters[i])) {
+		case "id":
+			var ok bool
+			if id, ok = parseInt(filters[i+1]); !ok || id <= 0 {
+				return nil, InvalidClientIDErrorMsg
+			}
+		case "user":
+			user = value
+		case "addr":
+			addr = value
+		case "laddr":
+			laddr = value
+		case "skipme":
+			switch strings.ToLower(value) {
+			case "yes":
+				skipMe = true
+			case "no":
+				skipMe = false
+			default:
+				return nil, SyntaxErrorMsg
+			}
+		default:
+			return nil, SyntaxErrorMsg
+		}
+	}
+
+	var targets []*session
+	for _, s := range self.server.clients.sessions() {
+		info := s.currentInfo()
+
+		switch {
+		case id != 0 && s.id != id:
+		case user != "" && info.user != user:
+		case addr != "" && info.addr != addr:
+		case laddr != "" && info.laddr != laddr:
+		case skipMe && s == self:
+		default:
+			targets = append(targets, s)
+		}
+	}
+	return targets, ""
+}
+
+// killClient closes the connection of target, once the reply to CLIENT KILL was written
+// if the client kills itself.
+func killClient(conn redcon.Conn, self, target *session) {
+	if target == self {
+		_ = conn.Close()
+		return
+	}
+	target.kill()
+}
+
+// validClientName returns whether name only has printable characters, and no spaces.
+func validClientName(name []byte) bool {
+	for _, c := range name {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,267 @@
+package commands
+
+import (
+	"strings"
+)
+
+// commandSpec describes a command for the ACL checks: its categories (without the '@'), and
+// which of its arguments are keys, like the key specs of Redis' command table.
+type commandSpec struct {
+	// arity is the number of arguments, the command name included, like in Redis' command
+	// table: -n means at least n
+	arity      int
+	categories []string
+	// the keys are args[firstKey], args[firstKey+keyStep], ... up to args[lastKey], where a
+	// negative lastKey counts from the end (-1 is the last argument); firstKey is 0 without keys
+	firstKey, lastKey, keyStep int
+	// keysFunc, if set, returns the keys instead of firstKey to lastKey, for the commands
+	// whose keys depend on their options, like MIGRATE
+	keysFunc func(args [][]byte) [][]byte
+	// subcommands, checked as "command|subcommand", for commands whose subcommands
+	// need different permissions
+	subcommands map[string]commandSpec
+}
+
+// spec returns a commandSpec with the space-separated categories.
+func spec(arity int, categories string, firstKey, lastKey, keyStep int) commandSpec {
+	return commandSpec{
+		arity:      arity,
+		categories: strings.Fields(categories),
+		firstKey:   firstKey,
+		lastKey:    lastKey,
+		keyStep:    keyStep,
+	}
+}
+
+// withSubcommands returns s, with the given subcommands.
+func (s commandSpec) withSubcommands(subcommands map[string]commandSpec) commandSpec {
+	s.subcommands = subcommands
+	return s
+}
+
+// withKeysFunc returns s, whose keys are returned by keysFunc.
+func (s commandSpec) withKeysFunc(keysFunc func(args [][]byte) [][]byte) commandSpec {
+	s.keysFunc = keysFunc
+	return s
+}
+
+// checkArity returns the name of the command or subcommand of args ("client|setname") if
+// args has the wrong number of arguments for it, "" otherwise.
+func (s commandSpec) checkArity(args [][]byte) string {
+	name := strings.ToLower(string(args[0]))
+	if s.arity >= 0 && len(args) != s.arity || s.arity < 0 && len(args) < -s.arity {
+		return name
+	}
+	if len(args) > 1 {
+		subcommand := strings.ToLower(string(args[1]))
+		if sub, ok := s.subcommands[subcommand]; ok {
+			if sub.checkArity(args) != "" {
+				return name + "|" + subcommand
+			}
+		}
+	}
+	return ""
+}
+
+// keys returns the keys among args.
+func (s commandSpec) keys(args [][]byte) [][]byte {
+	if s.firstKey == 0 {
+		return nil
+	}
+
+	if s.keysFunc != nil {
+		return s.keysFunc(args)
+	}
+
+	last := s.lastKey
+	if last < 0 {
+		last += len(args)
+	}
+	last = min(last, len(args)-1)
+
+	var keys [][]byte
+	for i := s.firstKey; i <= last; i += s.keyStep {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+// commandSpecs has the spec of every command of CommandMap and transactionCommands.
+var commandSpecs = map[string]commandSpec{
+	"ping":    spec(-1, "fast connection", 0, 0, 0),
+	"quit":    spec(-1, "fast connection", 0, 0, 0),
+	"auth":    spec(-2, "fast connection", 0, 0, 0),
+	"hello":   spec(-1, "fast connection", 0, 0, 0),
+	"set":     spec(-3, "write string slow", 1, 1, 1),
+	"get":     spec(2, "read string fast", 1, 1, 1),
+	"del":     spec(-2, "keyspace write slow", 1, -1, 1),
+	"keys":    spec(2, "keyspace read slow dangerous", 0, 0, 0),
+	"scan":    spec(-2, "keyspace read slow", 0, 0, 0),
+	"exists":  spec(-2, "keyspace read fast", 1, -1, 1),
+	"expire":  spec(-3, "keyspace write fast", 1, 1, 1),
+	"ttl":     spec(2, "keyspace read fast", 1, 1, 1),
+	"persist": spec(2, "keyspace write fast", 1, 1, 1),
+	"type":    spec(2, "keyspace read fast", 1, 1, 1),
+
+	"unlink":    spec(-2, "keyspace write fast", 1, -1, 1),
+	"touch":     spec(-2, "keyspace read fast", 1, -1, 1),
+	"rename":    spec(3, "keyspace write slow", 1, 2, 1),
+	"renamenx":  spec(3, "keyspace write fast", 1, 2, 1),
+	"copy":      spec(-3, "keyspace write slow", 1, 2, 1),
+	"randomkey": spec(1, "keyspace read slow", 0, 0, 0),
+	"expireat":  spec(-3, "keyspace write fast", 1, 1, 1),
+	"pexpire":   spec(-3, "keyspace write fast", 1, 1, 1),
+	"pexpireat": spec(-3, "keyspace write fast", 1, 1, 1),
+	"pttl":      spec(2, "keyspace read fast", 1, 1, 1),
+	"dump":      spec(2, "keyspace read slow", 1, 1, 1),
+	"restore":   spec(-4, "keyspace write slow dangerous", 1, 1, 1),
+	"migrate":   spec(-6, "keyspace write slow dangerous", 3, 3, 1).withKeysFunc(migrateKeys),
+
+	"client": spec(-2, "slow connection", 0, 0, 0).withSubcommands(map[string]commandSpec{
+		"id":      spec(2, "slow connection", 0, 0, 0),
+		"setname": spec(3, "slow connection", 0, 0, 0),
+		"getname": spec(2, "slow connection", 0, 0, 0),
+		"setinfo": spec(4, "slow connection", 0, 0, 0),
+		"info":    spec(2, "slow connection", 0, 0, 0),
+		"list":    spec(-2, "admin slow dangerous connection", 0, 0, 0),
+		"kill":    spec(-3, "admin slow dangerous connection", 0, 0, 0),
+	}),
+	"acl": spec(-2, "slow", 0, 0, 0).withSubcommands(map[string]commandSpec{
+		"whoami":  spec(2, "slow", 0, 0, 0),
+		"list":    spec(2, "admin slow dangerous", 0, 0, 0),
+		"setuser": spec(-3, "admin slow dangerous", 0, 0, 0),
+		"deluser": spec(-3, "admin slow dangerous", 0, 0, 0),
+	}),
+
+	"info":     spec(-1, "slow dangerous", 0, 0, 0),
+	"dbsize":   spec(1, "keyspace read fast", 0, 0, 0),
+	"flushdb":  spec(-1, "keyspace write slow dangerous", 0, 0, 0),
+	"flushall": spec(-1, "keyspace write slow dangerous", 0, 0, 0),
+	"save":     spec(1, "admin slow dangerous", 0, 0, 0),
+	"bgsave":   spec(-1, "admin slow dangerous", 0, 0, 0),
+	"lastsave": spec(1, "admin fast dangerous", 0, 0, 0),
+	"slowlog": spec(-2, "admin slow dangerous", 0, 0, 0).withSubcommands(map[string]commandSpec{
+		"get":   spec(-2, "admin slow dangerous", 0, 0, 0),
+		"len":   spec(2, "admin slow dangerous", 0, 0, 0),
+		"reset": spec(2, "admin slow dangerous", 0, 0, 0),
+	}),
+	"latency": spec(-2, "admin slow dangerous", 0, 0, 0).withSubcommands(map[string]commandSpec{
+		"latest":  spec(2, "admin slow dangerous", 0, 0, 0),
+		"history": spec(3, "admin slow dangerous", 0, 0, 0),
+		"reset":   spec(-2, "admin slow dangerous", 0, 0, 0),
+	}),
+	"monitor":  spec(1, "admin slow dangerous", 0, 0, 0),
+	"shutdown": spec(-1, "admin slow dangerous", 0, 0, 0),
+	"config": spec(-2, "admin slow dangerous", 0, 0, 0).withSubcommands(map[string]commandSpec{
+		"get":       spec(-3, "admin slow dangerous", 0, 0, 0),
+		"set":       spec(-4, "admin slow dangerous", 0, 0, 0),
+		"rewrite":   spec(2, "admin slow dangerous", 0, 0, 0),
+		"resetstat": spec(2, "admin slow dangerous", 0, 0, 0),
+	}),
+
+	"select": spec(2, "fast connection", 0, 0, 0),
+	"swapdb": spec(3, "keyspace write fast dangerous", 0, 0, 0),
+	"move":   spec(3, "keyspace write fast", 1, 1, 1),
+
+	"multi":   spec(1, "fast transaction", 0, 0, 0),
+	"exec":    spec(1, "slow transaction", 0, 0, 0),
+	"discard": spec(1, "fast transaction", 0, 0, 0),
+	"watch":   spec(-2, "fast transaction", 1, -1, 1),
+	"unwatch": spec(1, "fast transaction", 0, 0, 0),
+
+	"subscribe":    spec(-2, "pubsub slow", 0, 0, 0),
+	"psubscribe":   spec(-2, "pubsub slow", 0, 0, 0),
+	"unsubscribe":  spec(-1, "pubsub slow", 0, 0, 0),
+	"punsubscribe": spec(-1, "pubsub slow", 0, 0, 0),
+	"publish":      spec(3, "pubsub fast", 0, 0, 0),
+	"pubsub": spec(-2, "pubsub slow", 0, 0, 0).withSubcommands(map[string]commandSpec{
+		"channels": spec(-2, "pubsub slow", 0, 0, 0),
+		"numsub":   spec(-2, "pubsub slow", 0, 0, 0),
+		"numpat":   spec(2, "pubsub slow", 0, 0, 0),
+	}),
+
+	"mget":        spec(-2, "read string fast", 1, -1, 1),
+	"mset":        spec(-3, "write string slow", 1, -1, 2),
+	"msetnx":      spec(-3, "write string slow", 1, -1, 2),
+	"incr":        spec(2, "write string fast", 1, 1, 1),
+	"decr":        spec(2, "write string fast", 1, 1, 1),
+	"incrby":      spec(3, "write string fast", 1, 1, 1),
+	"decrby":      spec(3, "write string fast", 1, 1, 1),
+	"incrbyfloat": spec(3, "write string fast", 1, 1, 1),
+	"append":      spec(3, "write string fast", 1, 1, 1),
+	"strlen":      spec(2, "read string fast", 1, 1, 1),
+	"getrange":    spec(4, "read string slow", 1, 1, 1),
+	"setrange":    spec(4, "write string slow", 1, 1, 1),
+	"setnx":       spec(3, "write string fast", 1, 1, 1),
+	"setex":       spec(4, "write string slow", 1, 1, 1),
+	"psetex":      spec(4, "write string slow", 1, 1, 1),
+	"getset":      spec(3, "write string fast", 1, 1, 1),
+	"getdel":      spec(2, "write string fast", 1, 1, 1),
+	"getex":       spec(-2, "write string fast", 1, 1, 1),
+
+	"hset":         spec(-4, "write hash fast", 1, 1, 1),
+	"hmset":        spec(-4, "write hash fast", 1, 1, 1),
+	"hsetnx":       spec(4, "write hash fast", 1, 1, 1),
+	"hget":         spec(3, "read hash fast", 1, 1, 1),
+	"hmget":        spec(-3, "read hash fast", 1, 1, 1),
+	"hgetall":      spec(2, "read hash slow", 1, 1, 1),
+	"hkeys":        spec(2, "read hash slow", 1, 1, 1),
+	"hvals":        spec(2, "read hash slow", 1, 1, 1),
+	"hdel":         spec(-3, "write hash fast", 1, 1, 1),
+	"hexists":      spec(3, "read hash fast", 1, 1, 1),
+	"hlen":         spec(2, "read hash fast", 1, 1, 1),
+	"hstrlen":      spec(3, "read hash fast", 1, 1, 1),
+	"hincrby":      spec(4, "write hash fast", 1, 1, 1),
+	"hincrbyfloat": spec(4, "write hash fast", 1, 1, 1),
+	"hrandfield":   spec(-2, "read hash slow", 1, 1, 1),
+	"hscan":        spec(-3, "read hash slow", 1, 1, 1),
+
+	"lpush":      spec(-3, "write list fast", 1, 1, 1),
+	"rpush":      spec(-3, "write list fast", 1, 1, 1),
+	"lpushx":     spec(-3, "write list fast", 1, 1, 1),
+	"rpushx":     spec(-3, "write list fast", 1, 1, 1),
+	"lpop":       spec(-2, "write list fast", 1, 1, 1),
+	"rpop":       spec(-2, "write list fast", 1, 1, 1),
+	"llen":       spec(2, "read list fast", 1, 1, 1),
+	"lrange":     spec(4, "read list slow", 1, 1, 1),
+	"lindex":     spec(3, "read list slow", 1, 1, 1),
+	"lset":       spec(4, "write list slow", 1, 1, 1),
+	"lrem":       spec(4, "write list slow", 1, 1, 1),
+	"ltrim":      spec(4, "write list slow", 1, 1, 1),
+	"linsert":    spec(5, "write list slow", 1, 1, 1),
+	"lmove":      spec(5, "write list slow", 1, 2, 1),
+	"rpoplpush":  spec(3, "write list slow", 1, 2, 1),
+	"blpop":      spec(-3, "write list slow blocking", 1, -2, 1),
+	"brpop":      spec(-3, "write list slow blocking", 1, -2, 1),
+	"blmove":     spec(6, "write list slow blocking", 1, 2, 1),
+	"brpoplpush": spec(4, "write list slow blocking", 1, 2, 1),
+
+	"sadd":        spec(-3, "write set fast", 1, 1, 1),
+	"srem":        spec(-3, "write set fast", 1, 1, 1),
+	"smembers":    spec(2, "read set slow", 1, 1, 1),
+	"sismember":   spec(3, "read set fast", 1, 1, 1),
+	"scard":       spec(2, "read set fast", 1, 1, 1),
+	"sinter":      spec(-2, "read set slow", 1, -1, 1),
+	"sunion":      spec(-2, "read set slow", 1, -1, 1),
+	"sdiff":       spec(-2, "read set slow", 1, -1, 1),
+	"sinterstore": spec(-3, "write set slow", 1, -1, 1),
+	"sunionstore": spec(-3, "write set slow", 1, -1, 1),
+	"sdiffstore":  spec(-3, "write set slow", 1, -1, 1),
+	"srandmember": spec(-2, "read set slow", 1, 1, 1),
+	"spop":        spec(-2, "write set fast", 1, 1, 1),
+	"sscan":       spec(-3, "read set slow", 1, 1, 1),
+
+	"zadd":             spec(-4, "write sortedset fast", 1, 1, 1),
+	"zincrby":          spec(4, "write sortedset fast", 1, 1, 1),
+	"zrem":             spec(-3, "write sortedset fast", 1, 1, 1),
+	"zcard":            spec(2, "read sortedset fast", 1, 1, 1),
+	"zscore":           spec(3, "read sortedset fast", 1, 1, 1),
+	"zrank":            spec(-3, "read sortedset fast", 1, 1, 1),
+	"zrevrank":         spec(-3, "read sortedset fast", 1, 1, 1),
+	"zrange":           spec(-4, "read sortedset slow", 1, 1, 1),
+	"zrevrange":        spec(-4, "read sortedset slow", 1, 1, 1),
+	"zrangebyscore":    spec(-4, "read sortedset slow", 1, 1, 1),
+	"zrevrangebyscore": spec(-4, "read sortedset slow", 1, 1, 1),
+	"zcount":           spec(4, "read sortedset fast", 1, 1, 1),
+	"zscan":            spec(-3, "read sortedset slow", 1, 1, 1),
+}
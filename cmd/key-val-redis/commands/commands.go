@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"strconv"
 	"sync"
-	"time"
 
 	"github.com/tidwall/redcon"
 
@@ -27,9 +26,141 @@ var CommandMap map[string]CommandFunc = map[string]CommandFunc{
 	"get":    Get,
 	"del":    Delete,
 	"keys":   Keys,
+	"scan":   Scan,
 	"exists": Exists,
 	"expire": Expire,
 	"ttl":    Ttl,
+
+	"unlink":    Delete,
+	"touch":     Touch,
+	"rename":    Rename,
+	"renamenx":  Rename,
+	"copy":      Copy,
+	"randomkey": RandomKey,
+	"expireat":  ExpireAt,
+	"pexpire":   PExpire,
+	"pexpireat": PExpireAt,
+	"pttl":      Ttl,
+	"dump":      Dump,
+	"restore":   Restore,
+	"migrate":   Migrate,
+	"slowlog":   Slowlog,
+	"monitor":   Monitor,
+	"latency":   Latency,
+
+	"unwatch": Unwatch,
+	"hello":   Hello,
+	"client":  Client,
+	"auth":    Auth,
+	"acl":     ACL,
+
+	"info":     Info,
+	"dbsize":   DBSize,
+	"flushdb":  FlushDB,
+	"flushall": FlushAll,
+	"save":     Save,
+	"bgsave":   Bgsave,
+	"lastsave": LastSave,
+	"config":   Config,
+	"shutdown": Shutdown,
+
+	"select": Select,
+	"swapdb": SwapDB,
+	"move":   Move,
+
+	"subscribe":    Subscribe,
+	"psubscribe":   Subscribe,
+	"unsubscribe":  Unsubscribe,
+	"punsubscribe": Unsubscribe,
+	"publish":      Publish,
+	"pubsub":       PubSub,
+
+	"mget":        MGet,
+	"mset":        MSet,
+	"msetnx":      MSetNX,
+	"incr":        Incr,
+	"decr":        Decr,
+	"incrby":      IncrBy,
+	"decrby":      DecrBy,
+	"incrbyfloat": IncrByFloat,
+	"append":      Append,
+	"strlen":      StrLen,
+	"getrange":    GetRange,
+	"setrange":    SetRange,
+	"setnx":       SetNX,
+	"setex":       SetEx,
+	"psetex":      PSetEx,
+	"getset":      GetSet,
+	"getdel":      GetDel,
+	"getex":       GetEx,
+	"persist":     Persist,
+	"type":        Type,
+
+	"hset":         HSet,
+	"hmset":        HSet,
+	"hsetnx":       HSetNX,
+	"hget":         HGet,
+	"hmget":        HMGet,
+	"hgetall":      HGetAll,
+	"hkeys":        HKeys,
+	"hvals":        HVals,
+	"hdel":         HDel,
+	"hexists":      HExists,
+	"hlen":         HLen,
+	"hstrlen":      HStrLen,
+	"hincrby":      HIncrBy,
+	"hincrbyfloat": HIncrByFloat,
+	"hrandfield":   HRandField,
+	"hscan":        HScan,
+
+	"lpush":      LPush,
+	"rpush":      LPush,
+	"lpushx":     LPush,
+	"rpushx":     LPush,
+	"lpop":       LPop,
+	"rpop":       LPop,
+	"llen":       LLen,
+	"lrange":     LRange,
+	"lindex":     LIndex,
+	"lset":       LSet,
+	"lrem":       LRem,
+	"ltrim":      LTrim,
+	"linsert":    LInsert,
+	"lmove":      LMove,
+	"rpoplpush":  LMove,
+	"blpop":      BLPop,
+	"brpop":      BLPop,
+	"blmove":     BLMove,
+	"brpoplpush": BLMove,
+
+	"sadd":        SAdd,
+	"srem":        SRem,
+	"smembers":    SMembers,
+	"sismember":   SIsMember,
+	"scard":       SCard,
+	"sinter":      SInter,
+	"sunion":      SInter,
+	"sdiff":       SInter,
+	"sinterstore": SInterStore,
+	"sunionstore": SInterStore,
+	"sdiffstore":  SInterStore,
+	"srandmember": SRandMember,
+	"spop":        SRandMember,
+	"sscan":       SScan,
+
+	"zadd":             ZAdd,
+	"zincrby":          ZIncrBy,
+	"zrem":             ZRem,
+	"zcard":            ZCard,
+	"zscore":           ZScore,
+	"zrank":            ZRank,
+	"zrevrank":         ZRank,
+	"zrange":           ZRange,
+	"zrevrange":        ZRange,
+	"zrangebyscore":    ZRange,
+	"zrevrangebyscore": ZRange,
+	"zcount":           ZCount,
+	"zscan":            ZScan,
 }
 
 var Ping CommandFunc = func(
@@ -51,25 +182,45 @@ var Quit CommandFunc = func(
 	conn.Close()
 }
 
+// Set implements SET key value [NX | XX] [GET] [EX seconds | PX milliseconds |
+// EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
 var Set CommandFunc = func(
 	conn redcon.Conn,
 	args [][]byte,
 	mu *sync.RWMutex,
 	db *KeyValor.KeyValorDatabase,
 ) {
-	if len(args) != 3 {
+	if len(args) < 3 {
 		conn.WriteError(fmt.Sprintf(InfalidArgumentsErrorMsg, string(args[0])))
 		return
 	}
+
+	opts, errMsg := parseSetOptions(args[3:])
+	if errMsg != "" {
+		conn.WriteError(errMsg)
+		return
+	}
+
 	mu.Lock()
-	err := db.Set(string(args[1]), args[2])
+	result, err := db.SetWithOptions(string(args[1]), args[2], opts)
 	mu.Unlock()
 
-	if err != nil {
-		conn.WriteError(err.Error())
-	} else {
+	switch {
+	case err != nil:
+		writeDBError(conn, err)
+	case opts.Get:
+		writeBulkOrNull(conn, result.Previous, result.Existed)
+	case !result.Written:
+		writeNull(conn)
+	default:
 		conn.WriteString("OK")
 	}
+	if err == nil && result.Written {
+		notifyKeyspaceEvent(conn, notifyString, "set", string(args[1]))
+		if !opts.Expiry.IsZero() {
+			notifyKeyspaceEvent(conn, notifyGeneric, "expire", string(args[1]))
+		}
+	}
 }
 
 var Get CommandFunc = func(
@@ -86,34 +237,16 @@ var Get CommandFunc = func(
 	val, err := db.Get(string(args[1]))
 	mu.RUnlock()
 
-	if err != nil {
-		// conn.WriteError(err.Error())
-		conn.WriteNull()
-	} else {
+	switch {
+	case isMissingKey(err):
+		writeNull(conn)
+	case err != nil:
+		writeDBError(conn, err)
+	default:
 		conn.WriteBulk(val)
 	}
 }
 
-var Delete CommandFunc = func(
-	conn redcon.Conn,
-	args [][]byte,
-	mu *sync.RWMutex,
-	db *KeyValor.KeyValorDatabase,
-) {
-	if len(args) != 2 {
-		conn.WriteError(fmt.Sprintf(InfalidArgumentsErrorMsg, string(args[0])))
-		return
-	}
-	mu.Lock()
-	err := db.Delete(string(args[1]))
-	mu.Unlock()
-	if err != nil {
-		conn.WriteInt(0)
-	} else {
-		conn.WriteInt(1)
-	}
-}
-
 var Exists CommandFunc = func(
 	conn redcon.Conn,
 	args [][]byte,
@@ -154,53 +287,74 @@ var Keys CommandFunc = func(
 	}
 }
 
-var Ttl CommandFunc = func(
+// Scan implements SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+var Scan CommandFunc = func(
 	conn redcon.Conn,
 	args [][]byte,
 	mu *sync.RWMutex,
 	db *KeyValor.KeyValorDatabase,
 ) {
-	if len(args) != 2 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(args[0]) + "' command")
+	if len(args) < 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	opts, errMsg := parseScanOptions(args[1:], false, true)
+	if errMsg != "" {
+		conn.WriteError(errMsg)
 		return
 	}
 
 	mu.RLock()
-	ttl, err := db.TTL(string(args[1]))
+	keys, next, err := db.Scan(opts.cursor, opts.match, opts.count)
+	if err == nil && opts.typ != "" {
+		keys, err = keysOfType(db, keys, opts.typ)
+	}
 	mu.RUnlock()
 	if err != nil {
-		conn.WriteError(err.Error())
-	} else {
-		conn.WriteInt(int(ttl))
+		writeDBError(conn, err)
+		return
 	}
+
+	conn.WriteArray(2)
+	conn.WriteBulkString(strconv.FormatUint(next, 10))
+	WriteRedisArray(conn, keys)
 }
 
-var Expire CommandFunc = func(
+// keysOfType filters the keys holding a value of the given type ("string", "hash", ...).
+func keysOfType(db *KeyValor.KeyValorDatabase, keys []string, typ string) ([]string, error) {
+	filtered := keys[:0]
+	for _, key := range keys {
+		keyType, err := db.Type(key)
+		if err != nil {
+			return nil, err
+		}
+		if keyType == typ {
+			filtered = append(filtered, key)
+		}
+	}
+	return filtered, nil
+}
+
+var Type CommandFunc = func(
 	conn redcon.Conn,
 	args [][]byte,
 	mu *sync.RWMutex,
 	db *KeyValor.KeyValorDatabase,
 ) {
-	if len(args) < 3 {
-		conn.WriteError("ERR wrong number of arguments for '" + string(args[0]) + "' command")
-		return
-	}
-	ttl, err := strconv.Atoi(string(args[2]))
-	if err != nil {
-		conn.WriteInt(-2)
+	if len(args) != 2 {
+		writeWrongArgs(conn, args)
 		return
 	}
-	expiryNanos := time.Now().UnixNano() + int64(ttl*int(time.Second))
-	expiryTime := time.Unix(0, expiryNanos)
 
-	mu.Lock()
-	err = db.Expire(string(args[1]), &expiryTime)
-	mu.Unlock()
+	mu.RLock()
+	typ, err := db.Type(string(args[1]))
+	mu.RUnlock()
 	if err != nil {
-		conn.WriteInt(-1)
-	} else {
-		conn.WriteInt(1)
+		writeDBError(conn, err)
+		return
 	}
+	conn.WriteString(typ)
 }
 
 func WriteRedisArray(conn redcon.Conn, strArr []string) {
@@ -0,0 +1,2356 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+	"KeyValor/config"
+	"KeyValor/constants"
+	"KeyValor/dbops"
+)
+
+// fakeConn records the RESP replies written by a command.
+type fakeConn struct {
+	redcon.Conn
+	out []byte
+	ctx interface{}
+}
+
+func (c *fakeConn) Context() interface{}     { return c.ctx }
+func (c *fakeConn) SetContext(v interface{}) { c.ctx = v }
+func (c *fakeConn) RemoteAddr() string       { return "fake" }
+func (c *fakeConn) NetConn() net.Conn        { return nil }
+
+func (c *fakeConn) WriteString(str string)      { c.out = redcon.AppendString(c.out, str) }
+func (c *fakeConn) WriteBulk(bulk []byte)       { c.out = redcon.AppendBulk(c.out, bulk) }
+func (c *fakeConn) WriteBulkString(bulk string) { c.out = redcon.AppendBulkString(c.out, bulk) }
+func (c *fakeConn) WriteInt(num int)            { c.out = redcon.AppendInt(c.out, int64(num)) }
+func (c *fakeConn) WriteInt64(num int64)        { c.out = redcon.AppendInt(c.out, num) }
+func (c *fakeConn) WriteError(msg string)       { c.out = redcon.AppendError(c.out, msg) }
+func (c *fakeConn) WriteArray(count int)        { c.out = redcon.AppendArray(c.out, count) }
+func (c *fakeConn) WriteNull()                  { c.out = redcon.AppendNull(c.out) }
+func (c *fakeConn) WriteRaw(data []byte)        { c.out = append(c.out, data...) }
+
+type testServer struct {
+	t   *testing.T
+	srv *Server
+	dbs *Databases
+	// db is the database 0, selected by default
+	db *KeyValor.KeyValorDatabase
+}
+
+func newTestServer(t *testing.T) *testServer {
+	dbs, err := OpenDatabases(t.TempDir(), 16)
+	require.NoError(t, err)
+	srv := NewServer(DefaultServerConfig(), dbs)
+	t.Cleanup(func() { srv.Shutdown(true) })
+
+	return &testServer{t: t, srv: srv, dbs: dbs, db: dbs.Get(0)}
+}
+
+// do runs a command from a new client, and returns its RESP reply.
+func (ts *testServer) do(command string) string {
+	client := ts.newClient()
+	defer CloseSession(client.conn)
+
+	return client.do(command)
+}
+
+// listen serves ts over TCP like main.go does, and returns its address.
+func (ts *testServer) listen() string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(ts.t, err)
+	go ts.srv.Serve(ln)
+
+	return ln.Addr().String()
+}
+
+// respClient is a network client of a server started with listen.
+type respClient struct {
+	t    *testing.T
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *respClient {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return &respClient{t: t, conn: conn, rd: bufio.NewReader(conn)}
+}
+
+func dialTLS(t *testing.T, addr string, cfg *tls.Config) *respClient {
+	conn, err := tls.Dial("tcp", addr, cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return &respClient{t: t, conn: conn, rd: bufio.NewReader(conn)}
+}
+
+// send sends a command, without waiting for its reply.
+func (c *respClient) send(command string) {
+	args := strings.Fields(command)
+	buf := redcon.AppendArray(nil, len(args))
+	for _, arg := range args {
+		buf = redcon.AppendBulkString(buf, arg)
+	}
+	_, err := c.conn.Write(buf)
+	require.NoError(c.t, err)
+}
+
+// read reads the next RESP reply (or pushed message).
+func (c *respClient) read() string {
+	require.NoError(c.t, c.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	var readValue func() string
+	readValue = func() string {
+		line, err := c.rd.ReadString('\n')
+		require.NoError(c.t, err)
+
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		switch line[0] {
+		case '$':
+			if n < 0 {
+				return line
+			}
+			data := make([]byte, n+2)
+			_, err := io.ReadFull(c.rd, data)
+			require.NoError(c.t, err)
+			return line + string(data)
+		case '*', '>', '%':
+			if line[0] == '%' {
+				n *= 2
+			}
+			for range n {
+				line += readValue()
+			}
+			return line
+		default:
+			return line
+		}
+	}
+	return readValue()
+}
+
+// do sends a command, and returns its reply.
+func (c *respClient) do(command string) string {
+	c.send(command)
+	return c.read()
+}
+
+// testClient is a connection to a testServer, that keeps its session between commands.
+type testClient struct {
+	ts   *testServer
+	conn *fakeConn
+}
+
+func (ts *testServer) newClient() *testClient {
+	return &testClient{ts: ts, conn: &fakeConn{}}
+}
+
+// do runs a command, and returns its RESP reply.
+func (c *testClient) do(command string) string {
+	args := make([][]byte, 0)
+	for _, arg := range strings.Fields(command) {
+		args = append(args, []byte(arg))
+	}
+
+	c.conn.out = nil
+	c.ts.srv.Dispatch(c.conn, args)
+	return string(c.conn.out)
+}
+
+// dispatch runs a command whose arguments may be empty or binary, and returns its RESP reply.
+func (c *testClient) dispatch(args ...string) string {
+	byteArgs := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		byteArgs = append(byteArgs, []byte(arg))
+	}
+
+	c.conn.out = nil
+	c.ts.srv.Dispatch(c.conn, byteArgs)
+	return string(c.conn.out)
+}
+
+func TestStringCommands(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		command string
+		reply   string
+	}{
+		{"MSET a 1 b 2", "+OK\r\n"},
+		{"MGET a missing b", "*3\r\n$1\r\n1\r\n$-1\r\n$1\r\n2\r\n"},
+		{"MSETNX a 3 c 3", ":0\r\n"},
+		{"MSETNX c 3 d 4", ":1\r\n"},
+		{"MSET a", "-ERR wrong number of arguments for 'mset' command\r\n"},
+
+		{"INCR a", ":2\r\n"},
+		{"INCRBY a 10", ":12\r\n"},
+		{"DECRBY a 20", ":-8\r\n"},
+		{"DECR counter", ":-1\r\n"},
+		{"INCRBY a x", "-ERR value is not an integer or out of range\r\n"},
+		{"SET big 9223372036854775807", "+OK\r\n"},
+		{"INCR big", "-ERR increment or decrement would overflow\r\n"},
+		{"SET text hello", "+OK\r\n"},
+		{"INCR text", "-ERR value is not an integer or out of range\r\n"},
+		{"SET padded 010", "+OK\r\n"},
+		{"INCR padded", "-ERR value is not an integer or out of range\r\n"},
+
+		{"SET f 10.50", "+OK\r\n"},
+		{"INCRBYFLOAT f 0.1", "$4\r\n10.6\r\n"},
+		{"INCRBYFLOAT f -5", "$3\r\n5.6\r\n"},
+		{"INCRBYFLOAT text 1", "-ERR value is not a valid float\r\n"},
+		{"INCRBYFLOAT f inf", "-ERR increment would produce NaN or Infinity\r\n"},
+
+		{"APPEND text _world", ":11\r\n"},
+		{"APPEND new abc", ":3\r\n"},
+		{"STRLEN text", ":11\r\n"},
+		{"STRLEN missing", ":0\r\n"},
+		{"GETRANGE text 0 4", "$5\r\nhello\r\n"},
+		{"GETRANGE text -5 -1", "$5\r\nworld\r\n"},
+		{"GETRANGE text 5 2", "$0\r\n\r\n"},
+		{"GETRANGE text 0 100", "$11\r\nhello_world\r\n"},
+		{"GETRANGE missing 0 -1", "$0\r\n\r\n"},
+		{"SETRANGE text 6 WORLD", ":11\r\n"},
+		{"GET text", "$11\r\nhello_WORLD\r\n"},
+		{"SETRANGE pad 3 x", ":4\r\n"},
+		{"GET pad", "$4\r\n\x00\x00\x00x\r\n"},
+		{"SETRANGE text -1 x", "-ERR offset is out of range\r\n"},
+
+		{"SETNX text other", ":0\r\n"},
+		{"SETNX fresh v", ":1\r\n"},
+		{"GETSET fresh w", "$1\r\nv\r\n"},
+		{"GETSET unset w", "$-1\r\n"},
+		{"GETDEL fresh", "$1\r\nw\r\n"},
+		{"GETDEL fresh", "$-1\r\n"},
+
+		{"SETEX e 100 v", "+OK\r\n"},
+		{"SETEX e 0 v", "-ERR invalid expire time in 'setex' command\r\n"},
+		{"PSETEX e -5 v", "-ERR invalid expire time in 'psetex' command\r\n"},
+		{"SETEX e ten v", "-ERR value is not an integer or out of range\r\n"},
+		{"TTL e", ":100\r\n"},
+		{"PERSIST e", ":1\r\n"},
+		{"PERSIST e", ":0\r\n"},
+		{"PERSIST missing", ":0\r\n"},
+		{"TTL e", ":-1\r\n"},
+
+		{"GETEX e EX 50", "$1\r\nv\r\n"},
+		{"TTL e", ":50\r\n"},
+		{"GETEX e PERSIST", "$1\r\nv\r\n"},
+		{"TTL e", ":-1\r\n"},
+		{"GETEX e PX 0", "-ERR invalid expire time in 'getex' command\r\n"},
+		{"GETEX e FOO 1", "-ERR syntax error\r\n"},
+		{"GETEX e EX 1 PERSIST", "-ERR syntax error\r\n"},
+		{"GETEX missing", "$-1\r\n"},
+		{"GETEX e PXAT 1", "$1\r\nv\r\n"},
+		{"GET e", "$-1\r\n"},
+
+		{"PSETEX p 100000 v", "+OK\r\n"},
+		{"INCR p", "-ERR value is not an integer or out of range\r\n"},
+		{"SETEX n 100 5", "+OK\r\n"},
+		{"INCR n", ":6\r\n"},
+		{"TTL n", ":100\r\n"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.reply, ts.do(test.command), test.command)
+	}
+}
+
+func TestEmptyStrings(t *testing.T) {
+	ts := newTestServer(t)
+	client := ts.newClient()
+
+	tests := []struct {
+		args  []string
+		reply string
+	}{
+		{[]string{"SET", "k", ""}, "+OK\r\n"},
+		{[]string{"GET", "k"}, "$0\r\n\r\n"},
+		{[]string{"EXISTS", "k"}, ":1\r\n"},
+		{[]string{"STRLEN", "k"}, ":0\r\n"},
+		{[]string{"TYPE", "k"}, "+string\r\n"},
+		{[]string{"APPEND", "k", "abc"}, ":3\r\n"},
+		{[]string{"APPEND", "k", ""}, ":3\r\n"},
+		{[]string{"APPEND", "new", ""}, ":0\r\n"},
+		{[]string{"GET", "new"}, "$0\r\n\r\n"},
+		{[]string{"MSET", "a", "", "b", "1"}, "+OK\r\n"},
+		{[]string{"MGET", "a", "b"}, "*2\r\n$0\r\n\r\n$1\r\n1\r\n"},
+		{[]string{"MSET", "x", "1", "", "2"}, "-ERR key is empty\r\n"},
+		{[]string{"EXISTS", "x"}, ":0\r\n"},
+		{[]string{"MSETNX", "x", "1", "", "2"}, "-ERR key is empty\r\n"},
+		{[]string{"EXISTS", "x"}, ":0\r\n"},
+		{[]string{"MSETNX", "c", "", "d", ""}, ":1\r\n"},
+		{[]string{"GET", "d"}, "$0\r\n\r\n"},
+		{[]string{"GETSET", "k", ""}, "$3\r\nabc\r\n"},
+		{[]string{"GETDEL", "k"}, "$0\r\n\r\n"},
+		{[]string{"SETEX", "e", "10", ""}, "+OK\r\n"},
+		{[]string{"GET", "e"}, "$0\r\n\r\n"},
+		{[]string{"TTL", "e"}, ":10\r\n"},
+		{[]string{"INCR", "e"}, "-ERR value is not an integer or out of range\r\n"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.reply, client.dispatch(test.args...), strings.Join(test.args, " "))
+	}
+}
+
+func TestGetReportsStorageErrors(t *testing.T) {
+	corrupt := func(call *dbops.Call, next dbops.Invoker) error {
+		if call.Op == dbops.OpGet && call.Keys[0] == "corrupt" {
+			return constants.ErrChecksumIsInvalid
+		}
+		return next()
+	}
+	dbs, err := OpenDatabases(t.TempDir(), 1, KeyValor.WithInterceptors(corrupt))
+	require.NoError(t, err)
+	srv := NewServer(DefaultServerConfig(), dbs)
+	defer srv.Shutdown(true)
+	ts := &testServer{t: t, srv: srv, dbs: dbs, db: dbs.Get(0)}
+
+	require.Equal(t, "+OK\r\n", ts.do("SET corrupt v"))
+	require.Equal(t, "-ERR the checksum of the record is invalid\r\n", ts.do("GET corrupt"))
+	require.Equal(t, "$-1\r\n", ts.do("GET missing"))
+	require.Equal(t, ":1\r\n", ts.do("HSET h f v"))
+	require.Equal(t, "-"+WrongTypeErrorMsg+"\r\n", ts.do("GET h"))
+}
+
+func TestSetOptions(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		command string
+		reply   string
+	}{
+		{"SET k v EX 10 NX", "+OK\r\n"},
+		{"TTL k", ":10\r\n"},
+		{"SET k w EX 10 NX", "$-1\r\n"},
+		{"GET k", "$1\r\nv\r\n"},
+		{"SET missing v XX", "$-1\r\n"},
+		{"EXISTS missing", ":0\r\n"},
+		{"SET k w xx px 20000", "+OK\r\n"},
+		{"TTL k", ":20\r\n"},
+
+		{"SET k x KEEPTTL GET", "$1\r\nw\r\n"},
+		{"TTL k", ":20\r\n"},
+		{"SET k y", "+OK\r\n"},
+		{"TTL k", ":-1\r\n"},
+		{"SET fresh v GET", "$-1\r\n"},
+		{"SET fresh w NX GET", "$1\r\nv\r\n"},
+		{"GET fresh", "$1\r\nv\r\n"},
+
+		{"SET at v EXAT 4000000000", "+OK\r\n"},
+		{"SET at v PXAT 1", "+OK\r\n"},
+		{"GET at", "$-1\r\n"},
+
+		{"SET k v NX XX", "-ERR syntax error\r\n"},
+		{"SET k v EX 10 PX 100", "-ERR syntax error\r\n"},
+		{"SET k v EX 10 KEEPTTL", "-ERR syntax error\r\n"},
+		{"SET k v EX", "-ERR syntax error\r\n"},
+		{"SET k v FOO", "-ERR syntax error\r\n"},
+		{"SET k v EX 0 NX XX", "-ERR syntax error\r\n"},
+		{"SET k v EX 0", "-ERR invalid expire time in 'set' command\r\n"},
+		{"SET k v PX -1", "-ERR invalid expire time in 'set' command\r\n"},
+		{"SET k v EX ten", "-ERR value is not an integer or out of range\r\n"},
+		{"GET k", "$1\r\ny\r\n"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.reply, ts.do(test.command), test.command)
+	}
+
+	// KEEPTTL doesn't rewrite the expiry
+	ts.do("SET kept v EX 100")
+	_, before, err := ts.db.GetWithExpiry("kept")
+	require.NoError(t, err)
+
+	ts.do("SET kept w KEEPTTL")
+	value, after, err := ts.db.GetWithExpiry("kept")
+	require.NoError(t, err)
+	require.Equal(t, "w", string(value))
+	require.True(t, before.Equal(after))
+
+	// every option accepts an empty value
+	client := ts.newClient()
+	empty := []struct {
+		args  []string
+		reply string
+	}{
+		{[]string{"SET", "e", "", "NX"}, "+OK\r\n"},
+		{[]string{"SET", "e", "", "XX", "GET"}, "$0\r\n\r\n"},
+		{[]string{"SET", "e", "", "EX", "10"}, "+OK\r\n"},
+		{[]string{"SET", "e", "", "KEEPTTL"}, "+OK\r\n"},
+		{[]string{"TTL", "e"}, ":10\r\n"},
+		{[]string{"SET", "e", "v", "GET"}, "$0\r\n\r\n"},
+		{[]string{"SET", "e", "", "PX", "20000", "GET"}, "$1\r\nv\r\n"},
+		{[]string{"GET", "e"}, "$0\r\n\r\n"},
+		{[]string{"TTL", "e"}, ":20\r\n"},
+	}
+	for _, test := range empty {
+		require.Equal(t, test.reply, client.dispatch(test.args...), strings.Join(test.args, " "))
+	}
+}
+
+func TestHashCommands(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		command string
+		reply   string
+	}{
+		{"HSET h name alice age 30", ":2\r\n"},
+		{"HSET h age 31 city paris", ":1\r\n"},
+		{"HGET h age", "$2\r\n31\r\n"},
+		{"HGET h missing", "$-1\r\n"},
+		{"HGET nohash f", "$-1\r\n"},
+		{"HMGET h name missing", "*2\r\n$5\r\nalice\r\n$-1\r\n"},
+		{"HGETALL h", "*6\r\n$3\r\nage\r\n$2\r\n31\r\n$4\r\ncity\r\n$5\r\nparis\r\n$4\r\nname\r\n$5\r\nalice\r\n"},
+		{"HKEYS h", "*3\r\n$3\r\nage\r\n$4\r\ncity\r\n$4\r\nname\r\n"},
+		{"HVALS h", "*3\r\n$2\r\n31\r\n$5\r\nparis\r\n$5\r\nalice\r\n"},
+		{"HLEN h", ":3\r\n"},
+		{"HSTRLEN h name", ":5\r\n"},
+		{"HEXISTS h city", ":1\r\n"},
+		{"HSETNX h city london", ":0\r\n"},
+		{"HSETNX h zip 75001", ":1\r\n"},
+		{"HMSET h a 1 b 2", "+OK\r\n"},
+		{"HSET h a", "-ERR wrong number of arguments for 'hset' command\r\n"},
+
+		{"HINCRBY h age 2", ":33\r\n"},
+		{"HINCRBY h visits -1", ":-1\r\n"},
+		{"HINCRBY h name 1", "-ERR hash value is not an integer\r\n"},
+		{"HINCRBY h age x", "-ERR value is not an integer or out of range\r\n"},
+		{"HINCRBYFLOAT h age 0.5", "$4\r\n33.5\r\n"},
+		{"HINCRBYFLOAT h name 1", "-ERR hash value is not a float\r\n"},
+
+		{"HDEL h a b missing", ":2\r\n"},
+		{"HSCAN h 0 COUNT 2", "*2\r\n$1\r\n2\r\n*4\r\n$3\r\nage\r\n$4\r\n33.5\r\n$4\r\ncity\r\n$5\r\nparis\r\n"},
+		{"HSCAN h 2 MATCH [nv]* NOVALUES", "*2\r\n$1\r\n0\r\n*2\r\n$4\r\nname\r\n$6\r\nvisits\r\n"},
+		{"HSCAN h x", "-ERR invalid cursor\r\n"},
+		{"HSCAN h 0 COUNT 0", "-ERR syntax error\r\n"},
+		{"HRANDFIELD nohash", "$-1\r\n"},
+		{"HRANDFIELD nohash 3", "*0\r\n"},
+		{"HRANDFIELD single", "$-1\r\n"},
+
+		{"TYPE h", "+hash\r\n"},
+		{"TYPE missing", "+none\r\n"},
+		{"SET s v", "+OK\r\n"},
+		{"TYPE s", "+string\r\n"},
+
+		// string commands on a hash, and hash commands on a string
+		{"GET h", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"APPEND h x", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"INCR h", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"SET h v GET", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"MGET h s", "*2\r\n$-1\r\n$1\r\nv\r\n"},
+		{"SETNX h v", ":0\r\n"},
+		{"HGET s f", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"HSET s f v", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+
+		// type-agnostic commands
+		{"EXPIRE h 100", ":1\r\n"},
+		{"HSET h more fields", ":1\r\n"},
+		{"TTL h", ":100\r\n"},
+		{"PERSIST h", ":1\r\n"},
+		{"SET h v", "+OK\r\n"},
+		{"TYPE h", "+string\r\n"},
+
+		// deleting the last field deletes the key
+		{"HSET single f v", ":1\r\n"},
+		{"HDEL single f", ":1\r\n"},
+		{"EXISTS single", ":0\r\n"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.reply, ts.do(test.command), test.command)
+	}
+
+	// HRANDFIELD picks distinct fields for a positive count, and may repeat them for a negative one
+	ts.do("HSET r a 1 b 2 c 3 d 4")
+	require.Equal(t, "*4\r\n", ts.do("HRANDFIELD r 10")[:4])
+	require.Equal(t, "*10\r\n", ts.do("HRANDFIELD r -10")[:5])
+	require.Equal(t, "*4\r\n", ts.do("HRANDFIELD r 2 WITHVALUES")[:4])
+}
+
+func TestListCommands(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		command string
+		reply   string
+	}{
+		{"RPUSH l a b c", ":3\r\n"},
+		{"LPUSH l y z", ":5\r\n"},
+		{"LRANGE l 0 -1", "*5\r\n$1\r\nz\r\n$1\r\ny\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{"LRANGE l -2 100", "*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{"LRANGE l 3 1", "*0\r\n"},
+		{"LRANGE missing 0 -1", "*0\r\n"},
+		{"LLEN l", ":5\r\n"},
+		{"LINDEX l -1", "$1\r\nc\r\n"},
+		{"LINDEX l 10", "$-1\r\n"},
+		{"LSET l 0 Z", "+OK\r\n"},
+		{"LSET l 10 x", "-ERR index out of range\r\n"},
+		{"LSET missing 0 x", "-ERR no such key\r\n"},
+		{"LPUSHX missing x", ":0\r\n"},
+		{"EXISTS missing", ":0\r\n"},
+		{"RPUSHX l a", ":6\r\n"},
+		{"LREM l -1 a", ":1\r\n"},
+		{"LINSERT l BEFORE b B", ":6\r\n"},
+		{"LINSERT l AFTER nope x", ":-1\r\n"},
+		{"LINSERT missing AFTER a x", ":0\r\n"},
+		{"LRANGE l 0 -1", "*6\r\n$1\r\nZ\r\n$1\r\ny\r\n$1\r\na\r\n$1\r\nB\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{"LTRIM l 1 -2", "+OK\r\n"},
+		{"LPOP l", "$1\r\ny\r\n"},
+		{"RPOP l 2", "*2\r\n$1\r\nb\r\n$1\r\nB\r\n"},
+		{"LPOP l -1", "-ERR value is out of range, must be positive\r\n"},
+		{"LPOP missing", "$-1\r\n"},
+		{"LPOP missing 2", "*-1\r\n"},
+
+		{"RPUSH src 1 2 3", ":3\r\n"},
+		{"LMOVE src dst RIGHT LEFT", "$1\r\n3\r\n"},
+		{"RPOPLPUSH src dst", "$1\r\n2\r\n"},
+		{"LMOVE src src LEFT RIGHT", "$1\r\n1\r\n"},
+		{"LMOVE missing dst LEFT LEFT", "$-1\r\n"},
+		{"LMOVE src dst UP LEFT", "-ERR syntax error\r\n"},
+		{"LRANGE dst 0 -1", "*2\r\n$1\r\n2\r\n$1\r\n3\r\n"},
+
+		// popping the last element deletes the key
+		{"LPOP l", "$1\r\na\r\n"},
+		{"EXISTS l", ":0\r\n"},
+		{"SET s v", "+OK\r\n"},
+		{"LPUSH s x", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"TYPE dst", "+list\r\n"},
+
+		{"BLPOP dst 0", "*2\r\n$3\r\ndst\r\n$1\r\n2\r\n"},
+		{"BRPOP empty s 0", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"BLPOP empty 0.01", "*-1\r\n"},
+		{"BLMOVE empty dst LEFT LEFT 0.01", "*-1\r\n"},
+		{"BLPOP empty -1", "-ERR timeout is negative\r\n"},
+		{"BLPOP empty x", "-ERR timeout is not a float or out of range\r\n"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.reply, ts.do(test.command), test.command)
+	}
+}
+
+func TestBlockingListCommands(t *testing.T) {
+	ts := newTestServer(t)
+
+	// goBlocked runs a blocking command in the background, once it is blocked on key
+	goBlocked := func(command, key string) <-chan string {
+		waiters := ts.srv.listWaiters.len(ts.db, key)
+		reply := make(chan string, 1)
+		go func() { reply <- ts.do(command) }()
+		require.Eventually(t, func() bool { return ts.srv.listWaiters.len(ts.db, key) > waiters }, time.Second, time.Millisecond)
+		return reply
+	}
+
+	// clients blocked on the same key are served in FIFO order
+	first := goBlocked("BLPOP q1 q2 0", "q2")
+	second := goBlocked("BRPOP q2 0", "q2")
+	require.Equal(t, ":2\r\n", ts.do("RPUSH q2 a b"))
+	require.Equal(t, "*2\r\n$2\r\nq2\r\n$1\r\na\r\n", <-first)
+	require.Equal(t, "*2\r\n$2\r\nq2\r\n$1\r\nb\r\n", <-second)
+	require.Zero(t, ts.srv.listWaiters.len(ts.db, "q1"))
+
+	// a client woken up for an element that another client took keeps its place in the queue
+	first = goBlocked("BLPOP q3 0", "q3")
+	second = goBlocked("BLPOP q3 0", "q3")
+	client := ts.newClient()
+	client.do("MULTI")
+	client.do("RPUSH q3 a")
+	client.do("LPOP q3")
+	require.Equal(t, "*2\r\n:1\r\n$1\r\na\r\n", client.do("EXEC"))
+	require.Eventually(t, func() bool { return ts.srv.listWaiters.len(ts.db, "q3") == 2 }, time.Second, time.Millisecond)
+	require.Equal(t, ":1\r\n", ts.do("RPUSH q3 b"))
+	require.Equal(t, "*2\r\n$2\r\nq3\r\n$1\r\nb\r\n", <-first)
+	require.Equal(t, ":1\r\n", ts.do("RPUSH q3 c"))
+	require.Equal(t, "*2\r\n$2\r\nq3\r\n$1\r\nc\r\n", <-second)
+
+	// BLMOVE wakes up when its source gets an element, and wakes up the clients blocked on its destination
+	popped := goBlocked("BLPOP dst 0", "dst")
+	moved := goBlocked("BLMOVE src dst RIGHT LEFT 5", "src")
+	require.Equal(t, ":1\r\n", ts.do("LPUSH src x"))
+	require.Equal(t, "$1\r\nx\r\n", <-moved)
+	require.Equal(t, "*2\r\n$3\r\ndst\r\n$1\r\nx\r\n", <-popped)
+
+	// a timed out client is no longer waiting
+	require.Equal(t, "*-1\r\n", ts.do("BRPOPLPUSH src dst 0.01"))
+	require.Zero(t, ts.srv.listWaiters.len(ts.db, "src"))
+}
+
+func TestSetCommands(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		command string
+		reply   string
+	}{
+		{"SADD a x y z", ":3\r\n"},
+		{"SADD a x w", ":1\r\n"},
+		{"SADD b y z v", ":3\r\n"},
+		{"SMEMBERS a", "*4\r\n$1\r\nw\r\n$1\r\nx\r\n$1\r\ny\r\n$1\r\nz\r\n"},
+		{"SMEMBERS missing", "*0\r\n"},
+		{"SISMEMBER a x", ":1\r\n"},
+		{"SISMEMBER a v", ":0\r\n"},
+		{"SCARD a", ":4\r\n"},
+		{"SREM a w missing", ":1\r\n"},
+
+		{"SINTER a b", "*2\r\n$1\r\ny\r\n$1\r\nz\r\n"},
+		{"SINTER a missing", "*0\r\n"},
+		{"SUNION a b", "*4\r\n$1\r\nv\r\n$1\r\nx\r\n$1\r\ny\r\n$1\r\nz\r\n"},
+		{"SDIFF a b", "*1\r\n$1\r\nx\r\n"},
+		{"SET str v", "+OK\r\n"},
+		{"SINTER a str", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"SINTERSTORE str a b", ":2\r\n"},
+		{"TYPE str", "+set\r\n"},
+		{"SDIFFSTORE empty a a", ":0\r\n"},
+		{"EXISTS empty", ":0\r\n"},
+
+		{"SRANDMEMBER missing", "$-1\r\n"},
+		{"SRANDMEMBER a 0", "*0\r\n"},
+		{"SPOP a -1", "-ERR value is out of range, must be positive\r\n"},
+		{"SSCAN a 0 MATCH [xy]", "*2\r\n$1\r\n0\r\n*2\r\n$1\r\nx\r\n$1\r\ny\r\n"},
+		{"SSCAN a 0 COUNT 2", "*2\r\n$1\r\n2\r\n*2\r\n$1\r\nx\r\n$1\r\ny\r\n"},
+		{"SSCAN a 2 COUNT 2", "*2\r\n$1\r\n0\r\n*1\r\n$1\r\nz\r\n"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.reply, ts.do(test.command), test.command)
+	}
+
+	require.Equal(t, "*3\r\n", ts.do("SRANDMEMBER a 10")[:4])
+	require.Equal(t, "*5\r\n", ts.do("SRANDMEMBER a -5")[:4])
+
+	// SPOP removes what it returns, and the key with its last member
+	require.Equal(t, "*3\r\n", ts.do("SPOP a 5")[:4])
+	require.Equal(t, ":0\r\n", ts.do("EXISTS a"))
+}
+
+func TestSortedSetCommands(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		command string
+		reply   string
+	}{
+		{"ZADD z 1 one 2 two 3 three", ":3\r\n"},
+		{"ZADD z 1.5 one 4 four", ":1\r\n"},
+		{"ZADD z CH 2 one 2 two", ":1\r\n"},
+		{"ZADD z NX 10 one 5 five", ":1\r\n"},
+		{"ZADD z XX 10 six", ":0\r\n"},
+		{"ZADD z GT CH 1 two 6 three", ":1\r\n"},
+		{"ZADD z INCR 0.5 one", "$3\r\n2.5\r\n"},
+		{"ZADD z NX INCR 1 one", "$-1\r\n"},
+		{"ZADD z NX XX 1 one", "-ERR XX and NX options at the same time are not compatible\r\n"},
+		{"ZADD z GT LT 1 one", "-ERR GT, LT, and/or NX options at the same time are not compatible\r\n"},
+		{"ZADD z INCR 1 a 2 b", "-ERR INCR option supports a single increment-element pair\r\n"},
+		{"ZADD z x one", "-ERR value is not a valid float\r\n"},
+		{"ZADD z 1 one 2", "-ERR syntax error\r\n"},
+
+		// two:2 one:2.5 four:4 five:5 three:6
+		{"ZCARD z", ":5\r\n"},
+		{"ZSCORE z one", "$3\r\n2.5\r\n"},
+		{"ZSCORE z missing", "$-1\r\n"},
+		{"ZRANK z four", ":2\r\n"},
+		{"ZREVRANK z four WITHSCORE", "*2\r\n:2\r\n$1\r\n4\r\n"},
+		{"ZRANK z missing", "$-1\r\n"},
+		{"ZRANGE z 0 1", "*2\r\n$3\r\ntwo\r\n$3\r\none\r\n"},
+		{"ZRANGE z -2 -1 WITHSCORES", "*4\r\n$4\r\nfive\r\n$1\r\n5\r\n$5\r\nthree\r\n$1\r\n6\r\n"},
+		{"ZREVRANGE z 0 0", "*1\r\n$5\r\nthree\r\n"},
+		{"ZRANGE z 0 -1 REV LIMIT 0 1", "-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX\r\n"},
+		{"ZRANGEBYSCORE z (2 5", "*3\r\n$3\r\none\r\n$4\r\nfour\r\n$4\r\nfive\r\n"},
+		{"ZRANGEBYSCORE z -inf +inf LIMIT 1 2", "*2\r\n$3\r\none\r\n$4\r\nfour\r\n"},
+		{"ZREVRANGEBYSCORE z 5 (2 WITHSCORES LIMIT 0 1", "*2\r\n$4\r\nfive\r\n$1\r\n5\r\n"},
+		{"ZRANGE z (5 +inf BYSCORE", "*1\r\n$5\r\nthree\r\n"},
+		{"ZRANGE z +inf 5 BYSCORE REV", "*2\r\n$5\r\nthree\r\n$4\r\nfive\r\n"},
+		{"ZRANGEBYSCORE z x 5", "-ERR min or max is not a float\r\n"},
+		{"ZCOUNT z 2 (5", ":3\r\n"},
+		{"ZCOUNT z 7 +inf", ":0\r\n"},
+
+		{"ZINCRBY z -10 two", "$2\r\n-8\r\n"},
+		{"ZINCRBY z +inf inf", "$3\r\ninf\r\n"},
+		{"ZINCRBY z -inf inf", "-ERR resulting score is not a number (NaN)\r\n"},
+		{"ZRANGE z 0 0", "*1\r\n$3\r\ntwo\r\n"},
+		{"ZREM z two inf missing", ":2\r\n"},
+		{"ZSCAN z 0 MATCH f*", "*2\r\n$1\r\n0\r\n*4\r\n$4\r\nfive\r\n$1\r\n5\r\n$4\r\nfour\r\n$1\r\n4\r\n"},
+		{"TYPE z", "+zset\r\n"},
+		{"SET s v", "+OK\r\n"},
+		{"ZADD s 1 a", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.reply, ts.do(test.command), test.command)
+	}
+}
+
+func TestScanCommands(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.do("MSET user:1 a user:2 b order:1 c")
+	ts.do("HSET user:3 f v")
+
+	require.Equal(t, "*2\r\n$6\r\nuser:1\r\n$6\r\nuser:2\r\n", sortedArrayReply(t, ts.do("KEYS user:[12]")))
+	require.Equal(t, "*0\r\n", ts.do("KEYS user.*"))
+
+	reply := ts.do("SCAN 0 MATCH user:* COUNT 100")
+	require.True(t, strings.HasPrefix(reply, "*2\r\n$1\r\n0\r\n"), reply)
+	require.Equal(t, "*3\r\n$6\r\nuser:1\r\n$6\r\nuser:2\r\n$6\r\nuser:3\r\n",
+		sortedArrayReply(t, strings.TrimPrefix(reply, "*2\r\n$1\r\n0\r\n")))
+
+	require.Equal(t, "*2\r\n$1\r\n0\r\n*1\r\n$6\r\nuser:3\r\n", ts.do("SCAN 0 COUNT 100 TYPE hash"))
+	require.Equal(t, "*2\r\n$1\r\n0\r\n*0\r\n", ts.do("SCAN 0 TYPE list"))
+	require.Equal(t, "-ERR invalid cursor\r\n", ts.do("SCAN x"))
+	require.Equal(t, "-ERR syntax error\r\n", ts.do("SCAN 0 NOVALUES"))
+}
+
+func TestKeyCommands(t *testing.T) {
+	ts := newTestServer(t)
+	client := ts.newClient()
+
+	tests := []struct {
+		command string
+		reply   string
+	}{
+		{"TTL missing", ":-2\r\n"},
+		{"PTTL missing", ":-2\r\n"},
+		{"SET a 1", "+OK\r\n"},
+		{"TTL a", ":-1\r\n"},
+		{"PTTL a", ":-1\r\n"},
+
+		{"EXPIRE missing 10", ":0\r\n"},
+		{"EXPIRE a ten", "-ERR value is not an integer or out of range\r\n"},
+		{"EXPIRE a 9223372036854775807", "-ERR invalid expire time in 'expire' command\r\n"},
+		{"EXPIRE a 10 XX", ":0\r\n"},
+		{"EXPIRE a 10 GT", ":0\r\n"},
+		{"EXPIRE a 10 NX", ":1\r\n"},
+		{"EXPIRE a 20 NX", ":0\r\n"},
+		{"EXPIRE a 5 GT", ":0\r\n"},
+		{"EXPIRE a 20 LT", ":0\r\n"},
+		{"TTL a", ":10\r\n"},
+		{"PEXPIRE a 100000 XX", ":1\r\n"},
+		{"TTL a", ":100\r\n"},
+		{"EXPIRE a 10 NX XX", "-ERR NX and XX, GT or LT options at the same time are not compatible\r\n"},
+		{"EXPIRE a 10 GT LT", "-ERR GT and LT options at the same time are not compatible\r\n"},
+		{"EXPIRE a 10 FOO", "-ERR Unsupported option FOO\r\n"},
+		{"EXPIREAT a 4000000000", ":1\r\n"},
+		{"PEXPIREAT a 4000000000000", ":1\r\n"},
+		{"PERSIST a", ":1\r\n"},
+
+		// an expiry in the past deletes the key
+		{"SET gone 1", "+OK\r\n"},
+		{"PEXPIRE gone -1", ":1\r\n"},
+		{"EXISTS gone", ":0\r\n"},
+		{"SET gone 1", "+OK\r\n"},
+		{"EXPIREAT gone 1", ":1\r\n"},
+		{"EXISTS gone", ":0\r\n"},
+
+		{"RENAME missing b", "-ERR no such key\r\n"},
+		{"SETEX a 100 1", "+OK\r\n"},
+		{"RENAME a b", "+OK\r\n"},
+		{"EXISTS a", ":0\r\n"},
+		{"GET b", "$1\r\n1\r\n"},
+		{"TTL b", ":100\r\n"},
+		{"RENAME b b", "+OK\r\n"},
+		{"SET c 3", "+OK\r\n"},
+		{"RENAMENX b c", ":0\r\n"},
+		{"RENAMENX b d", ":1\r\n"},
+		{"RENAMENX missing e", "-ERR no such key\r\n"},
+
+		{"COPY d e", ":1\r\n"},
+		{"COPY d c", ":0\r\n"},
+		{"COPY d c REPLACE", ":1\r\n"},
+		{"GET c", "$1\r\n1\r\n"},
+		{"TTL c", ":100\r\n"},
+		{"COPY missing f", ":0\r\n"},
+		{"COPY d d", "-ERR source and destination objects are the same\r\n"},
+		{"COPY d d DB 1", ":1\r\n"},
+		{"COPY d d DB 16", "-ERR DB index is out of range\r\n"},
+		{"COPY d d FOO", "-ERR syntax error\r\n"},
+		{"RPUSH l x y", ":2\r\n"},
+		{"COPY l l2", ":1\r\n"},
+		{"LRANGE l2 0 -1", "*2\r\n$1\r\nx\r\n$1\r\ny\r\n"},
+
+		{"TOUCH c d missing", ":2\r\n"},
+		{"TYPE l2", "+list\r\n"},
+		{"DEL c d missing", ":2\r\n"},
+		{"UNLINK e l2 l", ":3\r\n"},
+		{"DBSIZE", ":0\r\n"},
+		{"RANDOMKEY", "$-1\r\n"},
+		{"SELECT 1", "+OK\r\n"},
+		{"RANDOMKEY", "$1\r\nd\r\n"},
+		{"TTL d", ":100\r\n"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.reply, client.do(tt.command), tt.command)
+	}
+
+	// RANDOMKEY returns every key, eventually
+	ts.do("MSET k1 1 k2 2 k3 3")
+	seen := make(map[string]bool)
+	for i := 0; i < 1000 && len(seen) < 3; i++ {
+		seen[ts.do("RANDOMKEY")] = true
+	}
+	require.Len(t, seen, 3)
+
+	// RENAME wakes up the clients blocked on the new key
+	blocked := make(chan string)
+	go func() {
+		blocked <- ts.do("BLPOP target 5")
+	}()
+	require.Eventually(t, func() bool { return ts.srv.listWaiters.len(ts.db, "target") == 1 }, time.Second, time.Millisecond)
+	ts.do("RPUSH source x")
+	require.Equal(t, "+OK\r\n", ts.do("RENAME source target"))
+	require.Equal(t, "*2\r\n$6\r\ntarget\r\n$1\r\nx\r\n", <-blocked)
+}
+
+func TestDumpRestoreMigrate(t *testing.T) {
+	ts := newTestServer(t)
+	client := ts.newClient()
+
+	require.Equal(t, "$-1\r\n", client.do("DUMP missing"))
+	client.do("SET s 10")
+	reply := client.do("DUMP s")
+	header, payload, ok := strings.Cut(reply, "\r\n")
+	require.True(t, ok)
+	payload = strings.TrimSuffix(payload, "\r\n")
+	require.Equal(t, "$"+strconv.Itoa(len(payload)), header)
+
+	pastMs := strconv.FormatInt(time.Now().Add(-time.Second).UnixMilli(), 10)
+	futureMs := strconv.FormatInt(time.Now().Add(100*time.Second).UnixMilli(), 10)
+	tests := []struct {
+		args  []string
+		reply string
+	}{
+		{[]string{"RESTORE", "r", "0", payload}, "+OK\r\n"},
+		{[]string{"GET", "r"}, "$2\r\n10\r\n"},
+		{[]string{"RESTORE", "r", "0", payload}, "-BUSYKEY Target key name already exists.\r\n"},
+		{[]string{"RESTORE", "r", "100000", payload, "REPLACE"}, "+OK\r\n"},
+		{[]string{"TTL", "r"}, ":100\r\n"},
+		{[]string{"RESTORE", "r", futureMs, payload, "REPLACE", "ABSTTL"}, "+OK\r\n"},
+		{[]string{"TTL", "r"}, ":100\r\n"},
+		{[]string{"RESTORE", "r", pastMs, payload, "REPLACE", "ABSTTL"}, "+OK\r\n"},
+		{[]string{"EXISTS", "r"}, ":0\r\n"},
+		{[]string{"RESTORE", "r", "-1", payload}, "-ERR Invalid TTL value, must be >= 0\r\n"},
+		{[]string{"RESTORE", "r", "ten", payload}, "-ERR value is not an integer or out of range\r\n"},
+		{[]string{"RESTORE", "r", "0", payload, "FOO"}, "-ERR syntax error\r\n"},
+		// the payload of Redis' documentation, whose string is encoded as an integer
+		{[]string{"RESTORE", "r", "0", "\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n", "REPLACE"}, "+OK\r\n"},
+		{[]string{"GET", "r"}, "$2\r\n10\r\n"},
+		{[]string{"DEL", "r"}, ":1\r\n"},
+		{[]string{"RESTORE", "r", "0", "garbage"}, "-ERR DUMP payload version or checksum are wrong\r\n"},
+		{[]string{"RESTORE", "r", "0", "\x00\x05ab\x09\x00\x00\x00\x00\x00\x00\x00\x00\x00"}, "-ERR Bad data format\r\n"},
+		{[]string{"EXISTS", "r"}, ":0\r\n"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.reply, client.dispatch(tt.args...), tt.args)
+	}
+
+	// MIGRATE moves keys to another server, with their TTL
+	target := newTestServer(t)
+	host, port, err := net.SplitHostPort(target.listen())
+	require.NoError(t, err)
+	migrate := func(key, db string, options ...string) string {
+		return client.dispatch(append([]string{"MIGRATE", host, port, key, db, "1000"}, options...)...)
+	}
+
+	client.do("RPUSH l a b")
+	client.do("SETEX e 100 v")
+	client.do("SET c 1")
+	require.Equal(t, "+OK\r\n", migrate("l", "0"))
+	require.Equal(t, ":0\r\n", client.do("EXISTS l"))
+	require.Equal(t, "*2\r\n$1\r\na\r\n$1\r\nb\r\n", target.do("LRANGE l 0 -1"))
+	require.Equal(t, "+OK\r\n", migrate("", "0", "KEYS", "e", "missing"))
+	require.Equal(t, ":100\r\n", target.do("TTL e"))
+	require.Equal(t, "+NOKEY\r\n", migrate("missing", "0"))
+
+	// COPY keeps the keys, and REPLACE overwrites those of the target
+	require.Equal(t, "+OK\r\n", migrate("c", "0", "COPY"))
+	require.Equal(t, "$1\r\n1\r\n", client.do("GET c"))
+	require.Equal(t, "-ERR Target instance replied with error: BUSYKEY Target key name already exists.\r\n",
+		migrate("c", "0"))
+	require.Equal(t, ":1\r\n", client.do("EXISTS c"))
+	client.do("SET c 2")
+	require.Equal(t, "+OK\r\n", migrate("c", "0", "COPY", "REPLACE"))
+	require.Equal(t, "$1\r\n2\r\n", target.do("GET c"))
+	require.Equal(t, "+OK\r\n", migrate("c", "3"))
+	require.Equal(t, ":0\r\n", client.do("EXISTS c"))
+	require.True(t, target.dbs.Get(3).Exists("c"))
+
+	require.Equal(t, "-ERR Target instance replied with error: ERR DB index is out of range\r\n", migrate("s", "16"))
+	require.Equal(t, ":1\r\n", client.do("EXISTS s"))
+	require.Equal(t, "-ERR When using MIGRATE KEYS option, the key argument must be set to the empty string\r\n",
+		migrate("s", "0", "KEYS", "s"))
+	require.Equal(t, "-ERR syntax error\r\n", migrate("s", "0", "FOO"))
+
+	// a target that can't be reached
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	_, closedPort, err := net.SplitHostPort(ln.Addr().String())
+	require.NoError(t, err)
+	require.NoError(t, ln.Close())
+	require.Equal(t, "-IOERR error or timeout connecting to the client\r\n",
+		client.dispatch("MIGRATE", "127.0.0.1", closedPort, "s", "0", "1000"))
+	require.Equal(t, ":1\r\n", client.do("EXISTS s"))
+}
+
+func TestSlowlog(t *testing.T) {
+	ts := newTestServer(t)
+	client := ts.newClient()
+	client.do("CLIENT SETNAME bob")
+
+	tests := []struct {
+		command string
+		reply   string
+	}{
+		{"CONFIG SET slowlog-log-slower-than 0", "+OK\r\n"},
+		{"SLOWLOG RESET", "+OK\r\n"},
+		{"SET a 1", "+OK\r\n"},
+		{"AUTH secret", "-ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?\r\n"},
+		{"SLOWLOG LEN", ":3\r\n"},
+		{"SLOWLOG GET -2", "-ERR count should be greater than or equal to -1\r\n"},
+		{"SLOWLOG NOPE", "-ERR unknown subcommand 'NOPE'. Try SLOWLOG HELP.\r\n"},
+		{"CONFIG GET slowlog-*", "*4\r\n$23\r\nslowlog-log-slower-than\r\n$1\r\n0\r\n$15\r\nslowlog-max-len\r\n$3\r\n128\r\n"},
+		{"CONFIG SET slowlog-max-len -1", "-ERR CONFIG SET failed (possibly related to argument 'slowlog-max-len') - argument must be at least 0\r\n"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.reply, client.do(tt.command), tt.command)
+	}
+
+	// the newest entries come first, with the passwords redacted
+	var logged []string
+	for _, entry := range ts.srv.slowLog.latest(-1) {
+		require.Equal(t, "fake", entry.addr)
+		require.Equal(t, "bob", entry.name)
+		logged = append(logged, string(bytes.Join(entry.args, []byte(" "))))
+	}
+	require.Equal(t, []string{
+		"CONFIG SET slowlog-max-len -1", "CONFIG GET slowlog-*", "SLOWLOG NOPE", "SLOWLOG GET -2",
+		"SLOWLOG LEN", "AUTH (redacted)", "SET a 1", "SLOWLOG RESET",
+	}, logged)
+	require.Regexp(t, `^\*1\r\n\*6\r\n:\d+\r\n:\d+\r\n:\d+\r\n\*4\r\n\$6\r\nCONFIG\r\n\$3\r\nSET\r\n\$15\r\nslowlog-max-len\r\n\$2\r\n-1\r\n`+
+		`\$4\r\nfake\r\n\$3\r\nbob\r\n$`, client.do("SLOWLOG GET 1"))
+
+	// the log keeps the latest entries
+	client.do("CONFIG SET slowlog-max-len 2")
+	client.do("PING")
+	require.Equal(t, ":2\r\n", client.do("SLOWLOG LEN"))
+
+	// the time blocked waiting for keys isn't counted, but the time waiting for the lock is
+	client.do("CONFIG SET slowlog-log-slower-than 100000")
+	client.do("SLOWLOG RESET")
+	require.Equal(t, "*-1\r\n", client.do("BLPOP missing 0.2"))
+	require.Equal(t, ":0\r\n", client.do("SLOWLOG LEN"))
+	ts.srv.mu.Lock()
+	time.AfterFunc(200*time.Millisecond, ts.srv.mu.Unlock)
+	require.Equal(t, "+OK\r\n", client.do("SET a 2"))
+	require.Equal(t, ":1\r\n", client.do("SLOWLOG LEN"))
+	require.GreaterOrEqual(t, ts.srv.slowLog.latest(1)[0].duration, 200*time.Millisecond)
+
+	client.do("CONFIG SET slowlog-log-slower-than -1")
+	client.do("SLOWLOG RESET")
+	client.do("PING")
+	require.Equal(t, ":0\r\n", client.do("SLOWLOG LEN"))
+
+	// the long commands are shortened
+	args := [][]byte{[]byte("MSET"), bytes.Repeat([]byte("k"), 200)}
+	for i := 0; i < 40; i++ {
+		args = append(args, []byte("v"))
+	}
+	logged = nil
+	for _, arg := range slowLogArgs(args) {
+		logged = append(logged, string(arg))
+	}
+	require.Len(t, logged, 32)
+	require.Equal(t, strings.Repeat("k", 128)+"... (72 more bytes)", logged[1])
+	require.Equal(t, "... (11 more arguments)", logged[31])
+
+	require.Equal(t, "HELLO 3 AUTH alice (redacted) SETNAME c", string(bytes.Join(redactArgs(bytes.Fields(
+		[]byte("HELLO 3 AUTH alice wonderland SETNAME c"))), []byte(" "))))
+	require.Equal(t, "MIGRATE h 1 k 0 10 AUTH2 u (redacted) KEYS", string(bytes.Join(redactArgs(bytes.Fields(
+		[]byte("MIGRATE h 1 k 0 10 AUTH2 u p KEYS"))), []byte(" "))))
+}
+
+func TestLatency(t *testing.T) {
+	ts := newTestServer(t)
+	client := ts.newClient()
+
+	// the background tasks of the databases are recorded
+	record := ts.db.Config().LatencyListener
+	require.NotNil(t, record)
+
+	record(config.LatencyCompaction, 50*time.Millisecond)
+	require.Equal(t, "*0\r\n", client.do("LATENCY LATEST"))
+	require.Equal(t, "+OK\r\n", client.do("CONFIG SET latency-monitor-threshold 10"))
+	record(config.LatencyCompaction, 50*time.Millisecond)
+	record(config.LatencyCompaction, 70*time.Millisecond)
+	record(config.LatencyIndexFlush, 5*time.Millisecond)
+
+	// the commands waiting for the lock are recorded, in the event of their category
+	ts.srv.mu.Lock()
+	time.AfterFunc(50*time.Millisecond, ts.srv.mu.Unlock)
+	require.Equal(t, "+OK\r\n", client.do("SET a 1"))
+	ts.srv.mu.Lock()
+	time.AfterFunc(50*time.Millisecond, ts.srv.mu.Unlock)
+	require.Equal(t, ":1\r\n", client.do("INCR b"))
+
+	require.Regexp(t, `^\*3\r\n`+
+		`\*4\r\n\$7\r\ncommand\r\n:\d+\r\n:\d+\r\n:\d+\r\n`+
+		`\*4\r\n\$10\r\ncompaction\r\n:\d+\r\n:70\r\n:70\r\n`+
+		`\*4\r\n\$12\r\nfast-command\r\n:\d+\r\n:\d+\r\n:\d+\r\n$`, client.do("LATENCY LATEST"))
+	// the samples of a second are merged
+	require.Regexp(t, `^\*[12]\r\n(\*2\r\n:\d+\r\n:50\r\n)?\*2\r\n:\d+\r\n:70\r\n$`, client.do("LATENCY HISTORY compaction"))
+	require.Equal(t, "*0\r\n", client.do("LATENCY HISTORY index-flush"))
+
+	require.Equal(t, ":1\r\n", client.do("LATENCY RESET compaction missing"))
+	require.Equal(t, ":2\r\n", client.do("LATENCY RESET"))
+	require.Equal(t, "*0\r\n", client.do("LATENCY LATEST"))
+	require.Equal(t, "-ERR unknown subcommand 'DOCTOR'. Try LATENCY HELP.\r\n", client.do("LATENCY DOCTOR"))
+}
+
+// sortedArrayReply sorts the elements of an array of bulk strings reply, whose order is unspecified.
+func sortedArrayReply(t *testing.T, reply string) string {
+	lines := strings.Split(strings.TrimSuffix(reply, "\r\n"), "\r\n")
+	require.True(t, strings.HasPrefix(lines[0], "*"), reply)
+
+	elements := make([]string, 0, len(lines)/2)
+	for i := 1; i+1 < len(lines); i += 2 {
+		elements = append(elements, lines[i]+"\r\n"+lines[i+1]+"\r\n")
+	}
+	sort.Strings(elements)
+	return lines[0] + "\r\n" + strings.Join(elements, "")
+}
+
+func TestMonitor(t *testing.T) {
+	ts := newTestServer(t)
+	addr := ts.listen()
+
+	monitor := dial(t, addr)
+	client := dial(t, addr)
+	clientAddr := regexp.QuoteMeta(client.conn.LocalAddr().String())
+
+	require.Equal(t, "+OK\r\n", monitor.do("MONITOR"))
+	require.Contains(t, client.do("CLIENT LIST"), "flags=O ")
+
+	// the commands of the clients are shown once they ran, with their secrets redacted
+	client.do("SET a 1")
+	client.do("AUTH secret")
+	client.do("SELECT 2")
+	client.do("MULTI")
+	client.do("SET b 2")
+	client.do("EXEC")
+	for _, want := range []string{
+		`[0 ` + clientAddr + `] "CLIENT" "LIST"`,
+		`[0 ` + clientAddr + `] "SET" "a" "1"`,
+		`[0 ` + clientAddr + `] "AUTH" "\(redacted\)"`,
+		`[2 ` + clientAddr + `] "SELECT" "2"`,
+		`[2 ` + clientAddr + `] "MULTI"`,
+		`[2 ` + clientAddr + `] "SET" "b" "2"`,
+		`[2 ` + clientAddr + `] "EXEC"`,
+	} {
+		require.Regexp(t, `^\+\d+\.\d{6} \`+want+"\r\n$", monitor.read())
+	}
+	require.Equal(t, "+1.000005 [0 x] \"a\\\"b\\n\\x01\\xc3\\xa9\"\r\n",
+		string(monitorLine(time.Unix(1, 5000), 0, "x", [][]byte{[]byte("a\"b\n\x01é")})))
+
+	// a monitor can't use the keyspace, and its other commands are shown too
+	require.Equal(t, "-ERR Replica can't interact with the keyspace\r\n", monitor.do("GET a"))
+	require.Equal(t, "-ERR Can't execute 'multi' while monitoring\r\n", monitor.do("MULTI"))
+	require.Equal(t, "+PONG\r\n", monitor.do("PING"))
+	require.Regexp(t, `"PING"\r\n$`, monitor.read())
+
+	// MONITOR can't run inside a transaction
+	require.Equal(t, "+OK\r\n", client.do("MULTI"))
+	require.Equal(t, "+QUEUED\r\n", client.do("MONITOR"))
+	require.Equal(t, "*1\r\n-ERR MONITOR isn't allowed for DENY BLOCKING client\r\n", client.do("EXEC"))
+
+	// a monitor that disconnects is removed
+	require.NoError(t, monitor.conn.Close())
+	require.Eventually(t, func() bool { return ts.srv.monitors.count.Load() == 0 }, time.Second, time.Millisecond)
+
+	// and so is one that falls behind
+	defer func(backlog int) { monitorBacklog = backlog }(monitorBacklog)
+	monitorBacklog = 1
+	slow := dial(t, addr)
+	require.Equal(t, "+OK\r\n", slow.do("MONITOR"))
+	require.EqualValues(t, 1, ts.srv.monitors.count.Load())
+	large := strings.Repeat("x", 1<<20)
+	for i := 0; i < 64 && ts.srv.monitors.count.Load() > 0; i++ {
+		require.Equal(t, "+PONG\r\n", client.do("PING "+large))
+	}
+	require.Eventually(t, func() bool { return ts.srv.monitors.count.Load() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestTransactionCommands(t *testing.T) {
+	ts := newTestServer(t)
+	client := ts.newClient()
+
+	tests := []struct {
+		command string
+		reply   string
+	}{
+		{"EXEC", "-ERR EXEC without MULTI\r\n"},
+		{"DISCARD", "-ERR DISCARD without MULTI\r\n"},
+		{"MULTI", "+OK\r\n"},
+		{"MULTI", "-ERR MULTI calls can not be nested\r\n"},
+		{"SET a 1", "+QUEUED\r\n"},
+		{"INCR a", "+QUEUED\r\n"},
+		{"LPUSH a x", "+QUEUED\r\n"},
+		{"GET a", "+QUEUED\r\n"},
+		// a command failing at run time doesn't stop the others
+		{"EXEC", "*4\r\n+OK\r\n:2\r\n-WRONGTYPE Operation against a key holding the wrong kind of value\r\n$1\r\n2\r\n"},
+		{"MULTI", "+OK\r\n"},
+		{"EXEC", "*0\r\n"},
+
+		{"MULTI", "+OK\r\n"},
+		{"SET b 1", "+QUEUED\r\n"},
+		{"DISCARD", "+OK\r\n"},
+		{"EXISTS b", ":0\r\n"},
+
+		// a command that can't be queued aborts the transaction
+		{"MULTI", "+OK\r\n"},
+		{"SET b 1", "+QUEUED\r\n"},
+		{"NOPE", "-ERR unknown command 'nope'\r\n"},
+		{"EXEC", "-EXECABORT Transaction discarded because of previous errors.\r\n"},
+		{"EXISTS b", ":0\r\n"},
+
+		// and so does a command with the wrong number of arguments
+		{"MULTI", "+OK\r\n"},
+		{"SET b 1", "+QUEUED\r\n"},
+		{"MSET b", "-ERR wrong number of arguments for 'mset' command\r\n"},
+		{"CLIENT SETNAME", "-ERR wrong number of arguments for 'client|setname' command\r\n"},
+		{"EXEC", "-EXECABORT Transaction discarded because of previous errors.\r\n"},
+		{"EXISTS b", ":0\r\n"},
+
+		{"MULTI", "+OK\r\n"},
+		{"WATCH a", "-ERR WATCH inside MULTI is not allowed\r\n"},
+		// blocking commands don't block inside a transaction
+		{"BLPOP empty 0", "+QUEUED\r\n"},
+		{"EXEC", "*1\r\n*-1\r\n"},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.reply, client.do(tt.command), tt.command)
+	}
+}
+
+func TestWatchCommands(t *testing.T) {
+	ts := newTestServer(t)
+	client := ts.newClient()
+
+	// no write of the watched keys: EXEC runs
+	require.Equal(t, "+OK\r\n", client.do("WATCH a b"))
+	require.Equal(t, "+OK\r\n", ts.do("SET c 1"))
+	require.Equal(t, "+OK\r\n", client.do("MULTI"))
+	require.Equal(t, "+QUEUED\r\n", client.do("INCR a"))
+	require.Equal(t, "*1\r\n:1\r\n", client.do("EXEC"))
+
+	// EXEC released the watches: writing a doesn't abort the next transaction
+	require.Equal(t, "+OK\r\n", ts.do("SET a 5"))
+	require.Equal(t, "+OK\r\n", client.do("MULTI"))
+	require.Equal(t, "+QUEUED\r\n", client.do("INCR a"))
+	require.Equal(t, "*1\r\n:6\r\n", client.do("EXEC"))
+
+	// a watched key written by another client (even with the same value) aborts EXEC
+	require.Equal(t, "+OK\r\n", client.do("WATCH a"))
+	require.Equal(t, "+OK\r\n", ts.do("SET a 6"))
+	require.Equal(t, "+OK\r\n", client.do("MULTI"))
+	require.Equal(t, "+QUEUED\r\n", client.do("INCR a"))
+	require.Equal(t, "*-1\r\n", client.do("EXEC"))
+	require.Equal(t, "$1\r\n6\r\n", ts.do("GET a"))
+
+	// failed writes don't count
+	require.Equal(t, "+OK\r\n", client.do("WATCH a"))
+	require.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", ts.do("LPUSH a x"))
+	require.Equal(t, "+OK\r\n", client.do("MULTI"))
+	require.Equal(t, "+QUEUED\r\n", client.do("INCR a"))
+	require.Equal(t, "*1\r\n:7\r\n", client.do("EXEC"))
+
+	// UNWATCH forgets the keys
+	require.Equal(t, "+OK\r\n", client.do("WATCH a"))
+	require.Equal(t, "+OK\r\n", client.do("UNWATCH"))
+	require.Equal(t, ":1\r\n", ts.do("DEL a"))
+	require.Equal(t, "+OK\r\n", client.do("MULTI"))
+	require.Equal(t, "+QUEUED\r\n", client.do("EXISTS a"))
+	require.Equal(t, "*1\r\n:0\r\n", client.do("EXEC"))
+
+	// a watched key deleted by the active expiry aborts EXEC
+	require.Equal(t, "+OK\r\n", ts.do("CONFIG SET active-expire-interval 10ms"))
+	require.Equal(t, "+OK\r\n", ts.do("PSETEX e 20 v"))
+	require.Equal(t, "+OK\r\n", client.do("WATCH e"))
+	watch := sessionOf(client.conn).watches[0]
+	require.Eventually(t, watch.Dirty, time.Second, 10*time.Millisecond)
+	require.Equal(t, "+OK\r\n", client.do("MULTI"))
+	require.Equal(t, "+QUEUED\r\n", client.do("SET e w"))
+	require.Equal(t, "*-1\r\n", client.do("EXEC"))
+	require.Equal(t, "$-1\r\n", ts.do("GET e"))
+}
+
+func TestExecIsAtomic(t *testing.T) {
+	ts := newTestServer(t)
+
+	const clients, increments = 4, 50
+
+	var wg sync.WaitGroup
+	replies := make(chan string, clients*increments)
+	for range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := ts.newClient()
+			for range increments {
+				client.do("MULTI")
+				client.do("INCR counter")
+				client.do("INCR counter")
+				replies <- client.do("EXEC")
+			}
+		}()
+	}
+	wg.Wait()
+	close(replies)
+
+	// the two increments of a transaction are never interleaved with another one
+	for reply := range replies {
+		var first, second int
+		_, err := fmt.Sscanf(reply, "*2\r\n:%d\r\n:%d\r\n", &first, &second)
+		require.NoError(t, err, reply)
+		require.Equal(t, 1, first%2, reply)
+		require.Equal(t, first+1, second, reply)
+	}
+	require.Equal(t, "$3\r\n400\r\n", ts.do("GET counter"))
+}
+
+func TestPubSubCommands(t *testing.T) {
+	ts := newTestServer(t)
+	addr := ts.listen()
+
+	subscriber := dial(t, addr)
+	patternSubscriber := dial(t, addr)
+	publisher := dial(t, addr)
+
+	require.Equal(t, "*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n", subscriber.do("SUBSCRIBE news sport"))
+	require.Equal(t, "*3\r\n$9\r\nsubscribe\r\n$5\r\nsport\r\n:2\r\n", subscriber.read())
+	require.Equal(t, "*3\r\n$10\r\npsubscribe\r\n$2\r\nn*\r\n:1\r\n", patternSubscriber.do("PSUBSCRIBE n*"))
+
+	// a message goes to the subscribers of the channel and of the matching patterns
+	require.Equal(t, ":2\r\n", publisher.do("PUBLISH news hello"))
+	require.Equal(t, "*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n", subscriber.read())
+	require.Equal(t, "*4\r\n$8\r\npmessage\r\n$2\r\nn*\r\n$4\r\nnews\r\n$5\r\nhello\r\n", patternSubscriber.read())
+	require.Equal(t, ":1\r\n", publisher.do("PUBLISH sport goal"))
+	require.Equal(t, "*3\r\n$7\r\nmessage\r\n$5\r\nsport\r\n$4\r\ngoal\r\n", subscriber.read())
+	require.Equal(t, ":0\r\n", publisher.do("PUBLISH weather sunny"))
+
+	tests := []struct {
+		command string
+		reply   string
+	}{
+		{"PUBSUB CHANNELS", "*2\r\n$4\r\nnews\r\n$5\r\nsport\r\n"},
+		{"PUBSUB CHANNELS s*", "*1\r\n$5\r\nsport\r\n"},
+		{"PUBSUB NUMSUB news missing", "*4\r\n$4\r\nnews\r\n:1\r\n$7\r\nmissing\r\n:0\r\n"},
+		{"PUBSUB NUMPAT", ":1\r\n"},
+		{"PUBSUB NOPE", "-ERR unknown subcommand 'NOPE'. Try PUBSUB HELP.\r\n"},
+		// a client that never subscribed has nothing to unsubscribe from
+		{"UNSUBSCRIBE", "*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.reply, publisher.do(tt.command), tt.command)
+	}
+
+	// a subscribed client can only (un)subscribe, PING and QUIT
+	require.Equal(t, "-ERR Can't execute 'get': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context\r\n", subscriber.do("GET a"))
+	require.Equal(t, "*2\r\n$4\r\npong\r\n$0\r\n\r\n", subscriber.do("PING"))
+
+	// once it unsubscribed from everything, it can run any command again
+	require.Equal(t, "*3\r\n$11\r\nunsubscribe\r\n$4\r\nnews\r\n:1\r\n", subscriber.do("UNSUBSCRIBE"))
+	require.Equal(t, "*3\r\n$11\r\nunsubscribe\r\n$5\r\nsport\r\n:0\r\n", subscriber.read())
+	require.Equal(t, "+OK\r\n", subscriber.do("SET a 1"))
+	require.Equal(t, "+PONG\r\n", subscriber.do("PING"))
+
+	// a client that disconnects is unsubscribed
+	require.NoError(t, patternSubscriber.conn.Close())
+	require.Eventually(t, func() bool { return publisher.do("PUBSUB NUMPAT") == ":0\r\n" }, time.Second, time.Millisecond)
+	require.Equal(t, "*0\r\n", publisher.do("PUBSUB CHANNELS"))
+}
+
+func TestRESP3(t *testing.T) {
+	ts := newTestServer(t)
+	client := ts.newClient()
+
+	require.Equal(t, ":1\r\n", client.do("HSET h f v"))
+	require.Equal(t, ":1\r\n", client.do("ZADD z 1.5 m"))
+
+	tests := []struct {
+		command string
+		reply   string
+	}{
+		{"HELLO 4", "-NOPROTO unsupported protocol version\r\n"},
+		{"HELLO x", "-ERR Protocol version is not an integer or out of range\r\n"},
+		{"HELLO 3 SETNAME", "-ERR Syntax error in HELLO option 'SETNAME'\r\n"},
+		{"HELLO 3 AUTH someone secret", "-WRONGPASS invalid username-password pair or user is disabled.\r\n"},
+		// RESP2 replies, until HELLO 3 succeeds
+		{"GET missing", "$-1\r\n"},
+		{"HGETALL h", "*2\r\n$1\r\nf\r\n$1\r\nv\r\n"},
+		{"ZSCORE z m", "$3\r\n1.5\r\n"},
+
+		{"HELLO 3 SETNAME app", "%7\r\n$6\r\nserver\r\n$5\r\nredis\r\n$7\r\nversion\r\n$5\r\n7.2.0\r\n$5\r\nproto\r\n:3\r\n" +
+			"$2\r\nid\r\n:" + strconv.FormatInt(sessionOf(client.conn).id, 10) + "\r\n$4\r\nmode\r\n$10\r\nstandalone\r\n$4\r\nrole\r\n$6\r\nmaster\r\n$7\r\nmodules\r\n*0\r\n"},
+		{"CLIENT GETNAME", "$3\r\napp\r\n"},
+		{"GET missing", "_\r\n"},
+		{"BLPOP missing 0.01", "_\r\n"},
+		{"HGETALL h", "%1\r\n$1\r\nf\r\n$1\r\nv\r\n"},
+		{"ZSCORE z m", ",1.5\r\n"},
+		{"ZINCRBY z +inf m", ",inf\r\n"},
+		{"ZRANGE z 0 -1 WITHSCORES", "*1\r\n*2\r\n$1\r\nm\r\n,inf\r\n"},
+
+		{"HELLO 2", "*14\r\n$6\r\nserver\r\n$5\r\nredis\r\n$7\r\nversion\r\n$5\r\n7.2.0\r\n$5\r\nproto\r\n:2\r\n" +
+			"$2\r\nid\r\n:" + strconv.FormatInt(sessionOf(client.conn).id, 10) + "\r\n$4\r\nmode\r\n$10\r\nstandalone\r\n$4\r\nrole\r\n$6\r\nmaster\r\n$7\r\nmodules\r\n*0\r\n"},
+		{"ZSCORE z m", "$3\r\ninf\r\n"},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.reply, client.do(tt.command), tt.command)
+	}
+}
+
+func TestClientCommands(t *testing.T) {
+	ts := newTestServer(t)
+	addr := ts.listen()
+
+	app := dial(t, addr)
+	admin := dial(t, addr)
+
+	appID := strings.TrimSpace(app.do("CLIENT ID")[1:])
+	adminID := strings.TrimSpace(admin.do("CLIENT ID")[1:])
+
+	tests := []struct {
+		command string
+		reply   string
+	}{
+		{"CLIENT GETNAME", "$-1\r\n"},
+		{"CLIENT SETNAME worker-1", "+OK\r\n"},
+		{"CLIENT GETNAME", "$8\r\nworker-1\r\n"},
+		{"CLIENT SETINFO LIB-NAME go-redis", "+OK\r\n"},
+		{"CLIENT SETINFO LIB-VER 9.0.0", "+OK\r\n"},
+		{"CLIENT SETINFO LIB-COLOR red", "-ERR Unrecognized option 'LIB-COLOR'\r\n"},
+		{"CLIENT NOPE", "-ERR unknown subcommand 'NOPE'. Try CLIENT HELP.\r\n"},
+		{"CLIENT LIST TYPE nope", "-ERR Unknown client type 'nope'\r\n"},
+		{"CLIENT LIST ID x", "-ERR client-id should be greater than 0\r\n"},
+		{"CLIENT KILL ID 1 SKIPME", "-ERR syntax error\r\n"},
+		{"CLIENT KILL 1.2.3.4:5", "-ERR No such client\r\n"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.reply, app.do(tt.command), tt.command)
+	}
+
+	info := app.do("CLIENT INFO")
+	require.Contains(t, info, "id="+appID+" addr="+app.conn.LocalAddr().String()+" laddr="+addr+" name=worker-1 ")
+	require.Contains(t, info, " flags=N db=0 sub=0 psub=0 multi=-1 cmd=client user=default lib-name=go-redis lib-ver=9.0.0\n")
+
+	list := admin.do("CLIENT LIST")
+	require.Contains(t, list, "id="+appID+" ")
+	require.Contains(t, list, "id="+adminID+" ")
+	require.NotContains(t, admin.do("CLIENT LIST ID "+adminID), "id="+appID+" ")
+
+	// CLIENT LIST shows the transactions and the subscriptions of the clients
+	require.Equal(t, "+OK\r\n", app.do("MULTI"))
+	require.Equal(t, "+QUEUED\r\n", app.do("PING"))
+	require.Contains(t, admin.do("CLIENT LIST ID "+appID), " flags=x db=0 sub=0 psub=0 multi=1 ")
+	require.Equal(t, "*1\r\n+PONG\r\n", app.do("EXEC"))
+
+	subscriber := dial(t, addr)
+	subscriberID := strings.TrimSpace(subscriber.do("CLIENT ID")[1:])
+	subscriber.send("SUBSCRIBE a b")
+	subscriber.read()
+	subscriber.read()
+	require.Contains(t, admin.do("CLIENT LIST TYPE pubsub"), "id="+subscriberID+" ")
+	require.NotContains(t, admin.do("CLIENT LIST TYPE normal"), "id="+subscriberID+" ")
+
+	// killing clients: the client itself is skipped by default
+	require.Equal(t, ":0\r\n", admin.do("CLIENT KILL ID "+adminID))
+	require.Equal(t, ":1\r\n", admin.do("CLIENT KILL ID "+appID))
+	require.Equal(t, ":1\r\n", admin.do("CLIENT KILL ADDR "+subscriber.conn.LocalAddr().String()+" SKIPME yes"))
+	for _, killed := range []*respClient{app, subscriber} {
+		_, err := killed.rd.ReadByte()
+		require.Error(t, err)
+	}
+	require.Eventually(t, func() bool {
+		list := admin.do("CLIENT LIST")
+		return !strings.Contains(list, "id="+appID+" ") && !strings.Contains(list, "id="+subscriberID+" ")
+	}, time.Second, time.Millisecond)
+
+	// a client can kill itself, and gets the reply first
+	require.Equal(t, ":1\r\n", admin.do("CLIENT KILL ID "+adminID+" SKIPME no"))
+	_, err := admin.rd.ReadByte()
+	require.Error(t, err)
+}
+
+// TestServersInOneProcess checks that the servers of a process don't share their state.
+func TestServersInOneProcess(t *testing.T) {
+	ts1, ts2 := newTestServer(t), newTestServer(t)
+	client1, client2 := ts1.newClient(), ts2.newClient()
+
+	// each server has its own clients
+	require.Equal(t, "+OK\r\n", client1.do("CLIENT SETNAME one"))
+	require.Equal(t, "+OK\r\n", client2.do("CLIENT SETNAME two"))
+	require.Equal(t, ":1\r\n", client1.do("CLIENT ID"))
+	require.Equal(t, ":1\r\n", client2.do("CLIENT ID"))
+	require.NotContains(t, client2.do("CLIENT LIST"), "name=one ")
+	require.NotContains(t, client1.do("CLIENT LIST"), "name=two ")
+
+	// and its own ACL users
+	require.Equal(t, "+OK\r\n", client1.do("ACL SETUSER alice on >wonderland +@all"))
+	require.Equal(t, "+OK\r\n", client1.do("AUTH alice wonderland"))
+	require.Equal(t, "-WRONGPASS invalid username-password pair or user is disabled.\r\n", client2.do("AUTH alice wonderland"))
+	require.Equal(t, "*1\r\n$31\r\nuser default on nopass ~* +@all\r\n", client2.do("ACL LIST"))
+
+	// its own config and statistics
+	require.Equal(t, "+OK\r\n", client1.do("CONFIG SET slowlog-max-len 5"))
+	require.Equal(t, "*2\r\n$15\r\nslowlog-max-len\r\n$3\r\n128\r\n", client2.do("CONFIG GET slowlog-max-len"))
+	require.Equal(t, "+OK\r\n", client1.do("CONFIG SET notify-keyspace-events KA"))
+	require.Equal(t, keyspaceEvents(0), ts2.srv.enabledKeyspaceEvents())
+	require.Equal(t, "+OK\r\n", client1.do("CONFIG RESETSTAT"))
+	require.Contains(t, client2.do("INFO stats"), "\r\ntotal_commands_processed:7\r\n")
+
+	// and its own subscribers
+	subscriber := dial(t, ts1.listen())
+	subscriber.do("SUBSCRIBE news")
+	require.Equal(t, ":0\r\n", client2.do("PUBLISH news hello"))
+	require.Equal(t, "*0\r\n", client2.do("PUBSUB CHANNELS"))
+	require.Equal(t, ":1\r\n", client1.do("PUBLISH news hello"))
+
+	// and its own SLOWLOG and LATENCY
+	require.Equal(t, "+OK\r\n", client1.do("CONFIG SET slowlog-log-slower-than 0 latency-monitor-threshold 1"))
+	client1.do("PING")
+	ts1.db.Config().LatencyListener(config.LatencyCompaction, 50*time.Millisecond)
+	require.NotEqual(t, ":0\r\n", client1.do("SLOWLOG LEN"))
+	require.Equal(t, ":0\r\n", client2.do("SLOWLOG LEN"))
+	require.Equal(t, "*0\r\n", client2.do("LATENCY LATEST"))
+
+	// and its own monitors
+	monitor := dial(t, ts1.listen())
+	require.Equal(t, "+OK\r\n", monitor.do("MONITOR"))
+	require.EqualValues(t, 1, ts1.srv.monitors.count.Load())
+	require.EqualValues(t, 0, ts2.srv.monitors.count.Load())
+}
+
+func TestRESP3PubSub(t *testing.T) {
+	ts := newTestServer(t)
+	addr := ts.listen()
+
+	subscriber := dial(t, addr)
+	publisher := dial(t, addr)
+
+	require.Contains(t, subscriber.do("HELLO 3"), "proto")
+	require.Equal(t, ">3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n", subscriber.do("SUBSCRIBE news"))
+	require.Equal(t, ":1\r\n", publisher.do("PUBLISH news hello"))
+	require.Equal(t, ">3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n", subscriber.read())
+
+	// a RESP3 subscriber can run any command
+	require.Equal(t, "+OK\r\n", subscriber.do("SET a 1"))
+	require.Equal(t, "+PONG\r\n", subscriber.do("PING"))
+}
+
+func TestCommandSpecs(t *testing.T) {
+	for _, commands := range []map[string]CommandFunc{CommandMap, transactionCommands} {
+		for name := range commands {
+			spec, ok := commandSpecs[name]
+			require.True(t, ok, "no spec for %s", name)
+			require.NotZero(t, spec.arity, "no arity for %s", name)
+		}
+	}
+
+	args := func(command string) [][]byte {
+		var args [][]byte
+		for _, arg := range strings.Fields(command) {
+			args = append(args, []byte(arg))
+		}
+		return args
+	}
+	require.Empty(t, commandSpecs["get"].checkArity(args("GET a")))
+	require.Equal(t, "get", commandSpecs["get"].checkArity(args("GET a b")))
+	require.Empty(t, commandSpecs["del"].checkArity(args("DEL a b c")))
+	require.Equal(t, "del", commandSpecs["del"].checkArity(args("DEL")))
+	require.Empty(t, commandSpecs["client"].checkArity(args("CLIENT SETNAME n")))
+	require.Equal(t, "client|setname", commandSpecs["client"].checkArity(args("CLIENT setname")))
+	require.Empty(t, commandSpecs["client"].checkArity(args("CLIENT NOPE")))
+
+	require.Equal(t, [][]byte{[]byte("a"), []byte("b")},
+		commandSpecs["mset"].keys([][]byte{[]byte("MSET"), []byte("a"), []byte("1"), []byte("b"), []byte("2")}))
+	require.Equal(t, [][]byte{[]byte("a"), []byte("b")},
+		commandSpecs["blpop"].keys([][]byte{[]byte("BLPOP"), []byte("a"), []byte("b"), []byte("0")}))
+	require.Equal(t, [][]byte{[]byte("a")},
+		commandSpecs["migrate"].keys([][]byte{[]byte("MIGRATE"), []byte("host"), []byte("6379"), []byte("a"), []byte("0"), []byte("1000")}))
+	require.Equal(t, [][]byte{[]byte("a"), []byte("b")},
+		commandSpecs["migrate"].keys([][]byte{[]byte("MIGRATE"), []byte("host"), []byte("6379"), []byte(""), []byte("0"), []byte("1000"), []byte("KEYS"), []byte("a"), []byte("b")}))
+	require.Equal(t, [][]byte{[]byte("secret")},
+		commandSpecs["migrate"].keys([][]byte{[]byte("MIGRATE"), []byte("host"), []byte("6379"), []byte("secret"), []byte("0"), []byte("1000"), []byte("AUTH"), []byte("keys")}))
+	require.Equal(t, [][]byte{[]byte("a")},
+		commandSpecs["migrate"].keys([][]byte{[]byte("MIGRATE"), []byte("host"), []byte("6379"), []byte(""), []byte("0"), []byte("1000"), []byte("AUTH"), []byte("keys"), []byte("KEYS"), []byte("a")}))
+	require.Empty(t, commandSpecs["ping"].keys([][]byte{[]byte("PING"), []byte("hello")}))
+}
+
+func TestACLCommands(t *testing.T) {
+	ts := newTestServer(t)
+
+	aclFile := filepath.Join(t.TempDir(), "users.acl")
+	require.NoError(t, os.WriteFile(aclFile, []byte(`# the users of the cache
+user alice on >wonderland ~cache:* +@read +set +acl|whoami
+user bob off >builder allkeys +@all
+`), 0o600))
+	ts.srv.acl.requirePass("secret")
+	require.NoError(t, ts.srv.LoadACLFile(aclFile))
+
+	client := ts.newClient()
+	tests := []struct {
+		command string
+		reply   string
+	}{
+		{"GET a", "-NOAUTH Authentication required.\r\n"},
+		{"NOPE", "-ERR unknown command 'nope'\r\n"},
+		{"HELLO 3", "-" + HelloNoAuthErrorMsg + "\r\n"},
+		{"AUTH nope", "-WRONGPASS invalid username-password pair or user is disabled.\r\n"},
+		{"AUTH bob builder", "-WRONGPASS invalid username-password pair or user is disabled.\r\n"},
+		{"AUTH secret", "+OK\r\n"},
+		{"ACL WHOAMI", "$7\r\ndefault\r\n"},
+		{"SET a 1", "+OK\r\n"},
+
+		{"AUTH alice wonderland", "+OK\r\n"},
+		{"ACL WHOAMI", "$5\r\nalice\r\n"},
+		{"SET cache:a 1", "+OK\r\n"},
+		{"GET cache:a", "$1\r\n1\r\n"},
+		{"GET a", "-NOPERM No permissions to access a key\r\n"},
+		{"MGET cache:a a", "-NOPERM No permissions to access a key\r\n"},
+		{"DEL cache:a", "-NOPERM User alice has no permissions to run the 'del' command\r\n"},
+		{"ACL LIST", "-NOPERM User alice has no permissions to run the 'acl|list' command\r\n"},
+		{"MULTI", "-NOPERM User alice has no permissions to run the 'multi' command\r\n"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.reply, client.do(tt.command), tt.command)
+	}
+
+	// the rules of a user change for its connected clients
+	admin := ts.newClient()
+	require.Equal(t, "+OK\r\n", admin.do("AUTH default secret"))
+	require.Equal(t, "+OK\r\n", admin.do("ACL SETUSER alice +del +multi +exec"))
+	require.Equal(t, "+OK\r\n", client.do("MULTI"))
+	require.Equal(t, "-NOPERM No permissions to access a key\r\n", client.do("DEL a"))
+	require.Equal(t, "+QUEUED\r\n", client.do("DEL cache:a"))
+	require.Equal(t, "-EXECABORT Transaction discarded because of previous errors.\r\n", client.do("EXEC"))
+
+	require.Equal(t, "-ERR Error in ACL SETUSER modifier 'nope': Syntax error\r\n", admin.do("ACL SETUSER carol nope"))
+	require.Equal(t, "-ERR Error in ACL SETUSER modifier '+nope': Unknown command\r\n", admin.do("ACL SETUSER carol +nope"))
+	require.Equal(t, "-ERR Error in ACL SETUSER modifier '+@nope': Unknown command category\r\n", admin.do("ACL SETUSER carol +@nope"))
+	require.Equal(t, "+OK\r\n", admin.do("ACL SETUSER carol on nopass ~* +client|id"))
+	require.Equal(t, "+OK\r\n", client.do("AUTH carol anything"))
+	require.Equal(t, ":", client.do("CLIENT ID")[:1])
+	require.Equal(t, "-NOPERM User carol has no permissions to run the 'client|list' command\r\n", client.do("CLIENT LIST"))
+
+	list := admin.do("ACL LIST")
+	require.Equal(t, "*4\r\n", list[:4])
+	require.Contains(t, list, "user alice on #"+hashPassword("wonderland")+" ~cache:* -@all +@read +set +acl|whoami +del +multi +exec\r\n")
+	require.Contains(t, list, "user bob off #"+hashPassword("builder")+" ~* +@all\r\n")
+	require.Contains(t, list, "user carol on nopass ~* -@all +client|id\r\n")
+	require.Contains(t, list, "user default on #"+hashPassword("secret")+" ~* +@all\r\n")
+
+	// the keys of MIGRATE are checked, whatever the operands of its options
+	require.Equal(t, "+OK\r\n", admin.do("ACL SETUSER dave on nopass ~cache:* +migrate"))
+	require.Equal(t, "+OK\r\n", client.do("AUTH dave anything"))
+	for _, args := range [][]string{
+		{"MIGRATE", "127.0.0.1", "1", "secret", "0", "1000", "AUTH", "keys"},
+		{"MIGRATE", "127.0.0.1", "1", "secret", "0", "1000", "AUTH2", "keys", "keys"},
+		{"MIGRATE", "127.0.0.1", "1", "secret", "0", "1000", "KEYS", "cache:a"},
+		{"MIGRATE", "127.0.0.1", "1", "", "0", "1000", "AUTH", "keys", "KEYS", "cache:a", "secret"},
+	} {
+		require.Equal(t, "-NOPERM No permissions to access a key\r\n", client.dispatch(args...), args)
+	}
+
+	// the clients of a user that is disabled or deleted must authenticate again
+	require.Equal(t, "+OK\r\n", admin.do("ACL SETUSER dave off"))
+	require.Equal(t, "-NOAUTH Authentication required.\r\n", client.do("MIGRATE 127.0.0.1 1 cache:a 0 1000"))
+	require.Equal(t, "-WRONGPASS invalid username-password pair or user is disabled.\r\n", client.do("AUTH dave anything"))
+	require.Equal(t, "+OK\r\n", admin.do("ACL SETUSER dave on"))
+	require.Equal(t, "+OK\r\n", client.do("AUTH dave anything"))
+	require.Equal(t, ":1\r\n", admin.do("ACL DELUSER dave nobody"))
+	require.Equal(t, "-NOAUTH Authentication required.\r\n", client.do("MIGRATE 127.0.0.1 1 cache:a 0 1000"))
+	require.Equal(t, "-ERR The 'default' user cannot be removed\r\n", admin.do("ACL DELUSER carol default"))
+	require.Equal(t, ":0\r\n", admin.do("ACL DELUSER dave"))
+
+	// the commands without a spec are denied
+	require.Equal(t, "NOPERM User default has no permissions to run the 'nope' command",
+		ts.srv.acl.check(ts.srv.acl.users[defaultUserName], "nope", [][]byte{[]byte("NOPE")}))
+
+	// HELLO authenticates, and CLIENT LIST shows the users
+	hello := ts.newClient()
+	require.Equal(t, "-WRONGPASS invalid username-password pair or user is disabled.\r\n", hello.do("HELLO 2 AUTH alice nope"))
+	require.Equal(t, "*14\r\n", hello.do("HELLO 2 AUTH alice wonderland")[:5])
+	require.Contains(t, admin.do("CLIENT LIST"), " user=alice ")
+}
+
+func TestLoadACLFile(t *testing.T) {
+	ts := newTestServer(t)
+	dir := t.TempDir()
+
+	tests := []struct {
+		content string
+		err     string
+	}{
+		{"users alice on\n", ":1: lines must start with 'user <name>'"},
+		{"user alice on\n\nuser alice off\n", ":3: user 'alice' is defined twice"},
+		{"# alice\nuser alice on +nope\n", ":2: error in rule '+nope': Unknown command"},
+		{"user alice on #abc\n", ":1: error in rule '#abc': The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, "users.acl")
+		require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+		require.EqualError(t, ts.srv.LoadACLFile(path), path+tt.err)
+	}
+
+	// the users of a failed load are not loaded
+	require.Len(t, ts.srv.acl.list(), 1)
+	require.NotNil(t, ts.srv.acl.defaultUserIfNoPass())
+}
+
+func TestServerCommands(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.do("SET a 1")
+	ts.do("SETEX b 100 2")
+	ts.do("GET a")
+	ts.do("GET nope")
+
+	tests := []struct {
+		command string
+		reply   string
+	}{
+		{"DBSIZE", ":2\r\n"},
+		{"DBSIZE x", "-ERR wrong number of arguments for 'dbsize' command\r\n"},
+		{"SAVE", "+OK\r\n"},
+		{"FLUSHDB NOW", "-ERR syntax error\r\n"},
+		{"BGSAVE NOW", "-ERR syntax error\r\n"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.reply, ts.do(tt.command), tt.command)
+	}
+
+	lastSave, err := strconv.ParseInt(strings.TrimSpace(ts.do("LASTSAVE")[1:]), 10, 64)
+	require.NoError(t, err)
+	require.InDelta(t, time.Now().Unix(), lastSave, 2)
+
+	info := ts.do("INFO")
+	for _, section := range []string{"# Server\r\n", "# Clients\r\n", "# Memory\r\n", "# Persistence\r\n", "# Stats\r\n", "# Keyspace\r\n"} {
+		require.Contains(t, info, section)
+	}
+	require.Contains(t, info, "\r\nredis_version:7.2.0\r\n")
+	require.Contains(t, info, "\r\nrdb_changes_since_last_save:0\r\n")
+	require.Contains(t, info, "\r\nkeyspace_hits:1\r\nkeyspace_misses:1\r\n")
+	require.Contains(t, info, "\r\ndb0:keys=2,expires=1,avg_ttl=0\r\n")
+
+	// only the requested sections
+	info = ts.do("INFO keyspace CLIENTS")
+	require.NotContains(t, info, "# Server")
+	require.Contains(t, info, "# Clients\r\nconnected_clients:")
+	require.Contains(t, info, "\r\n\r\n# Keyspace\r\n")
+
+	require.Equal(t, "+Background saving started\r\n", ts.do("BGSAVE"))
+	require.Eventually(t, func() bool {
+		return strings.Contains(ts.do("INFO persistence"), "\r\nrdb_bgsave_in_progress:0\r\nrdb_last_save_time:")
+	}, time.Second, 10*time.Millisecond)
+
+	// FLUSHDB deletes every key, and aborts the transactions watching them
+	watcher := ts.newClient()
+	require.Equal(t, "+OK\r\n", watcher.do("WATCH a"))
+	require.Equal(t, "+OK\r\n", ts.do("FLUSHALL SYNC"))
+	require.Equal(t, ":0\r\n", ts.do("DBSIZE"))
+	require.Equal(t, "$-1\r\n", ts.do("GET a"))
+	require.NotContains(t, ts.do("INFO keyspace"), "db0:")
+	require.Equal(t, "+OK\r\n", watcher.do("MULTI"))
+	require.Equal(t, "+QUEUED\r\n", watcher.do("SET a 2"))
+	require.Equal(t, "*-1\r\n", watcher.do("EXEC"))
+}
+
+func TestConfigCommands(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		command string
+		reply   string
+	}{
+		{"CONFIG GET nope", "*0\r\n"},
+		{"CONFIG GET default-ttl", "*2\r\n$11\r\ndefault-ttl\r\n$2\r\n0s\r\n"},
+		{"CONFIG GET *-interval max-*", "*10\r\n" +
+			"$22\r\nactive-expire-interval\r\n$2\r\n1s\r\n" +
+			"$24\r\ncheck-file-size-interval\r\n$4\r\n1m0s\r\n" +
+			"$16\r\ncompact-interval\r\n$6\r\n2h0m0s\r\n" +
+			"$20\r\nmax-active-file-size\r\n$7\r\n5242880\r\n" +
+			"$19\r\nsync-write-interval\r\n$4\r\n1m0s\r\n"},
+		{"CONFIG SET default-ttl 3600 max-active-file-size 1mb", "+OK\r\n"},
+		{"CONFIG GET default-ttl max-active-file-size", "*4\r\n" +
+			"$11\r\ndefault-ttl\r\n$6\r\n1h0m0s\r\n" +
+			"$20\r\nmax-active-file-size\r\n$7\r\n1048576\r\n"},
+		{"CONFIG SET compact-interval 90m", "+OK\r\n"},
+		{"CONFIG GET compact-interval", "*2\r\n$16\r\ncompact-interval\r\n$7\r\n1h30m0s\r\n"},
+
+		{"CONFIG SET nope 1", "-ERR Unknown option or number of arguments for CONFIG SET - 'nope'\r\n"},
+		{"CONFIG SET dir /tmp", "-ERR CONFIG SET failed (possibly related to argument 'dir') - can't set immutable config\r\n"},
+		{"CONFIG SET default-ttl soon", "-ERR CONFIG SET failed (possibly related to argument 'default-ttl') - argument must be a duration\r\n"},
+		{"CONFIG SET compact-interval 0", "-ERR CONFIG SET failed (possibly related to argument 'compact-interval') - argument must be a positive duration\r\n"},
+		{"CONFIG SET sync-policy never", "-ERR CONFIG SET failed (possibly related to argument 'sync-policy') - argument must be 'interval' or 'always'\r\n"},
+		{"CONFIG SET default-ttl 1 default-ttl 2", "-ERR CONFIG SET failed (possibly related to argument 'default-ttl') - duplicate parameter\r\n"},
+		{"CONFIG SET default-ttl 10 max-active-file-size 0", "-ERR CONFIG SET failed (possibly related to argument 'max-active-file-size') - argument must be a memory value\r\n"},
+		{"CONFIG GET default-ttl", "*2\r\n$11\r\ndefault-ttl\r\n$6\r\n1h0m0s\r\n"},
+		{"CONFIG SET default-ttl", "-ERR unknown subcommand 'SET'. Try CONFIG HELP.\r\n"},
+		{"CONFIG REWRITE", "-ERR The server is running without a config file\r\n"},
+		{"CONFIG RESETSTAT", "+OK\r\n"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.reply, ts.do(tt.command), tt.command)
+	}
+
+	// the new default TTL applies, to every database
+	ts.do("SET a 1")
+	require.Equal(t, ":3600\r\n", ts.do("TTL a"))
+	require.Equal(t, time.Hour, ts.dbs.Get(5).Config().DefaultTTL)
+	require.Equal(t, "*2\r\n$9\r\ndatabases\r\n$2\r\n16\r\n", ts.do("CONFIG GET databases"))
+}
+
+func TestSelectCommands(t *testing.T) {
+	ts := newTestServer(t)
+	client := ts.newClient()
+
+	tests := []struct {
+		command string
+		reply   string
+	}{
+		{"SET a 0", "+OK\r\n"},
+		{"SELECT 1", "+OK\r\n"},
+		{"GET a", "$-1\r\n"},
+		{"SET a 1", "+OK\r\n"},
+		{"RPUSH l x", ":1\r\n"},
+		{"SELECT 16", "-ERR DB index is out of range\r\n"},
+		{"SELECT one", "-ERR value is not an integer or out of range\r\n"},
+		{"DBSIZE", ":2\r\n"},
+
+		{"MOVE a 0", ":0\r\n"},
+		{"MOVE l 2", ":1\r\n"},
+		{"MOVE l 2", ":0\r\n"},
+		{"MOVE a 1", "-ERR source and destination objects are the same\r\n"},
+		{"MOVE a -1", "-ERR DB index is out of range\r\n"},
+		{"EXISTS l", ":0\r\n"},
+
+		{"SWAPDB 0 1", "+OK\r\n"},
+		{"GET a", "$1\r\n0\r\n"},
+		{"SWAPDB x 1", "-ERR invalid first DB index\r\n"},
+		{"SWAPDB 0 x", "-ERR invalid second DB index\r\n"},
+		{"SWAPDB 0 99", "-ERR DB index is out of range\r\n"},
+
+		// a SELECT queued in a transaction applies to the next queued commands
+		{"MULTI", "+OK\r\n"},
+		{"SELECT 2", "+QUEUED\r\n"},
+		{"LLEN l", "+QUEUED\r\n"},
+		{"EXEC", "*2\r\n+OK\r\n:1\r\n"},
+		{"LLEN l", ":1\r\n"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.reply, client.do(tt.command), tt.command)
+	}
+
+	// other clients use database 0, which is now the former database 1
+	require.Equal(t, "$1\r\n1\r\n", ts.do("GET a"))
+	require.Contains(t, client.do("CLIENT INFO"), " db=2 ")
+
+	info := ts.do("INFO keyspace")
+	require.Contains(t, info, "\r\ndb0:keys=1,expires=0,avg_ttl=0\r\n")
+	require.Contains(t, info, "\r\ndb1:keys=1,expires=0,avg_ttl=0\r\n")
+	require.Contains(t, info, "\r\ndb2:keys=1,expires=0,avg_ttl=0\r\n")
+
+	// MOVE wakes up the clients blocked on the key in the target database
+	blocked := make(chan string)
+	go func() {
+		blocked <- ts.do("BLPOP l 5")
+	}()
+	require.Eventually(t, func() bool { return ts.srv.listWaiters.len(ts.dbs.Get(0), "l") == 1 }, time.Second, time.Millisecond)
+	require.Equal(t, ":1\r\n", client.do("MOVE l 0"))
+	require.Equal(t, "*2\r\n$1\r\nl\r\n$1\r\nx\r\n", <-blocked)
+
+	// SWAPDB wakes up the clients blocked on either database, which pop from the database now
+	// at the index they selected, and aborts the transactions watching either of them
+	go func() {
+		blocked <- ts.do("BLPOP q 5")
+	}()
+	require.Eventually(t, func() bool { return ts.srv.listWaiters.len(ts.dbs.Get(0), "q") == 1 }, time.Second, time.Millisecond)
+	watcher := ts.newClient()
+	defer CloseSession(watcher.conn)
+	require.Equal(t, "+OK\r\n", watcher.do("WATCH w"))
+	require.Equal(t, "+OK\r\n", client.do("SELECT 3"))
+	require.Equal(t, ":1\r\n", client.do("RPUSH q y"))
+	require.Equal(t, "+OK\r\n", client.do("SWAPDB 0 3"))
+	require.Equal(t, "*2\r\n$1\r\nq\r\n$1\r\ny\r\n", <-blocked)
+	require.Equal(t, "+OK\r\n", watcher.do("MULTI"))
+	require.Equal(t, "+QUEUED\r\n", watcher.do("SET w 1"))
+	require.Equal(t, "*-1\r\n", watcher.do("EXEC"))
+
+	// FLUSHALL clears every database
+	require.Equal(t, "+OK\r\n", ts.do("FLUSHALL"))
+	require.NotContains(t, ts.do("INFO keyspace"), ":keys=")
+}
+
+func TestSwapDBRestart(t *testing.T) {
+	ts := newTestServer(t)
+	require.Equal(t, "+OK\r\n", ts.do("SET a 0"))
+	client := ts.newClient()
+	defer CloseSession(client.conn)
+	for _, command := range []string{"SELECT 1", "SET a 1", "SELECT 2", "SET a 2", "SWAPDB 0 1", "SWAPDB 1 2", "SWAPDB 3 3"} {
+		require.Equal(t, "+OK\r\n", client.do(command), command)
+	}
+	require.NoError(t, ts.dbs.Shutdown())
+
+	// the databases are reopened at the index they were swapped to
+	dbs, err := OpenDatabases(ts.dbs.dir, 16)
+	require.NoError(t, err)
+	for index, value := range []string{"1", "2", "0"} {
+		stored, err := dbs.Get(index).Get("a")
+		require.NoError(t, err)
+		require.Equal(t, value, string(stored), index)
+	}
+	require.NoError(t, dbs.Shutdown())
+
+	// with fewer databases, the swapped ones beyond them keep their directory
+	dbs, err = OpenDatabases(ts.dbs.dir, 2)
+	require.NoError(t, err)
+	require.NoError(t, dbs.swap(0, 1))
+	require.NoError(t, dbs.Shutdown())
+	dbs, err = OpenDatabases(ts.dbs.dir, 3)
+	require.NoError(t, err)
+	defer dbs.Shutdown()
+	for index, value := range []string{"2", "1", "0"} {
+		stored, err := dbs.Get(index).Get("a")
+		require.NoError(t, err)
+		require.Equal(t, value, string(stored), index)
+	}
+
+	// a corrupted list of the directories isn't ignored
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, databasesFile), []byte("db1\ndb1\n"), 0o644))
+	_, err = OpenDatabases(dir, 2)
+	require.ErrorContains(t, err, `unexpected database directory "db1"`)
+}
+
+func TestServerConfig(t *testing.T) {
+	dir := t.TempDir()
+	confFile := filepath.Join(dir, "keyvalor.conf")
+	require.NoError(t, os.WriteFile(confFile, []byte(`# the server
+port 7000
+bind 127.0.0.1
+dir "`+dir+`/data"
+compact-interval 90m
+max-active-file-size 1mb
+loglevel WARN
+slowlog-log-slower-than -1
+`), 0o644))
+
+	cfg := DefaultServerConfig()
+	require.NoError(t, cfg.LoadFile(confFile))
+	require.Equal(t, "127.0.0.1:7000", cfg.Addr())
+	require.Equal(t, filepath.Join(dir, "data"), cfg.Dir)
+	require.Equal(t, 90*time.Minute, cfg.DB.CompactInterval)
+	require.EqualValues(t, 1<<20, cfg.DB.MaxActiveFileSize)
+	require.Equal(t, "warn", cfg.LogLevel.String())
+	require.EqualValues(t, -1, cfg.SlowlogLogSlowerThan)
+	require.Equal(t, confFile, cfg.File)
+
+	// the flags override the config file
+	fs := flag.NewFlagSet("key-val-redis", flag.ContinueOnError)
+	cfg.RegisterFlags(fs)
+	require.NoError(t, fs.Parse([]string{"-port", "7001", "-sync-policy", "always"}))
+	require.NoError(t, cfg.ApplyFlags(fs))
+	require.Equal(t, 7001, cfg.Port)
+	require.Equal(t, config.SyncAlways, cfg.DB.SyncPolicy)
+	require.Equal(t, 90*time.Minute, cfg.DB.CompactInterval)
+
+	yamlFile := filepath.Join(dir, "keyvalor.yaml")
+	require.NoError(t, os.WriteFile(yamlFile, []byte("port: 7002\ndatabases: 4\nbind: \"::1\"\n"), 0o644))
+	cfg = DefaultServerConfig()
+	require.NoError(t, cfg.LoadFile(yamlFile))
+	require.Equal(t, "[::1]:7002", cfg.Addr())
+	require.Equal(t, 4, cfg.Databases)
+
+	// the errors tell the file, line and parameter
+	tests := []struct {
+		file, content, err string
+	}{
+		{"a.conf", "port 7000\nnope 1\n", `a.conf:2: unknown parameter "nope"`},
+		{"a.conf", "\n\nport 70000\n", `a.conf:3: invalid port "70000": must be a port number between 0 and 65535`},
+		{"a.conf", "compact-interval 0\n", `a.conf:1: invalid compact-interval "0": argument must be a positive duration`},
+		{"a.conf", "storage-engine btree\n", `a.conf:1: invalid storage-engine "btree": unknown storage engine "btree" (supported: hashtable)`},
+		{"a.conf", "storage-engine LSMTree\n", `a.conf:1: invalid storage-engine "LSMTree": storage engine "lsmtree" is not supported by the server (supported: hashtable)`},
+		{"a.conf", "dir \"data\n", `a.conf:1: unbalanced quotes in the value of dir`},
+		{"a.yml", "port: 7000\nbind:\n  - a\n", `a.yml:3: the value of bind must be a scalar`},
+		{"a.yml", "- port\n", `a.yml:1: the config must be a mapping of parameters to values`},
+		{"a.yml", "loglevel: loud\n", `a.yml:1: invalid loglevel "loud": unknown log level: "loud"`},
+		{"a.conf", "slowlog-max-len -1\n", `a.conf:1: invalid slowlog-max-len "-1": argument must be at least 0`},
+		{"a.conf", "latency-monitor-threshold 1ms\n", `a.conf:1: invalid latency-monitor-threshold "1ms": argument couldn't be parsed into an integer`},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.file)
+		require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o644))
+		require.EqualError(t, DefaultServerConfig().LoadFile(path), filepath.Join(dir, tt.err), tt.content)
+	}
+
+	fs = flag.NewFlagSet("key-val-redis", flag.ContinueOnError)
+	cfg.RegisterFlags(fs)
+	require.NoError(t, fs.Parse([]string{"-databases", "0"}))
+	require.EqualError(t, cfg.ApplyFlags(fs), `-databases: invalid databases "0": must be a number of at least 1`)
+
+	// the help shows the type of the flags
+	var help bytes.Buffer
+	fs.SetOutput(&help)
+	fs.PrintDefaults()
+	require.Contains(t, help.String(), "-port int\n")
+	require.Contains(t, help.String(), "-sync-write-interval duration\n")
+	require.Contains(t, help.String(), "-compression string\n")
+	require.Error(t, fs.Parse([]string{"-port", "none"}))
+}
+
+func TestConfigRewrite(t *testing.T) {
+	ts := newTestServer(t)
+
+	for _, name := range []string{"keyvalor.conf", "keyvalor.yaml"} {
+		file := filepath.Join(t.TempDir(), name)
+		require.NoError(t, os.WriteFile(file, []byte("# the port\nport 7000\ndefault-ttl 60\n"), 0o644))
+		if name == "keyvalor.yaml" {
+			require.NoError(t, os.WriteFile(file, []byte("# the port\nport: 7000\ndefault-ttl: 60\n"), 0o644))
+		}
+
+		cfg := DefaultServerConfig()
+		require.NoError(t, cfg.LoadFile(file))
+		ts.srv.config = cfg
+		require.Contains(t, ts.do("INFO server"), "\r\ntcp_port:7000\r\n")
+		require.Contains(t, ts.do("INFO server"), "\r\nconfig_file:"+file+"\r\n")
+
+		require.Equal(t, "+OK\r\n", ts.do("CONFIG SET default-ttl 2m compact-interval 1h"))
+		require.Equal(t, "+OK\r\n", ts.do("CONFIG REWRITE"))
+
+		// the lines are rewritten in place, and the changed parameters appended
+		rewritten, err := os.ReadFile(file)
+		require.NoError(t, err)
+		if name == "keyvalor.yaml" {
+			require.Equal(t, "# the port\nport: 7000\ndefault-ttl: 2m0s\ncompact-interval: 1h0m0s\n", string(rewritten))
+		} else {
+			require.Equal(t, "# the port\nport 7000\ndefault-ttl 2m0s\ncompact-interval 1h0m0s\n", string(rewritten))
+		}
+
+		// and read back
+		cfg = DefaultServerConfig()
+		require.NoError(t, cfg.LoadFile(file))
+		require.Equal(t, 2*time.Minute, cfg.DB.DefaultTTL)
+		require.Equal(t, time.Hour, cfg.DB.CompactInterval)
+		require.Equal(t, "+OK\r\n", ts.do("CONFIG SET default-ttl 0 compact-interval 2h"))
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	ts := newTestServer(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	served := make(chan error, 1)
+	go func() { served <- ts.srv.Serve(ln) }()
+	addr := ln.Addr().String()
+
+	client := dial(t, addr)
+	require.Equal(t, "+OK\r\n", client.do("SET a 1"))
+	require.Equal(t, "+OK\r\n", client.do("SELECT 3"))
+	require.Equal(t, "+OK\r\n", client.do("SET b 2"))
+	subscriber := dial(t, addr)
+	require.Equal(t, "*3\r\n$9\r\nsubscribe\r\n$1\r\nc\r\n:1\r\n", subscriber.do("SUBSCRIBE c"))
+	blocked := dial(t, addr)
+	blocked.send("BLPOP l 0")
+	require.Eventually(t, func() bool { return ts.srv.listWaiters.len(ts.db, "l") == 1 }, time.Second, time.Millisecond)
+
+	require.Equal(t, "-ERR syntax error\r\n", client.do("SHUTDOWN NOW"))
+	client.send("SHUTDOWN")
+	require.ErrorIs(t, <-served, ErrServerClosed)
+
+	// every connection is closed, the blocked and subscribed ones included
+	for _, c := range []*respClient{client, subscriber, blocked} {
+		require.NoError(t, c.conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, err := io.ReadAll(c.rd)
+		require.NoError(t, err)
+	}
+	_, err = net.Dial("tcp", addr)
+	require.Error(t, err)
+
+	// the databases were shut down, releasing their directory, with their data persisted
+	dbs, err := OpenDatabases(ts.dbs.dir, 16)
+	require.NoError(t, err)
+	defer dbs.Shutdown()
+	value, err := dbs.Get(0).Get("a")
+	require.NoError(t, err)
+	require.Equal(t, "1", string(value))
+	require.True(t, dbs.Get(3).Exists("b"))
+}
+
+func TestShutdownDrainsCommands(t *testing.T) {
+	ts := newTestServer(t)
+	ts.srv.shutdownTimeout = time.Second
+
+	// a command in flight waits for mu: the shutdown waits for it
+	ts.srv.mu.RLock()
+	done := make(chan string)
+	go func() { done <- ts.do("SET a 1") }()
+	require.Eventually(t, func() bool {
+		// new readers are kept waiting once the writer waits
+		if ts.srv.mu.TryRLock() {
+			ts.srv.mu.RUnlock()
+			return false
+		}
+		return true
+	}, time.Second, time.Millisecond)
+
+	shutdown := make(chan error)
+	go func() { shutdown <- ts.srv.Shutdown(false) }()
+	require.Eventually(t, func() bool { return ts.do("PING") == "-ERR The server is shutting down\r\n" }, time.Second, time.Millisecond)
+	select {
+	case <-shutdown:
+		t.Fatal("the shutdown didn't wait for the command in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ts.srv.mu.RUnlock()
+	require.Equal(t, "+OK\r\n", <-done)
+	require.NoError(t, <-shutdown)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	ts := newTestServer(t)
+	ts.srv.shutdownTimeout = 10 * time.Millisecond
+
+	// once the timeout expired, the connections are closed, but the databases are only
+	// shut down once the command in flight is done
+	ts.srv.mu.RLock()
+	done := make(chan string)
+	go func() { done <- ts.do("SET a 1") }()
+	require.Eventually(t, func() bool {
+		if ts.srv.mu.TryRLock() {
+			ts.srv.mu.RUnlock()
+			return false
+		}
+		return true
+	}, time.Second, time.Millisecond)
+
+	shutdown := make(chan error)
+	go func() { shutdown <- ts.srv.Shutdown(true) }()
+	require.Eventually(t, func() bool {
+		select {
+		case <-ts.srv.drained:
+			return true
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+	select {
+	case <-shutdown:
+		t.Fatal("the databases were shut down with a command in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ts.srv.mu.RUnlock()
+	require.Equal(t, "+OK\r\n", <-done)
+	require.NoError(t, <-shutdown)
+}
+
+// testCertificate is a certificate for the TLS tests, with its key.
+type testCertificate struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCertificate generates a certificate of 127.0.0.1 signed by ca, or a CA certificate
+// if ca is nil.
+func newTestCertificate(t *testing.T, commonName string, ca *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	parent, parentKey := template, key
+	if ca == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		parent, parentKey = ca.cert, ca.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &testCertificate{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// clientConfig returns the configuration of a client trusting ca, with the certificate c.
+func (c *testCertificate) clientConfig(t *testing.T, ca *testCertificate) *tls.Config {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	cfg := &tls.Config{RootCAs: roots}
+	if c != nil {
+		cert, err := tls.X509KeyPair(c.certPEM, c.keyPEM)
+		require.NoError(t, err)
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificate(t, "test CA", nil)
+	writeServerCertificate := func(cert *testCertificate) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "server.crt"), cert.certPEM, 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "server.key"), cert.keyPEM, 0o600))
+	}
+	writeServerCertificate(newTestCertificate(t, "server", ca))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ca.crt"), ca.certPEM, 0o600))
+
+	cfg := DefaultServerConfig()
+	require.NoError(t, cfg.Set("tls-port", "6380"))
+	require.EqualError(t, cfg.Validate(), "tls-port requires tls-cert-file and tls-key-file")
+	require.NoError(t, cfg.Set("tls-cert-file", filepath.Join(dir, "server.crt")))
+	require.NoError(t, cfg.Set("tls-key-file", filepath.Join(dir, "server.key")))
+	require.NoError(t, cfg.Set("tls-auth-clients", "yes"))
+	require.EqualError(t, cfg.Validate(), "tls-auth-clients yes requires tls-ca-cert-file")
+	require.NoError(t, cfg.Set("tls-ca-cert-file", filepath.Join(dir, "ca.crt")))
+	require.NoError(t, cfg.Validate())
+	require.EqualError(t, cfg.Set("tls-auth-clients", "maybe"), `invalid tls-auth-clients "maybe": must be yes, no or optional`)
+
+	certs, err := LoadTLSCertificates(cfg)
+	require.NoError(t, err)
+
+	ts := newTestServer(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go ts.srv.ServeTLS(ln, certs)
+	addr := ln.Addr().String()
+
+	// the plaintext listener serves the same databases
+	require.Equal(t, "+OK\r\n", dial(t, ts.listen()).do("SET k v"))
+
+	client := newTestCertificate(t, "client", ca)
+	c := dialTLS(t, addr, client.clientConfig(t, ca))
+	require.Equal(t, "$1\r\nv\r\n", c.do("GET k"))
+	require.Equal(t, "server", c.conn.(*tls.Conn).ConnectionState().PeerCertificates[0].Subject.CommonName)
+
+	// the clients without a certificate signed by the CA are refused
+	otherCA := newTestCertificate(t, "other CA", nil)
+	for _, clientCert := range []*testCertificate{nil, newTestCertificate(t, "intruder", otherCA)} {
+		conn, err := tls.Dial("tcp", addr, clientCert.clientConfig(t, ca))
+		if err == nil {
+			// with TLS 1.3, the server checks the client certificate after the handshake
+			_, err = conn.Write([]byte("PING\r\n"))
+			if err == nil {
+				_, err = bufio.NewReader(conn).ReadString('\n')
+			}
+			conn.Close()
+		}
+		require.Error(t, err)
+	}
+
+	// SIGHUP reloads the certificates: the new connections use them, and the established ones go on
+	writeServerCertificate(newTestCertificate(t, "renewed server", ca))
+	require.NoError(t, certs.Reload())
+	renewed := dialTLS(t, addr, client.clientConfig(t, ca))
+	require.Equal(t, "+PONG\r\n", renewed.do("PING"))
+	require.Equal(t, "renewed server", renewed.conn.(*tls.Conn).ConnectionState().PeerCertificates[0].Subject.CommonName)
+	require.Equal(t, "+PONG\r\n", c.do("PING"))
+
+	// invalid certificates aren't reloaded
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "server.key"), []byte("garbage"), 0o600))
+	require.Error(t, certs.Reload())
+	require.Equal(t, "+PONG\r\n", dialTLS(t, addr, client.clientConfig(t, ca)).do("PING"))
+}
+
+func TestKeyspaceNotifications(t *testing.T) {
+	ts := newTestServer(t)
+	addr := ts.listen()
+
+	pmessage := func(channel, message string) string {
+		buf := redcon.AppendArray(nil, 4)
+		for _, s := range []string{"pmessage", "__key*__:*", channel, message} {
+			buf = redcon.AppendBulkString(buf, s)
+		}
+		return string(buf)
+	}
+
+	subscriber := dial(t, addr)
+	require.Equal(t, "*3\r\n$10\r\npsubscribe\r\n$10\r\n__key*__:*\r\n:1\r\n", subscriber.do("PSUBSCRIBE __key*__:*"))
+
+	// nothing is published by default
+	require.Equal(t, "+OK\r\n", ts.do("SET a 1"))
+
+	tests := []struct {
+		command string
+		reply   string
+	}{
+		{"CONFIG GET notify-keyspace-events", "*2\r\n$22\r\nnotify-keyspace-events\r\n$0\r\n\r\n"},
+		{"CONFIG SET notify-keyspace-events KQ", "-ERR CONFIG SET failed (possibly related to argument 'notify-keyspace-events') - invalid event class character 'Q', use 'AKEg$lshzxe'\r\n"},
+		{"CONFIG SET notify-keyspace-events $gxKE", "+OK\r\n"},
+		{"CONFIG GET notify-keyspace-events", "*2\r\n$22\r\nnotify-keyspace-events\r\n$5\r\ng$xKE\r\n"},
+		{"CONFIG SET notify-keyspace-events KEA", "+OK\r\n"},
+		{"CONFIG GET notify-keyspace-events", "*2\r\n$22\r\nnotify-keyspace-events\r\n$3\r\nAKE\r\n"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.reply, ts.do(tt.command), tt.command)
+	}
+
+	require.Equal(t, "+OK\r\n", ts.do("SET k v EX 100"))
+	require.Equal(t, pmessage("__keyspace@0__:k", "set"), subscriber.read())
+	require.Equal(t, pmessage("__keyevent@0__:set", "k"), subscriber.read())
+	require.Equal(t, pmessage("__keyspace@0__:k", "expire"), subscriber.read())
+	require.Equal(t, pmessage("__keyevent@0__:expire", "k"), subscriber.read())
+
+	// the events of a transaction are published once it is done, on the selected database
+	client := ts.newClient()
+	defer CloseSession(client.conn)
+	for _, command := range []string{"SELECT 1", "MULTI", "MSET m 1 n 2", "DEL m", "DEL missing", "RENAME n o", "COPY o p DB 2"} {
+		client.do(command)
+	}
+	require.Equal(t, "*5\r\n+OK\r\n:1\r\n:0\r\n+OK\r\n:1\r\n", client.do("EXEC"))
+	for _, event := range []struct{ db, event, key string }{
+		{"1", "set", "m"}, {"1", "set", "n"}, {"1", "del", "m"},
+		{"1", "rename_from", "n"}, {"1", "rename_to", "o"}, {"2", "copy_to", "p"},
+	} {
+		require.Equal(t, pmessage("__keyspace@"+event.db+"__:"+event.key, event.event), subscriber.read())
+		require.Equal(t, pmessage("__keyevent@"+event.db+"__:"+event.event, event.key), subscriber.read())
+	}
+
+	// the keys deleted by the active expiry are notified
+	require.Equal(t, "+OK\r\n", ts.do("CONFIG SET notify-keyspace-events Ex active-expire-interval 10ms"))
+	require.Equal(t, "+OK\r\n", ts.do("PSETEX e 20 v"))
+	require.Equal(t, "+OK\r\n", ts.do("SET f v"))
+	require.Equal(t, pmessage("__keyevent@0__:expired", "e"), subscriber.read())
+
+	// a RESP3 client can run commands notifying itself
+	self := dial(t, addr)
+	self.do("HELLO 3")
+	require.Equal(t, ">3\r\n$9\r\nsubscribe\r\n$21\r\n__keyevent@0__:expire\r\n:1\r\n", self.do("SUBSCRIBE __keyevent@0__:expire"))
+	require.Equal(t, "+OK\r\n", ts.do("CONFIG SET notify-keyspace-events Eg"))
+	require.Equal(t, ":1\r\n", self.do("EXPIRE f 100"))
+	require.Equal(t, ">3\r\n$7\r\nmessage\r\n$21\r\n__keyevent@0__:expire\r\n$1\r\nf\r\n", self.read())
+}
+
+func TestKeyspaceNotificationsOfTypes(t *testing.T) {
+	ts := newTestServer(t)
+	addr := ts.listen()
+
+	subscriber := dial(t, addr)
+	subscriber.do("PSUBSCRIBE __keyevent@0__:*")
+
+	tests := []struct {
+		classes  string
+		commands []string
+		// events are the published events, as "<event> <key>"
+		events []string
+	}{
+		{
+			"hg",
+			[]string{"HSET h a 1 b 2", "HSETNX h a 3", "HSETNX h c 3", "HINCRBY h a 1", "HINCRBYFLOAT h a 0.5", "HDEL h x", "HDEL h a b c"},
+			[]string{"hset h", "hset h", "hincrby h", "hincrbyfloat h", "hdel h", "del h"},
+		},
+		{
+			"lg",
+			[]string{
+				"RPUSH l a b c", "LPUSHX missing x", "LPUSH l z", "LSET l 0 y", "LINSERT l BEFORE a w", "LREM l 0 w",
+				"LTRIM l 0 2", "RPOPLPUSH l l2", "LPOP l 2", "LPOP l", "BLPOP l2 0",
+			},
+			[]string{
+				"rpush l", "lpush l", "lset l", "linsert l", "lrem l", "ltrim l", "lpush l2", "rpop l",
+				"lpop l", "del l", "lpop l2", "del l2",
+			},
+		},
+		{
+			"sg",
+			[]string{"SADD s a b", "SADD s a", "SREM s a x", "SADD t b c", "SINTERSTORE d s t", "SPOP s", "SDIFFSTORE d s t", "SREM s b"},
+			[]string{"sadd s", "srem s", "sadd t", "sinterstore d", "spop s", "del s", "del d"},
+		},
+		{
+			"zg",
+			[]string{"ZADD z 1 a 2 b", "ZADD z NX 3 a", "ZADD z INCR 1 a", "ZINCRBY z 1 b", "ZREM z a x", "ZREM z b"},
+			[]string{"zadd z", "zincr z", "zincr z", "zrem z", "zrem z", "del z"},
+		},
+		{
+			"$",
+			[]string{"INCR n", "DECRBY n 2", "INCRBYFLOAT n 1.5", "APPEND str ab", "SETRANGE str 1 c"},
+			[]string{"incrby n", "incrby n", "incrbyfloat n", "append str", "setrange str"},
+		},
+		// the del events are generic ones
+		{"l", []string{"RPUSH f a", "RPOP f", "RPOP f"}, []string{"rpush f", "rpop f"}},
+	}
+	for _, tt := range tests {
+		require.Equal(t, "+OK\r\n", ts.do("CONFIG SET notify-keyspace-events E"+tt.classes))
+		for _, command := range tt.commands {
+			require.NotContains(t, ts.do(command), "ERR", command)
+		}
+
+		// a generic event of a key of its own marks the end of the events of the commands
+		require.Equal(t, "+OK\r\n", ts.do("CONFIG SET notify-keyspace-events Eg"))
+		require.Equal(t, "+OK\r\n", ts.do("SET end 1"))
+		require.Equal(t, ":1\r\n", ts.do("DEL end"))
+
+		var events []string
+		for {
+			// *4 $8 pmessage $15 <pattern> $<n> <channel> $<n> <key>
+			reply := strings.Split(subscriber.read(), "\r\n")
+			require.Len(t, reply, 10, reply)
+			event, key := strings.TrimPrefix(reply[6], "__keyevent@0__:"), reply[8]
+			if key == "end" {
+				break
+			}
+			events = append(events, event+" "+key)
+		}
+		require.Equal(t, tt.events, events, tt.classes)
+	}
+}
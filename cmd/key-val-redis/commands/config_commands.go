@@ -0,0 +1,367 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+	"KeyValor/config"
+	"KeyValor/internal/utils/globutils"
+)
+
+const (
+	ConfigSetUnknownErrorMsg = "ERR Unknown option or number of arguments for CONFIG SET - '%s'"
+	ConfigSetFailedErrorMsg  = "ERR CONFIG SET failed (possibly related to argument '%s') - %s"
+)
+
+// configParam is a parameter of CONFIG GET and CONFIG SET.
+type configParam struct {
+	get func(srv *Server) string
+	// set parses a value into the option to reconfigure the database with;
+	// it is nil for the parameters that can't change while the server runs
+	set func(value string) (KeyValor.Option, error)
+	// setServer parses a value of a parameter of the server srv, rather than of the databases,
+	// into the function that applies it
+	setServer func(srv *Server, value string) (apply func(), err error)
+}
+
+// configParams are the parameters of CONFIG GET and CONFIG SET: the options of the
+// databases (see config.DBCfgOpts), that all of them share, and those of the server.
+var configParams = map[string]configParam{
+	"dir": {get: func(srv *Server) string {
+		return srv.dbs.dir
+	}},
+	"databases": {get: func(srv *Server) string {
+		return strconv.Itoa(srv.dbs.Len())
+	}},
+	"compression": {get: func(srv *Server) string {
+		return srv.dbs.Get(0).Config().Compression.String()
+	}},
+	"read-only": {get: func(srv *Server) string {
+		return yesNo(srv.dbs.Get(0).Config().ReadOnly)
+	}},
+	"bind": {get: func(srv *Server) string {
+		return srv.config.Bind
+	}},
+	"port": {get: func(srv *Server) string {
+		return strconv.Itoa(srv.config.Port)
+	}},
+	"logdir": {get: func(srv *Server) string {
+		return srv.config.LogDir
+	}},
+	"loglevel": {get: func(srv *Server) string {
+		return srv.config.LogLevel.String()
+	}},
+	"storage-engine": {get: func(srv *Server) string {
+		return srv.config.StorageEngine
+	}},
+	"notify-keyspace-events": {
+		get: func(srv *Server) string {
+			return srv.config.NotifyKeyspaceEvents
+		},
+		setServer: func(srv *Server, value string) (func(), error) {
+			events, err := parseKeyspaceEvents(value)
+			if err != nil {
+				return nil, err
+			}
+			return func() {
+				srv.config.NotifyKeyspaceEvents = events.String()
+				srv.notifications.Store(uint32(events))
+			}, nil
+		},
+	},
+	"slowlog-log-slower-than": intConfigParam(
+		func(cfg *ServerConfig) *int64 { return &cfg.SlowlogLogSlowerThan }, -1,
+		func(srv *Server, n int64) { srv.slowLog.slowerThan.Store(n) }),
+	"slowlog-max-len": intConfigParam(
+		func(cfg *ServerConfig) *int64 { return &cfg.SlowlogMaxLen }, 0,
+		func(srv *Server, n int64) { srv.slowLog.maxLen.Store(n) }),
+	"latency-monitor-threshold": intConfigParam(
+		func(cfg *ServerConfig) *int64 { return &cfg.LatencyMonitorThreshold }, 0,
+		func(srv *Server, n int64) { srv.latency.threshold.Store(n) }),
+	"tls-port": {get: func(srv *Server) string {
+		return strconv.Itoa(srv.config.TLSPort)
+	}},
+	"tls-cert-file": {get: func(srv *Server) string {
+		return srv.config.TLSCertFile
+	}},
+	"tls-key-file": {get: func(srv *Server) string {
+		return srv.config.TLSKeyFile
+	}},
+	"tls-ca-cert-file": {get: func(srv *Server) string {
+		return srv.config.TLSCACertFile
+	}},
+	"tls-auth-clients": {get: func(srv *Server) string {
+		return srv.config.TLSAuthClients
+	}},
+
+	"sync-write-interval": durationParam(
+		func(cfg config.DBCfgOpts) time.Duration { return cfg.SyncWriteInterval },
+		KeyValor.WithSyncWriteInterval, parseInterval),
+	"compact-interval": durationParam(
+		func(cfg config.DBCfgOpts) time.Duration { return cfg.CompactInterval },
+		KeyValor.WithCompactInterval, parseInterval),
+	"check-file-size-interval": durationParam(
+		func(cfg config.DBCfgOpts) time.Duration { return cfg.CheckFileSizeInterval },
+		KeyValor.WithCheckFileSizeInterval, parseInterval),
+	"active-expire-interval": durationParam(
+		func(cfg config.DBCfgOpts) time.Duration { return cfg.ActiveExpireInterval },
+		KeyValor.WithActiveExpireInterval, parseInterval),
+	"default-ttl": durationParam(
+		func(cfg config.DBCfgOpts) time.Duration { return cfg.DefaultTTL },
+		KeyValor.WithDefaultTTL, parseDuration),
+	"sync-policy": {
+		get: func(srv *Server) string {
+			return srv.dbs.Get(0).Config().SyncPolicy.String()
+		},
+		set: func(value string) (KeyValor.Option, error) {
+			policy, err := config.ParseSyncPolicy(strings.ToLower(value))
+			if err != nil {
+				return nil, errors.New("argument must be 'interval' or 'always'")
+			}
+			return KeyValor.WithSyncPolicy(policy), nil
+		},
+	},
+	"max-active-file-size": {
+		get: func(srv *Server) string {
+			return strconv.FormatInt(srv.dbs.Get(0).Config().MaxActiveFileSize, 10)
+		},
+		set: func(value string) (KeyValor.Option, error) {
+			size, err := parseMemory(value)
+			if err != nil {
+				return nil, err
+			}
+			return KeyValor.WithMaxActiveFileSize(size), nil
+		},
+	},
+}
+
+// intConfigParam returns a parameter for an integer field of the server config, of at least
+// minimum; enable applies a new value to the running server.
+func intConfigParam(
+	field func(cfg *ServerConfig) *int64,
+	minimum int64,
+	enable func(srv *Server, n int64),
+) configParam {
+	return configParam{
+		get: func(srv *Server) string {
+			return strconv.FormatInt(*field(srv.config), 10)
+		},
+		setServer: func(srv *Server, value string) (func(), error) {
+			n, err := parseIntParam(value, minimum)
+			if err != nil {
+				return nil, err
+			}
+			return func() {
+				*field(srv.config) = n
+				enable(srv, n)
+			}, nil
+		},
+	}
+}
+
+// durationParam returns a parameter for a duration option, set in seconds or as a Go
+// duration (e.g. "90s", "2h").
+func durationParam(
+	field func(cfg config.DBCfgOpts) time.Duration,
+	option func(time.Duration) KeyValor.Option,
+	parse func(value string) (time.Duration, error),
+) configParam {
+	return configParam{
+		get: func(srv *Server) string {
+			return field(srv.dbs.Get(0).Config()).String()
+		},
+		set: func(value string) (KeyValor.Option, error) {
+			d, err := parse(value)
+			if err != nil {
+				return nil, err
+			}
+			return option(d), nil
+		},
+	}
+}
+
+// parseDuration parses a duration in seconds, or a Go duration.
+func parseDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		value = strconv.FormatInt(seconds, 10) + "s"
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.New("argument must be a duration")
+	}
+	if d < 0 {
+		return 0, errors.New("argument must be a positive duration")
+	}
+	return d, nil
+}
+
+// parseInterval parses the interval of a background task, that can't be 0.
+func parseInterval(value string) (time.Duration, error) {
+	d, err := parseDuration(value)
+	if err == nil && d == 0 {
+		return 0, errors.New("argument must be a positive duration")
+	}
+	return d, err
+}
+
+// parseMemory parses a size in bytes, with an optional unit like in redis.conf
+// (k, kb, m, mb, g, gb; case insensitive).
+func parseMemory(value string) (int64, error) {
+	lower := strings.ToLower(value)
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+	} {
+		if number, ok := strings.CutSuffix(lower, unit.suffix); ok {
+			lower, multiplier = number, unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, errors.New("argument must be a memory value")
+	}
+	return n * multiplier, nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// Config implements CONFIG GET, SET, REWRITE and RESETSTAT.
+var Config CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	switch subcommand := strings.ToLower(string(args[1])); {
+	case subcommand == "get" && len(args) >= 3:
+		mu.RLock()
+		defer mu.RUnlock()
+
+		configGet(conn, args[2:], serverOf(conn))
+
+	case subcommand == "set" && len(args) >= 4 && len(args)%2 == 0:
+		mu.Lock()
+		defer mu.Unlock()
+
+		configSet(conn, args[2:], serverOf(conn))
+
+	case subcommand == "rewrite" && len(args) == 2:
+		mu.RLock()
+		defer mu.RUnlock()
+
+		srv := serverOf(conn)
+		if srv.config.File == "" {
+			conn.WriteError(NoConfigFileErrorMsg)
+			return
+		}
+		if err := rewriteConfigFile(srv); err != nil {
+			conn.WriteError("ERR Rewriting config file: " + err.Error())
+			return
+		}
+		conn.WriteString("OK")
+
+	case subcommand == "resetstat" && len(args) == 2:
+		serverOf(conn).stats.reset()
+		conn.WriteString("OK")
+
+	default:
+		conn.WriteError(fmt.Sprintf(UnknownSubcommandErrorMsg, string(args[1]), "CONFIG"))
+	}
+}
+
+// configGet replies with the parameters matching the glob patterns, and their values.
+func configGet(conn redcon.Conn, patterns [][]byte, srv *Server) {
+	var names []string
+	for name := range configParams {
+		for _, pattern := range patterns {
+			if globutils.Match(strings.ToLower(string(pattern)), name) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+
+	writeMap(conn, len(names))
+	for _, name := range names {
+		conn.WriteBulkString(name)
+		conn.WriteBulkString(configParams[name].get(srv))
+	}
+}
+
+// configSet sets the parameter-value pairs of srv and of every database: all of them, or none
+// if one of them is invalid.
+func configSet(conn redcon.Conn, pairs [][]byte, srv *Server) {
+	options := make([]KeyValor.Option, 0, len(pairs)/2)
+	var applies []func()
+	seen := make(map[string]bool)
+
+	for i := 0; i < len(pairs); i += 2 {
+		name, value := strings.ToLower(string(pairs[i])), string(pairs[i+1])
+
+		param, ok := configParams[name]
+		switch {
+		case !ok:
+			conn.WriteError(fmt.Sprintf(ConfigSetUnknownErrorMsg, string(pairs[i])))
+			return
+		case seen[name]:
+			conn.WriteError(fmt.Sprintf(ConfigSetFailedErrorMsg, string(pairs[i]), "duplicate parameter"))
+			return
+		case param.set == nil && param.setServer == nil:
+			conn.WriteError(fmt.Sprintf(ConfigSetFailedErrorMsg, string(pairs[i]), "can't set immutable config"))
+			return
+		}
+		seen[name] = true
+
+		if param.setServer != nil {
+			apply, err := param.setServer(srv, value)
+			if err != nil {
+				conn.WriteError(fmt.Sprintf(ConfigSetFailedErrorMsg, string(pairs[i]), err.Error()))
+				return
+			}
+			applies = append(applies, apply)
+			continue
+		}
+		option, err := param.set(value)
+		if err != nil {
+			conn.WriteError(fmt.Sprintf(ConfigSetFailedErrorMsg, string(pairs[i]), err.Error()))
+			return
+		}
+		options = append(options, option)
+	}
+
+	for _, db := range srv.dbs.all() {
+		if err := db.Configure(options...); err != nil {
+			writeDBError(conn, err)
+			return
+		}
+	}
+	for _, apply := range applies {
+		apply()
+	}
+	conn.WriteString("OK")
+}
@@ -0,0 +1,342 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+	"KeyValor/internal/utils/fileutils"
+)
+
+const (
+	DBIndexNotIntegerErrorMsg = "ERR value is not an integer or out of range"
+	DBIndexOutOfRangeErrorMsg = "ERR DB index is out of range"
+	InvalidFirstDBErrorMsg    = "ERR invalid first DB index"
+	InvalidSecondDBErrorMsg   = "ERR invalid second DB index"
+	SameObjectErrorMsg        = "ERR source and destination objects are the same"
+
+	// databasesFile is the file of the directory of the databases that lists their
+	// sub-directories by index, once SWAPDB swapped some of them
+	databasesFile = "databases"
+)
+
+// Databases are the logical databases of the server, that each client selects with SELECT
+// (database 0 by default).
+type Databases struct {
+	// dir is the directory of the sub-directories of the databases
+	dir string
+
+	mu  sync.RWMutex
+	dbs []*KeyValor.KeyValorDatabase
+	// dirs are the sub-directories of the databases by index, followed by those of the
+	// databases beyond n that a previous run had, so that they keep their data
+	dirs []string
+
+	// server is the server of the databases, set by NewServer: their keyspace hits and misses,
+	// the keys they expire and the latencies of their background tasks are reported to it
+	server atomic.Pointer[Server]
+}
+
+// OpenDatabases opens n databases, each one in its own sub-directory of dir (db0, db1, ...,
+// unless SWAPDB swapped them), with the same options. Their lookups are counted by INFO stats,
+// the keys they expire are notified, see notify-keyspace-events, and their background tasks
+// are recorded by LATENCY.
+func OpenDatabases(dir string, n int, options ...KeyValor.Option) (*Databases, error) {
+	dirs, err := readDatabaseDirs(dir, n)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Databases{dir: dir, dirs: dirs}
+	for i := 0; i < n; i++ {
+		dbDir := filepath.Join(dir, dirs[i])
+		if err := os.MkdirAll(dbDir, fs.ModePerm); err != nil {
+			d.Shutdown()
+			return nil, err
+		}
+
+		listener := &expiryListener{dbs: d}
+		dbOptions := append([]KeyValor.Option{KeyValor.WithDirectory(dbDir)}, options...)
+		db, err := KeyValor.NewKeyValorDB(append(dbOptions, KeyValor.WithInterceptors(d.keyspaceStats),
+			KeyValor.WithExpiryListener(listener.expired), KeyValor.WithLatencyListener(d.recordLatency))...)
+		if err != nil {
+			d.Shutdown()
+			return nil, fmt.Errorf("cannot open database %d: %w", i, err)
+		}
+		listener.db.Store(db)
+		d.dbs = append(d.dbs, db)
+	}
+	return d, nil
+}
+
+// Len returns the number of databases.
+func (d *Databases) Len() int {
+	return len(d.dbs)
+}
+
+// Get returns the database of the given index.
+func (d *Databases) Get(index int) *KeyValor.KeyValorDatabase {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.dbs[index]
+}
+
+// indexOf returns the index of the database db, or -1 if it isn't one of them.
+func (d *Databases) indexOf(db *KeyValor.KeyValorDatabase) int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for i := range d.dbs {
+		if d.dbs[i] == db {
+			return i
+		}
+	}
+	return -1
+}
+
+// all returns the databases, by index.
+func (d *Databases) all() []*KeyValor.KeyValorDatabase {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return append([]*KeyValor.KeyValorDatabase(nil), d.dbs...)
+}
+
+// swap swaps two databases: the clients that selected one of them now use the other one.
+// The new order of their sub-directories is persisted first, so that the swap survives a
+// restart.
+func (d *Databases) swap(i, j int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if i == j {
+		return nil
+	}
+
+	dirs := slices.Clone(d.dirs)
+	dirs[i], dirs[j] = dirs[j], dirs[i]
+	if err := writeDatabaseDirs(d.dir, dirs); err != nil {
+		return fmt.Errorf("cannot persist the swap of the databases: %w", err)
+	}
+
+	d.dirs = dirs
+	d.dbs[i], d.dbs[j] = d.dbs[j], d.dbs[i]
+	return nil
+}
+
+// readDatabaseDirs returns the sub-directories of dir of (at least) n databases, by index:
+// those listed in databasesFile, if any, followed by db<index> for the next ones.
+func readDatabaseDirs(dir string, n int) ([]string, error) {
+	path := filepath.Join(dir, databasesFile)
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// the sub-directories were swapped, but are still db0 to db<len(dirs)-1>
+	dirs := strings.Fields(string(content))
+	seen := make([]bool, len(dirs))
+	for _, name := range dirs {
+		index, err := strconv.Atoi(strings.TrimPrefix(name, "db"))
+		if err != nil || index < 0 || index >= len(dirs) || seen[index] || name != fmt.Sprintf("db%d", index) {
+			return nil, fmt.Errorf("invalid %s: unexpected database directory %q", path, name)
+		}
+		seen[index] = true
+	}
+
+	for i := len(dirs); i < n; i++ {
+		dirs = append(dirs, fmt.Sprintf("db%d", i))
+	}
+	return dirs, nil
+}
+
+// writeDatabaseDirs atomically replaces the databasesFile of dir with dirs.
+func writeDatabaseDirs(dir string, dirs []string) error {
+	return fileutils.AtomicReplaceFile(filepath.Join(dir, databasesFile), func(f *os.File) error {
+		_, err := f.WriteString(strings.Join(dirs, "\n") + "\n")
+		return err
+	})
+}
+
+// stats returns the statistics of all the databases: the sums of their counters, their
+// oldest checkpoint (when all of them were last persisted), and their last compaction.
+func (d *Databases) stats() KeyValor.Stats {
+	var total KeyValor.Stats
+	for i, db := range d.all() {
+		stats := db.Stats()
+		total.Keys += stats.Keys
+		total.KeysWithExpiry += stats.KeysWithExpiry
+		total.DataFiles += stats.DataFiles
+		total.DiskBytes += stats.DiskBytes
+		total.ChangesSinceCheckpoint += stats.ChangesSinceCheckpoint
+		total.Checkpoints += stats.Checkpoints
+		total.Compactions += stats.Compactions
+		total.FileRotations += stats.FileRotations
+
+		if i == 0 || stats.LastCheckpoint.Before(total.LastCheckpoint) {
+			total.LastCheckpoint = stats.LastCheckpoint
+		}
+		if stats.LastCompaction.After(total.LastCompaction) {
+			total.LastCompaction = stats.LastCompaction
+		}
+	}
+	return total
+}
+
+// checkpoint persists the index of every database, see KeyValor.KeyValorDatabase.Checkpoint.
+func (d *Databases) checkpoint() error {
+	for _, db := range d.all() {
+		if err := db.Checkpoint(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown shuts every database down.
+func (d *Databases) Shutdown() error {
+	var errs []error
+	for _, db := range d.all() {
+		errs = append(errs, db.Shutdown())
+	}
+	return errors.Join(errs...)
+}
+
+// ShutdownWithoutCheckpoint shuts every database down, without persisting their index: they
+// reopen without the writes made since their last checkpoint.
+func (d *Databases) ShutdownWithoutCheckpoint() error {
+	var errs []error
+	for _, db := range d.all() {
+		errs = append(errs, db.ShutdownWithoutCheckpoint())
+	}
+	return errors.Join(errs...)
+}
+
+// parseDBIndex parses the index of a database among dbs, or returns the error to reply.
+func parseDBIndex(arg []byte, dbs *Databases, notIntegerMsg string) (int, string) {
+	index, err := strconv.Atoi(string(arg))
+	if err != nil {
+		return 0, notIntegerMsg
+	}
+	if index < 0 || index >= dbs.Len() {
+		return 0, DBIndexOutOfRangeErrorMsg
+	}
+	return index, ""
+}
+
+// Select implements SELECT index: the next commands of the client use the database index.
+var Select CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	s := sessionOf(conn)
+	index, errMsg := parseDBIndex(args[1], s.databases, DBIndexNotIntegerErrorMsg)
+	if errMsg != "" {
+		conn.WriteError(errMsg)
+		return
+	}
+
+	s.db = index
+	s.updateInfo(func(info *clientInfo) { info.db = index })
+	conn.WriteString("OK")
+}
+
+// SwapDB implements SWAPDB index1 index2: the clients that selected one of the databases
+// now use the other one. Like in Redis, their watches on either database become dirty, and
+// their blocked commands try again on the database they now use.
+var SwapDB CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	dbs := sessionOf(conn).databases
+	first, errMsg := parseDBIndex(args[1], dbs, InvalidFirstDBErrorMsg)
+	if errMsg != "" {
+		conn.WriteError(errMsg)
+		return
+	}
+	second, errMsg := parseDBIndex(args[2], dbs, InvalidSecondDBErrorMsg)
+	if errMsg != "" {
+		conn.WriteError(errMsg)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := dbs.swap(first, second); err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	for _, swapped := range []*KeyValor.KeyValorDatabase{dbs.Get(first), dbs.Get(second)} {
+		swapped.TouchWatches()
+		serverOf(conn).listWaiters.wakeAll(swapped)
+	}
+	conn.WriteString("OK")
+}
+
+// Move implements MOVE key db: it moves key, with its expiry, from the selected database to
+// the database db, unless db already has it.
+var Move CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	index, errMsg := parseDBIndex(args[2], sessionOf(conn).databases, DBIndexNotIntegerErrorMsg)
+	if errMsg != "" {
+		conn.WriteError(errMsg)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	target := sessionOf(conn).databases.Get(index)
+	if target == db {
+		conn.WriteError(SameObjectErrorMsg)
+		return
+	}
+
+	key := string(args[1])
+	moved, err := db.Move(key, target)
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	if moved {
+		wakeListWaiters(conn, target, key)
+		conn.WriteInt(1)
+	} else {
+		conn.WriteInt(0)
+	}
+}
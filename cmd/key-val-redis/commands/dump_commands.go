@@ -0,0 +1,362 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+)
+
+const (
+	BusyKeyErrorMsg         = "BUSYKEY Target key name already exists."
+	BadDataFormatErrorMsg   = "ERR Bad data format"
+	InvalidTTLErrorMsg      = "ERR Invalid TTL value, must be >= 0"
+	MigrateKeysErrorMsg     = "ERR When using MIGRATE KEYS option, the key argument must be set to the empty string"
+	MigrateConnectErrorMsg  = "IOERR error or timeout connecting to the client"
+	MigrateWriteErrorMsg    = "IOERR error or timeout writing to target instance"
+	MigrateReadErrorMsg     = "IOERR error or timeout reading to target instance"
+	MigrateTargetErrorMsg   = "ERR Target instance replied with error: %s"
+	defaultMigrateTimeoutMs = 1000
+)
+
+// Dump implements DUMP key: the serialization of the value of the key (without its TTL),
+// or null if it doesn't exist.
+var Dump CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	mu.RLock()
+	payload, _, err := db.Dump(string(args[1]))
+	mu.RUnlock()
+	if err != nil && !isMissingKey(err) {
+		writeDBError(conn, err)
+		return
+	}
+	writeBulkOrNull(conn, payload, err == nil)
+}
+
+// Restore implements RESTORE key ttl serialized-value [REPLACE] [ABSTTL]: the key expires
+// after ttl milliseconds, or at the unix time ttl in milliseconds with ABSTTL (never, if ttl
+// is 0).
+var Restore CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 4 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	ttl, ok := parseInt(args[2])
+	if !ok {
+		conn.WriteError(NotIntegerErrorMsg)
+		return
+	}
+	if ttl < 0 {
+		conn.WriteError(InvalidTTLErrorMsg)
+		return
+	}
+
+	replace, absolute := false, false
+	for _, arg := range args[4:] {
+		switch strings.ToLower(string(arg)) {
+		case "replace":
+			replace = true
+		case "absttl":
+			absolute = true
+		default:
+			conn.WriteError(SyntaxErrorMsg)
+			return
+		}
+	}
+
+	var expiry time.Time
+	switch {
+	case ttl == 0:
+	case absolute:
+		expiry = time.UnixMilli(ttl)
+	default:
+		expiry = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+	}
+
+	key := string(args[1])
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	exists, err := keyExists(db, key)
+	if err == nil {
+		err = db.Restore(key, args[3], expiry, replace)
+	}
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteString("OK")
+
+	// an expiry in the past only deletes the key
+	if !expiry.IsZero() && !expiry.After(time.Now()) {
+		if exists {
+			notifyKeyspaceEvent(conn, notifyGeneric, "del", key)
+		}
+		return
+	}
+	notifyKeyspaceEvent(conn, notifyGeneric, "restore", key)
+	wakeListWaiters(conn, db, key)
+}
+
+// migrateOptions are the arguments of MIGRATE.
+type migrateOptions struct {
+	addr    string
+	db      int64
+	timeout time.Duration
+	copy    bool
+	replace bool
+	// auth are the arguments of the AUTH command sent to the target, if any
+	auth [][]byte
+	keys []string
+}
+
+// parseMigrateOptions parses MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE]
+// [AUTH password | AUTH2 username password] [KEYS key [key ...]].
+func parseMigrateOptions(args [][]byte) (migrateOptions, string) {
+	opts := migrateOptions{
+		addr: net.JoinHostPort(string(args[1]), string(args[2])),
+		keys: []string{string(args[3])},
+	}
+
+	db, ok := parseInt(args[4])
+	if !ok {
+		return opts, NotIntegerErrorMsg
+	}
+	timeoutMs, ok := parseInt(args[5])
+	if !ok {
+		return opts, NotIntegerErrorMsg
+	}
+	if timeoutMs <= 0 {
+		timeoutMs = defaultMigrateTimeoutMs
+	}
+	opts.db, opts.timeout = db, time.Duration(timeoutMs)*time.Millisecond
+
+	for i := 6; i < len(args); i++ {
+		switch option := strings.ToLower(string(args[i])); {
+		case option == "copy":
+			opts.copy = true
+		case option == "replace":
+			opts.replace = true
+		case option == "auth" && i+1 < len(args):
+			opts.auth = args[i+1 : i+2]
+			i++
+		case option == "auth2" && i+2 < len(args):
+			opts.auth = args[i+1 : i+3]
+			i += 2
+		case option == "keys":
+			if len(args[3]) != 0 {
+				return opts, MigrateKeysErrorMsg
+			}
+			opts.keys = opts.keys[:0]
+			for _, key := range args[i+1:] {
+				opts.keys = append(opts.keys, string(key))
+			}
+			return opts, ""
+		default:
+			return opts, SyntaxErrorMsg
+		}
+	}
+	return opts, ""
+}
+
+// migrateKeys returns the keys of MIGRATE, for the ACL checks, as parseMigrateOptions parses
+// them: the operands of the options (e.g. an AUTH password "keys") aren't keywords. The key
+// argument is a key whenever it isn't empty, even if the options are invalid.
+func migrateKeys(args [][]byte) [][]byte {
+	if len(args) < 4 {
+		return nil
+	}
+	// KEYS needs an empty key argument: with another one, the key argument is the only key
+	if len(args[3]) > 0 || len(args) < 6 {
+		return args[3:4]
+	}
+
+	opts, errMsg := parseMigrateOptions(args)
+	if errMsg != "" {
+		return args[3:4]
+	}
+	keys := make([][]byte, 0, len(opts.keys))
+	for _, key := range opts.keys {
+		keys = append(keys, []byte(key))
+	}
+	return keys
+}
+
+// keyDump is the serialization of a key, for MIGRATE.
+type keyDump struct {
+	key     string
+	payload []byte
+	expiry  time.Time
+}
+
+// Migrate implements MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE]
+// [AUTH password | AUTH2 username password] [KEYS key [key ...]]: the keys are restored on
+// the target instance (KeyValor or Redis), then deleted unless COPY is given. The server
+// runs no other command until the target replied, or the timeout, in milliseconds, elapsed.
+var Migrate CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 6 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	opts, errMsg := parseMigrateOptions(args)
+	if errMsg != "" {
+		conn.WriteError(errMsg)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var dumps []keyDump
+	for _, key := range opts.keys {
+		payload, expiry, err := db.Dump(key)
+		if isMissingKey(err) {
+			continue
+		}
+		if err != nil {
+			writeDBError(conn, err)
+			return
+		}
+		dumps = append(dumps, keyDump{key: key, payload: payload, expiry: expiry})
+	}
+	if len(dumps) == 0 {
+		conn.WriteString("NOKEY")
+		return
+	}
+
+	restored, errMsg := pushDumps(opts, dumps)
+	if !opts.copy {
+		for _, key := range restored {
+			if err := db.Delete(key); err != nil {
+				writeDBError(conn, err)
+				return
+			}
+			notifyKeyspaceEvent(conn, notifyGeneric, "del", key)
+		}
+	}
+	if errMsg != "" {
+		conn.WriteError(errMsg)
+		return
+	}
+	conn.WriteString("OK")
+}
+
+// pushDumps restores the dumps on the target of MIGRATE, in one pipeline, and returns the keys
+// it restored, and the error replied to the client, if any.
+func pushDumps(opts migrateOptions, dumps []keyDump) ([]string, string) {
+	target, err := net.DialTimeout("tcp", opts.addr, opts.timeout)
+	if err != nil {
+		return nil, MigrateConnectErrorMsg
+	}
+	defer target.Close()
+
+	var buf []byte
+	if opts.auth != nil {
+		buf = appendCommand(buf, append([][]byte{[]byte("AUTH")}, opts.auth...)...)
+	}
+	buf = appendCommand(buf, []byte("SELECT"), strconv.AppendInt(nil, opts.db, 10))
+	for _, dump := range dumps {
+		// the TTL is relative, for a target whose clock differs
+		var ttl int64
+		if !dump.expiry.IsZero() {
+			ttl = max(time.Until(dump.expiry).Milliseconds(), 1)
+		}
+		restore := [][]byte{[]byte("RESTORE"), []byte(dump.key), strconv.AppendInt(nil, ttl, 10), dump.payload}
+		if opts.replace {
+			restore = append(restore, []byte("REPLACE"))
+		}
+		buf = appendCommand(buf, restore...)
+	}
+
+	_ = target.SetDeadline(time.Now().Add(opts.timeout))
+	if _, err := target.Write(buf); err != nil {
+		return nil, MigrateWriteErrorMsg
+	}
+
+	rd := bufio.NewReader(target)
+	replies := len(dumps) + 1
+	if opts.auth != nil {
+		replies++
+	}
+	var restored []string
+	var errMsg string
+	for i := 0; i < replies; i++ {
+		_ = target.SetReadDeadline(time.Now().Add(opts.timeout))
+		replyErr, err := readSimpleReply(rd)
+		if err != nil {
+			return restored, MigrateReadErrorMsg
+		}
+
+		// the replies of AUTH and SELECT come before those of the keys
+		dump := i - (replies - len(dumps))
+		switch {
+		case replyErr != "" && dump < 0:
+			return nil, fmt.Sprintf(MigrateTargetErrorMsg, replyErr)
+		case replyErr != "":
+			if errMsg == "" {
+				errMsg = fmt.Sprintf(MigrateTargetErrorMsg, replyErr)
+			}
+		case dump >= 0:
+			restored = append(restored, dumps[dump].key)
+		}
+	}
+	return restored, errMsg
+}
+
+// appendCommand appends a command in the RESP format of the requests.
+func appendCommand(buf []byte, args ...[]byte) []byte {
+	buf = redcon.AppendArray(buf, len(args))
+	for _, arg := range args {
+		buf = redcon.AppendBulk(buf, arg)
+	}
+	return buf
+}
+
+// readSimpleReply reads a reply of the target of MIGRATE: a simple string, an integer, or an
+// error, whose message is returned.
+func readSimpleReply(rd *bufio.Reader) (errMsg string, err error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+	switch {
+	case strings.HasPrefix(line, "-"):
+		return line[1:], nil
+	case strings.HasPrefix(line, "+"), strings.HasPrefix(line, ":"):
+		return "", nil
+	default:
+		return "", errors.New("unexpected reply " + strconv.Quote(line))
+	}
+}
@@ -0,0 +1,519 @@
+package commands
+
+import (
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+)
+
+const (
+	HashValueNotIntegerErrorMsg = "ERR hash value is not an integer"
+	HashValueNotFloatErrorMsg   = "ERR hash value is not a float"
+	ValueOutOfRangeErrorMsg     = "ERR value is out of range"
+)
+
+var HSet CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 4 || len(args)%2 != 0 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	added := 0
+
+	mu.Lock()
+	err := db.UpdateHash(string(args[1]), func(h *KeyValor.Hash) error {
+		for i := 2; i < len(args); i += 2 {
+			if h.Set(string(args[i]), args[i+1]) {
+				added++
+			}
+		}
+		return nil
+	})
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+
+	if strings.EqualFold(string(args[0]), "hmset") {
+		conn.WriteString("OK")
+	} else {
+		conn.WriteInt(added)
+	}
+	notifyKeyspaceEvent(conn, notifyHash, "hset", string(args[1]))
+}
+
+var HSetNX CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 4 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	added := false
+
+	mu.Lock()
+	err := db.UpdateHash(string(args[1]), func(h *KeyValor.Hash) error {
+		if _, exists := h.Get(string(args[2])); !exists {
+			added = h.Set(string(args[2]), args[3])
+		}
+		return nil
+	})
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	writeBool(conn, added)
+	if added {
+		notifyKeyspaceEvent(conn, notifyHash, "hset", string(args[1]))
+	}
+}
+
+var HGet CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	h, ok := getHash(conn, mu, db, args[1])
+	if !ok {
+		return
+	}
+
+	value, exists := h.Get(string(args[2]))
+	writeBulkOrNull(conn, value, exists)
+}
+
+var HMGet CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	h, ok := getHash(conn, mu, db, args[1])
+	if !ok {
+		return
+	}
+
+	conn.WriteArray(len(args) - 2)
+	for _, field := range args[2:] {
+		value, exists := h.Get(string(field))
+		writeBulkOrNull(conn, value, exists)
+	}
+}
+
+var HGetAll CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	h, ok := getHash(conn, mu, db, args[1])
+	if !ok {
+		return
+	}
+
+	fields := h.Fields()
+	writeMap(conn, len(fields))
+	for _, field := range fields {
+		value, _ := h.Get(field)
+		conn.WriteBulkString(field)
+		conn.WriteBulk(value)
+	}
+}
+
+var HKeys CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	h, ok := getHash(conn, mu, db, args[1])
+	if !ok {
+		return
+	}
+	WriteRedisArray(conn, h.Fields())
+}
+
+var HVals CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	h, ok := getHash(conn, mu, db, args[1])
+	if !ok {
+		return
+	}
+
+	conn.WriteArray(h.Len())
+	for _, field := range h.Fields() {
+		value, _ := h.Get(field)
+		conn.WriteBulk(value)
+	}
+}
+
+var HDel CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	var (
+		deleted int
+		emptied bool
+	)
+
+	mu.Lock()
+	err := db.UpdateHash(string(args[1]), func(h *KeyValor.Hash) error {
+		for _, field := range args[2:] {
+			if h.Delete(string(field)) {
+				deleted++
+			}
+		}
+		emptied = h.Len() == 0
+		return nil
+	})
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteInt(deleted)
+	if deleted > 0 {
+		notifyCollectionEvent(conn, notifyHash, "hdel", string(args[1]), emptied)
+	}
+}
+
+var HExists CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	h, ok := getHash(conn, mu, db, args[1])
+	if !ok {
+		return
+	}
+
+	_, exists := h.Get(string(args[2]))
+	writeBool(conn, exists)
+}
+
+var HLen CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	h, ok := getHash(conn, mu, db, args[1])
+	if !ok {
+		return
+	}
+	conn.WriteInt(h.Len())
+}
+
+var HStrLen CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	h, ok := getHash(conn, mu, db, args[1])
+	if !ok {
+		return
+	}
+
+	value, _ := h.Get(string(args[2]))
+	conn.WriteInt(len(value))
+}
+
+var HIncrBy CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 4 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	delta, ok := parseInt(args[3])
+	if !ok {
+		conn.WriteError(NotIntegerErrorMsg)
+		return
+	}
+
+	var result int64
+
+	mu.Lock()
+	err := db.UpdateHash(string(args[1]), func(h *KeyValor.Hash) error {
+		var current int64
+		if value, exists := h.Get(string(args[2])); exists {
+			if current, ok = parseInt(value); !ok {
+				return replyError(HashValueNotIntegerErrorMsg)
+			}
+		}
+
+		if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+			return replyError(IncrOverflowErrorMsg)
+		}
+
+		result = current + delta
+		h.Set(string(args[2]), strconv.AppendInt(nil, result, 10))
+		return nil
+	})
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteInt64(result)
+	notifyKeyspaceEvent(conn, notifyHash, "hincrby", string(args[1]))
+}
+
+var HIncrByFloat CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 4 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	delta, ok := parseFloat(args[3])
+	if !ok {
+		conn.WriteError(NotFloatErrorMsg)
+		return
+	}
+
+	var result string
+
+	mu.Lock()
+	err := db.UpdateHash(string(args[1]), func(h *KeyValor.Hash) error {
+		var current float64
+		if value, exists := h.Get(string(args[2])); exists {
+			if current, ok = parseFloat(value); !ok {
+				return replyError(HashValueNotFloatErrorMsg)
+			}
+		}
+
+		sum := current + delta
+		if math.IsNaN(sum) || math.IsInf(sum, 0) {
+			return replyError(NaNOrInfinityErrorMsg)
+		}
+
+		result = strconv.FormatFloat(sum, 'f', -1, 64)
+		h.Set(string(args[2]), []byte(result))
+		return nil
+	})
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteBulkString(result)
+	notifyKeyspaceEvent(conn, notifyHash, "hincrbyfloat", string(args[1]))
+}
+
+// HRandField implements HRANDFIELD key [count [WITHVALUES]]
+var HRandField CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 2 || len(args) > 4 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	var (
+		count      int64
+		withCount  = len(args) >= 3
+		withValues = len(args) == 4
+		ok         bool
+	)
+	if withCount {
+		if count, ok = parseInt(args[2]); !ok {
+			conn.WriteError(NotIntegerErrorMsg)
+			return
+		}
+		if count < -math.MaxInt32 {
+			conn.WriteError(ValueOutOfRangeErrorMsg)
+			return
+		}
+	}
+	if withValues && !strings.EqualFold(string(args[3]), "withvalues") {
+		conn.WriteError(SyntaxErrorMsg)
+		return
+	}
+
+	h, ok := getHash(conn, mu, db, args[1])
+	if !ok {
+		return
+	}
+	fields := h.Fields()
+
+	if !withCount {
+		if len(fields) == 0 {
+			writeNull(conn)
+			return
+		}
+		conn.WriteBulkString(fields[rand.IntN(len(fields))])
+		return
+	}
+
+	writeHashFields(conn, h, randomElements(fields, count), withValues)
+}
+
+// HScan implements HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES]
+var HScan CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	opts, errMsg := parseScanOptions(args[2:], true, false)
+	if errMsg != "" {
+		conn.WriteError(errMsg)
+		return
+	}
+
+	h, ok := getHash(conn, mu, db, args[1])
+	if !ok {
+		return
+	}
+
+	page, next := scanSorted(h.Fields(), opts)
+
+	conn.WriteArray(2)
+	conn.WriteBulkString(strconv.FormatUint(next, 10))
+	writeHashFields(conn, h, page, !opts.noValues)
+}
+
+// getHash reads the hash at key, or replies with the error and returns false.
+func getHash(conn redcon.Conn, mu *sync.RWMutex, db *KeyValor.KeyValorDatabase, key []byte) (*KeyValor.Hash, bool) {
+	mu.RLock()
+	h, err := db.GetHash(string(key))
+	mu.RUnlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return nil, false
+	}
+	return h, true
+}
+
+// writeHashFields replies with the given fields of h, each one followed by its value if withValues is set.
+func writeHashFields(conn redcon.Conn, h *KeyValor.Hash, fields []string, withValues bool) {
+	if !withValues {
+		WriteRedisArray(conn, fields)
+		return
+	}
+
+	conn.WriteArray(2 * len(fields))
+	for _, field := range fields {
+		value, _ := h.Get(field)
+		conn.WriteBulkString(field)
+		conn.WriteBulk(value)
+	}
+}
+
+// randomElements picks count distinct elements at random, or -count elements
+// that may repeat if count is negative (the semantics of HRANDFIELD, SRANDMEMBER, ...).
+func randomElements(elements []string, count int64) []string {
+	if len(elements) == 0 || count == 0 {
+		return []string{}
+	}
+
+	if count < 0 {
+		picked := make([]string, 0, min(-count, 1<<20))
+		for i := int64(0); i < -count; i++ {
+			picked = append(picked, elements[rand.IntN(len(elements))])
+		}
+		return picked
+	}
+
+	picked := append([]string(nil), elements...)
+	rand.Shuffle(len(picked), func(i, j int) {
+		picked[i], picked[j] = picked[j], picked[i]
+	})
+	return picked[:min(count, int64(len(picked)))]
+}
+
+func writeBool(conn redcon.Conn, b bool) {
+	if b {
+		conn.WriteInt(1)
+	} else {
+		conn.WriteInt(0)
+	}
+}
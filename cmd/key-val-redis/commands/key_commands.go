@@ -0,0 +1,422 @@
+package commands
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+)
+
+const (
+	ExpireNXErrorMsg          = "ERR NX and XX, GT or LT options at the same time are not compatible"
+	ExpireGTLTErrorMsg        = "ERR GT and LT options at the same time are not compatible"
+	UnsupportedOptionErrorMsg = "ERR Unsupported option %s"
+)
+
+// randomKeyAttempts is the number of random buckets RANDOMKEY looks into, before picking a key
+// among all of them (the keys it finds may have expired).
+const randomKeyAttempts = 16
+
+// Delete implements DEL key [key ...] and UNLINK key [key ...]: both delete the keys right
+// away, and reply with the number of keys that existed.
+var Delete CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	deleted := 0
+	for _, arg := range args[1:] {
+		key := string(arg)
+		// deleting a missing key succeeds, but isn't counted (nor notified)
+		exists, err := keyExists(db, key)
+		if err == nil && exists {
+			err = db.Delete(key)
+		}
+		if err != nil {
+			writeDBError(conn, err)
+			return
+		}
+		if exists {
+			deleted++
+			notifyKeyspaceEvent(conn, notifyGeneric, "del", key)
+		}
+	}
+	conn.WriteInt(deleted)
+}
+
+// Touch implements TOUCH key [key ...]: the number of keys that exist.
+var Touch CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	count := 0
+	for _, arg := range args[1:] {
+		exists, err := keyExists(db, string(arg))
+		if err != nil {
+			writeDBError(conn, err)
+			return
+		}
+		if exists {
+			count++
+		}
+	}
+	conn.WriteInt(count)
+}
+
+// Rename implements RENAME key newkey and RENAMENX key newkey, which only renames the key if
+// newkey doesn't exist.
+var Rename CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	nx := strings.EqualFold(string(args[0]), "renamenx")
+	key, newKey := string(args[1]), string(args[2])
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	exists, err := keyExists(db, key)
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	if !exists {
+		conn.WriteError(NoSuchKeyErrorMsg)
+		return
+	}
+
+	if nx {
+		taken, err := keyExists(db, newKey)
+		if err != nil {
+			writeDBError(conn, err)
+			return
+		}
+		if taken {
+			conn.WriteInt(0)
+			return
+		}
+	}
+
+	if key != newKey {
+		if err := db.Rename(key, newKey); err != nil {
+			writeDBError(conn, err)
+			return
+		}
+		notifyKeyspaceEvent(conn, notifyGeneric, "rename_from", key)
+		notifyKeyspaceEvent(conn, notifyGeneric, "rename_to", newKey)
+		wakeListWaiters(conn, db, newKey)
+	}
+
+	if nx {
+		conn.WriteInt(1)
+	} else {
+		conn.WriteString("OK")
+	}
+}
+
+// Copy implements COPY source destination [DB destination-db] [REPLACE].
+var Copy CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	s := sessionOf(conn)
+	index, replace := s.db, false
+	for i := 3; i < len(args); i++ {
+		switch {
+		case strings.EqualFold(string(args[i]), "replace"):
+			replace = true
+		case strings.EqualFold(string(args[i]), "db") && i+1 < len(args):
+			var errMsg string
+			index, errMsg = parseDBIndex(args[i+1], s.databases, DBIndexNotIntegerErrorMsg)
+			if errMsg != "" {
+				conn.WriteError(errMsg)
+				return
+			}
+			i++
+		default:
+			conn.WriteError(SyntaxErrorMsg)
+			return
+		}
+	}
+
+	key, destination := string(args[1]), string(args[2])
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	target := s.databases.Get(index)
+	if target == db && key == destination {
+		conn.WriteError(SameObjectErrorMsg)
+		return
+	}
+
+	copied, err := db.CopyTo(key, target, destination, replace)
+	if err != nil && !isMissingKey(err) {
+		writeDBError(conn, err)
+		return
+	}
+	if !copied {
+		conn.WriteInt(0)
+		return
+	}
+	conn.WriteInt(1)
+	notifyKeyspaceEventIn(conn, index, notifyGeneric, "copy_to", destination)
+	wakeListWaiters(conn, target, destination)
+}
+
+// RandomKey implements RANDOMKEY: a random key, or null if the database is empty.
+var RandomKey CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 1 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	key, found, err := randomKey(db)
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	writeBulkOrNull(conn, []byte(key), found)
+}
+
+// randomKey returns a random key of db, looking into random buckets of the scan table first,
+// and only then among all the keys.
+func randomKey(db *KeyValor.KeyValorDatabase) (string, bool, error) {
+	if db.Stats().Keys == 0 {
+		return "", false, nil
+	}
+
+	for i := 0; i < randomKeyAttempts; i++ {
+		keys, _, err := db.Scan(rand.Uint64(), "*", 1)
+		if err != nil {
+			return "", false, err
+		}
+		if key, found, err := pickExistingKey(db, keys); err != nil || found {
+			return key, found, err
+		}
+	}
+
+	keys, err := db.AllKeys()
+	if err != nil {
+		return "", false, err
+	}
+	return pickExistingKey(db, keys)
+}
+
+// pickExistingKey returns a random key among keys that exists, i.e. hasn't expired.
+func pickExistingKey(db *KeyValor.KeyValorDatabase, keys []string) (string, bool, error) {
+	for _, i := range rand.Perm(len(keys)) {
+		exists, err := keyExists(db, keys[i])
+		if err != nil {
+			return "", false, err
+		}
+		if exists {
+			return keys[i], true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// expireCommand returns the implementation of EXPIRE key seconds [NX | XX | GT | LT] and its
+// variants: the argument is a time to live, or a unix time if absolute, in the given unit.
+// An expiry in the past deletes the key.
+func expireCommand(unit time.Duration, absolute bool) CommandFunc {
+	return func(
+		conn redcon.Conn,
+		args [][]byte,
+		mu *sync.RWMutex,
+		db *KeyValor.KeyValorDatabase,
+	) {
+		if len(args) < 3 {
+			writeWrongArgs(conn, args)
+			return
+		}
+
+		n, ok := parseInt(args[2])
+		if !ok {
+			conn.WriteError(NotIntegerErrorMsg)
+			return
+		}
+		expiry, ok := expiryOf(n, unit, absolute)
+		if !ok {
+			conn.WriteError(fmt.Sprintf(InvalidExpireErrorMsg, strings.ToLower(string(args[0]))))
+			return
+		}
+
+		var nx, xx, gt, lt bool
+		for _, arg := range args[3:] {
+			switch strings.ToLower(string(arg)) {
+			case "nx":
+				nx = true
+			case "xx":
+				xx = true
+			case "gt":
+				gt = true
+			case "lt":
+				lt = true
+			default:
+				conn.WriteError(fmt.Sprintf(UnsupportedOptionErrorMsg, string(arg)))
+				return
+			}
+		}
+		if nx && (xx || gt || lt) {
+			conn.WriteError(ExpireNXErrorMsg)
+			return
+		}
+		if gt && lt {
+			conn.WriteError(ExpireGTLTErrorMsg)
+			return
+		}
+
+		key := string(args[1])
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		pttl, err := db.PTTL(key)
+		if isMissingKey(err) {
+			conn.WriteInt(0)
+			return
+		}
+		if err != nil {
+			writeDBError(conn, err)
+			return
+		}
+
+		// a key without expiry has an infinite time to live
+		current, persistent := time.Now().Add(time.Duration(pttl)*time.Millisecond), pttl < 0
+		if nx && !persistent || xx && persistent ||
+			gt && (persistent || !expiry.After(current)) || lt && !persistent && !expiry.Before(current) {
+			conn.WriteInt(0)
+			return
+		}
+
+		if !expiry.After(time.Now()) {
+			if err := db.Delete(key); err != nil {
+				writeDBError(conn, err)
+				return
+			}
+			conn.WriteInt(1)
+			notifyKeyspaceEvent(conn, notifyGeneric, "del", key)
+			return
+		}
+
+		if err := db.Expire(key, &expiry); err != nil {
+			writeDBError(conn, err)
+			return
+		}
+		conn.WriteInt(1)
+		notifyKeyspaceEvent(conn, notifyGeneric, "expire", key)
+	}
+}
+
+// expiryOf returns the expiry time given to EXPIRE and its variants, and false if it
+// overflows.
+func expiryOf(n int64, unit time.Duration, absolute bool) (time.Time, bool) {
+	if n > math.MaxInt64/int64(unit) || n < math.MinInt64/int64(unit) {
+		return time.Time{}, false
+	}
+	nanos := n * int64(unit)
+	if absolute {
+		return time.Unix(0, nanos), true
+	}
+
+	now := time.Now().UnixNano()
+	if nanos > 0 && nanos > math.MaxInt64-now {
+		return time.Time{}, false
+	}
+	return time.Unix(0, now+nanos), true
+}
+
+var (
+	// Expire implements EXPIRE key seconds [NX | XX | GT | LT]
+	Expire = expireCommand(time.Second, false)
+	// PExpire implements PEXPIRE key milliseconds [NX | XX | GT | LT]
+	PExpire = expireCommand(time.Millisecond, false)
+	// ExpireAt implements EXPIREAT key unix-time-seconds [NX | XX | GT | LT]
+	ExpireAt = expireCommand(time.Second, true)
+	// PExpireAt implements PEXPIREAT key unix-time-milliseconds [NX | XX | GT | LT]
+	PExpireAt = expireCommand(time.Millisecond, true)
+)
+
+// Ttl implements TTL key and PTTL key: the time to live of the key in seconds (or
+// milliseconds), -1 if it doesn't expire and -2 if it doesn't exist.
+var Ttl CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	key := string(args[1])
+
+	mu.RLock()
+	var ttl int64
+	var err error
+	if strings.EqualFold(string(args[0]), "pttl") {
+		ttl, err = db.PTTL(key)
+	} else {
+		ttl, err = db.TTL(key)
+	}
+	mu.RUnlock()
+
+	switch {
+	case isMissingKey(err):
+		conn.WriteInt(-2)
+	case err != nil:
+		writeDBError(conn, err)
+	default:
+		conn.WriteInt64(ttl)
+	}
+}
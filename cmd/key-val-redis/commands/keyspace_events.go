@@ -0,0 +1,174 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+)
+
+// keyspaceEvents are the classes of keyspace notifications, the flags of
+// notify-keyspace-events.
+type keyspaceEvents uint32
+
+const (
+	// notifyKeyspace publishes the events of a key on __keyspace@<db>__:<key>, and
+	// notifyKeyevent publishes the keys of an event on __keyevent@<db>__:<event>
+	notifyKeyspace keyspaceEvents = 1 << iota
+	notifyKeyevent
+	notifyGeneric
+	notifyString
+	notifyList
+	notifySet
+	notifyHash
+	notifyZSet
+	notifyExpired
+	// notifyEvicted is accepted for the compatibility with Redis, but never published: the
+	// server has no maxmemory, so it never evicts a key
+	notifyEvicted
+
+	// notifyAll are the classes of events (not the channels), "A" in notify-keyspace-events
+	notifyAll = notifyGeneric | notifyString | notifyList | notifySet | notifyHash | notifyZSet |
+		notifyExpired | notifyEvicted
+)
+
+// keyspaceEventClasses are the characters of notify-keyspace-events, in the order of Redis.
+var keyspaceEventClasses = []struct {
+	char  byte
+	class keyspaceEvents
+}{
+	{'g', notifyGeneric}, {'$', notifyString}, {'l', notifyList}, {'s', notifySet},
+	{'h', notifyHash}, {'z', notifyZSet}, {'x', notifyExpired}, {'e', notifyEvicted},
+	{'K', notifyKeyspace}, {'E', notifyKeyevent},
+}
+
+// parseKeyspaceEvents parses a value of notify-keyspace-events, like "Ex" or "KA".
+func parseKeyspaceEvents(value string) (keyspaceEvents, error) {
+	var events keyspaceEvents
+	for i := 0; i < len(value); i++ {
+		if value[i] == 'A' {
+			events |= notifyAll
+			continue
+		}
+		known := false
+		for _, c := range keyspaceEventClasses {
+			if value[i] == c.char {
+				events, known = events|c.class, true
+				break
+			}
+		}
+		if !known {
+			return 0, fmt.Errorf("invalid event class character %q, use 'AKEg$lshzxe'", value[i])
+		}
+	}
+	return events, nil
+}
+
+func (events keyspaceEvents) String() string {
+	var b strings.Builder
+	all := events&notifyAll == notifyAll
+	if all {
+		b.WriteByte('A')
+	}
+	for _, c := range keyspaceEventClasses {
+		if events&c.class != 0 && !(all && c.class&notifyAll != 0) {
+			b.WriteByte(c.char)
+		}
+	}
+	return b.String()
+}
+
+// enabledKeyspaceEvents returns the keyspace events published by srv, set by
+// notify-keyspace-events: none by default, since publishing them costs every write.
+func (srv *Server) enabledKeyspaceEvents() keyspaceEvents {
+	return keyspaceEvents(srv.notifications.Load())
+}
+
+// keyspaceEvent is an event of a key of a database.
+type keyspaceEvent struct {
+	db         int
+	event, key string
+}
+
+// notifyKeyspaceEvent records the event of key, of the given class, caused by a command of
+// the client conn on the database it selected. Its notifications are published once the
+// command (or the transaction) is done, without holding any lock: see Server.Dispatch.
+func notifyKeyspaceEvent(conn redcon.Conn, class keyspaceEvents, event, key string) {
+	notifyKeyspaceEventIn(conn, sessionOf(conn).db, class, event, key)
+}
+
+// notifyKeyspaceEventIn is notifyKeyspaceEvent, for an event of key in the database db, like the
+// destination of COPY ... DB.
+func notifyKeyspaceEventIn(conn redcon.Conn, db int, class keyspaceEvents, event, key string) {
+	s := sessionOf(conn)
+	if s.server.enabledKeyspaceEvents()&class == 0 {
+		return
+	}
+	s.events = append(s.events, keyspaceEvent{db: db, event: event, key: key})
+}
+
+// notifyCollectionEvent records the event of a write to the collection at key, followed by
+// its del event if the write removed its last element: like in Redis, an empty collection
+// doesn't exist.
+func notifyCollectionEvent(conn redcon.Conn, class keyspaceEvents, event, key string, emptied bool) {
+	notifyKeyspaceEvent(conn, class, event, key)
+	if emptied {
+		notifyKeyspaceEvent(conn, notifyGeneric, "del", key)
+	}
+}
+
+// publishKeyspaceEvents publishes the notifications of the events caused by the commands of
+// the session s.
+func publishKeyspaceEvents(s *session) {
+	for _, e := range s.events {
+		s.server.publishKeyspaceEvent(e)
+	}
+	s.events = s.events[:0]
+}
+
+// publishKeyspaceEvent publishes the notifications of an event to the subscribers of srv, on
+// the channels enabled by notify-keyspace-events.
+func (srv *Server) publishKeyspaceEvent(e keyspaceEvent) {
+	events := srv.enabledKeyspaceEvents()
+	db := strconv.Itoa(e.db)
+	if events&notifyKeyspace != 0 {
+		srv.pubSub.publish("__keyspace@"+db+"__:"+e.key, []byte(e.event))
+	}
+	if events&notifyKeyevent != 0 {
+		srv.pubSub.publish("__keyevent@"+db+"__:"+e.event, []byte(e.key))
+	}
+}
+
+// expiryListener publishes the expired events of the keys deleted by the background tasks
+// of a database, see KeyValor.WithExpiryListener, and aborts the transactions watching them
+// like Redis 6.0.9 does. The index of the database in the notifications is its current one,
+// since SWAPDB moves the databases.
+type expiryListener struct {
+	dbs *Databases
+	// db is set once the database is open
+	db atomic.Pointer[KeyValor.KeyValorDatabase]
+}
+
+func (l *expiryListener) expired(keys []string) {
+	db := l.db.Load()
+	if db == nil {
+		return
+	}
+	db.TouchWatchedKeys(keys)
+
+	srv := l.dbs.server.Load()
+	if srv == nil || srv.enabledKeyspaceEvents()&notifyExpired == 0 {
+		return
+	}
+	index := l.dbs.indexOf(db)
+	if index < 0 {
+		return
+	}
+	for _, key := range keys {
+		srv.publishKeyspaceEvent(keyspaceEvent{db: index, event: "expired", key: key})
+	}
+}
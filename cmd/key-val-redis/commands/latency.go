@@ -0,0 +1,207 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+)
+
+// the events of LATENCY recorded by the server; those of the background tasks of the
+// databases are the config.Latency* events
+const (
+	latencyCommand     = "command"
+	latencyFastCommand = "fast-command"
+)
+
+// latencyHistoryLen is the number of samples kept per event, like in Redis.
+const latencyHistoryLen = 160
+
+// latencySample is the longest latency of an event during a second.
+type latencySample struct {
+	// time is a unix time, in seconds
+	time    int64
+	latency time.Duration
+}
+
+// latencyEvent is the history of an event.
+type latencyEvent struct {
+	// samples are the latest ones, the oldest first
+	samples []latencySample
+	max     time.Duration
+}
+
+// latencyMonitor keeps the history of the events longer than latency-monitor-threshold, for
+// LATENCY: the commands, and the background tasks of the databases.
+type latencyMonitor struct {
+	// threshold is latency-monitor-threshold, in milliseconds: the databases and every command
+	// read it, without the lock
+	threshold atomic.Int64
+
+	sync.Mutex
+	events map[string]*latencyEvent
+}
+
+func newLatencyMonitor() *latencyMonitor {
+	return &latencyMonitor{events: make(map[string]*latencyEvent)}
+}
+
+// recordLatency is the LatencyListener of the databases, see OpenDatabases: it records the
+// background tasks of the databases for LATENCY of their server.
+func (d *Databases) recordLatency(event string, duration time.Duration) {
+	if srv := d.server.Load(); srv != nil {
+		srv.latency.record(event, duration)
+	}
+}
+
+// record records that the event lasted for duration, if it is longer than the threshold.
+func (lm *latencyMonitor) record(event string, duration time.Duration) {
+	threshold := lm.threshold.Load()
+	if threshold == 0 || duration.Milliseconds() < threshold {
+		return
+	}
+
+	now := time.Now().Unix()
+
+	lm.Lock()
+	defer lm.Unlock()
+
+	e, ok := lm.events[event]
+	if !ok {
+		e = &latencyEvent{}
+		lm.events[event] = e
+	}
+	e.max = max(e.max, duration)
+
+	if n := len(e.samples); n > 0 && e.samples[n-1].time == now {
+		e.samples[n-1].latency = max(e.samples[n-1].latency, duration)
+		return
+	}
+	e.samples = append(e.samples, latencySample{time: now, latency: duration})
+	if len(e.samples) > latencyHistoryLen {
+		e.samples = e.samples[1:]
+	}
+}
+
+// recordCommand records the duration of a command in the event of its category.
+func (lm *latencyMonitor) recordCommand(commandName string, duration time.Duration) {
+	if threshold := lm.threshold.Load(); threshold == 0 || duration.Milliseconds() < threshold {
+		return
+	}
+
+	event := latencyCommand
+	for _, category := range commandSpecs[commandName].categories {
+		if category == "fast" {
+			event = latencyFastCommand
+		}
+	}
+	lm.record(event, duration)
+}
+
+// latestSample is the latest sample of an event, for LATENCY LATEST.
+type latestSample struct {
+	event string
+	latencySample
+	max time.Duration
+}
+
+// latest returns the latest sample of every event, by name.
+func (lm *latencyMonitor) latest() []latestSample {
+	lm.Lock()
+	defer lm.Unlock()
+
+	latest := make([]latestSample, 0, len(lm.events))
+	for name, e := range lm.events {
+		latest = append(latest, latestSample{event: name, latencySample: e.samples[len(e.samples)-1], max: e.max})
+	}
+	sort.Slice(latest, func(i, j int) bool { return latest[i].event < latest[j].event })
+	return latest
+}
+
+// history returns the samples of an event, the oldest first.
+func (lm *latencyMonitor) history(event string) []latencySample {
+	lm.Lock()
+	defer lm.Unlock()
+
+	if e, ok := lm.events[event]; ok {
+		return append([]latencySample(nil), e.samples...)
+	}
+	return nil
+}
+
+// reset deletes the history of the events (of all of them if none is given), and returns how
+// many it deleted.
+func (lm *latencyMonitor) reset(events []string) int {
+	lm.Lock()
+	defer lm.Unlock()
+
+	if len(events) == 0 {
+		n := len(lm.events)
+		clear(lm.events)
+		return n
+	}
+
+	n := 0
+	for _, event := range events {
+		if _, ok := lm.events[event]; ok {
+			delete(lm.events, event)
+			n++
+		}
+	}
+	return n
+}
+
+// Latency implements LATENCY LATEST, LATENCY HISTORY event and LATENCY RESET [event ...].
+// The events are "command" and "fast-command" (the commands of the fast category), and
+// "compaction", "file-rotation", "index-flush" and "expire-cycle", the background tasks of the
+// databases, which hold their locks; the latencies are in milliseconds.
+var Latency CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	latency := serverOf(conn).latency
+	switch subcommand := strings.ToLower(string(args[1])); {
+	case subcommand == "latest" && len(args) == 2:
+		latest := latency.latest()
+		conn.WriteArray(len(latest))
+		for _, sample := range latest {
+			conn.WriteArray(4)
+			conn.WriteBulkString(sample.event)
+			conn.WriteInt64(sample.time)
+			conn.WriteInt64(sample.latency.Milliseconds())
+			conn.WriteInt64(sample.max.Milliseconds())
+		}
+
+	case subcommand == "history" && len(args) == 3:
+		history := latency.history(string(args[2]))
+		conn.WriteArray(len(history))
+		for _, sample := range history {
+			conn.WriteArray(2)
+			conn.WriteInt64(sample.time)
+			conn.WriteInt64(sample.latency.Milliseconds())
+		}
+
+	case subcommand == "reset":
+		events := make([]string, 0, len(args)-2)
+		for _, arg := range args[2:] {
+			events = append(events, string(arg))
+		}
+		conn.WriteInt(latency.reset(events))
+
+	default:
+		conn.WriteError(fmt.Sprintf(UnknownSubcommandErrorMsg, string(args[1]), "LATENCY"))
+	}
+}
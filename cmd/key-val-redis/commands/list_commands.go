@@ -0,0 +1,627 @@
+package commands
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+)
+
+const (
+	NoSuchKeyErrorMsg         = "ERR no such key"
+	IndexOutOfRangeErrorMsg   = "ERR index out of range"
+	MustBePositiveErrorMsg    = "ERR value is out of range, must be positive"
+	listEndLeft, listEndRight = "left", "right"
+)
+
+// LPush implements LPUSH, RPUSH, LPUSHX and RPUSHX
+var LPush CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	command := strings.ToLower(string(args[0]))
+	left := command[0] == 'l'
+	onlyIfExists := strings.HasSuffix(command, "x")
+	length := 0
+
+	mu.Lock()
+	err := db.UpdateList(string(args[1]), func(l *KeyValor.List) error {
+		if onlyIfExists && l.Len() == 0 {
+			return nil
+		}
+		if left {
+			l.PushLeft(args[2:]...)
+		} else {
+			l.PushRight(args[2:]...)
+		}
+		length = l.Len()
+		return nil
+	})
+	if err == nil && length > 0 {
+		serverOf(conn).listWaiters.wake(db, string(args[1]), len(args)-2)
+	}
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteInt(length)
+	if length > 0 {
+		notifyKeyspaceEvent(conn, notifyList, strings.TrimSuffix(command, "x"), string(args[1]))
+	}
+}
+
+// LPop implements LPOP key [count] and RPOP key [count]
+var LPop CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 2 && len(args) != 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	count := int64(1)
+	withCount := len(args) == 3
+	if withCount {
+		var ok bool
+		if count, ok = parseInt(args[2]); !ok || count < 0 {
+			conn.WriteError(MustBePositiveErrorMsg)
+			return
+		}
+	}
+
+	left := strings.EqualFold(string(args[0]), "lpop")
+	var (
+		popped           [][]byte
+		existed, emptied bool
+	)
+
+	mu.Lock()
+	err := db.UpdateList(string(args[1]), func(l *KeyValor.List) error {
+		existed = l.Len() > 0
+		popped = popElements(l, left, count)
+		emptied = l.Len() == 0
+		return nil
+	})
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+
+	switch {
+	case !withCount:
+		if len(popped) == 0 {
+			writeNull(conn)
+		} else {
+			conn.WriteBulk(popped[0])
+		}
+	case !existed:
+		writeNullArray(conn)
+	default:
+		writeBulkArray(conn, popped)
+	}
+	if len(popped) > 0 {
+		notifyCollectionEvent(conn, notifyList, strings.ToLower(string(args[0])), string(args[1]), emptied)
+	}
+}
+
+var LLen CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	var length int
+	ok := viewList(conn, mu, db, args[1], func(l *KeyValor.List) {
+		length = l.Len()
+	})
+	if ok {
+		conn.WriteInt(length)
+	}
+}
+
+var LRange CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 4 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	start, stop, ok := parseListRange(conn, args[2], args[3])
+	if !ok {
+		return
+	}
+
+	var elements [][]byte
+	ok = viewList(conn, mu, db, args[1], func(l *KeyValor.List) {
+		elements = l.Range(start, stop)
+	})
+	if ok {
+		writeBulkArray(conn, elements)
+	}
+}
+
+var LIndex CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	index, ok := parseInt(args[2])
+	if !ok {
+		conn.WriteError(NotIntegerErrorMsg)
+		return
+	}
+
+	var (
+		element []byte
+		found   bool
+	)
+	ok = viewList(conn, mu, db, args[1], func(l *KeyValor.List) {
+		element, found = l.Index(clampIndex(index))
+	})
+	if ok {
+		writeBulkOrNull(conn, element, found)
+	}
+}
+
+var LSet CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 4 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	index, ok := parseInt(args[2])
+	if !ok {
+		conn.WriteError(NotIntegerErrorMsg)
+		return
+	}
+
+	mu.Lock()
+	err := db.UpdateList(string(args[1]), func(l *KeyValor.List) error {
+		if l.Len() == 0 {
+			return replyError(NoSuchKeyErrorMsg)
+		}
+		if !l.Set(clampIndex(index), args[3]) {
+			return replyError(IndexOutOfRangeErrorMsg)
+		}
+		return nil
+	})
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteString("OK")
+	notifyKeyspaceEvent(conn, notifyList, "lset", string(args[1]))
+}
+
+// LRem implements LREM key count element
+var LRem CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 4 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	count, ok := parseInt(args[2])
+	if !ok {
+		conn.WriteError(NotIntegerErrorMsg)
+		return
+	}
+
+	var (
+		removed int
+		emptied bool
+	)
+
+	mu.Lock()
+	err := db.UpdateList(string(args[1]), func(l *KeyValor.List) error {
+		removed = l.Remove(clampIndex(count), args[3])
+		emptied = l.Len() == 0
+		return nil
+	})
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteInt(removed)
+	if removed > 0 {
+		notifyCollectionEvent(conn, notifyList, "lrem", string(args[1]), emptied)
+	}
+}
+
+var LTrim CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 4 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	start, stop, ok := parseListRange(conn, args[2], args[3])
+	if !ok {
+		return
+	}
+
+	var existed, emptied bool
+
+	mu.Lock()
+	err := db.UpdateList(string(args[1]), func(l *KeyValor.List) error {
+		existed = l.Len() > 0
+		l.Trim(start, stop)
+		emptied = l.Len() == 0
+		return nil
+	})
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteString("OK")
+	if existed {
+		notifyCollectionEvent(conn, notifyList, "ltrim", string(args[1]), emptied)
+	}
+}
+
+// LInsert implements LINSERT key BEFORE|AFTER pivot element
+var LInsert CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 5 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	var before bool
+	switch strings.ToLower(string(args[2])) {
+	case "before":
+		before = true
+	case "after":
+	default:
+		conn.WriteError(SyntaxErrorMsg)
+		return
+	}
+
+	length := 0
+
+	mu.Lock()
+	err := db.UpdateList(string(args[1]), func(l *KeyValor.List) error {
+		if l.Len() == 0 {
+			return nil
+		}
+		if !l.Insert(before, args[3], args[4]) {
+			length = -1
+			return nil
+		}
+		length = l.Len()
+		return nil
+	})
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteInt(length)
+	if length > 0 {
+		notifyKeyspaceEvent(conn, notifyList, "linsert", string(args[1]))
+	}
+}
+
+// LMove implements LMOVE source destination LEFT|RIGHT LEFT|RIGHT, and RPOPLPUSH source destination
+var LMove CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	fromLeft, toLeft, ok := parseMoveArgs(conn, args, 0)
+	if !ok {
+		return
+	}
+
+	mu.Lock()
+	element, moved, err := moveElement(conn, db, args[1], args[2], fromLeft, toLeft)
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	writeBulkOrNull(conn, element, moved)
+}
+
+// BLPop implements BLPOP key [key ...] timeout and BRPOP key [key ...] timeout
+var BLPop CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	timeout, errMsg := parseTimeout(args[len(args)-1])
+	if errMsg != "" {
+		conn.WriteError(errMsg)
+		return
+	}
+
+	keys := make([]string, 0, len(args)-2)
+	for _, key := range args[1 : len(args)-1] {
+		keys = append(keys, string(key))
+	}
+	left := strings.EqualFold(string(args[0]), "blpop")
+
+	var (
+		poppedKey string
+		element   []byte
+		emptied   bool
+	)
+
+	served, err := blockOnKeys(conn, mu, db, keys, timeout, func(db *KeyValor.KeyValorDatabase) (bool, error) {
+		// the first non empty list is served, but a key of another type fails the command
+		for _, key := range keys {
+			var popped [][]byte
+			err := db.UpdateList(key, func(l *KeyValor.List) error {
+				popped = popElements(l, left, 1)
+				emptied = l.Len() == 0
+				return nil
+			})
+			if err != nil {
+				return false, err
+			}
+			if len(popped) > 0 {
+				poppedKey, element = key, popped[0]
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	if !served {
+		writeNullArray(conn)
+		return
+	}
+
+	conn.WriteArray(2)
+	conn.WriteBulkString(poppedKey)
+	conn.WriteBulk(element)
+	notifyCollectionEvent(conn, notifyList, listEndEvent(left, "lpop", "rpop"), poppedKey, emptied)
+}
+
+// BLMove implements BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout,
+// and BRPOPLPUSH source destination timeout
+var BLMove CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	fromLeft, toLeft, ok := parseMoveArgs(conn, args, 1)
+	if !ok {
+		return
+	}
+
+	timeout, errMsg := parseTimeout(args[len(args)-1])
+	if errMsg != "" {
+		conn.WriteError(errMsg)
+		return
+	}
+
+	var element []byte
+
+	source := []string{string(args[1])}
+	served, err := blockOnKeys(conn, mu, db, source, timeout, func(db *KeyValor.KeyValorDatabase) (bool, error) {
+		var (
+			moved bool
+			err   error
+		)
+		element, moved, err = moveElement(conn, db, args[1], args[2], fromLeft, toLeft)
+		return moved, err
+	})
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	if !served {
+		writeNullArray(conn)
+		return
+	}
+	conn.WriteBulk(element)
+}
+
+// moveElement pops an element from source and pushes it to destination (which can be the
+// same list), wakes up a client blocked on destination, and notifies the events of the
+// move. It must be called with mu locked.
+func moveElement(
+	conn redcon.Conn,
+	db *KeyValor.KeyValorDatabase,
+	source, destination []byte,
+	fromLeft, toLeft bool,
+) ([]byte, bool, error) {
+	var (
+		element        []byte
+		moved, emptied bool
+	)
+
+	err := db.UpdateLists([]string{string(source), string(destination)}, func(lists []*KeyValor.List) error {
+		if fromLeft {
+			element, moved = lists[0].PopLeft()
+		} else {
+			element, moved = lists[0].PopRight()
+		}
+		if !moved {
+			return nil
+		}
+
+		if toLeft {
+			lists[1].PushLeft(element)
+		} else {
+			lists[1].PushRight(element)
+		}
+		emptied = lists[0].Len() == 0
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if !moved {
+		return nil, false, nil
+	}
+
+	serverOf(conn).listWaiters.wake(db, string(destination), 1)
+
+	// in the order of Redis: the push, then the pop
+	notifyKeyspaceEvent(conn, notifyList, listEndEvent(toLeft, "lpush", "rpush"), string(destination))
+	notifyCollectionEvent(conn, notifyList, listEndEvent(fromLeft, "lpop", "rpop"), string(source), emptied)
+	return element, true, nil
+}
+
+// parseMoveArgs parses the directions of the LMOVE family of commands: LMOVE and BLMOVE
+// have them after source and destination, while RPOPLPUSH and BRPOPLPUSH always move from
+// right to left. extraArgs is the number of arguments after the directions (the timeout).
+func parseMoveArgs(conn redcon.Conn, args [][]byte, extraArgs int) (fromLeft, toLeft, ok bool) {
+	command := strings.ToLower(string(args[0]))
+	if strings.HasSuffix(command, "rpoplpush") {
+		if len(args) != 3+extraArgs {
+			writeWrongArgs(conn, args)
+			return false, false, false
+		}
+		return false, true, true
+	}
+
+	if len(args) != 5+extraArgs {
+		writeWrongArgs(conn, args)
+		return false, false, false
+	}
+
+	from, to := strings.ToLower(string(args[3])), strings.ToLower(string(args[4]))
+	if (from != listEndLeft && from != listEndRight) || (to != listEndLeft && to != listEndRight) {
+		conn.WriteError(SyntaxErrorMsg)
+		return false, false, false
+	}
+	return from == listEndLeft, to == listEndLeft, true
+}
+
+// listEndEvent returns the event of a push or a pop at the head (left) or the tail of a list.
+func listEndEvent(left bool, head, tail string) string {
+	if left {
+		return head
+	}
+	return tail
+}
+
+// popElements pops up to count elements from the head (or the tail) of l.
+func popElements(l *KeyValor.List, left bool, count int64) [][]byte {
+	popped := make([][]byte, 0, min(count, int64(l.Len())))
+	for int64(len(popped)) < count {
+		var (
+			element []byte
+			ok      bool
+		)
+		if left {
+			element, ok = l.PopLeft()
+		} else {
+			element, ok = l.PopRight()
+		}
+		if !ok {
+			break
+		}
+		popped = append(popped, element)
+	}
+	return popped
+}
+
+// viewList calls view on the list at key, which reads only the elements it accesses, or replies
+// with the error and returns false.
+func viewList(conn redcon.Conn, mu *sync.RWMutex, db *KeyValor.KeyValorDatabase, key []byte, view func(l *KeyValor.List)) bool {
+	mu.RLock()
+	err := db.ViewList(string(key), func(l *KeyValor.List) error {
+		view(l)
+		return nil
+	})
+	mu.RUnlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return false
+	}
+	return true
+}
+
+// parseListRange parses the start and stop indexes of LRANGE and LTRIM,
+// or replies with the error and returns false.
+func parseListRange(conn redcon.Conn, startArg, stopArg []byte) (int, int, bool) {
+	start, ok := parseInt(startArg)
+	if !ok {
+		conn.WriteError(NotIntegerErrorMsg)
+		return 0, 0, false
+	}
+	stop, ok := parseInt(stopArg)
+	if !ok {
+		conn.WriteError(NotIntegerErrorMsg)
+		return 0, 0, false
+	}
+	return clampIndex(start), clampIndex(stop), true
+}
+
+// clampIndex converts a list index to an int, which is out of range
+// for any list on platforms where int is smaller than int64.
+func clampIndex(index int64) int {
+	const maxInt = int64(^uint(0) >> 1)
+	return int(max(min(index, maxInt), -maxInt))
+}
+
+func writeBulkArray(conn redcon.Conn, elements [][]byte) {
+	conn.WriteArray(len(elements))
+	for _, element := range elements {
+		conn.WriteBulk(element)
+	}
+}
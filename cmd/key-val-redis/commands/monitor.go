@@ -0,0 +1,262 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+	"KeyValor/log"
+)
+
+const (
+	MonitorDenyBlockingErrorMsg = "ERR MONITOR isn't allowed for DENY BLOCKING client"
+	MonitorKeyspaceErrorMsg     = "ERR Replica can't interact with the keyspace"
+	MonitorContextErrorMsg      = "ERR Can't execute '%s' while monitoring"
+)
+
+// monitorBacklog is the number of lines queued for a monitor: one that falls further behind
+// the commands is dropped. It is a variable for the tests.
+var monitorBacklog = 4096
+
+// monitor is a client that ran MONITOR. Like a subscriber, its connection is detached from
+// the redcon server, and served by its own goroutine (see serve); the lines of the commands
+// are queued by the clients that run them, and written by another goroutine (see stream), so
+// that a slow monitor never slows them down.
+type monitor struct {
+	// mu serializes the writes to conn, by its own commands and by stream
+	mu   sync.Mutex
+	conn redcon.DetachedConn
+
+	lines chan []byte
+	// dropped is closed once the monitor is dropped, or disconnects
+	dropped  chan struct{}
+	dropOnce sync.Once
+
+	// serving is set once serve was started, by Dispatch
+	serving bool
+}
+
+// serve runs the commands of the client until it disconnects, or is dropped. The commands
+// that read or write keys are refused, like those of a Redis replica.
+func (m *monitor) serve(srv *Server) {
+	defer func() {
+		srv.monitors.remove(m)
+		m.drop()
+		m.mu.Lock()
+		m.conn.Close()
+		m.mu.Unlock()
+		sessionOf(m.conn).release()
+	}()
+
+	go m.stream()
+
+	for {
+		cmd, err := m.conn.ReadCommand()
+		if err != nil {
+			return
+		}
+		if len(cmd.Args) == 0 {
+			continue
+		}
+
+		m.mu.Lock()
+		m.run(cmd.Args, srv)
+		err = m.conn.Flush()
+		m.mu.Unlock()
+		if err != nil {
+			return
+		}
+		publishKeyspaceEvents(sessionOf(m.conn))
+	}
+}
+
+// run runs a command of the client, with m.mu locked.
+func (m *monitor) run(args [][]byte, srv *Server) {
+	commandName := strings.ToLower(string(args[0]))
+	for _, category := range commandSpecs[commandName].categories {
+		switch category {
+		case "read", "write":
+			m.conn.WriteError(MonitorKeyspaceErrorMsg)
+			return
+		case "transaction":
+			m.conn.WriteError(fmt.Sprintf(MonitorContextErrorMsg, commandName))
+			return
+		}
+	}
+	if commandName == "subscribe" || commandName == "psubscribe" {
+		m.conn.WriteError(fmt.Sprintf(MonitorContextErrorMsg, commandName))
+		return
+	}
+	srv.dispatch(m.conn, args)
+}
+
+// stream writes the queued lines to the client, until it is dropped. The lines queued while
+// one is written are flushed with it.
+func (m *monitor) stream() {
+	for {
+		select {
+		case <-m.dropped:
+			return
+		case line := <-m.lines:
+			m.mu.Lock()
+			m.conn.WriteRaw(line)
+			for n := len(m.lines); n > 0; n-- {
+				m.conn.WriteRaw(<-m.lines)
+			}
+			err := m.conn.Flush()
+			m.mu.Unlock()
+			if err != nil {
+				m.drop()
+				return
+			}
+		}
+	}
+}
+
+// drop stops stream, and closes the connection: serve then notices it, and removes the
+// monitor. The connection is closed directly since stream may be blocked writing to it.
+func (m *monitor) drop() {
+	m.dropOnce.Do(func() {
+		close(m.dropped)
+		if netConn := m.conn.NetConn(); netConn != nil {
+			_ = netConn.Close()
+		}
+	})
+}
+
+// monitorHub holds the monitors. count is read by every command without the lock, so that
+// feeding the monitors costs nothing while there are none.
+type monitorHub struct {
+	count atomic.Int32
+
+	sync.RWMutex
+	monitors map[*monitor]struct{}
+}
+
+func newMonitorHub() *monitorHub {
+	return &monitorHub{monitors: make(map[*monitor]struct{})}
+}
+
+func (h *monitorHub) add(m *monitor) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.monitors[m] = struct{}{}
+	h.count.Store(int32(len(h.monitors)))
+}
+
+func (h *monitorHub) remove(m *monitor) {
+	h.Lock()
+	defer h.Unlock()
+
+	delete(h.monitors, m)
+	h.count.Store(int32(len(h.monitors)))
+}
+
+// feed queues the command args, run by the client of s, for the monitors. Those whose
+// backlog is full are dropped.
+func (h *monitorHub) feed(s *session, args [][]byte) {
+	if h.count.Load() == 0 {
+		return
+	}
+
+	line := monitorLine(time.Now(), s.db, s.conn.RemoteAddr(), args)
+
+	h.RLock()
+	defer h.RUnlock()
+
+	for m := range h.monitors {
+		select {
+		case m.lines <- line:
+		default:
+			log.Warnf("dropping the monitor %s: it fell %d commands behind", m.conn.RemoteAddr(), cap(m.lines))
+			m.drop()
+		}
+	}
+}
+
+// monitorLine formats a command like Redis: +<unix time> [<db> <client address>] followed by
+// the quoted arguments, without their secrets.
+func monitorLine(now time.Time, db int, addr string, args [][]byte) []byte {
+	line := fmt.Appendf(nil, "+%d.%06d [%d %s]", now.Unix(), now.Nanosecond()/1000, db, addr)
+	for _, arg := range redactArgs(args) {
+		line = append(line, ' ')
+		line = appendRepr(line, arg)
+	}
+	return append(line, '\r', '\n')
+}
+
+// appendRepr appends s quoted and escaped like in Redis (sdscatrepr): the line of a command
+// stays on one line, whatever its arguments.
+func appendRepr(b, s []byte) []byte {
+	b = append(b, '"')
+	for _, c := range s {
+		switch c {
+		case '\\', '"':
+			b = append(b, '\\', c)
+		case '\n':
+			b = append(b, '\\', 'n')
+		case '\r':
+			b = append(b, '\\', 'r')
+		case '\t':
+			b = append(b, '\\', 't')
+		case '\a':
+			b = append(b, '\\', 'a')
+		case '\b':
+			b = append(b, '\\', 'b')
+		default:
+			if c < 0x20 || c > 0x7e {
+				b = append(b, '\\', 'x')
+				if c < 0x10 {
+					b = append(b, '0')
+				}
+				b = strconv.AppendUint(b, uint64(c), 16)
+			} else {
+				b = append(b, c)
+			}
+		}
+	}
+	return append(b, '"')
+}
+
+// Monitor implements MONITOR: from then on, the client receives a line for every command run
+// by the server (see monitorLine). A client that falls too far behind is disconnected.
+var Monitor CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 1 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	s := sessionOf(conn)
+	if s.executing || s.subscriber != nil {
+		conn.WriteError(MonitorDenyBlockingErrorMsg)
+		return
+	}
+	// like in Redis, MONITOR is ignored by a monitor
+	if s.monitor != nil {
+		return
+	}
+
+	m := &monitor{
+		conn:    conn.Detach(),
+		lines:   make(chan []byte, monitorBacklog),
+		dropped: make(chan struct{}),
+	}
+	s.monitor = m
+	s.updateInfo(func(info *clientInfo) { info.monitor = true })
+	// the reply goes before the lines
+	m.conn.WriteString("OK")
+	_ = m.conn.Flush()
+	s.server.monitors.add(m)
+}
@@ -0,0 +1,412 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+	"KeyValor/internal/utils/globutils"
+)
+
+const (
+	SubscribedContextErrorMsg = "ERR Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context"
+	SubscribeInTxErrorMsg     = "ERR Command not allowed inside a transaction"
+	UnknownSubcommandErrorMsg = "ERR unknown subcommand '%s'. Try %s HELP."
+)
+
+// subscriber is a client that subscribed to channels or patterns at least once. Its connection
+// is detached from the redcon server: it is served by its own goroutine (see serve) from then
+// on, because messages can be written to it at any time, by the clients that publish them.
+type subscriber struct {
+	// mu serializes the writes to conn, by its own commands and by the published messages
+	mu   sync.Mutex
+	conn redcon.DetachedConn
+
+	// the subscriptions, only used by the goroutine of the subscriber
+	channels map[string]struct{}
+	patterns map[string]struct{}
+
+	// serving is set once serve was started, by Dispatch
+	serving bool
+}
+
+// count returns the number of subscriptions of the client.
+func (sub *subscriber) count() int {
+	return len(sub.channels) + len(sub.patterns)
+}
+
+// subscriptions returns the channels (or the patterns) of the client, sorted.
+func (sub *subscriber) subscriptions(pattern bool) []string {
+	set := sub.channels
+	if pattern {
+		set = sub.patterns
+	}
+
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// serve runs the commands of the client until it disconnects. While it has subscriptions,
+// only the (un)subscribe commands, PING and QUIT are allowed, like in Redis.
+func (sub *subscriber) serve(srv *Server) {
+	defer func() {
+		srv.pubSub.unsubscribeAll(sub)
+		// a message may still be delivered, by a publisher that collected the client before
+		sub.mu.Lock()
+		sub.conn.Close()
+		sub.mu.Unlock()
+		sessionOf(sub.conn).release()
+	}()
+
+	for {
+		cmd, err := sub.conn.ReadCommand()
+		if err != nil {
+			return
+		}
+		if len(cmd.Args) == 0 {
+			continue
+		}
+
+		sub.mu.Lock()
+		sub.run(cmd.Args, srv)
+		err = sub.conn.Flush()
+		sub.mu.Unlock()
+		if err != nil {
+			return
+		}
+		// the client may be notified of its own commands: sub.mu must be unlocked
+		publishKeyspaceEvents(sessionOf(sub.conn))
+	}
+}
+
+// run runs a command of the client, with sub.mu locked. A RESP3 client can run any command,
+// since the messages are pushed with a type of their own.
+func (sub *subscriber) run(args [][]byte, srv *Server) {
+	if sub.count() == 0 || resp3(sub.conn) {
+		srv.dispatch(sub.conn, args)
+		return
+	}
+
+	switch commandName := strings.ToLower(string(args[0])); commandName {
+	case "subscribe", "psubscribe", "unsubscribe", "punsubscribe", "quit":
+		srv.dispatch(sub.conn, args)
+	case "ping":
+		if len(args) > 2 {
+			writeWrongArgs(sub.conn, args)
+			return
+		}
+		sub.conn.WriteArray(2)
+		sub.conn.WriteBulkString("pong")
+		if len(args) == 2 {
+			sub.conn.WriteBulk(args[1])
+		} else {
+			sub.conn.WriteBulkString("")
+		}
+	default:
+		sub.conn.WriteError(fmt.Sprintf(SubscribedContextErrorMsg, commandName))
+	}
+}
+
+// updateSessionInfo shows the subscriptions in the client info of s.
+func (sub *subscriber) updateSessionInfo(s *session) {
+	s.updateInfo(func(info *clientInfo) {
+		info.sub, info.psub = len(sub.channels), len(sub.patterns)
+	})
+}
+
+// deliver writes a message to the client.
+func (sub *subscriber) deliver(write func(conn redcon.Conn)) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	write(sub.conn)
+	// a failed write is noticed by serve, which then unsubscribes the client
+	_ = sub.conn.Flush()
+}
+
+// pubSubHub holds the subscribers of each channel and of each pattern.
+type pubSubHub struct {
+	sync.RWMutex
+	channels map[string]map[*subscriber]struct{}
+	patterns map[string]map[*subscriber]struct{}
+}
+
+func newPubSubHub() *pubSubHub {
+	return &pubSubHub{
+		channels: make(map[string]map[*subscriber]struct{}),
+		patterns: make(map[string]map[*subscriber]struct{}),
+	}
+}
+
+func (h *pubSubHub) subscribe(sub *subscriber, pattern bool, name string) {
+	h.Lock()
+	defer h.Unlock()
+
+	subscriptions, subscribers := sub.channels, h.channels
+	if pattern {
+		subscriptions, subscribers = sub.patterns, h.patterns
+	}
+
+	subscriptions[name] = struct{}{}
+	if subscribers[name] == nil {
+		subscribers[name] = make(map[*subscriber]struct{})
+	}
+	subscribers[name][sub] = struct{}{}
+}
+
+func (h *pubSubHub) unsubscribe(sub *subscriber, pattern bool, name string) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.unsubscribeHubLocked(sub, pattern, name)
+}
+
+func (h *pubSubHub) unsubscribeHubLocked(sub *subscriber, pattern bool, name string) {
+	subscriptions, subscribers := sub.channels, h.channels
+	if pattern {
+		subscriptions, subscribers = sub.patterns, h.patterns
+	}
+
+	delete(subscriptions, name)
+	delete(subscribers[name], sub)
+	if len(subscribers[name]) == 0 {
+		delete(subscribers, name)
+	}
+}
+
+// unsubscribeAll removes every subscription of a client that disconnected.
+func (h *pubSubHub) unsubscribeAll(sub *subscriber) {
+	h.Lock()
+	defer h.Unlock()
+
+	for _, pattern := range []bool{false, true} {
+		for _, name := range sub.subscriptions(pattern) {
+			h.unsubscribeHubLocked(sub, pattern, name)
+		}
+	}
+}
+
+// publish sends message to the subscribers of channel and of the patterns matching it,
+// and returns the number of deliveries (a client subscribed twice receives the message twice).
+func (h *pubSubHub) publish(channel string, message []byte) int {
+	type delivery struct {
+		sub     *subscriber
+		pattern string
+	}
+
+	// the recipients are collected first: a subscriber holds its own lock while it
+	// (un)subscribes, so it must not be written to with the hub locked
+	h.RLock()
+	var deliveries []delivery
+	for sub := range h.channels[channel] {
+		deliveries = append(deliveries, delivery{sub: sub})
+	}
+	for pattern, subscribers := range h.patterns {
+		if globutils.Match(pattern, channel) {
+			for sub := range subscribers {
+				deliveries = append(deliveries, delivery{sub: sub, pattern: pattern})
+			}
+		}
+	}
+	h.RUnlock()
+
+	for _, d := range deliveries {
+		d.sub.deliver(func(conn redcon.Conn) {
+			if d.pattern == "" {
+				writePush(conn, 3)
+				conn.WriteBulkString("message")
+			} else {
+				writePush(conn, 4)
+				conn.WriteBulkString("pmessage")
+				conn.WriteBulkString(d.pattern)
+			}
+			conn.WriteBulkString(channel)
+			conn.WriteBulk(message)
+		})
+	}
+	return len(deliveries)
+}
+
+// activeChannels returns the channels with at least one subscriber that match pattern
+// (all of them if pattern is empty), sorted.
+func (h *pubSubHub) activeChannels(pattern string) []string {
+	h.RLock()
+	defer h.RUnlock()
+
+	channels := make([]string, 0)
+	for channel := range h.channels {
+		if pattern == "" || globutils.Match(pattern, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+func (h *pubSubHub) numSub(channel string) int {
+	h.RLock()
+	defer h.RUnlock()
+
+	return len(h.channels[channel])
+}
+
+func (h *pubSubHub) numPat() int {
+	h.RLock()
+	defer h.RUnlock()
+
+	return len(h.patterns)
+}
+
+// Subscribe implements SUBSCRIBE channel [channel ...] and PSUBSCRIBE pattern [pattern ...].
+// The first subscription of a client detaches its connection, which Dispatch then serves.
+var Subscribe CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	s := sessionOf(conn)
+	if s.executing {
+		conn.WriteError(SubscribeInTxErrorMsg)
+		return
+	}
+
+	sub := s.subscriber
+	if sub == nil {
+		sub = &subscriber{
+			conn:     conn.Detach(),
+			channels: make(map[string]struct{}),
+			patterns: make(map[string]struct{}),
+		}
+		s.subscriber = sub
+
+		// from now on, messages can be delivered concurrently: the replies go first
+		sub.mu.Lock()
+		defer func() {
+			_ = sub.conn.Flush()
+			sub.mu.Unlock()
+		}()
+	}
+
+	kind := strings.ToLower(string(args[0]))
+	for _, name := range args[1:] {
+		s.server.pubSub.subscribe(sub, kind == "psubscribe", string(name))
+		writeSubscription(sub.conn, kind, name, sub.count())
+	}
+	sub.updateSessionInfo(s)
+}
+
+// Unsubscribe implements UNSUBSCRIBE [channel ...] and PUNSUBSCRIBE [pattern ...]:
+// without arguments, the client unsubscribes from all its channels (or patterns).
+var Unsubscribe CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	kind := strings.ToLower(string(args[0]))
+	pattern := kind == "punsubscribe"
+
+	s := sessionOf(conn)
+	sub := s.subscriber
+	if sub == nil {
+		// never subscribed: there is nothing to unsubscribe from
+		if len(args) == 1 {
+			writeSubscription(conn, kind, nil, 0)
+		}
+		for _, name := range args[1:] {
+			writeSubscription(conn, kind, name, 0)
+		}
+		return
+	}
+
+	var names [][]byte
+	names = append(names, args[1:]...)
+	if len(names) == 0 {
+		for _, name := range sub.subscriptions(pattern) {
+			names = append(names, []byte(name))
+		}
+		if len(names) == 0 {
+			writeSubscription(conn, kind, nil, sub.count())
+		}
+	}
+	for _, name := range names {
+		s.server.pubSub.unsubscribe(sub, pattern, string(name))
+		writeSubscription(conn, kind, name, sub.count())
+	}
+	sub.updateSessionInfo(s)
+}
+
+// Publish implements PUBLISH channel message, and replies with the number of deliveries.
+var Publish CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	conn.WriteInt(serverOf(conn).pubSub.publish(string(args[1]), args[2]))
+}
+
+// PubSub implements PUBSUB CHANNELS [pattern], PUBSUB NUMSUB [channel ...] and PUBSUB NUMPAT.
+var PubSub CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	hub := serverOf(conn).pubSub
+	switch subcommand := strings.ToLower(string(args[1])); {
+	case subcommand == "channels" && len(args) <= 3:
+		pattern := ""
+		if len(args) == 3 {
+			pattern = string(args[2])
+		}
+		WriteRedisArray(conn, hub.activeChannels(pattern))
+	case subcommand == "numsub":
+		conn.WriteArray(2 * (len(args) - 2))
+		for _, channel := range args[2:] {
+			conn.WriteBulk(channel)
+			conn.WriteInt(hub.numSub(string(channel)))
+		}
+	case subcommand == "numpat" && len(args) == 2:
+		conn.WriteInt(hub.numPat())
+	default:
+		conn.WriteError(fmt.Sprintf(UnknownSubcommandErrorMsg, string(args[1]), "PUBSUB"))
+	}
+}
+
+// writeSubscription writes the confirmation of a (un)subscription: its kind, the channel or
+// pattern (nil when unsubscribing without any subscription), and the number of subscriptions.
+func writeSubscription(conn redcon.Conn, kind string, name []byte, count int) {
+	writePush(conn, 3)
+	conn.WriteBulkString(kind)
+	if name == nil {
+		writeNull(conn)
+	} else {
+		conn.WriteBulk(name)
+	}
+	conn.WriteInt(count)
+}
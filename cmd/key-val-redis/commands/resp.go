@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/tidwall/redcon"
+)
+
+// The reply types that differ between RESP2 and RESP3 (negotiated with HELLO): each client
+// gets the ones of the protocol of its session. redcon only writes RESP2.
+
+// resp3 returns whether the client of conn speaks RESP3.
+func resp3(conn redcon.Conn) bool {
+	return sessionOf(conn).protocol == 3
+}
+
+// writeNull replies with a null: a null bulk string in RESP2.
+func writeNull(conn redcon.Conn) {
+	if resp3(conn) {
+		conn.WriteRaw([]byte("_\r\n"))
+		return
+	}
+	conn.WriteNull()
+}
+
+// writeNullArray replies with a null array, e.g. when a blocking command times out
+// (a plain null in RESP3).
+func writeNullArray(conn redcon.Conn) {
+	if resp3(conn) {
+		conn.WriteRaw([]byte("_\r\n"))
+		return
+	}
+	conn.WriteRaw([]byte("*-1\r\n"))
+}
+
+// writeMap writes the header of a map of count pairs, that must then be written as
+// alternating keys and values (a flat array in RESP2).
+func writeMap(conn redcon.Conn, count int) {
+	if resp3(conn) {
+		conn.WriteRaw([]byte("%" + strconv.Itoa(count) + "\r\n"))
+		return
+	}
+	conn.WriteArray(2 * count)
+}
+
+// writePush writes the header of an out-of-band message of count elements, like a published
+// message (an array in RESP2).
+func writePush(conn redcon.Conn, count int) {
+	if resp3(conn) {
+		conn.WriteRaw([]byte(">" + strconv.Itoa(count) + "\r\n"))
+		return
+	}
+	conn.WriteArray(count)
+}
+
+// writeDouble replies with a floating point number (a bulk string in RESP2).
+func writeDouble(conn redcon.Conn, f float64) {
+	if resp3(conn) {
+		conn.WriteRaw([]byte("," + formatDouble(f) + "\r\n"))
+		return
+	}
+	conn.WriteBulkString(formatDouble(f))
+}
+
+// writeVerbatim replies with a text meant to be displayed as is (a bulk string in RESP2).
+func writeVerbatim(conn redcon.Conn, text string) {
+	if resp3(conn) {
+		conn.WriteRaw([]byte("=" + strconv.Itoa(len(text)+4) + "\r\ntxt:" + text + "\r\n"))
+		return
+	}
+	conn.WriteBulkString(text)
+}
+
+// formatDouble formats a floating point number the way Redis replies it.
+func formatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
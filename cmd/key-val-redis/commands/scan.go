@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"strconv"
+	"strings"
+
+	"KeyValor/internal/utils/globutils"
+)
+
+const (
+	InvalidCursorErrorMsg = "ERR invalid cursor"
+	defaultScanCount      = 10
+)
+
+// scanOptions are the arguments of the *SCAN commands.
+type scanOptions struct {
+	cursor   uint64
+	match    string
+	count    int
+	noValues bool
+	typ      string
+}
+
+// parseScanOptions parses "cursor [MATCH pattern] [COUNT count] [NOVALUES] [TYPE type]",
+// or returns the error reply. NOVALUES (HSCAN) and TYPE (SCAN) are only accepted if allowed.
+func parseScanOptions(args [][]byte, allowNoValues, allowType bool) (scanOptions, string) {
+	opts := scanOptions{match: "*", count: defaultScanCount}
+
+	cursor, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil {
+		return opts, InvalidCursorErrorMsg
+	}
+	opts.cursor = cursor
+
+	for i := 1; i < len(args); i++ {
+		switch option := strings.ToLower(string(args[i])); {
+		case option == "match" && i+1 < len(args):
+			opts.match = string(args[i+1])
+			i++
+		case option == "count" && i+1 < len(args):
+			count, ok := parseInt(args[i+1])
+			if !ok {
+				return opts, NotIntegerErrorMsg
+			}
+			if count < 1 {
+				return opts, SyntaxErrorMsg
+			}
+			opts.count = int(min(count, int64(^uint(0)>>1)))
+			i++
+		case option == "novalues" && allowNoValues:
+			opts.noValues = true
+		case option == "type" && allowType && i+1 < len(args):
+			opts.typ = strings.ToLower(string(args[i+1]))
+			i++
+		default:
+			return opts, SyntaxErrorMsg
+		}
+	}
+	return opts, ""
+}
+
+// scanSorted returns the page of sorted elements starting at the cursor, filtered by the
+// MATCH pattern, and the cursor of the next page (0 once the end is reached).
+// The cursor is an offset in the sorted elements, so elements present during a whole scan
+// are returned at least once.
+func scanSorted(elements []string, opts scanOptions) ([]string, uint64) {
+	if opts.cursor >= uint64(len(elements)) {
+		return nil, 0
+	}
+
+	start := int(opts.cursor)
+	end := min(start+opts.count, len(elements))
+	if end < start {
+		// start + count overflowed
+		end = len(elements)
+	}
+
+	var page []string
+	for _, element := range elements[start:end] {
+		if opts.match == "*" || globutils.Match(opts.match, element) {
+			page = append(page, element)
+		}
+	}
+
+	if end == len(elements) {
+		return page, 0
+	}
+	return page, uint64(end)
+}
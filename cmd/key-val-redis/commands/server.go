@@ -0,0 +1,251 @@
+package commands
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor/log"
+)
+
+const (
+	ShuttingDownErrorMsg   = "ERR The server is shutting down"
+	ShutdownFailedErrorMsg = "ERR Errors trying to SHUTDOWN. Check logs."
+)
+
+// ErrServerClosed is returned by Serve once the server was shut down.
+var ErrServerClosed = errors.New("server closed")
+
+// Server serves databases over RESP, and owns them: Shutdown, on a signal or for the
+// SHUTDOWN command, stops serving and shuts them down.
+type Server struct {
+	dbs *Databases
+	// config is the configuration the server started with, changed by CONFIG SET
+	config *ServerConfig
+	stats  *serverStatistics
+	// notifications are the keyspace events published, see enabledKeyspaceEvents
+	notifications atomic.Uint32
+	// slowLog and latency are the commands and events timed for SLOWLOG and LATENCY
+	slowLog *commandLog
+	latency *latencyMonitor
+	// listWaiters are the clients blocked on keys, e.g. by BLPOP
+	listWaiters *waiterQueues
+	// mu is locked by the commands, to run atomically (see CommandFunc)
+	mu sync.RWMutex
+
+	shutdownTimeout time.Duration
+
+	// gate admits the commands while the server runs, counting them in inFlight
+	gate     sync.Mutex
+	stopping bool
+	inFlight sync.WaitGroup
+	lns      []*drainListener
+
+	// closing is closed when the server starts shutting down, so that blocked clients stop
+	// waiting; drained once the commands in flight are done, and stopped once it shut down
+	closing chan struct{}
+	drained chan struct{}
+	stopped chan struct{}
+	stopErr error
+
+	// clients are the sessions of the connected clients, acl the users they authenticate as,
+	// pubSub their subscriptions, and monitors those that ran MONITOR
+	clients  *clientRegistry
+	acl      *aclRegistry
+	pubSub   *pubSubHub
+	monitors *monitorHub
+}
+
+// NewServer returns a server of the databases dbs, configured by cfg: it enables its keyspace
+// notifications, and configures SLOWLOG and LATENCY. Its ACL users are the default user alone,
+// with the password of requirepass if any: see LoadACLFile.
+func NewServer(cfg *ServerConfig, dbs *Databases) *Server {
+	srv := &Server{
+		dbs:             dbs,
+		config:          cfg,
+		stats:           newServerStatistics(),
+		slowLog:         newCommandLog(),
+		latency:         newLatencyMonitor(),
+		listWaiters:     newWaiterQueues(),
+		shutdownTimeout: cfg.ShutdownTimeout,
+		closing:         make(chan struct{}),
+		drained:         make(chan struct{}),
+		stopped:         make(chan struct{}),
+		clients:         newClientRegistry(),
+		acl:             newACLRegistry(),
+		pubSub:          newPubSubHub(),
+		monitors:        newMonitorHub(),
+	}
+	if cfg.RequirePass != "" {
+		srv.acl.requirePass(cfg.RequirePass)
+	}
+	// the value was validated when it was set
+	events, _ := parseKeyspaceEvents(cfg.NotifyKeyspaceEvents)
+	srv.notifications.Store(uint32(events))
+	srv.slowLog.slowerThan.Store(cfg.SlowlogLogSlowerThan)
+	srv.slowLog.maxLen.Store(cfg.SlowlogMaxLen)
+	srv.latency.threshold.Store(cfg.LatencyMonitorThreshold)
+
+	// the databases report to srv
+	dbs.server.Store(srv)
+	return srv
+}
+
+// drainListener is the listener of a server. Once it is closed, it refuses the connections,
+// but doesn't tell redcon until the commands in flight are drained: redcon closes all the
+// connections it serves as soon as it notices.
+type drainListener struct {
+	net.Listener
+	drained <-chan struct{}
+}
+
+func (dl *drainListener) Accept() (net.Conn, error) {
+	conn, err := dl.Listener.Accept()
+	if errors.Is(err, net.ErrClosed) {
+		<-dl.drained
+	}
+	return conn, err
+}
+
+// ListenAndServe listens on addr, and serves the clients until the server is shut down.
+func (srv *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(ln)
+}
+
+// ListenAndServeTLS listens on addr, and serves the clients over TLS with the certificates
+// certs until the server is shut down.
+func (srv *Server) ListenAndServeTLS(addr string, certs *TLSCertificates) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return srv.ServeTLS(ln, certs)
+}
+
+// ServeTLS is like Serve, over TLS with the certificates certs.
+func (srv *Server) ServeTLS(ln net.Listener, certs *TLSCertificates) error {
+	return srv.Serve(tls.NewListener(ln, certs.Config()))
+}
+
+// Serve serves the clients that connect to ln until the server is shut down: it then returns
+// ErrServerClosed, or the error of the shutdown of the databases, once they are shut down.
+// A server can serve several listeners at once, e.g. with and without TLS.
+func (srv *Server) Serve(ln net.Listener) error {
+	srv.gate.Lock()
+	if srv.stopping {
+		srv.gate.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	dl := &drainListener{Listener: ln, drained: srv.drained}
+	srv.lns = append(srv.lns, dl)
+	srv.gate.Unlock()
+
+	rs := redcon.NewServerNetwork(ln.Addr().Network(), ln.Addr().String(),
+		func(conn redcon.Conn, cmd redcon.Command) {
+			if len(cmd.Args) == 0 {
+				conn.WriteError("ERR no arguments for command: [" + string(cmd.Raw) + "]")
+				return
+			}
+			srv.Dispatch(conn, cmd.Args)
+		},
+		func(conn redcon.Conn) bool {
+			// clients authenticate with AUTH: see Dispatch
+			srv.OpenSession(conn)
+			return true
+		},
+		func(conn redcon.Conn, err error) {
+			log.Debugf("closed: %s, err: %v", conn.RemoteAddr(), err)
+			CloseSession(conn)
+		},
+	)
+	err := rs.Serve(dl)
+
+	select {
+	case <-srv.closing:
+		<-srv.stopped
+		if srv.stopErr != nil {
+			return srv.stopErr
+		}
+		return ErrServerClosed
+	default:
+		return err
+	}
+}
+
+// admit counts a command in flight, unless the server is shutting down.
+func (srv *Server) admit() bool {
+	srv.gate.Lock()
+	defer srv.gate.Unlock()
+
+	if srv.stopping {
+		return false
+	}
+	srv.inFlight.Add(1)
+	return true
+}
+
+// Shutdown shuts the server down: it refuses new connections and commands, waits for the
+// commands in flight (the blocked clients stop waiting), and closes the connections once
+// they are done or the shutdown timeout expired. It then waits for the commands still
+// running, and shuts the databases down, syncing their data files and persisting their
+// index unless save is false: the writes since the last checkpoint are then lost, even
+// though they are in the data files. The first call does it, and the next ones wait for
+// it and return its error.
+func (srv *Server) Shutdown(save bool) error {
+	srv.gate.Lock()
+	first := !srv.stopping
+	srv.stopping = true
+	srv.gate.Unlock()
+
+	if first {
+		srv.stopErr = srv.shutdown(save)
+		close(srv.stopped)
+	}
+	<-srv.stopped
+	return srv.stopErr
+}
+
+func (srv *Server) shutdown(save bool) error {
+	// no listener is added once stopping is set
+	for _, ln := range srv.lns {
+		ln.Listener.Close()
+	}
+	close(srv.closing)
+
+	done := make(chan struct{})
+	go func() {
+		srv.inFlight.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(srv.shutdownTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		log.Warnf("closing the connections with commands still running after %s", srv.shutdownTimeout)
+	}
+	close(srv.drained)
+
+	// the connections detached by SUBSCRIBE or MONITOR aren't closed by redcon
+	for _, s := range srv.clients.sessions() {
+		s.kill()
+	}
+
+	// the databases are only closed once no command runs on them
+	<-done
+
+	if !save {
+		return srv.dbs.ShutdownWithoutCheckpoint()
+	}
+	return srv.dbs.Shutdown()
+}
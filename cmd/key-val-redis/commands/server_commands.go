@@ -0,0 +1,417 @@
+package commands
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+	"KeyValor/dbops"
+	"KeyValor/log"
+)
+
+const (
+	BgsaveInProgressErrorMsg = "ERR Background save already in progress"
+	NoConfigFileErrorMsg     = "ERR The server is running without a config file"
+)
+
+// serverStatistics are the counters of INFO, since the server started or CONFIG RESETSTAT.
+type serverStatistics struct {
+	started time.Time
+	runID   string
+
+	connections    atomic.Int64
+	commands       atomic.Int64
+	keyspaceHits   atomic.Int64
+	keyspaceMisses atomic.Int64
+	blockedClients atomic.Int64
+
+	bgsaveInProgress atomic.Bool
+	bgsaveFailed     atomic.Bool
+}
+
+func newServerStatistics() *serverStatistics {
+	id := make([]byte, 20)
+	_, _ = rand.Read(id)
+	return &serverStatistics{started: time.Now(), runID: hex.EncodeToString(id)}
+}
+
+// reset resets the counters of INFO stats, for CONFIG RESETSTAT.
+func (ss *serverStatistics) reset() {
+	ss.connections.Store(0)
+	ss.commands.Store(0)
+	ss.keyspaceHits.Store(0)
+	ss.keyspaceMisses.Store(0)
+}
+
+// keyspaceStats is an interceptor of the databases, see OpenDatabases, that counts the lookups
+// of string values that found them, or not, for the keyspace_hits and keyspace_misses of INFO
+// stats of their server. The lookups of the other data types can't be counted: a missing
+// collection is read as an empty one.
+func (d *Databases) keyspaceStats(call *dbops.Call, next dbops.Invoker) error {
+	err := next()
+	srv := d.server.Load()
+	if srv != nil && call.Invoked && (call.Op == dbops.OpGet || call.Op == dbops.OpGetWithExpiry) {
+		switch {
+		case err == nil:
+			srv.stats.keyspaceHits.Add(1)
+		case isMissingKey(err):
+			srv.stats.keyspaceMisses.Add(1)
+		}
+	}
+	return err
+}
+
+// infoSection is a section of INFO, whose fields are "name:value" lines.
+type infoSection struct {
+	name   string
+	fields func(srv *Server) []string
+}
+
+// infoSections are the sections of INFO, in the order they are replied.
+var infoSections = []infoSection{
+	{"Server", serverInfo},
+	{"Clients", clientsInfo},
+	{"Memory", memoryInfo},
+	{"Persistence", persistenceInfo},
+	{"Stats", statsInfo},
+	{"Keyspace", keyspaceInfo},
+}
+
+// Info implements INFO [section [section ...]], with the sections server, clients, memory,
+// persistence, stats and keyspace (all of them by default, or for "all" and "everything").
+var Info CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	requested := make(map[string]bool)
+	for _, arg := range args[1:] {
+		requested[strings.ToLower(string(arg))] = true
+	}
+	srv := serverOf(conn)
+	all := len(requested) == 0 || requested["default"] || requested["all"] || requested["everything"]
+
+	var info strings.Builder
+	for _, section := range infoSections {
+		if !all && !requested[strings.ToLower(section.name)] {
+			continue
+		}
+
+		if info.Len() > 0 {
+			info.WriteString("\r\n")
+		}
+		info.WriteString("# " + section.name + "\r\n")
+		for _, field := range section.fields(srv) {
+			info.WriteString(field + "\r\n")
+		}
+	}
+	writeVerbatim(conn, info.String())
+}
+
+func serverInfo(srv *Server) []string {
+	executable, _ := os.Executable()
+	uptime := time.Since(srv.stats.started)
+
+	return []string{
+		"redis_version:" + redisCompatibleVersion,
+		"redis_mode:standalone",
+		"os:" + runtime.GOOS + " " + runtime.GOARCH,
+		fmt.Sprintf("arch_bits:%d", 32<<(^uint(0)>>63)),
+		"go_version:" + runtime.Version(),
+		fmt.Sprintf("process_id:%d", os.Getpid()),
+		"run_id:" + srv.stats.runID,
+		fmt.Sprintf("tcp_port:%d", srv.config.Port),
+		fmt.Sprintf("server_time_usec:%d", time.Now().UnixMicro()),
+		fmt.Sprintf("uptime_in_seconds:%d", int64(uptime.Seconds())),
+		fmt.Sprintf("uptime_in_days:%d", int64(uptime.Hours()/24)),
+		"executable:" + executable,
+		"config_file:" + srv.config.File,
+	}
+}
+
+func clientsInfo(srv *Server) []string {
+	pubsubClients := 0
+	sessions := srv.clients.sessions()
+	for _, s := range sessions {
+		if info := s.currentInfo(); info.sub+info.psub > 0 {
+			pubsubClients++
+		}
+	}
+
+	return []string{
+		fmt.Sprintf("connected_clients:%d", len(sessions)),
+		fmt.Sprintf("blocked_clients:%d", srv.stats.blockedClients.Load()),
+		fmt.Sprintf("pubsub_clients:%d", pubsubClients),
+	}
+}
+
+func memoryInfo(srv *Server) []string {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	return []string{
+		fmt.Sprintf("used_memory:%d", m.HeapAlloc),
+		"used_memory_human:" + bytesToHuman(int64(m.HeapAlloc)),
+		fmt.Sprintf("used_memory_rss:%d", m.Sys),
+		"used_memory_rss_human:" + bytesToHuman(int64(m.Sys)),
+		"mem_allocator:go",
+		fmt.Sprintf("gc_cycles:%d", m.NumGC),
+	}
+}
+
+func persistenceInfo(srv *Server) []string {
+	stats := srv.dbs.stats()
+
+	bgsaveStatus := "ok"
+	if srv.stats.bgsaveFailed.Load() {
+		bgsaveStatus = "err"
+	}
+	lastCompaction := int64(-1)
+	if !stats.LastCompaction.IsZero() {
+		lastCompaction = stats.LastCompaction.Unix()
+	}
+
+	return []string{
+		"loading:0",
+		fmt.Sprintf("rdb_changes_since_last_save:%d", stats.ChangesSinceCheckpoint),
+		fmt.Sprintf("rdb_bgsave_in_progress:%d", boolToInt(srv.stats.bgsaveInProgress.Load())),
+		fmt.Sprintf("rdb_last_save_time:%d", stats.LastCheckpoint.Unix()),
+		"rdb_last_bgsave_status:" + bgsaveStatus,
+		"aof_enabled:0",
+		fmt.Sprintf("index_checkpoints:%d", stats.Checkpoints),
+		fmt.Sprintf("data_files:%d", stats.DataFiles),
+		fmt.Sprintf("disk_bytes:%d", stats.DiskBytes),
+		"disk_bytes_human:" + bytesToHuman(stats.DiskBytes),
+		fmt.Sprintf("compactions:%d", stats.Compactions),
+		fmt.Sprintf("last_compaction_time:%d", lastCompaction),
+		fmt.Sprintf("file_rotations:%d", stats.FileRotations),
+	}
+}
+
+func statsInfo(srv *Server) []string {
+	return []string{
+		fmt.Sprintf("total_connections_received:%d", srv.stats.connections.Load()),
+		fmt.Sprintf("total_commands_processed:%d", srv.stats.commands.Load()),
+		fmt.Sprintf("keyspace_hits:%d", srv.stats.keyspaceHits.Load()),
+		fmt.Sprintf("keyspace_misses:%d", srv.stats.keyspaceMisses.Load()),
+		fmt.Sprintf("pubsub_channels:%d", len(srv.pubSub.activeChannels("*"))),
+		fmt.Sprintf("pubsub_patterns:%d", srv.pubSub.numPat()),
+	}
+}
+
+func keyspaceInfo(srv *Server) []string {
+	var fields []string
+	for i, db := range srv.dbs.all() {
+		stats := db.Stats()
+		if stats.Keys == 0 {
+			continue
+		}
+		// the average TTL isn't tracked
+		fields = append(fields, fmt.Sprintf("db%d:keys=%d,expires=%d,avg_ttl=0", i, stats.Keys, stats.KeysWithExpiry))
+	}
+	return fields
+}
+
+// bytesToHuman formats a size like Redis does in INFO, e.g. 1.50M.
+func bytesToHuman(n int64) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%dB", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.2fK", float64(n)/1024)
+	case n < 1024*1024*1024:
+		return fmt.Sprintf("%.2fM", float64(n)/(1024*1024))
+	default:
+		return fmt.Sprintf("%.2fG", float64(n)/(1024*1024*1024))
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// DBSize implements DBSIZE.
+var DBSize CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 1 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	conn.WriteInt(db.Stats().Keys)
+}
+
+// FlushDB implements FLUSHDB [ASYNC|SYNC]: it deletes every key of the selected database,
+// and its data files. It is always synchronous.
+var FlushDB CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	flush(conn, args, mu, []*KeyValor.KeyValorDatabase{db})
+}
+
+// FlushAll implements FLUSHALL [ASYNC|SYNC]: FLUSHDB for every database.
+var FlushAll CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	flush(conn, args, mu, sessionOf(conn).databases.all())
+}
+
+// flush clears the databases, for FLUSHDB and FLUSHALL.
+func flush(conn redcon.Conn, args [][]byte, mu *sync.RWMutex, dbs []*KeyValor.KeyValorDatabase) {
+	if len(args) > 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+	if len(args) == 2 {
+		if mode := strings.ToLower(string(args[1])); mode != "async" && mode != "sync" {
+			conn.WriteError(SyntaxErrorMsg)
+			return
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, db := range dbs {
+		if err := db.Clear(); err != nil {
+			writeDBError(conn, err)
+			return
+		}
+	}
+	conn.WriteString("OK")
+}
+
+// Save implements SAVE: it persists the index of every database, with the data files synced.
+var Save CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 1 {
+		writeWrongArgs(conn, args)
+		return
+	}
+	srv := serverOf(conn)
+	if srv.stats.bgsaveInProgress.Load() {
+		conn.WriteError(BgsaveInProgressErrorMsg)
+		return
+	}
+
+	if err := srv.dbs.checkpoint(); err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteString("OK")
+}
+
+// Bgsave implements BGSAVE [SCHEDULE]: SAVE in the background. The writes are only blocked
+// while the index is copied.
+var Bgsave CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) > 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+	if len(args) == 2 && strings.ToLower(string(args[1])) != "schedule" {
+		conn.WriteError(SyntaxErrorMsg)
+		return
+	}
+
+	srv := serverOf(conn)
+	if !srv.stats.bgsaveInProgress.CompareAndSwap(false, true) {
+		conn.WriteError(BgsaveInProgressErrorMsg)
+		return
+	}
+	go func() {
+		defer srv.stats.bgsaveInProgress.Store(false)
+		srv.stats.bgsaveFailed.Store(srv.dbs.checkpoint() != nil)
+	}()
+	conn.WriteString("Background saving started")
+}
+
+// Shutdown implements SHUTDOWN [NOSAVE|SAVE]: it shuts the server down, see
+// Server.Shutdown. Unless NOSAVE is given, the databases are first checkpointed, and the
+// server keeps running if that fails; with NOSAVE, the writes since the last checkpoint (at
+// most sync-write-interval ago) are lost, like those since the last save in Redis. On
+// success, the client gets no reply: the connection is closed.
+var Shutdown CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) > 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+	save := true
+	if len(args) == 2 {
+		switch strings.ToLower(string(args[1])) {
+		case "save":
+		case "nosave":
+			save = false
+		default:
+			conn.WriteError(SyntaxErrorMsg)
+			return
+		}
+	}
+
+	s := sessionOf(conn)
+	if save {
+		if err := s.databases.checkpoint(); err != nil {
+			log.Errorf("cannot save before shutting down: %v", err)
+			conn.WriteError(ShutdownFailedErrorMsg)
+			return
+		}
+	}
+
+	log.Infof("shutting down for SHUTDOWN, from %s", conn.RemoteAddr())
+	// Shutdown waits for the commands in flight, this one included
+	go s.server.Shutdown(save)
+}
+
+// LastSave implements LASTSAVE: the Unix time of the last time the indexes of all the
+// databases were persisted.
+var LastSave CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 1 {
+		writeWrongArgs(conn, args)
+		return
+	}
+	conn.WriteInt64(sessionOf(conn).databases.stats().LastCheckpoint.Unix())
+}
@@ -0,0 +1,674 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"KeyValor"
+	"KeyValor/config"
+	"KeyValor/internal/utils/fileutils"
+	"KeyValor/log"
+)
+
+const hashTableEngine = "hashtable"
+
+// the defaults of Redis' slowlog-log-slower-than (in microseconds) and slowlog-max-len
+const (
+	defaultSlowlogLogSlowerThan = 10000
+	defaultSlowlogMaxLen        = 128
+)
+
+// ServerConfig is the configuration of the server: its own parameters, and the options of
+// its databases. It is read from a config file, and from the command-line flags of the
+// same names, which override it; every value is validated as it is set.
+type ServerConfig struct {
+	Bind          string
+	Port          int
+	Dir           string
+	LogDir        string
+	LogLevel      log.Level
+	Databases     int
+	StorageEngine string
+	RequirePass   string
+	ACLFile       string
+	// TLSPort is the port of the TLS listener, if not 0; its certificates are in the files
+	// TLSCertFile and TLSKeyFile, and those of the CAs of the client certificates, that
+	// TLSAuthClients may require, in TLSCACertFile
+	TLSPort        int
+	TLSCertFile    string
+	TLSKeyFile     string
+	TLSCACertFile  string
+	TLSAuthClients string
+	// NotifyKeyspaceEvents are the classes of keyspace notifications published, like "Ex"
+	NotifyKeyspaceEvents string
+	// ShutdownTimeout is how long the server waits for the commands in flight when it shuts down,
+	// before closing the connections (the databases are closed once the commands are done)
+	ShutdownTimeout time.Duration
+	// SlowlogLogSlowerThan is the duration, in microseconds, of the commands logged by SLOWLOG
+	// (every command if 0, none if negative), which keeps the SlowlogMaxLen latest ones
+	SlowlogLogSlowerThan int64
+	SlowlogMaxLen        int64
+	// LatencyMonitorThreshold is the duration, in milliseconds, of the events recorded by
+	// LATENCY (none if 0)
+	LatencyMonitorThreshold int64
+
+	// DB are the options of every database (but their Directory, a sub-directory of Dir)
+	DB config.DBCfgOpts
+
+	// File is the absolute path of the config file, if the configuration was read from one
+	File string
+}
+
+// DefaultServerConfig returns the configuration of a server started without a config file
+// or flags: it listens on port 6379 of all the interfaces, and keeps its data and logs in
+// the home directory.
+func DefaultServerConfig() *ServerConfig {
+	homeDir, _ := os.UserHomeDir()
+	return &ServerConfig{
+		Port:           6379,
+		Dir:            filepath.Join(homeDir, "keyvalor"),
+		LogDir:         filepath.Join(homeDir, "keyvalorlogs"),
+		LogLevel:       log.InfoLevel,
+		Databases:      16,
+		StorageEngine:  hashTableEngine,
+		TLSAuthClients: "no",
+		// like Redis' shutdown-timeout
+		ShutdownTimeout:      10 * time.Second,
+		SlowlogLogSlowerThan: defaultSlowlogLogSlowerThan,
+		SlowlogMaxLen:        defaultSlowlogMaxLen,
+		DB:                   *config.DefaultOpts(),
+	}
+}
+
+// Addr returns the address to listen on.
+func (c *ServerConfig) Addr() string {
+	return net.JoinHostPort(c.Bind, strconv.Itoa(c.Port))
+}
+
+// TLSAddr returns the address of the TLS listener.
+func (c *ServerConfig) TLSAddr() string {
+	return net.JoinHostPort(c.Bind, strconv.Itoa(c.TLSPort))
+}
+
+// Validate checks the parameters that depend on each other, once they are all set.
+func (c *ServerConfig) Validate() error {
+	switch {
+	case c.Port == 0 && c.TLSPort == 0:
+		return errors.New("port and tls-port are both 0: the server must listen on one of them")
+	case c.TLSPort != 0 && (c.TLSCertFile == "" || c.TLSKeyFile == ""):
+		return errors.New("tls-port requires tls-cert-file and tls-key-file")
+	case c.TLSAuthClients != "no" && c.TLSCACertFile == "":
+		return fmt.Errorf("tls-auth-clients %s requires tls-ca-cert-file", c.TLSAuthClients)
+	}
+	return nil
+}
+
+// Options returns the options to open the databases with.
+func (c *ServerConfig) Options() []KeyValor.Option {
+	return []KeyValor.Option{
+		KeyValor.WithSyncWriteInterval(c.DB.SyncWriteInterval),
+		KeyValor.WithCompactInterval(c.DB.CompactInterval),
+		KeyValor.WithCheckFileSizeInterval(c.DB.CheckFileSizeInterval),
+		KeyValor.WithActiveExpireInterval(c.DB.ActiveExpireInterval),
+		KeyValor.WithMaxActiveFileSize(c.DB.MaxActiveFileSize),
+		KeyValor.WithSyncPolicy(c.DB.SyncPolicy),
+		KeyValor.WithDefaultTTL(c.DB.DefaultTTL),
+		KeyValor.WithCompression(c.DB.Compression),
+	}
+}
+
+// serverParam is a parameter of the config file, and the flag of the same name.
+type serverParam struct {
+	usage string
+	// kind is the type of the flag, as shown by -h
+	kind paramKind
+	get  func(c *ServerConfig) string
+	set  func(c *ServerConfig, value string) error
+}
+
+// paramKind is the type of the flag of a serverParam.
+type paramKind int
+
+const (
+	stringFlag paramKind = iota
+	intFlag
+	durationFlag
+)
+
+// serverParams are the parameters of the config file. Those of the databases have the names
+// of their CONFIG GET parameters, so that CONFIG REWRITE can write their current values.
+var serverParams = map[string]serverParam{
+	"bind": {
+		usage: "address to listen on (all the interfaces if empty)",
+		get:   func(c *ServerConfig) string { return c.Bind },
+		set: func(c *ServerConfig, value string) error {
+			if value != "" && net.ParseIP(value) == nil && !isHostName(value) {
+				return errors.New("must be an IP address or a host name")
+			}
+			c.Bind = value
+			return nil
+		},
+	},
+	"port": {
+		usage: "TCP port to listen on (0 doesn't listen without TLS)",
+		kind:  intFlag,
+		get:   func(c *ServerConfig) string { return strconv.Itoa(c.Port) },
+		set: func(c *ServerConfig, value string) error {
+			port, err := parsePort(value)
+			if err != nil {
+				return err
+			}
+			c.Port = port
+			return nil
+		},
+	},
+	"tls-port": {
+		usage: "TCP port of the TLS listener (0 disables TLS)",
+		kind:  intFlag,
+		get:   func(c *ServerConfig) string { return strconv.Itoa(c.TLSPort) },
+		set: func(c *ServerConfig, value string) error {
+			port, err := parsePort(value)
+			if err != nil {
+				return err
+			}
+			c.TLSPort = port
+			return nil
+		},
+	},
+	"tls-cert-file": {
+		usage: "PEM certificate of the TLS listener, reloaded on SIGHUP",
+		get:   func(c *ServerConfig) string { return c.TLSCertFile },
+		set: func(c *ServerConfig, value string) error {
+			return setOptionalPath(&c.TLSCertFile, value)
+		},
+	},
+	"tls-key-file": {
+		usage: "PEM private key of tls-cert-file, reloaded on SIGHUP",
+		get:   func(c *ServerConfig) string { return c.TLSKeyFile },
+		set: func(c *ServerConfig, value string) error {
+			return setOptionalPath(&c.TLSKeyFile, value)
+		},
+	},
+	"tls-ca-cert-file": {
+		usage: "PEM bundle of the CAs of the client certificates, reloaded on SIGHUP",
+		get:   func(c *ServerConfig) string { return c.TLSCACertFile },
+		set: func(c *ServerConfig, value string) error {
+			return setOptionalPath(&c.TLSCACertFile, value)
+		},
+	},
+	"tls-auth-clients": {
+		usage: "whether TLS clients need a certificate signed by tls-ca-cert-file: yes, no or optional",
+		get:   func(c *ServerConfig) string { return c.TLSAuthClients },
+		set: func(c *ServerConfig, value string) error {
+			value = strings.ToLower(value)
+			if _, ok := tlsAuthClients[value]; !ok {
+				return errors.New("must be yes, no or optional")
+			}
+			c.TLSAuthClients = value
+			return nil
+		},
+	},
+	"dir": {
+		usage: "data directory, with a sub-directory per database",
+		get:   func(c *ServerConfig) string { return c.Dir },
+		set: func(c *ServerConfig, value string) error {
+			return setPath(&c.Dir, value)
+		},
+	},
+	"logdir": {
+		usage: "directory of the log files",
+		get:   func(c *ServerConfig) string { return c.LogDir },
+		set: func(c *ServerConfig, value string) error {
+			return setPath(&c.LogDir, value)
+		},
+	},
+	"loglevel": {
+		usage: "minimum level of the logged messages: debug, info, warn or error",
+		get:   func(c *ServerConfig) string { return c.LogLevel.String() },
+		set: func(c *ServerConfig, value string) (err error) {
+			c.LogLevel, err = log.ParseLevel(strings.ToLower(value))
+			return err
+		},
+	},
+	"databases": {
+		usage: "number of databases, selected with SELECT",
+		kind:  intFlag,
+		get:   func(c *ServerConfig) string { return strconv.Itoa(c.Databases) },
+		set: func(c *ServerConfig, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return errors.New("must be a number of at least 1")
+			}
+			c.Databases = n
+			return nil
+		},
+	},
+	"storage-engine": {
+		usage: "storage engine of the databases: hashtable",
+		get:   func(c *ServerConfig) string { return c.StorageEngine },
+		set: func(c *ServerConfig, value string) error {
+			switch value = strings.ToLower(value); value {
+			case hashTableEngine:
+				c.StorageEngine = value
+				return nil
+			case "lsmtree":
+				return fmt.Errorf("storage engine %q is not supported by the server (supported: hashtable)", value)
+			default:
+				return fmt.Errorf("unknown storage engine %q (supported: hashtable)", value)
+			}
+		},
+	},
+	"requirepass": {
+		usage: "password of the default user",
+		get:   func(c *ServerConfig) string { return c.RequirePass },
+		set: func(c *ServerConfig, value string) error {
+			c.RequirePass = value
+			return nil
+		},
+	},
+	"aclfile": {
+		usage: "file of the ACL users",
+		get:   func(c *ServerConfig) string { return c.ACLFile },
+		set: func(c *ServerConfig, value string) error {
+			c.ACLFile = value
+			return nil
+		},
+	},
+	"notify-keyspace-events": {
+		usage: "keyspace notifications published: K and/or E, with event classes like g$x, or A for all",
+		get:   func(c *ServerConfig) string { return c.NotifyKeyspaceEvents },
+		set: func(c *ServerConfig, value string) error {
+			events, err := parseKeyspaceEvents(value)
+			if err != nil {
+				return err
+			}
+			c.NotifyKeyspaceEvents = events.String()
+			return nil
+		},
+	},
+	"slowlog-log-slower-than": intServerParam(
+		"duration of the commands logged by SLOWLOG, in microseconds (0 logs every command, -1 none)",
+		func(c *ServerConfig) *int64 { return &c.SlowlogLogSlowerThan },
+		-1),
+	"slowlog-max-len": intServerParam(
+		"number of commands kept by SLOWLOG",
+		func(c *ServerConfig) *int64 { return &c.SlowlogMaxLen },
+		0),
+	"latency-monitor-threshold": intServerParam(
+		"duration of the events recorded by LATENCY, in milliseconds (0 records none)",
+		func(c *ServerConfig) *int64 { return &c.LatencyMonitorThreshold },
+		0),
+	"shutdown-timeout": durationServerParam(
+		"how long the commands in flight are waited for before closing the connections, on shutdown",
+		func(c *ServerConfig) *time.Duration { return &c.ShutdownTimeout },
+		parseDuration),
+
+	"sync-policy": {
+		usage: "when the writes are synced to disk: interval (with every index flush) or always",
+		get:   func(c *ServerConfig) string { return c.DB.SyncPolicy.String() },
+		set: func(c *ServerConfig, value string) (err error) {
+			c.DB.SyncPolicy, err = config.ParseSyncPolicy(strings.ToLower(value))
+			return err
+		},
+	},
+	"sync-write-interval": durationServerParam(
+		"interval of the index flushes, that sync the data files",
+		func(c *ServerConfig) *time.Duration { return &c.DB.SyncWriteInterval },
+		parseInterval),
+	"compact-interval": durationServerParam(
+		"interval of the compactions",
+		func(c *ServerConfig) *time.Duration { return &c.DB.CompactInterval },
+		parseInterval),
+	"check-file-size-interval": durationServerParam(
+		"interval of the checks that rotate the active data file once it is full",
+		func(c *ServerConfig) *time.Duration { return &c.DB.CheckFileSizeInterval },
+		parseInterval),
+	"active-expire-interval": durationServerParam(
+		"interval of the deletion of the expired keys",
+		func(c *ServerConfig) *time.Duration { return &c.DB.ActiveExpireInterval },
+		parseInterval),
+	"default-ttl": durationServerParam(
+		"expiry of the keys written without one (0 never expires them)",
+		func(c *ServerConfig) *time.Duration { return &c.DB.DefaultTTL },
+		parseDuration),
+	"max-active-file-size": {
+		usage: "size of the active data file that rotates it (e.g. 5mb)",
+		get:   func(c *ServerConfig) string { return strconv.FormatInt(c.DB.MaxActiveFileSize, 10) },
+		set: func(c *ServerConfig, value string) (err error) {
+			c.DB.MaxActiveFileSize, err = parseMemory(value)
+			return err
+		},
+	},
+	"compression": {
+		usage: "codec of the values on disk: none or flate",
+		get:   func(c *ServerConfig) string { return c.DB.Compression.String() },
+		set: func(c *ServerConfig, value string) (err error) {
+			c.DB.Compression, err = config.ParseCompression(strings.ToLower(value))
+			return err
+		},
+	},
+}
+
+// durationServerParam returns a parameter for a duration option, set in seconds or as a Go
+// duration (e.g. "90s", "2h").
+func durationServerParam(
+	usage string,
+	field func(c *ServerConfig) *time.Duration,
+	parse func(value string) (time.Duration, error),
+) serverParam {
+	return serverParam{
+		usage: usage,
+		kind:  durationFlag,
+		get:   func(c *ServerConfig) string { return field(c).String() },
+		set: func(c *ServerConfig, value string) error {
+			d, err := parse(value)
+			if err != nil {
+				return err
+			}
+			*field(c) = d
+			return nil
+		},
+	}
+}
+
+// intServerParam returns a parameter for an integer option, of at least minimum.
+func intServerParam(usage string, field func(c *ServerConfig) *int64, minimum int64) serverParam {
+	return serverParam{
+		usage: usage,
+		kind:  intFlag,
+		get:   func(c *ServerConfig) string { return strconv.FormatInt(*field(c), 10) },
+		set: func(c *ServerConfig, value string) error {
+			n, err := parseIntParam(value, minimum)
+			if err != nil {
+				return err
+			}
+			*field(c) = n
+			return nil
+		},
+	}
+}
+
+// parseIntParam parses the value of an integer parameter, of at least minimum.
+func parseIntParam(value string, minimum int64) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, errors.New("argument couldn't be parsed into an integer")
+	}
+	if n < minimum {
+		return 0, fmt.Errorf("argument must be at least %d", minimum)
+	}
+	return n, nil
+}
+
+// setPath sets a directory parameter to the absolute path of value.
+func setPath(field *string, value string) error {
+	if value == "" {
+		return errors.New("must not be empty")
+	}
+	path, err := filepath.Abs(value)
+	if err != nil {
+		return err
+	}
+	*field = path
+	return nil
+}
+
+// setOptionalPath sets a file parameter to the absolute path of value, unless it is empty.
+func setOptionalPath(field *string, value string) error {
+	if value == "" {
+		*field = ""
+		return nil
+	}
+	return setPath(field, value)
+}
+
+// parsePort parses a port number, or 0.
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 0 || port > 65535 {
+		return 0, errors.New("must be a port number between 0 and 65535")
+	}
+	return port, nil
+}
+
+// isHostName returns whether name is a valid host name (RFC 1123).
+func isHostName(name string) bool {
+	if len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Set sets the parameter name, from the config file or a flag.
+func (c *ServerConfig) Set(name, value string) error {
+	param, ok := serverParams[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown parameter %q", name)
+	}
+	if err := param.set(c, value); err != nil {
+		return fmt.Errorf("invalid %s %q: %w", strings.ToLower(name), value, err)
+	}
+	return nil
+}
+
+// isYAML returns whether the config file path is a YAML file, rather than a redis.conf-like one.
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// LoadFile reads the parameters of the config file path: a YAML mapping of the parameters
+// to their values if its extension is .yaml or .yml, and otherwise a file like redis.conf,
+// with a "name value" line per parameter and '#' comments. The errors give the line of the
+// invalid parameter.
+func (c *ServerConfig) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var lines []configLine
+	if isYAML(path) {
+		lines, err = parseYAMLConfig(data)
+	} else {
+		lines, err = parseConfConfig(data)
+	}
+	if err != nil {
+		return fmt.Errorf("%s:%w", path, err)
+	}
+
+	for _, line := range lines {
+		if err := c.Set(line.name, line.value); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line.number, err)
+		}
+	}
+
+	c.File, err = filepath.Abs(path)
+	return err
+}
+
+// configLine is a parameter set by a config file.
+type configLine struct {
+	number      int
+	name, value string
+}
+
+// parseConfConfig parses a redis.conf-like config file, whose values can be double-quoted.
+func parseConfConfig(data []byte) ([]configLine, error) {
+	var lines []configLine
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			name, value = line[:i], strings.TrimSpace(line[i:])
+		}
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("%d: unbalanced quotes in the value of %s", number, name)
+			}
+			value = unquoted
+		}
+		lines = append(lines, configLine{number: number, name: name, value: value})
+	}
+	return lines, scanner.Err()
+}
+
+// parseYAMLConfig parses a YAML config file, a mapping of the parameters to scalar values.
+func parseYAMLConfig(data []byte) ([]configLine, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		// the errors of the YAML parser are like "yaml: line 3: did not find expected key"
+		return nil, errors.New(strings.TrimPrefix(strings.TrimPrefix(err.Error(), "yaml: "), "line "))
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	mapping := doc.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%d: the config must be a mapping of parameters to values", mapping.Line)
+	}
+
+	var lines []configLine
+	for i := 0; i < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		if value.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("%d: the value of %s must be a scalar", value.Line, key.Value)
+		}
+		v := value.Value
+		if value.Tag == "!!null" {
+			v = ""
+		}
+		lines = append(lines, configLine{number: key.Line, name: key.Value, value: v})
+	}
+	return lines, nil
+}
+
+// RegisterFlags defines a flag on fs for every parameter of the config file, with the
+// values of c as defaults. The integer and duration flags are parsed by fs (a duration
+// needs a unit, e.g. 90s), and then validated like the config file by ApplyFlags.
+func (c *ServerConfig) RegisterFlags(fs *flag.FlagSet) {
+	for name, param := range serverParams {
+		value := param.get(c)
+		switch param.kind {
+		case intFlag:
+			n, _ := strconv.ParseInt(value, 10, 64)
+			fs.Int64(name, n, param.usage)
+		case durationFlag:
+			d, _ := time.ParseDuration(value)
+			fs.Duration(name, d, param.usage)
+		default:
+			fs.String(name, value, param.usage)
+		}
+	}
+}
+
+// ApplyFlags sets the parameters given as flags of fs (after it parsed the command line),
+// which override those of the config file.
+func (c *ServerConfig) ApplyFlags(fs *flag.FlagSet) error {
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if _, ok := serverParams[f.Name]; ok && err == nil {
+			if setErr := c.Set(f.Name, f.Value.String()); setErr != nil {
+				err = fmt.Errorf("-%s: %w", f.Name, setErr)
+			}
+		}
+	})
+	return err
+}
+
+// rewriteConfigFile rewrites the config file of srv with the current values of the parameters:
+// those of the databases as changed by CONFIG SET, and those of the config of srv. The lines of the
+// parameters are updated in place, keeping the comments and the order of the file, and the
+// parameters that aren't in the file yet are appended to it if they don't have their
+// default value.
+func rewriteConfigFile(srv *Server) error {
+	cfg := srv.config
+	current := func(name string) string {
+		if param, ok := configParams[name]; ok && param.set != nil {
+			return param.get(srv)
+		}
+		return serverParams[name].get(cfg)
+	}
+
+	yamlFile := isYAML(cfg.File)
+	format := func(name, value string) string {
+		if value == "" || strings.ContainsAny(value, " \t\"'#:") {
+			value = strconv.Quote(value)
+		}
+		if yamlFile {
+			return name + ": " + value
+		}
+		return name + " " + value
+	}
+
+	data, err := os.ReadFile(cfg.File)
+	if err != nil {
+		return err
+	}
+
+	var out []string
+	written := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		// the parameters are at the start of their line: the others are kept as they are,
+		// like the comments, or the nested values of a YAML file
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			out = append(out, line)
+			continue
+		}
+		name := strings.ToLower(strings.TrimSuffix(fields[0], ":"))
+		if _, ok := serverParams[name]; !ok {
+			out = append(out, line)
+			continue
+		}
+		if !written[name] {
+			out = append(out, format(name, current(name)))
+			written[name] = true
+		}
+	}
+
+	defaults := DefaultServerConfig()
+	var names []string
+	for name := range serverParams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if value := current(name); !written[name] && value != serverParams[name].get(defaults) {
+			out = append(out, format(name, value))
+		}
+	}
+
+	return fileutils.AtomicReplaceFile(cfg.File, func(f *os.File) error {
+		_, err := f.WriteString(strings.Join(out, "\n") + "\n")
+		return err
+	})
+}
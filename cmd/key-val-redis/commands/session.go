@@ -0,0 +1,329 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+)
+
+// session is the state of a client connection, stored in its context.
+type session struct {
+	id   int64
+	conn redcon.Conn
+	// protocol is the RESP version of the replies, 2 unless negotiated with HELLO
+	protocol int
+	// user is the ACL user of the client, nil until it authenticates
+	user *aclUser
+
+	// server is the server of the client, that opened the session
+	server *Server
+	// databases are those of the server, and db the index of the one selected by the client
+	databases *Databases
+	db        int
+
+	// multi is set between MULTI and EXEC (or DISCARD), while the commands are queued
+	multi bool
+	queue [][][]byte
+	// failed is set when a command couldn't be queued: EXEC then aborts the transaction
+	failed bool
+	// executing is set while EXEC runs the queued commands
+	executing bool
+
+	// watches of the keys given to WATCH, until EXEC, DISCARD or UNWATCH
+	watches []*KeyValor.Watch
+
+	// subscriber is set once the client subscribed: its connection is detached
+	subscriber *subscriber
+	// monitor is set once the client ran MONITOR: its connection is detached
+	monitor *monitor
+
+	// events are the keyspace events caused by the commands, not yet published
+	events []keyspaceEvent
+
+	// blocked is how long the running command was blocked waiting for keys, e.g. by BLPOP
+	blocked time.Duration
+
+	// info is what CLIENT LIST shows about the client: other clients read it, under infoMu
+	infoMu sync.Mutex
+	info   clientInfo
+}
+
+// clientInfo describes a client for CLIENT LIST and CLIENT INFO.
+type clientInfo struct {
+	addr, laddr     string
+	name            string
+	user            string
+	libName, libVer string
+	db              int
+	created         time.Time
+	lastActive      time.Time
+	lastCommand     string
+	sub, psub       int
+	monitor         bool
+	// multi is the number of queued commands, -1 outside MULTI
+	multi int
+}
+
+// clientRegistry holds the sessions of the connected clients, by id.
+type clientRegistry struct {
+	sync.Mutex
+	byID   map[int64]*session
+	nextID atomic.Int64
+}
+
+func newClientRegistry() *clientRegistry {
+	return &clientRegistry{byID: make(map[int64]*session)}
+}
+
+// sessions returns the sessions of the connected clients, by increasing id.
+func (cr *clientRegistry) sessions() []*session {
+	cr.Lock()
+	sessions := make([]*session, 0, len(cr.byID))
+	for _, s := range cr.byID {
+		sessions = append(sessions, s)
+	}
+	cr.Unlock()
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].id < sessions[j].id })
+	return sessions
+}
+
+// sessionOf returns the session of conn, opened by its server when it connected or on its
+// first command (see Server.Dispatch).
+func sessionOf(conn redcon.Conn) *session {
+	return conn.Context().(*session)
+}
+
+// serverOf returns the server of the client conn.
+func serverOf(conn redcon.Conn) *Server {
+	return sessionOf(conn).server
+}
+
+// OpenSession registers a client as soon as it connects, so that CLIENT LIST shows it
+// before its first command.
+func (srv *Server) OpenSession(conn redcon.Conn) {
+	srv.openSession(conn)
+}
+
+// openSession returns the session of conn, opening it if OpenSession wasn't called.
+func (srv *Server) openSession(conn redcon.Conn) *session {
+	if s, ok := conn.Context().(*session); ok {
+		return s
+	}
+
+	now := time.Now()
+	s := &session{
+		id:       srv.clients.nextID.Add(1),
+		conn:     conn,
+		protocol: 2,
+		server:   srv,
+		info: clientInfo{
+			addr:       conn.RemoteAddr(),
+			created:    now,
+			lastActive: now,
+			multi:      -1,
+		},
+	}
+	if s.user = srv.acl.defaultUserIfNoPass(); s.user != nil {
+		s.info.user = s.user.name
+	}
+	if netConn := conn.NetConn(); netConn != nil {
+		s.info.laddr = netConn.LocalAddr().String()
+	}
+	conn.SetContext(s)
+
+	srv.clients.Lock()
+	srv.clients.byID[s.id] = s
+	srv.clients.Unlock()
+	srv.stats.connections.Add(1)
+
+	return s
+}
+
+// updateInfo changes the info of the session.
+func (s *session) updateInfo(update func(info *clientInfo)) {
+	s.infoMu.Lock()
+	defer s.infoMu.Unlock()
+
+	update(&s.info)
+}
+
+// currentInfo returns a copy of the info of the session.
+func (s *session) currentInfo() clientInfo {
+	s.infoMu.Lock()
+	defer s.infoMu.Unlock()
+
+	return s.info
+}
+
+// kill closes the connection of the session from another client: the goroutine serving
+// the connection then notices it, and releases the session.
+func (s *session) kill() {
+	if netConn := s.conn.NetConn(); netConn != nil {
+		_ = netConn.Close()
+	}
+}
+
+// unwatch closes the watches of the session.
+func (s *session) unwatch() {
+	for _, w := range s.watches {
+		w.Close()
+	}
+	s.watches = nil
+}
+
+// release releases the state of the session, once its connection is closed.
+func (s *session) release() {
+	s.unwatch()
+
+	clients := s.server.clients
+	clients.Lock()
+	delete(clients.byID, s.id)
+	clients.Unlock()
+}
+
+// CloseSession releases the state of a client, once its connection is closed by the server.
+// It does nothing for a connection detached by SUBSCRIBE or MONITOR, whose session is released
+// once the detached connection closes.
+func CloseSession(conn redcon.Conn) {
+	if s, ok := conn.Context().(*session); ok && s.subscriber == nil && s.monitor == nil {
+		s.release()
+	}
+}
+
+// Dispatch runs the command args for the client conn on the database it selected, or queues
+// it if the client is inside a MULTI block. The commands are refused once the server is
+// shutting down. The keyspace notifications of the command are published once it is done.
+// The commands that run are timed for SLOWLOG and LATENCY, and fed to the monitors.
+func (srv *Server) Dispatch(conn redcon.Conn, args [][]byte) {
+	srv.dispatch(conn, args)
+
+	// the connection of a subscriber (or a monitor) is served by subscriber.serve (or
+	// monitor.serve), which publishes them
+	if s := srv.openSession(conn); s.subscriber == nil && s.monitor == nil {
+		publishKeyspaceEvents(s)
+	}
+}
+
+// dispatch is Dispatch, without publishing the keyspace notifications.
+func (srv *Server) dispatch(conn redcon.Conn, args [][]byte) {
+	if !srv.admit() {
+		conn.WriteError(ShuttingDownErrorMsg)
+		return
+	}
+	// deferred first, to run last
+	defer srv.inFlight.Done()
+
+	commandName := strings.ToLower(string(args[0]))
+	mu, dbs := &srv.mu, srv.dbs
+	s := srv.openSession(conn)
+	s.databases = dbs
+
+	// deferred first, to run last: from then on, the connection is only used by serve
+	defer func() {
+		// SUBSCRIBE detached the connection from the redcon server
+		if sub := s.subscriber; sub != nil && !sub.serving {
+			sub.serving = true
+			go sub.serve(srv)
+		}
+		// and so did MONITOR
+		if m := s.monitor; m != nil && !m.serving {
+			m.serving = true
+			go m.serve(srv)
+		}
+	}()
+	defer s.updateInfo(func(info *clientInfo) {
+		info.lastActive = time.Now()
+		info.lastCommand = commandName
+		info.multi = -1
+		if s.multi {
+			info.multi = len(s.queue)
+		}
+	})
+
+	commandFunc, transaction := transactionCommands[commandName]
+	supported := transaction
+	if !supported {
+		commandFunc, supported = CommandMap[commandName]
+	}
+	if !supported {
+		conn.WriteError("ERR unknown command '" + commandName + "'")
+		s.failed = s.multi
+		return
+	}
+
+	srv.stats.commands.Add(1)
+	if errMsg := s.checkAccess(commandName, args); errMsg != "" {
+		conn.WriteError(errMsg)
+		s.failed = s.multi
+		return
+	}
+
+	if s.multi && !transaction {
+		// like in Redis, a command that can't run fails now, and makes EXEC fail
+		if name := commandSpecs[commandName].checkArity(args); name != "" {
+			conn.WriteError(fmt.Sprintf(InfalidArgumentsErrorMsg, name))
+			s.failed = true
+			return
+		}
+		s.queue = append(s.queue, cloneArgs(args))
+		conn.WriteString("QUEUED")
+		return
+	}
+
+	s.blocked = 0
+	start := time.Now()
+	commandFunc(conn, args, mu, dbs.Get(s.db))
+
+	// the duration includes the time waiting for the locks, but not for keys
+	duration := time.Since(start) - s.blocked
+	srv.slowLog.record(s, args, duration)
+	srv.latency.recordCommand(commandName, duration)
+	// like in Redis, the commands are shown once they ran (EXEC after the queued commands), and
+	// MONITOR isn't shown
+	if commandName != "monitor" {
+		srv.monitors.feed(s, args)
+	}
+}
+
+// checkAccess returns the error replied to the client if it may not run the command args,
+// "" if it may. AUTH, HELLO and QUIT are always allowed; other commands need an authenticated
+// client, whose user is allowed the command and its keys.
+func (s *session) checkAccess(commandName string, args [][]byte) string {
+	switch {
+	case commandName == "auth" || commandName == "hello" || commandName == "quit":
+		return ""
+	case s.user == nil:
+		return NoAuthErrorMsg
+	}
+
+	errMsg := s.server.acl.check(s.user, commandName, args)
+	if errMsg == NoAuthErrorMsg {
+		// the user was disabled or deleted
+		s.user = nil
+		s.updateInfo(func(info *clientInfo) { info.user = "" })
+	}
+	return errMsg
+}
+
+// authenticate makes user the user of the client.
+func (s *session) authenticate(user *aclUser) {
+	s.user = user
+	s.updateInfo(func(info *clientInfo) { info.user = user.name })
+}
+
+// cloneArgs copies args, which point into the read buffer of the connection.
+func cloneArgs(args [][]byte) [][]byte {
+	clone := make([][]byte, len(args))
+	for i, arg := range args {
+		clone[i] = append([]byte(nil), arg...)
+	}
+	return clone
+}
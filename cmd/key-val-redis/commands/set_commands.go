@@ -0,0 +1,359 @@
+package commands
+
+import (
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+)
+
+var SAdd CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	added := 0
+
+	mu.Lock()
+	err := db.UpdateSet(string(args[1]), func(s *KeyValor.Set) error {
+		for _, member := range args[2:] {
+			if s.Add(string(member)) {
+				added++
+			}
+		}
+		return nil
+	})
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteInt(added)
+	if added > 0 {
+		notifyKeyspaceEvent(conn, notifySet, "sadd", string(args[1]))
+	}
+}
+
+var SRem CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	var (
+		removed int
+		emptied bool
+	)
+
+	mu.Lock()
+	err := db.UpdateSet(string(args[1]), func(s *KeyValor.Set) error {
+		for _, member := range args[2:] {
+			if s.Remove(string(member)) {
+				removed++
+			}
+		}
+		emptied = s.Len() == 0
+		return nil
+	})
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteInt(removed)
+	if removed > 0 {
+		notifyCollectionEvent(conn, notifySet, "srem", string(args[1]), emptied)
+	}
+}
+
+var SMembers CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	s, ok := getSet(conn, mu, db, args[1])
+	if !ok {
+		return
+	}
+	WriteRedisArray(conn, s.Members())
+}
+
+var SIsMember CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	s, ok := getSet(conn, mu, db, args[1])
+	if !ok {
+		return
+	}
+	writeBool(conn, s.Contains(string(args[2])))
+}
+
+var SCard CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	s, ok := getSet(conn, mu, db, args[1])
+	if !ok {
+		return
+	}
+	conn.WriteInt(s.Len())
+}
+
+// SInter implements SINTER, SUNION and SDIFF key [key ...]
+var SInter CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	mu.RLock()
+	result, err := combineSets(db, strings.ToLower(string(args[0])), args[1:])
+	mu.RUnlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	WriteRedisArray(conn, result.Members())
+}
+
+// SInterStore implements SINTERSTORE, SUNIONSTORE and SDIFFSTORE destination key [key ...]
+var SInterStore CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	command := strings.ToLower(string(args[0]))
+	operation := strings.TrimSuffix(command, "store")
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var replaced bool
+	result, err := combineSets(db, operation, args[2:])
+	if err == nil {
+		replaced, err = replaceSet(db, string(args[1]), result)
+	}
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteInt(result.Len())
+
+	// like in Redis, an empty result deletes the destination
+	switch {
+	case result.Len() > 0:
+		notifyKeyspaceEvent(conn, notifySet, command, string(args[1]))
+	case replaced:
+		notifyKeyspaceEvent(conn, notifyGeneric, "del", string(args[1]))
+	}
+}
+
+// SRandMember implements SRANDMEMBER key [count] and SPOP key [count]
+var SRandMember CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 2 && len(args) != 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	pop := strings.EqualFold(string(args[0]), "spop")
+	withCount := len(args) == 3
+
+	var count int64 = 1
+	if withCount {
+		var ok bool
+		if count, ok = parseInt(args[2]); !ok {
+			conn.WriteError(NotIntegerErrorMsg)
+			return
+		}
+		if pop && count < 0 {
+			conn.WriteError(MustBePositiveErrorMsg)
+			return
+		}
+		if count < -math.MaxInt32 {
+			conn.WriteError(ValueOutOfRangeErrorMsg)
+			return
+		}
+	}
+
+	var picked []string
+
+	if pop {
+		var emptied bool
+
+		mu.Lock()
+		err := db.UpdateSet(string(args[1]), func(s *KeyValor.Set) error {
+			picked = randomElements(s.Members(), count)
+			for _, member := range picked {
+				s.Remove(member)
+			}
+			emptied = s.Len() == 0
+			return nil
+		})
+		mu.Unlock()
+		if err != nil {
+			writeDBError(conn, err)
+			return
+		}
+		if len(picked) > 0 {
+			notifyCollectionEvent(conn, notifySet, "spop", string(args[1]), emptied)
+		}
+	} else {
+		s, ok := getSet(conn, mu, db, args[1])
+		if !ok {
+			return
+		}
+		if withCount {
+			picked = randomElements(s.Members(), count)
+		} else if members := s.Members(); len(members) > 0 {
+			picked = []string{members[rand.IntN(len(members))]}
+		}
+	}
+
+	if withCount {
+		WriteRedisArray(conn, picked)
+		return
+	}
+	if len(picked) == 0 {
+		writeNull(conn)
+		return
+	}
+	conn.WriteBulkString(picked[0])
+}
+
+// SScan implements SSCAN key cursor [MATCH pattern] [COUNT count]
+var SScan CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	opts, errMsg := parseScanOptions(args[2:], false, false)
+	if errMsg != "" {
+		conn.WriteError(errMsg)
+		return
+	}
+
+	s, ok := getSet(conn, mu, db, args[1])
+	if !ok {
+		return
+	}
+
+	page, next := scanSorted(s.Members(), opts)
+
+	conn.WriteArray(2)
+	conn.WriteBulkString(strconv.FormatUint(next, 10))
+	WriteRedisArray(conn, page)
+}
+
+// combineSets returns the intersection ("sinter"), union ("sunion") or difference ("sdiff")
+// of the sets at keys. A missing key is an empty set.
+func combineSets(db *KeyValor.KeyValorDatabase, operation string, keys [][]byte) (*KeyValor.Set, error) {
+	sets := make([]*KeyValor.Set, len(keys))
+	for i, key := range keys {
+		s, err := db.GetSet(string(key))
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = s
+	}
+
+	switch operation {
+	case "sinter":
+		return sets[0].Inter(sets[1:]...), nil
+	case "sunion":
+		return sets[0].Union(sets[1:]...), nil
+	default:
+		return sets[0].Diff(sets[1:]...), nil
+	}
+}
+
+// replaceSet stores s at key, whatever the key held before (and without its expiry), and
+// returns whether it held something. It must be called with mu locked.
+func replaceSet(db *KeyValor.KeyValorDatabase, key string, s *KeyValor.Set) (bool, error) {
+	exists, err := keyExists(db, key)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		if err := db.Delete(key); err != nil {
+			return false, err
+		}
+	}
+
+	return exists, db.UpdateSet(key, func(stored *KeyValor.Set) error {
+		for _, member := range s.Members() {
+			stored.Add(member)
+		}
+		return nil
+	})
+}
+
+// getSet reads the set at key, or replies with the error and returns false.
+func getSet(conn redcon.Conn, mu *sync.RWMutex, db *KeyValor.KeyValorDatabase, key []byte) (*KeyValor.Set, bool) {
+	mu.RLock()
+	s, err := db.GetSet(string(key))
+	mu.RUnlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return nil, false
+	}
+	return s, true
+}
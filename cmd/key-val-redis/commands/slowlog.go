@@ -0,0 +1,238 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+)
+
+const SlowlogCountErrorMsg = "ERR count should be greater than or equal to -1"
+
+// the limits of the arguments of a command in its slowlog entry, like in Redis: the last
+// arguments, and the end of the long ones, are replaced by how many of them were left out
+const (
+	slowlogMaxArgs      = 32
+	slowlogMaxArgLength = 128
+	// slowlogDefaultCount is the number of entries of SLOWLOG GET without a count
+	slowlogDefaultCount = 10
+)
+
+// slowLogEntry is a command logged by SLOWLOG.
+type slowLogEntry struct {
+	id       int64
+	time     time.Time
+	duration time.Duration
+	args     [][]byte
+	// addr and name are those of the client
+	addr, name string
+}
+
+// commandLog is the log of the commands slower than slowlog-log-slower-than, for SLOWLOG.
+type commandLog struct {
+	// slowerThan (in microseconds) and maxLen are slowlog-log-slower-than and slowlog-max-len:
+	// every command reads them, without the lock
+	slowerThan atomic.Int64
+	maxLen     atomic.Int64
+
+	sync.Mutex
+	// entries are the latest entries, the oldest first
+	entries []slowLogEntry
+	nextID  int64
+}
+
+func newCommandLog() *commandLog {
+	cl := &commandLog{}
+	cl.slowerThan.Store(defaultSlowlogLogSlowerThan)
+	cl.maxLen.Store(defaultSlowlogMaxLen)
+	return cl
+}
+
+// record logs the command args of the client of s, if it ran for longer than
+// slowlog-log-slower-than.
+func (cl *commandLog) record(s *session, args [][]byte, duration time.Duration) {
+	slowerThan := cl.slowerThan.Load()
+	if slowerThan < 0 || duration.Microseconds() < slowerThan {
+		return
+	}
+
+	info := s.currentInfo()
+	entry := slowLogEntry{
+		time:     time.Now(),
+		duration: duration,
+		args:     slowLogArgs(args),
+		addr:     info.addr,
+		name:     info.name,
+	}
+
+	cl.Lock()
+	defer cl.Unlock()
+
+	entry.id = cl.nextID
+	cl.nextID++
+	cl.entries = append(cl.entries, entry)
+	// the oldest entries are dropped once append reallocates the array
+	if excess := len(cl.entries) - int(cl.maxLen.Load()); excess > 0 {
+		cl.entries = cl.entries[excess:]
+	}
+}
+
+// latest returns the count latest entries (all of them if count is negative), the newest first.
+func (cl *commandLog) latest(count int) []slowLogEntry {
+	cl.Lock()
+	defer cl.Unlock()
+
+	if count < 0 || count > len(cl.entries) {
+		count = len(cl.entries)
+	}
+	entries := make([]slowLogEntry, 0, count)
+	for i := len(cl.entries) - 1; len(entries) < count; i-- {
+		entries = append(entries, cl.entries[i])
+	}
+	return entries
+}
+
+// len returns the number of entries.
+func (cl *commandLog) len() int {
+	cl.Lock()
+	defer cl.Unlock()
+
+	return len(cl.entries)
+}
+
+// reset deletes the entries.
+func (cl *commandLog) reset() {
+	cl.Lock()
+	defer cl.Unlock()
+
+	cl.entries = nil
+}
+
+// slowLogArgs returns a copy of the arguments of a command for its slowlog entry: without its
+// secrets, and within the limits of the entries.
+func slowLogArgs(args [][]byte) [][]byte {
+	args = redactArgs(args)
+
+	n := len(args)
+	if n > slowlogMaxArgs {
+		n = slowlogMaxArgs - 1
+	}
+	logged := make([][]byte, 0, min(len(args), slowlogMaxArgs))
+	for _, arg := range args[:n] {
+		if len(arg) > slowlogMaxArgLength {
+			arg = fmt.Appendf(append([]byte(nil), arg[:slowlogMaxArgLength]...),
+				"... (%d more bytes)", len(arg)-slowlogMaxArgLength)
+		} else {
+			arg = append([]byte(nil), arg...)
+		}
+		logged = append(logged, arg)
+	}
+	if n < len(args) {
+		logged = append(logged, fmt.Appendf(nil, "... (%d more arguments)", len(args)-n))
+	}
+	return logged
+}
+
+// redactedArg replaces the secrets in the arguments of a command shown to other clients.
+var redactedArg = []byte("(redacted)")
+
+// redactArgs returns the arguments of a command, with its passwords replaced by redactedArg:
+// the arguments of AUTH and ACL SETUSER, and those of the AUTH options of HELLO and MIGRATE.
+// args is returned as is if it has none.
+func redactArgs(args [][]byte) [][]byte {
+	var secrets []int
+	switch name := strings.ToLower(string(args[0])); {
+	case name == "auth":
+		for i := 1; i < len(args); i++ {
+			secrets = append(secrets, i)
+		}
+	case name == "acl" && len(args) > 3 && strings.EqualFold(string(args[1]), "setuser"):
+		for i := 3; i < len(args); i++ {
+			secrets = append(secrets, i)
+		}
+	case name == "hello" || name == "migrate":
+		for i := 1; i < len(args); i++ {
+			switch strings.ToLower(string(args[i])) {
+			case "auth":
+				// HELLO's AUTH has a user name, not redacted, and a password
+				if name == "hello" {
+					i++
+				}
+				secrets = append(secrets, i+1)
+				i++
+			case "auth2":
+				secrets = append(secrets, i+2)
+				i += 2
+			}
+		}
+	}
+	if len(secrets) == 0 {
+		return args
+	}
+
+	redacted := append([][]byte(nil), args...)
+	for _, i := range secrets {
+		if i < len(redacted) {
+			redacted[i] = redactedArg
+		}
+	}
+	return redacted
+}
+
+// Slowlog implements SLOWLOG GET [count], SLOWLOG LEN and SLOWLOG RESET. The duration of a
+// command is measured by Dispatch, including the time it waited for the locks (e.g. of a
+// compaction), but not the time it was blocked waiting for keys, like BLPOP.
+var Slowlog CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	slowLog := serverOf(conn).slowLog
+	switch subcommand := strings.ToLower(string(args[1])); {
+	case subcommand == "get" && len(args) <= 3:
+		count := int64(slowlogDefaultCount)
+		if len(args) == 3 {
+			var ok bool
+			if count, ok = parseInt(args[2]); !ok || count < -1 {
+				conn.WriteError(SlowlogCountErrorMsg)
+				return
+			}
+		}
+
+		entries := slowLog.latest(int(count))
+		conn.WriteArray(len(entries))
+		for _, entry := range entries {
+			conn.WriteArray(6)
+			conn.WriteInt64(entry.id)
+			conn.WriteInt64(entry.time.Unix())
+			conn.WriteInt64(entry.duration.Microseconds())
+			conn.WriteArray(len(entry.args))
+			for _, arg := range entry.args {
+				conn.WriteBulk(arg)
+			}
+			conn.WriteBulkString(entry.addr)
+			conn.WriteBulkString(entry.name)
+		}
+
+	case subcommand == "len" && len(args) == 2:
+		conn.WriteInt(slowLog.len())
+
+	case subcommand == "reset" && len(args) == 2:
+		slowLog.reset()
+		conn.WriteString("OK")
+
+	default:
+		conn.WriteError(fmt.Sprintf(UnknownSubcommandErrorMsg, string(args[1]), "SLOWLOG"))
+	}
+}
@@ -0,0 +1,518 @@
+package commands
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+)
+
+const (
+	ScoreRangeNotFloatErrorMsg = "ERR min or max is not a float"
+	ScoreIsNaNErrorMsg         = "ERR resulting score is not a number (NaN)"
+	XXAndNXErrorMsg            = "ERR XX and NX options at the same time are not compatible"
+	GTLTAndNXErrorMsg          = "ERR GT, LT, and/or NX options at the same time are not compatible"
+	IncrSinglePairErrorMsg     = "ERR INCR option supports a single increment-element pair"
+	LimitWithoutRangeErrorMsg  = "ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX"
+)
+
+// zaddOptions are the flags of ZADD.
+type zaddOptions struct {
+	nx, xx, gt, lt, ch, incr bool
+}
+
+// ZAdd implements ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+var ZAdd CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 4 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	var opts zaddOptions
+	i := 2
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "nx":
+			opts.nx = true
+		case "xx":
+			opts.xx = true
+		case "gt":
+			opts.gt = true
+		case "lt":
+			opts.lt = true
+		case "ch":
+			opts.ch = true
+		case "incr":
+			opts.incr = true
+		default:
+			break options
+		}
+	}
+
+	pairs := args[i:]
+	switch {
+	case len(pairs) == 0 || len(pairs)%2 != 0:
+		conn.WriteError(SyntaxErrorMsg)
+		return
+	case opts.nx && opts.xx:
+		conn.WriteError(XXAndNXErrorMsg)
+		return
+	case (opts.gt && opts.lt) || (opts.nx && (opts.gt || opts.lt)):
+		conn.WriteError(GTLTAndNXErrorMsg)
+		return
+	case opts.incr && len(pairs) != 2:
+		conn.WriteError(IncrSinglePairErrorMsg)
+		return
+	}
+
+	scores := make([]float64, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		score, ok := parseFloat(pairs[j])
+		if !ok {
+			conn.WriteError(NotFloatErrorMsg)
+			return
+		}
+		scores = append(scores, score)
+	}
+
+	var (
+		added, changed int
+		incremented    float64
+		updated        bool
+	)
+
+	mu.Lock()
+	err := db.UpdateSortedSet(string(args[1]), func(z *KeyValor.SortedSet) error {
+		for j, score := range scores {
+			member := string(pairs[2*j+1])
+
+			current, exists := z.Score(member)
+			if (exists && opts.nx) || (!exists && opts.xx) {
+				continue
+			}
+
+			if opts.incr {
+				score += current
+				if math.IsNaN(score) {
+					return replyError(ScoreIsNaNErrorMsg)
+				}
+			}
+			if exists && ((opts.gt && score <= current) || (opts.lt && score >= current)) {
+				continue
+			}
+
+			incremented, updated = score, true
+			if z.Add(member, score) {
+				added++
+			} else if score != current {
+				changed++
+			}
+		}
+		return nil
+	})
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+
+	switch {
+	case opts.incr && !updated:
+		writeNull(conn)
+	case opts.incr:
+		writeDouble(conn, incremented)
+	case opts.ch:
+		conn.WriteInt(added + changed)
+	default:
+		conn.WriteInt(added)
+	}
+
+	if added+changed > 0 {
+		event := "zadd"
+		if opts.incr {
+			event = "zincr"
+		}
+		notifyKeyspaceEvent(conn, notifyZSet, event, string(args[1]))
+	}
+}
+
+// ZIncrBy implements ZINCRBY key increment member
+var ZIncrBy CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 4 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	increment, ok := parseFloat(args[2])
+	if !ok {
+		conn.WriteError(NotFloatErrorMsg)
+		return
+	}
+
+	var score float64
+
+	mu.Lock()
+	err := db.UpdateSortedSet(string(args[1]), func(z *KeyValor.SortedSet) error {
+		current, _ := z.Score(string(args[3]))
+		score = current + increment
+		if math.IsNaN(score) {
+			return replyError(ScoreIsNaNErrorMsg)
+		}
+		z.Add(string(args[3]), score)
+		return nil
+	})
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	writeDouble(conn, score)
+	notifyKeyspaceEvent(conn, notifyZSet, "zincr", string(args[1]))
+}
+
+var ZRem CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	var (
+		removed int
+		emptied bool
+	)
+
+	mu.Lock()
+	err := db.UpdateSortedSet(string(args[1]), func(z *KeyValor.SortedSet) error {
+		for _, member := range args[2:] {
+			if z.Remove(string(member)) {
+				removed++
+			}
+		}
+		emptied = z.Len() == 0
+		return nil
+	})
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteInt(removed)
+	if removed > 0 {
+		notifyCollectionEvent(conn, notifyZSet, "zrem", string(args[1]), emptied)
+	}
+}
+
+var ZCard CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	z, ok := getSortedSet(conn, mu, db, args[1])
+	if !ok {
+		return
+	}
+	conn.WriteInt(z.Len())
+}
+
+var ZScore CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	z, ok := getSortedSet(conn, mu, db, args[1])
+	if !ok {
+		return
+	}
+
+	score, exists := z.Score(string(args[2]))
+	if !exists {
+		writeNull(conn)
+		return
+	}
+	writeDouble(conn, score)
+}
+
+// ZRank implements ZRANK key member [WITHSCORE] and ZREVRANK key member [WITHSCORE]
+var ZRank CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 3 && len(args) != 4 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	withScore := len(args) == 4
+	if withScore && !strings.EqualFold(string(args[3]), "withscore") {
+		conn.WriteError(SyntaxErrorMsg)
+		return
+	}
+
+	z, ok := getSortedSet(conn, mu, db, args[1])
+	if !ok {
+		return
+	}
+
+	reverse := strings.EqualFold(string(args[0]), "zrevrank")
+	rank, exists := z.Rank(string(args[2]), reverse)
+	switch {
+	case !exists && withScore:
+		writeNullArray(conn)
+	case !exists:
+		writeNull(conn)
+	case withScore:
+		score, _ := z.Score(string(args[2]))
+		conn.WriteArray(2)
+		conn.WriteInt(rank)
+		writeDouble(conn, score)
+	default:
+		conn.WriteInt(rank)
+	}
+}
+
+// zrangeOptions are the arguments of the ZRANGE family of commands.
+type zrangeOptions struct {
+	byScore    bool
+	reverse    bool
+	withScores bool
+	limit      bool
+	offset     int64
+	count      int64
+}
+
+// ZRange implements ZRANGE key start stop [BYSCORE] [REV] [LIMIT offset count] [WITHSCORES],
+// ZREVRANGE key start stop [WITHSCORES], ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+// and ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count]
+var ZRange CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 4 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	command := strings.ToLower(string(args[0]))
+	opts := zrangeOptions{
+		byScore: strings.HasSuffix(command, "byscore"),
+		reverse: strings.HasPrefix(command, "zrev"),
+		count:   -1,
+	}
+
+	for i := 4; i < len(args); i++ {
+		switch option := strings.ToLower(string(args[i])); {
+		case option == "withscores":
+			opts.withScores = true
+		case option == "byscore" && command == "zrange":
+			opts.byScore = true
+		case option == "rev" && command == "zrange":
+			opts.reverse = true
+		case option == "limit" && command != "zrevrange" && i+2 < len(args):
+			offset, ok := parseInt(args[i+1])
+			count, ok2 := parseInt(args[i+2])
+			if !ok || !ok2 {
+				conn.WriteError(NotIntegerErrorMsg)
+				return
+			}
+			opts.limit, opts.offset, opts.count = true, offset, count
+			i += 2
+		default:
+			conn.WriteError(SyntaxErrorMsg)
+			return
+		}
+	}
+	if opts.limit && !opts.byScore {
+		conn.WriteError(LimitWithoutRangeErrorMsg)
+		return
+	}
+
+	var members []KeyValor.ScoredMember
+	if opts.byScore {
+		// the first bound is the maximum in reverse
+		minArg, maxArg := args[2], args[3]
+		if opts.reverse {
+			minArg, maxArg = maxArg, minArg
+		}
+		minBound, ok := parseScoreBound(minArg)
+		maxBound, ok2 := parseScoreBound(maxArg)
+		if !ok || !ok2 {
+			conn.WriteError(ScoreRangeNotFloatErrorMsg)
+			return
+		}
+		if opts.offset < 0 {
+			// a negative offset returns nothing, like in Redis
+			WriteRedisArray(conn, []string{})
+			return
+		}
+
+		z, ok := getSortedSet(conn, mu, db, args[1])
+		if !ok {
+			return
+		}
+		members = z.RangeByScore(minBound, maxBound, opts.reverse, clampIndex(opts.offset), clampIndex(opts.count))
+	} else {
+		start, stop, ok := parseListRange(conn, args[2], args[3])
+		if !ok {
+			return
+		}
+
+		z, ok := getSortedSet(conn, mu, db, args[1])
+		if !ok {
+			return
+		}
+		members = z.RangeByRank(start, stop, opts.reverse)
+	}
+
+	writeScoredMembers(conn, members, opts.withScores)
+}
+
+// ZCount implements ZCOUNT key min max
+var ZCount CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 4 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	minBound, ok := parseScoreBound(args[2])
+	maxBound, ok2 := parseScoreBound(args[3])
+	if !ok || !ok2 {
+		conn.WriteError(ScoreRangeNotFloatErrorMsg)
+		return
+	}
+
+	z, ok := getSortedSet(conn, mu, db, args[1])
+	if !ok {
+		return
+	}
+	conn.WriteInt(z.Count(minBound, maxBound))
+}
+
+// ZScan implements ZSCAN key cursor [MATCH pattern] [COUNT count]
+var ZScan CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	opts, errMsg := parseScanOptions(args[2:], false, false)
+	if errMsg != "" {
+		conn.WriteError(errMsg)
+		return
+	}
+
+	z, ok := getSortedSet(conn, mu, db, args[1])
+	if !ok {
+		return
+	}
+
+	page, next := scanSorted(z.Members(), opts)
+
+	conn.WriteArray(2)
+	conn.WriteBulkString(strconv.FormatUint(next, 10))
+	conn.WriteArray(2 * len(page))
+	for _, member := range page {
+		score, _ := z.Score(member)
+		conn.WriteBulkString(member)
+		conn.WriteBulkString(formatDouble(score))
+	}
+}
+
+// parseScoreBound parses the minimum or the maximum of a score range:
+// a float, -inf or +inf, exclusive if prefixed with '('.
+func parseScoreBound(arg []byte) (KeyValor.ScoreBound, bool) {
+	var bound KeyValor.ScoreBound
+	if len(arg) > 0 && arg[0] == '(' {
+		bound.Exclusive = true
+		arg = arg[1:]
+	}
+
+	value, ok := parseFloat(arg)
+	bound.Value = value
+	return bound, ok
+}
+
+// writeScoredMembers replies with the members, each one followed by its score if withScores is set.
+func writeScoredMembers(conn redcon.Conn, members []KeyValor.ScoredMember, withScores bool) {
+	if !withScores {
+		conn.WriteArray(len(members))
+		for _, m := range members {
+			conn.WriteBulkString(m.Member)
+		}
+		return
+	}
+
+	// RESP3 clients get [member, score] pairs
+	if resp3(conn) {
+		conn.WriteArray(len(members))
+		for _, m := range members {
+			conn.WriteArray(2)
+			conn.WriteBulkString(m.Member)
+			writeDouble(conn, m.Score)
+		}
+		return
+	}
+
+	conn.WriteArray(2 * len(members))
+	for _, m := range members {
+		conn.WriteBulkString(m.Member)
+		conn.WriteBulkString(formatDouble(m.Score))
+	}
+}
+
+// getSortedSet reads the sorted set at key, or replies with the error and returns false.
+func getSortedSet(conn redcon.Conn, mu *sync.RWMutex, db *KeyValor.KeyValorDatabase, key []byte) (*KeyValor.SortedSet, bool) {
+	mu.RLock()
+	z, err := db.GetSortedSet(string(key))
+	mu.RUnlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return nil, false
+	}
+	return z, true
+}
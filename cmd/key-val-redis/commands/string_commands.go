@@ -0,0 +1,899 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+	"KeyValor/constants"
+)
+
+// Error replies, as worded by Redis
+const (
+	SyntaxErrorMsg           = "ERR syntax error"
+	NotIntegerErrorMsg       = "ERR value is not an integer or out of range"
+	NotFloatErrorMsg         = "ERR value is not a valid float"
+	IncrOverflowErrorMsg     = "ERR increment or decrement would overflow"
+	DecrOverflowErrorMsg     = "ERR decrement would overflow"
+	NaNOrInfinityErrorMsg    = "ERR increment would produce NaN or Infinity"
+	InvalidExpireErrorMsg    = "ERR invalid expire time in '%s' command"
+	OffsetOutOfRangeErrorMsg = "ERR offset is out of range"
+	StringTooLongErrorMsg    = "ERR string exceeds maximum allowed size (proto-max-bulk-len)"
+	WrongTypeErrorMsg        = "WRONGTYPE Operation against a key holding the wrong kind of value"
+)
+
+// replyError is an error whose message is the exact error reply to send,
+// e.g. returned from a KeyValorDatabase.UpdateHash callback.
+type replyError string
+
+func (e replyError) Error() string {
+	return string(e)
+}
+
+// maxStringSize is the largest value SETRANGE and APPEND can build (Redis' proto-max-bulk-len)
+const maxStringSize = 512 * 1024 * 1024
+
+var MGet CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	keys := make([]string, len(args)-1)
+	for i, arg := range args[1:] {
+		keys[i] = string(arg)
+	}
+
+	mu.RLock()
+	values, err := db.MGet(keys)
+	mu.RUnlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+
+	conn.WriteArray(len(values))
+	for _, value := range values {
+		if value.Err != nil {
+			writeNull(conn)
+		} else {
+			conn.WriteBulk(value.Val)
+		}
+	}
+}
+
+var MSet CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 3 || len(args)%2 == 0 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	mu.Lock()
+	err := setPairs(db, args[1:])
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteString("OK")
+	notifySetPairs(conn, args[1:])
+}
+
+var MSetNX CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 3 || len(args)%2 == 0 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i := 1; i < len(args); i += 2 {
+		exists, err := keyExists(db, string(args[i]))
+		if err != nil {
+			writeDBError(conn, err)
+			return
+		}
+		if exists {
+			conn.WriteInt(0)
+			return
+		}
+	}
+
+	if err := setPairs(db, args[1:]); err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteInt(1)
+	notifySetPairs(conn, args[1:])
+}
+
+var Incr CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+	incrBy(conn, mu, db, string(args[1]), 1)
+}
+
+var Decr CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+	incrBy(conn, mu, db, string(args[1]), -1)
+}
+
+var IncrBy CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	delta, ok := parseInt(args[2])
+	if !ok {
+		conn.WriteError(NotIntegerErrorMsg)
+		return
+	}
+	incrBy(conn, mu, db, string(args[1]), delta)
+}
+
+var DecrBy CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	delta, ok := parseInt(args[2])
+	if !ok {
+		conn.WriteError(NotIntegerErrorMsg)
+		return
+	}
+	if delta == math.MinInt64 {
+		conn.WriteError(DecrOverflowErrorMsg)
+		return
+	}
+	incrBy(conn, mu, db, string(args[1]), -delta)
+}
+
+var IncrByFloat CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	delta, ok := parseFloat(args[2])
+	if !ok {
+		conn.WriteError(NotFloatErrorMsg)
+		return
+	}
+
+	key := string(args[1])
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	value, expiry, found, err := getString(db, key)
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+
+	var current float64
+	if found {
+		if current, ok = parseFloat(value); !ok {
+			conn.WriteError(NotFloatErrorMsg)
+			return
+		}
+	}
+
+	result := current + delta
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		conn.WriteError(NaNOrInfinityErrorMsg)
+		return
+	}
+
+	newValue := strconv.FormatFloat(result, 'f', -1, 64)
+	if err := db.SetWithExpiry(key, []byte(newValue), expiry); err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteBulkString(newValue)
+	notifyKeyspaceEvent(conn, notifyString, "incrbyfloat", key)
+}
+
+var Append CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	key := string(args[1])
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	value, expiry, exists, err := getString(db, key)
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+
+	if len(value)+len(args[2]) > maxStringSize {
+		conn.WriteError(StringTooLongErrorMsg)
+		return
+	}
+	if exists && len(args[2]) == 0 {
+		conn.WriteInt(len(value))
+		return
+	}
+
+	newValue := make([]byte, 0, len(value)+len(args[2]))
+	newValue = append(append(newValue, value...), args[2]...)
+	if err := db.SetWithExpiry(key, newValue, expiry); err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteInt(len(newValue))
+	notifyKeyspaceEvent(conn, notifyString, strings.ToLower(string(args[0])), key)
+}
+
+var StrLen CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	mu.RLock()
+	value, _, _, err := getString(db, string(args[1]))
+	mu.RUnlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteInt(len(value))
+}
+
+var GetRange CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 4 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	start, startOk := parseInt(args[2])
+	end, endOk := parseInt(args[3])
+	if !startOk || !endOk {
+		conn.WriteError(NotIntegerErrorMsg)
+		return
+	}
+
+	mu.RLock()
+	value, _, _, err := getString(db, string(args[1]))
+	mu.RUnlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+
+	// same clamping as Redis' getrangeCommand
+	length := int64(len(value))
+	if start < 0 && end < 0 && start > end {
+		conn.WriteBulkString("")
+		return
+	}
+	if start < 0 {
+		start = max(length+start, 0)
+	}
+	if end < 0 {
+		end = max(length+end, 0)
+	}
+	if end >= length {
+		end = length - 1
+	}
+	if length == 0 || start > end {
+		conn.WriteBulkString("")
+		return
+	}
+	conn.WriteBulk(value[start : end+1])
+}
+
+var SetRange CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 4 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	offset, ok := parseInt(args[2])
+	if !ok {
+		conn.WriteError(NotIntegerErrorMsg)
+		return
+	}
+	if offset < 0 {
+		conn.WriteError(OffsetOutOfRangeErrorMsg)
+		return
+	}
+
+	key, patch := string(args[1]), args[3]
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	value, expiry, _, err := getString(db, key)
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+
+	// an empty patch doesn't modify (or create) the value
+	if len(patch) == 0 {
+		conn.WriteInt(len(value))
+		return
+	}
+	if offset+int64(len(patch)) > maxStringSize {
+		conn.WriteError(StringTooLongErrorMsg)
+		return
+	}
+
+	newLen := max(len(value), int(offset)+len(patch))
+	newValue := make([]byte, newLen)
+	copy(newValue, value)
+	copy(newValue[offset:], patch)
+
+	if err := db.SetWithExpiry(key, newValue, expiry); err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteInt(len(newValue))
+	notifyKeyspaceEvent(conn, notifyString, strings.ToLower(string(args[0])), key)
+}
+
+var SetNX CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	mu.Lock()
+	result, err := db.SetWithOptions(string(args[1]), args[2], KeyValor.SetOptions{
+		Condition: KeyValor.SetIfNotExists,
+	})
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+
+	if result.Written {
+		conn.WriteInt(1)
+		notifyKeyspaceEvent(conn, notifyString, "set", string(args[1]))
+	} else {
+		conn.WriteInt(0)
+	}
+}
+
+var SetEx CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	setWithTTL(conn, args, mu, db, time.Second)
+}
+
+var PSetEx CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	setWithTTL(conn, args, mu, db, time.Millisecond)
+}
+
+var GetSet CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 3 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	key := string(args[1])
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	oldValue, _, found, err := getString(db, key)
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+
+	if err := db.Set(key, args[2]); err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	writeBulkOrNull(conn, oldValue, found)
+	notifyKeyspaceEvent(conn, notifyString, "set", key)
+}
+
+var GetDel CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	key := string(args[1])
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	value, _, found, err := getString(db, key)
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+
+	if found {
+		if err := db.Delete(key); err != nil {
+			writeDBError(conn, err)
+			return
+		}
+		notifyKeyspaceEvent(conn, notifyGeneric, "del", key)
+	}
+	writeBulkOrNull(conn, value, found)
+}
+
+var GetEx CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	var (
+		newExpiry time.Time
+		persist   bool
+		setExpiry bool
+	)
+
+	switch len(args) {
+	case 2:
+	case 3:
+		if !strings.EqualFold(string(args[2]), "persist") {
+			conn.WriteError(SyntaxErrorMsg)
+			return
+		}
+		persist = true
+	case 4:
+		var errMsg string
+		newExpiry, errMsg = parseExpiryOption(args[2], args[3], "getex")
+		if errMsg != "" {
+			conn.WriteError(errMsg)
+			return
+		}
+		setExpiry = true
+	default:
+		conn.WriteError(SyntaxErrorMsg)
+		return
+	}
+
+	key := string(args[1])
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	value, expiry, found, err := getString(db, key)
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	if !found {
+		writeNull(conn)
+		return
+	}
+
+	switch {
+	case setExpiry:
+		if err = db.SetWithExpiry(key, value, newExpiry); err == nil {
+			notifyKeyspaceEvent(conn, notifyGeneric, "expire", key)
+		}
+	case persist && !expiry.IsZero():
+		if err = db.Persist(key); err == nil {
+			notifyKeyspaceEvent(conn, notifyGeneric, "persist", key)
+		}
+	}
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteBulk(value)
+}
+
+var Persist CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	key := string(args[1])
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// unlike the other commands of this file, PERSIST works on keys of any type
+	ttl, err := db.TTL(key)
+	if err != nil {
+		if isMissingKey(err) {
+			conn.WriteInt(0)
+		} else {
+			writeDBError(conn, err)
+		}
+		return
+	}
+	if ttl < 0 {
+		conn.WriteInt(0)
+		return
+	}
+
+	if err := db.Persist(key); err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteInt(1)
+	notifyKeyspaceEvent(conn, notifyGeneric, "persist", key)
+}
+
+// incrBy adds delta to the integer value of key (0 if it is missing), keeping its TTL,
+// and replies with the new value.
+func incrBy(conn redcon.Conn, mu *sync.RWMutex, db *KeyValor.KeyValorDatabase, key string, delta int64) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	value, expiry, found, err := getString(db, key)
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+
+	var current int64
+	if found {
+		var ok bool
+		if current, ok = parseInt(value); !ok {
+			conn.WriteError(NotIntegerErrorMsg)
+			return
+		}
+	}
+
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		conn.WriteError(IncrOverflowErrorMsg)
+		return
+	}
+
+	result := current + delta
+	if err := db.SetWithExpiry(key, strconv.AppendInt(nil, result, 10), expiry); err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteInt64(result)
+	notifyKeyspaceEvent(conn, notifyString, "incrby", key)
+}
+
+// setWithTTL implements SETEX and PSETEX, whose TTL argument is in the given unit.
+func setWithTTL(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+	unit time.Duration,
+) {
+	if len(args) != 4 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	ttl, ok := parseInt(args[2])
+	if !ok {
+		conn.WriteError(NotIntegerErrorMsg)
+		return
+	}
+
+	commandName := strings.ToLower(string(args[0]))
+	expiry, ok := expiryAfter(ttl, unit)
+	if !ok {
+		conn.WriteError(fmt.Sprintf(InvalidExpireErrorMsg, commandName))
+		return
+	}
+
+	mu.Lock()
+	err := db.SetWithExpiry(string(args[1]), args[3], expiry)
+	mu.Unlock()
+	if err != nil {
+		writeDBError(conn, err)
+		return
+	}
+	conn.WriteString("OK")
+	notifyKeyspaceEvent(conn, notifyString, "set", string(args[1]))
+	notifyKeyspaceEvent(conn, notifyGeneric, "expire", string(args[1]))
+}
+
+// parseSetOptions parses the options of SET, or returns the error reply.
+// Like Redis, it reports syntax errors before invalid expire times.
+func parseSetOptions(args [][]byte) (opts KeyValor.SetOptions, errMsg string) {
+	var expiryOption, expiryArg []byte
+
+	for i := 0; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		switch option {
+		case "nx", "xx":
+			condition := KeyValor.SetIfNotExists
+			if option == "xx" {
+				condition = KeyValor.SetIfExists
+			}
+			if opts.Condition != KeyValor.SetAlways && opts.Condition != condition {
+				return opts, SyntaxErrorMsg
+			}
+			opts.Condition = condition
+		case "get":
+			opts.Get = true
+		case "keepttl":
+			if expiryOption != nil {
+				return opts, SyntaxErrorMsg
+			}
+			opts.KeepTTL = true
+		case "ex", "px", "exat", "pxat":
+			if opts.KeepTTL || (expiryOption != nil && !strings.EqualFold(string(expiryOption), option)) ||
+				i+1 == len(args) {
+				return opts, SyntaxErrorMsg
+			}
+			expiryOption, expiryArg = args[i], args[i+1]
+			i++
+		default:
+			return opts, SyntaxErrorMsg
+		}
+	}
+
+	if expiryOption != nil {
+		opts.Expiry, errMsg = parseExpiryOption(expiryOption, expiryArg, "set")
+	}
+	return opts, errMsg
+}
+
+// parseExpiryOption parses one of the EX, PX, EXAT and PXAT options of SET and GETEX,
+// and returns the expiry time, or the error reply.
+func parseExpiryOption(option, arg []byte, commandName string) (time.Time, string) {
+	n, ok := parseInt(arg)
+	if !ok {
+		return time.Time{}, NotIntegerErrorMsg
+	}
+
+	var expiry time.Time
+	switch strings.ToLower(string(option)) {
+	case "ex":
+		expiry, ok = expiryAfter(n, time.Second)
+	case "px":
+		expiry, ok = expiryAfter(n, time.Millisecond)
+	case "exat":
+		ok = n > 0 && n <= math.MaxInt64/int64(time.Second)
+		expiry = time.Unix(n, 0)
+	case "pxat":
+		ok = n > 0 && n <= math.MaxInt64/int64(time.Millisecond)
+		expiry = time.UnixMilli(n)
+	default:
+		return time.Time{}, SyntaxErrorMsg
+	}
+
+	if !ok {
+		return time.Time{}, fmt.Sprintf(InvalidExpireErrorMsg, commandName)
+	}
+	return expiry, ""
+}
+
+// expiryAfter returns the time ttl units from now, or false if ttl isn't a valid TTL.
+func expiryAfter(ttl int64, unit time.Duration) (time.Time, bool) {
+	if ttl <= 0 || ttl > (math.MaxInt64-time.Now().UnixNano())/int64(unit) {
+		return time.Time{}, false
+	}
+	return time.Now().Add(time.Duration(ttl) * unit), true
+}
+
+// notifySetPairs notifies the set events of the keys of a flat key/value argument list.
+func notifySetPairs(conn redcon.Conn, pairs [][]byte) {
+	for i := 0; i < len(pairs); i += 2 {
+		notifyKeyspaceEvent(conn, notifyString, "set", string(pairs[i]))
+	}
+}
+
+// setPairs sets each key of a flat key/value argument list, clearing their TTLs.
+// The keys are all checked first, so that an invalid one sets none of them.
+func setPairs(db *KeyValor.KeyValorDatabase, pairs [][]byte) error {
+	for i := 0; i < len(pairs); i += 2 {
+		switch {
+		case len(pairs[i]) == 0:
+			return constants.ErrKeyIsEmpty
+		case len(pairs[i]) > constants.MaxKeySize:
+			return constants.ErrKeyTooBig
+		}
+	}
+
+	for i := 0; i < len(pairs); i += 2 {
+		if err := db.Set(string(pairs[i]), pairs[i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getString returns the value and expiry of key, and whether it exists
+// (missing, deleted and expired keys don't).
+func getString(db *KeyValor.KeyValorDatabase, key string) ([]byte, time.Time, bool, error) {
+	value, expiry, err := db.GetWithExpiry(key)
+	if err != nil {
+		if isMissingKey(err) {
+			return nil, time.Time{}, false, nil
+		}
+		return nil, time.Time{}, false, err
+	}
+	return value, expiry, true, nil
+}
+
+// keyExists tells whether key exists, whatever its data type.
+func keyExists(db *KeyValor.KeyValorDatabase, key string) (bool, error) {
+	typ, err := db.Type(key)
+	if err != nil {
+		return false, err
+	}
+	return typ != "none", nil
+}
+
+func isMissingKey(err error) bool {
+	return errors.Is(err, constants.ErrKeyMissing) ||
+		errors.Is(err, constants.ErrKeyIsDeleted) ||
+		errors.Is(err, constants.ErrKeyIsExpired)
+}
+
+// parseInt parses a base-10 64 bit integer the way Redis does:
+// no '+' sign, no leading zeros, no spaces.
+func parseInt(b []byte) (int64, bool) {
+	s := string(b)
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || s != strconv.FormatInt(n, 10) {
+		return 0, false
+	}
+	return n, true
+}
+
+// parseFloat parses a floating point number the way Redis does: no spaces, and no NaN.
+func parseFloat(b []byte) (float64, bool) {
+	s := string(b)
+	if len(s) == 0 || strings.TrimSpace(s) != s {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, false
+	}
+	return f, true
+}
+
+func writeBulkOrNull(conn redcon.Conn, value []byte, found bool) {
+	if found {
+		conn.WriteBulk(value)
+	} else {
+		writeNull(conn)
+	}
+}
+
+func writeWrongArgs(conn redcon.Conn, args [][]byte) {
+	conn.WriteError(fmt.Sprintf(InfalidArgumentsErrorMsg, strings.ToLower(string(args[0]))))
+}
+
+// writeDBError replies with the Redis wording of a database error.
+func writeDBError(conn redcon.Conn, err error) {
+	var reply replyError
+
+	switch {
+	case errors.As(err, &reply):
+		conn.WriteError(string(reply))
+	case errors.Is(err, constants.ErrWrongType):
+		conn.WriteError(WrongTypeErrorMsg)
+	case errors.Is(err, constants.ErrValueIsNotInteger):
+		conn.WriteError(NotIntegerErrorMsg)
+	case errors.Is(err, constants.ErrIncrOverflow):
+		conn.WriteError(IncrOverflowErrorMsg)
+	case errors.Is(err, constants.ErrKeyExists):
+		conn.WriteError(BusyKeyErrorMsg)
+	case errors.Is(err, constants.ErrBadDumpFormat):
+		conn.WriteError(BadDataFormatErrorMsg)
+	default:
+		conn.WriteError("ERR " + err.Error())
+	}
+}
@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// tlsAuthClients are the values of tls-auth-clients, and the client certificates they ask for.
+var tlsAuthClients = map[string]tls.ClientAuthType{
+	"no":       tls.NoClientCert,
+	"optional": tls.VerifyClientCertIfGiven,
+	"yes":      tls.RequireAndVerifyClientCert,
+}
+
+// TLSCertificates are the certificate of the TLS listener and, for mutual TLS, the bundle of
+// the CAs that sign the certificates of the clients. Reload reads their files again: the
+// next handshakes use them, while the connections already established keep going.
+type TLSCertificates struct {
+	certFile, keyFile, caCertFile string
+	clientAuth                    tls.ClientAuthType
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// LoadTLSCertificates loads the certificates of the TLS listener configured by cfg.
+func LoadTLSCertificates(cfg *ServerConfig) (*TLSCertificates, error) {
+	tc := &TLSCertificates{
+		certFile:   cfg.TLSCertFile,
+		keyFile:    cfg.TLSKeyFile,
+		caCertFile: cfg.TLSCACertFile,
+		clientAuth: tlsAuthClients[cfg.TLSAuthClients],
+	}
+	if err := tc.Reload(); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+// Reload reads the certificate files again. On error, the certificates in use are kept.
+func (tc *TLSCertificates) Reload() error {
+	cert, err := tls.LoadX509KeyPair(tc.certFile, tc.keyFile)
+	if err != nil {
+		return fmt.Errorf("cannot load the certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if tc.caCertFile != "" {
+		pem, err := os.ReadFile(tc.caCertFile)
+		if err != nil {
+			return fmt.Errorf("cannot load the CA certificates: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("cannot load the CA certificates: no certificate in %s", tc.caCertFile)
+		}
+	}
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.cert, tc.clientCAs = &cert, clientCAs
+	return nil
+}
+
+// Config returns the configuration of the TLS listener, which uses the certificates loaded
+// last for every handshake.
+func (tc *TLSCertificates) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			tc.mu.RLock()
+			defer tc.mu.RUnlock()
+
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*tc.cert},
+				ClientAuth:   tc.clientAuth,
+				ClientCAs:    tc.clientCAs,
+			}, nil
+		},
+	}
+}
@@ -0,0 +1,169 @@
+package commands
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/tidwall/redcon"
+
+	"KeyValor"
+)
+
+const (
+	NestedMultiErrorMsg         = "ERR MULTI calls can not be nested"
+	ExecWithoutMultiErrorMsg    = "ERR EXEC without MULTI"
+	DiscardWithoutMultiErrorMsg = "ERR DISCARD without MULTI"
+	WatchInsideMultiErrorMsg    = "ERR WATCH inside MULTI is not allowed"
+	ExecAbortErrorMsg           = "EXECABORT Transaction discarded because of previous errors."
+)
+
+// transactionCommands are run by Dispatch even inside a MULTI block, instead of being queued.
+// They aren't in CommandMap, since EXEC runs the queued commands from it.
+var transactionCommands = map[string]CommandFunc{
+	"multi":   Multi,
+	"exec":    Exec,
+	"discard": Discard,
+	"watch":   Watch,
+}
+
+var Multi CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 1 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	s := sessionOf(conn)
+	if s.multi {
+		conn.WriteError(NestedMultiErrorMsg)
+		return
+	}
+
+	s.multi = true
+	conn.WriteString("OK")
+}
+
+// Exec runs the queued commands under a single acquisition of mu, so that no command of
+// another client interleaves with them, and replies with the array of their replies.
+// It replies with a null array, without running them, if a watched key was written.
+var Exec CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 1 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	s := sessionOf(conn)
+	if !s.multi {
+		conn.WriteError(ExecWithoutMultiErrorMsg)
+		return
+	}
+
+	queue, failed := s.queue, s.failed
+	s.multi, s.queue, s.failed = false, nil, false
+	defer s.unwatch()
+
+	if failed {
+		conn.WriteError(ExecAbortErrorMsg)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, w := range s.watches {
+		if w.Dirty() {
+			writeNullArray(conn)
+			return
+		}
+	}
+
+	// the commands lock a mutex of their own: mu is held for the whole transaction
+	var txMu sync.RWMutex
+
+	s.executing = true
+	defer func() { s.executing = false }()
+
+	conn.WriteArray(len(queue))
+	for _, queued := range queue {
+		// a queued SELECT changes the database of the next commands
+		CommandMap[strings.ToLower(string(queued[0]))](conn, queued, &txMu, s.databases.Get(s.db))
+		s.server.monitors.feed(s, queued)
+	}
+}
+
+var Discard CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 1 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	s := sessionOf(conn)
+	if !s.multi {
+		conn.WriteError(DiscardWithoutMultiErrorMsg)
+		return
+	}
+
+	s.multi, s.queue, s.failed = false, nil, false
+	s.unwatch()
+	conn.WriteString("OK")
+}
+
+// Watch implements WATCH key [key ...]: EXEC aborts if one of the keys is written before it.
+var Watch CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) < 2 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	s := sessionOf(conn)
+	if s.multi {
+		conn.WriteError(WatchInsideMultiErrorMsg)
+		return
+	}
+
+	keys := make([]string, len(args)-1)
+	for i, key := range args[1:] {
+		keys[i] = string(key)
+	}
+
+	// writes hold mu locked: none of them is half done when the watch starts
+	mu.RLock()
+	s.watches = append(s.watches, db.Watch(keys...))
+	mu.RUnlock()
+
+	conn.WriteString("OK")
+}
+
+var Unwatch CommandFunc = func(
+	conn redcon.Conn,
+	args [][]byte,
+	mu *sync.RWMutex,
+	db *KeyValor.KeyValorDatabase,
+) {
+	if len(args) != 1 {
+		writeWrongArgs(conn, args)
+		return
+	}
+
+	sessionOf(conn).unwatch()
+	conn.WriteString("OK")
+}
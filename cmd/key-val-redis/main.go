@@ -1,66 +1,113 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
-	"io/fs"
 	"os"
-	"path/filepath"
-	"strings"
-	"sync"
+	"os/signal"
+	"syscall"
 
-	"github.com/tidwall/redcon"
-
-	"KeyValor"
 	"KeyValor/cmd/key-val-redis/commands"
 	"KeyValor/log"
 )
 
-var addr = ":6379"
+var configFile = flag.String("config", "", "config file, like redis.conf or in YAML (.yaml, .yml)")
+
+// loadConfig reads the configuration from the config file, if any, and the command-line
+// flags, which override it.
+func loadConfig() (*commands.ServerConfig, error) {
+	cfg := commands.DefaultServerConfig()
+	cfg.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", flag.Args())
+	}
+	if *configFile != "" {
+		if err := cfg.LoadFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.ApplyFlags(flag.CommandLine); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
 
 func main() {
-	var mu sync.RWMutex
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	var certs *commands.TLSCertificates
+	if cfg.TLSPort != 0 {
+		if certs, err = commands.LoadTLSCertificates(cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot load the TLS certificates: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-	homeDir, _ := os.UserHomeDir()
-	keyValurStoreDir := filepath.Join(homeDir, "keyvalor")
-	logDir := filepath.Join(homeDir, "keyvalorlogs")
-	log.InitLogger(logDir)
+	log.InitLoggerAtLevel(cfg.LogDir, cfg.LogLevel)
 
-	os.MkdirAll(keyValurStoreDir, fs.ModePerm)
-	db, err := KeyValor.NewKeyValorDB(KeyValor.WithDirectory(keyValurStoreDir))
+	dbs, err := commands.OpenDatabases(cfg.Dir, cfg.Databases, cfg.Options()...)
 	if err != nil {
 		panic(fmt.Sprintf("cannot initialize KeyValor store, err: [%+v]", err))
 	}
 
-	err = redcon.ListenAndServe(addr,
-		func(conn redcon.Conn, cmd redcon.Command) {
+	srv := commands.NewServer(cfg, dbs)
+	if cfg.ACLFile != "" {
+		if err := srv.LoadACLFile(cfg.ACLFile); err != nil {
+			fmt.Fprintf(os.Stderr, "cannot load the ACL file: %v\n", err)
+			srv.Shutdown(true)
+			os.Exit(1)
+		}
+	}
 
-			if len(cmd.Args) == 0 {
-				conn.WriteError(fmt.Sprintf("ERR no arguments for command: [%s]", string(cmd.Raw)))
-				return
+	// the server owns the databases: it shuts them down on SIGINT or SIGTERM, or for SHUTDOWN;
+	// SIGHUP reloads the TLS certificates
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGHUP {
+				if certs == nil {
+					continue
+				}
+				if err := certs.Reload(); err != nil {
+					log.Errorf("cannot reload the TLS certificates, keeping the current ones: %v", err)
+				} else {
+					log.Infof("reloaded the TLS certificates")
+				}
+				continue
 			}
+			log.Infof("received %s, shutting down", sig)
+			srv.Shutdown(true)
+			return
+		}
+	}()
 
-			commandName := strings.ToLower(string(cmd.Args[0]))
+	var listeners []func() error
+	if cfg.Port != 0 {
+		listeners = append(listeners, func() error { return srv.ListenAndServe(cfg.Addr()) })
+	}
+	if cfg.TLSPort != 0 {
+		listeners = append(listeners, func() error { return srv.ListenAndServeTLS(cfg.TLSAddr(), certs) })
+	}
 
-			commandFunc, supported := commands.CommandMap[commandName]
-			if !supported {
-				conn.WriteError("ERR unknown command '" + commandName + "'")
-			} else {
-				commandFunc(conn, cmd.Args, &mu, db)
-			}
-		},
-		func(conn redcon.Conn) bool {
-			// Use this function to accept or deny the connection.
-			// log.Printf("accept: %s", conn.RemoteAddr())
-			return true
-		},
-		func(conn redcon.Conn, err error) {
-			// This is called when the connection has been closed
-			log.Infof("closed: %s, err: %v", conn.RemoteAddr(), err)
-			log.Infof("closing key-value store")
-			db.Shutdown()
-		},
-	)
-	if err != nil {
-		log.Fatalf("%v", err)
+	errs := make(chan error, len(listeners))
+	for _, listen := range listeners {
+		go func(listen func() error) { errs <- listen() }(listen)
+	}
+	for range listeners {
+		if err := <-errs; !errors.Is(err, commands.ErrServerClosed) {
+			log.Fatalf("%v", err)
+		}
 	}
+	log.Infof("shut down")
 }
@@ -0,0 +1,156 @@
+package KeyValor
+
+import (
+	"sync"
+	"time"
+
+	"KeyValor/internal/storage"
+	"KeyValor/internal/utils/timeutils"
+)
+
+// maxCachedCollections is the number of decoded collections a database keeps.
+const maxCachedCollections = 1024
+
+// collectionCache keeps the decoded form of the collections last read or updated, so that
+// reading one again doesn't read and decode its whole stored value. Only the shareable
+// collections are cached, the sorted sets: rebuilding their skiplist is the most expensive
+// decoding.
+//
+// An entry is dropped by every write of its key (see cacheInvalidatingStorage), which runs with
+// the lock of the database held: the readers, which take its read lock, never see an entry
+// older than the stored value.
+type collectionCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedCollection
+}
+
+// shareableCollection is a collection that can be cached: share returns another collection
+// with the same elements, and makes both of them copy their elements before their first
+// modification, so that the cached one never changes.
+type shareableCollection interface {
+	collection
+	share() collection
+}
+
+type cachedCollection struct {
+	c shareableCollection
+	// expiry is the expiry of the key when c was cached (zero if it doesn't expire): the
+	// expired keys are deleted by the storage engine itself, without going through the cache
+	expiry time.Time
+}
+
+func newCollectionCache() *collectionCache {
+	return &collectionCache{entries: make(map[string]cachedCollection)}
+}
+
+// get returns a share of the collection cached for key and the expiry of the key, unless the
+// key has expired since.
+func (cc *collectionCache) get(key string) (collection, time.Time, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	entry, ok := cc.entries[key]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	if !entry.expiry.IsZero() && entry.expiry.UnixNano() <= timeutils.CurrentTimeNanos() {
+		delete(cc.entries, key)
+		return nil, time.Time{}, false
+	}
+	return entry.c.share(), entry.expiry, true
+}
+
+// put caches a share of c, the collection stored at key until expiry. A full cache drops an
+// arbitrary entry first.
+func (cc *collectionCache) put(key string, c shareableCollection, expiry time.Time) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if _, ok := cc.entries[key]; !ok && len(cc.entries) >= maxCachedCollections {
+		for evicted := range cc.entries {
+			delete(cc.entries, evicted)
+			break
+		}
+	}
+	cc.entries[key] = cachedCollection{c: c.share().(shareableCollection), expiry: expiry}
+}
+
+// drop drops the entries of keys.
+func (cc *collectionCache) drop(keys ...string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	for _, key := range keys {
+		delete(cc.entries, key)
+	}
+}
+
+// clear drops every entry.
+func (cc *collectionCache) clear() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	clear(cc.entries)
+}
+
+// cacheInvalidatingStorage wraps the storage of a database, and drops the cached collections of
+// the keys it writes.
+type cacheInvalidatingStorage struct {
+	storage.DiskStorage
+	cache *collectionCache
+}
+
+func (cis *cacheInvalidatingStorage) Set(key string, value []byte) error {
+	cis.cache.drop(key)
+	return cis.DiskStorage.Set(key, value)
+}
+
+func (cis *cacheInvalidatingStorage) Delete(key string) error {
+	cis.cache.drop(key)
+	return cis.DiskStorage.Delete(key)
+}
+
+func (cis *cacheInvalidatingStorage) SetEx(key string, value []byte, ttlSeconds int64) error {
+	cis.cache.drop(key)
+	return cis.DiskStorage.SetEx(key, value, ttlSeconds)
+}
+
+func (cis *cacheInvalidatingStorage) SetWithExpiry(key string, value []byte, expiry time.Time) error {
+	cis.cache.drop(key)
+	return cis.DiskStorage.SetWithExpiry(key, value, expiry)
+}
+
+func (cis *cacheInvalidatingStorage) Expire(key string, expireTime *time.Time) error {
+	cis.cache.drop(key)
+	return cis.DiskStorage.Expire(key, expireTime)
+}
+
+func (cis *cacheInvalidatingStorage) Persist(key string) error {
+	cis.cache.drop(key)
+	return cis.DiskStorage.Persist(key)
+}
+
+func (cis *cacheInvalidatingStorage) Incr(key string) error {
+	cis.cache.drop(key)
+	return cis.DiskStorage.Incr(key)
+}
+
+func (cis *cacheInvalidatingStorage) Decr(key string) error {
+	cis.cache.drop(key)
+	return cis.DiskStorage.Decr(key)
+}
+
+func (cis *cacheInvalidatingStorage) Rename(key, newKey string) error {
+	cis.cache.drop(key, newKey)
+	return cis.DiskStorage.Rename(key, newKey)
+}
+
+func (cis *cacheInvalidatingStorage) Copy(key, destination string, replace bool) (bool, error) {
+	cis.cache.drop(destination)
+	return cis.DiskStorage.Copy(key, destination, replace)
+}
+
+func (cis *cacheInvalidatingStorage) Clear() error {
+	cis.cache.clear()
+	return cis.DiskStorage.Clear()
+}
@@ -0,0 +1,203 @@
+package KeyValor
+
+import (
+	"time"
+
+	"KeyValor/constants"
+	"KeyValor/dbops"
+	"KeyValor/internal/datatypes"
+	"KeyValor/internal/storage/storagecommon"
+)
+
+// collection is the in-memory form of the value of a hash, list, set or sorted set key.
+type collection interface {
+	kind() datatypes.Kind
+	encode() []byte
+	Len() int
+}
+
+// decodeString returns the value of a string key from its stored form,
+// or constants.ErrWrongType if the key holds another data type.
+func decodeString(stored []byte) ([]byte, error) {
+	kind, payload, err := datatypes.Untag(stored)
+	if err != nil {
+		return nil, err
+	}
+	if kind != datatypes.KindString {
+		return nil, constants.ErrWrongType
+	}
+	return payload, nil
+}
+
+// Type returns the data type of the value stored at key: "string", "hash", "list", "set",
+// or "zset"; or "none" if the key doesn't exist.
+// It acquires a read lock on the database to ensure thread safety.
+func (db *KeyValorDatabase) Type(key string) (typ string, err error) {
+	err = db.intercept(dbops.OpType, false, []string{key}, func() error {
+		db.RLock()
+		defer db.RUnlock()
+
+		stored, err := db.storage.Get(key)
+		if err != nil {
+			if storagecommon.IsMissingKey(err) {
+				typ = "none"
+				return nil
+			}
+			return err
+		}
+
+		kind, _, err := datatypes.Untag(stored)
+		if err != nil {
+			return err
+		}
+		typ = kind.String()
+		return nil
+	})
+	return typ, err
+}
+
+// readCollection returns the collection stored at key, or an empty one if the key doesn't exist.
+// The shareable collections come from the cache of the database once they were loaded.
+func readCollection[C collection](
+	db *KeyValorDatabase,
+	op string,
+	key string,
+	decode func(payload []byte) (C, error),
+	empty func() C,
+) (c C, err error) {
+	err = db.intercept(op, false, []string{key}, func() error {
+		db.RLock()
+		defer db.RUnlock()
+
+		var (
+			expiry time.Time
+			found  bool
+		)
+		c, expiry, found, err = loadCollectionMuLocked(db, key, decode, empty)
+		if shareable, ok := any(c).(shareableCollection); ok && found && err == nil {
+			db.collections.put(key, shareable, expiry)
+		}
+		return err
+	})
+	return c, err
+}
+
+// updateCollection atomically loads the collection stored at key (an empty one if the key
+// doesn't exist), calls update on it, and stores it back, unless update fails.
+// The key keeps its expiry; it is deleted once the collection is empty.
+func updateCollection[C collection](
+	db *KeyValorDatabase,
+	op string,
+	key string,
+	decode func(payload []byte) (C, error),
+	empty func() C,
+	update func(c C) error,
+) error {
+	return updateCollections(db, op, []string{key}, decode, empty, func(cs []C) error {
+		return update(cs[0])
+	})
+}
+
+// updateCollections is updateCollection for several keys at once: cs[i] is the collection
+// stored at keys[i], and a key given more than once gets the same collection.
+func updateCollections[C collection](
+	db *KeyValorDatabase,
+	op string,
+	keys []string,
+	decode func(payload []byte) (C, error),
+	empty func() C,
+	update func(cs []C) error,
+) error {
+	return db.intercept(op, true, keys, func() error {
+		db.Lock()
+		defer db.Unlock()
+
+		type loaded struct {
+			c      C
+			expiry time.Time
+			found  bool
+		}
+
+		byKey := make(map[string]*loaded, len(keys))
+		cs := make([]C, len(keys))
+		for i, key := range keys {
+			if l, ok := byKey[key]; ok {
+				cs[i] = l.c
+				continue
+			}
+
+			c, expiry, found, err := loadCollectionMuLocked(db, key, decode, empty)
+			if err != nil {
+				return err
+			}
+			byKey[key] = &loaded{c: c, expiry: expiry, found: found}
+			cs[i] = c
+		}
+
+		if err := update(cs); err != nil {
+			return err
+		}
+
+		for key, l := range byKey {
+			var err error
+			switch {
+			case l.c.Len() == 0 && l.found:
+				err = db.storage.Delete(key)
+			case l.c.Len() == 0:
+			case l.found:
+				err = db.storage.SetWithExpiry(key, datatypes.Tag(l.c.kind(), l.c.encode()), l.expiry)
+				// a new key may get the default TTL: it is cached by the next read instead
+				if shareable, ok := any(l.c).(shareableCollection); ok && err == nil {
+					db.collections.put(key, shareable, l.expiry)
+				}
+			default:
+				err = db.storage.Set(key, datatypes.Tag(l.c.kind(), l.c.encode()))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// loadCollectionMuLocked returns the collection stored at key with its expiry, and whether the
+// key exists: a shareable collection is a share of the cached one, if any.
+func loadCollectionMuLocked[C collection](
+	db *KeyValorDatabase,
+	key string,
+	decode func(payload []byte) (C, error),
+	empty func() C,
+) (C, time.Time, bool, error) {
+	var zero C
+
+	if _, shareable := any(zero).(shareableCollection); shareable {
+		if cached, expiry, ok := db.collections.get(key); ok {
+			if c, ok := cached.(C); ok {
+				return c, expiry, true, nil
+			}
+		}
+	}
+
+	stored, expiry, err := db.storage.GetWithExpiry(key)
+	if err != nil {
+		if storagecommon.IsMissingKey(err) {
+			return empty(), time.Time{}, false, nil
+		}
+		return zero, time.Time{}, false, err
+	}
+
+	kind, payload, err := datatypes.Untag(stored)
+	if err != nil {
+		return zero, time.Time{}, false, err
+	}
+	if kind != empty().kind() {
+		return zero, time.Time{}, false, constants.ErrWrongType
+	}
+
+	c, err := decode(payload)
+	if err != nil {
+		return zero, time.Time{}, false, err
+	}
+	return c, expiry, true, nil
+}
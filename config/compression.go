@@ -0,0 +1,34 @@
+package config
+
+import "fmt"
+
+// Compression identifies the codec used to compress values on disk.
+type Compression int8
+
+const (
+	CompressionNone Compression = iota
+	CompressionFlate
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionFlate:
+		return "flate"
+	default:
+		return fmt.Sprintf("unknown(%d)", int8(c))
+	}
+}
+
+// ParseCompression converts a codec name (as returned by String) to a Compression.
+func ParseCompression(name string) (Compression, error) {
+	switch name {
+	case "", "none":
+		return CompressionNone, nil
+	case "flate":
+		return CompressionFlate, nil
+	default:
+		return CompressionNone, fmt.Errorf("unknown compression: %q", name)
+	}
+}
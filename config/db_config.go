@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"KeyValor/constants"
+	"KeyValor/dbops"
 )
 
 type DBCfgOpts struct {
@@ -11,13 +12,42 @@ type DBCfgOpts struct {
 	SyncWriteInterval     time.Duration
 	CompactInterval       time.Duration
 	CheckFileSizeInterval time.Duration
-	MaxActiveFileSize     int64
+	// ActiveExpireInterval is the interval of the task that deletes the expired keys
+	ActiveExpireInterval time.Duration
+	MaxActiveFileSize    int64
+	// SyncPolicy is when the writes are synced to disk
+	SyncPolicy SyncPolicy
+	// DefaultTTL is applied to keys written without an explicit expiry (0 = never expire)
+	DefaultTTL time.Duration
+	// Compression is the codec used for values stored on disk
+	Compression Compression
+	// ReadOnly opens every file read-only, rejects writes and runs no background tasks
+	ReadOnly bool
+	// LockMode is how the data directory is claimed (see LockMode)
+	LockMode LockMode
+	// Interceptors wrap every database operation, the first one being the outermost
+	Interceptors []dbops.Interceptor
+	// ExpiryListener is called with the keys deleted because they expired, by the active
+	// expiry and the compaction (nil if none)
+	ExpiryListener func(keys []string)
+	// LatencyListener is called with the duration of every run of a background task, named
+	// by one of the Latency* events (nil if none)
+	LatencyListener func(event string, duration time.Duration)
 }
 
+// the events of LatencyListener: the background tasks that hold the lock of the storage
+const (
+	LatencyCompaction   = "compaction"
+	LatencyFileRotation = "file-rotation"
+	LatencyIndexFlush   = "index-flush"
+	LatencyExpireCycle  = "expire-cycle"
+)
+
 const (
 	defaultSyncInterval      = time.Minute * 1
 	defaultCompactInterval   = time.Hour * 2
 	defaultFileSizeInterval  = time.Minute * 1
+	defaultExpireInterval    = time.Second * 1
 	defaultMaxActiveFileSize = 5 * constants.MB
 )
 
@@ -27,6 +57,20 @@ func DefaultOpts() *DBCfgOpts {
 		SyncWriteInterval:     defaultSyncInterval,
 		CompactInterval:       defaultCompactInterval,
 		CheckFileSizeInterval: defaultFileSizeInterval,
+		ActiveExpireInterval:  defaultExpireInterval,
 		MaxActiveFileSize:     defaultMaxActiveFileSize,
+		SyncPolicy:            SyncEveryInterval,
+		DefaultTTL:            0,
+		Compression:           CompressionNone,
+		ReadOnly:              false,
+		LockMode:              LockExclusive,
 	}
 }
+
+// Clone returns a copy of the options, so that a derived keyspace
+// (e.g. a namespace) can override fields without affecting its parent.
+func (cfg *DBCfgOpts) Clone() *DBCfgOpts {
+	clone := *cfg
+	clone.Interceptors = append([]dbops.Interceptor(nil), cfg.Interceptors...)
+	return &clone
+}
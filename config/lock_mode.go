@@ -0,0 +1,28 @@
+package config
+
+// LockMode is how a process claims a data directory when opening it.
+type LockMode int8
+
+const (
+	// LockExclusive is taken by the (single) process writing to a directory.
+	LockExclusive LockMode = iota
+	// LockShared is taken by read-only processes, alongside the writer.
+	// The writer postpones the compaction of data files while it is held.
+	LockShared
+	// LockNone takes no lock at all. Meant for read-only access to a
+	// checkpoint (a copy of a data directory) that no process writes to.
+	LockNone
+)
+
+func (m LockMode) String() string {
+	switch m {
+	case LockExclusive:
+		return "exclusive"
+	case LockShared:
+		return "shared"
+	case LockNone:
+		return "none"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,37 @@
+package config
+
+import "fmt"
+
+// SyncPolicy is when the writes are synced (fsync) to the data files.
+type SyncPolicy int8
+
+const (
+	// SyncEveryInterval syncs the data files with every index flush (see SyncWriteInterval):
+	// a crash loses at most the writes of the last interval.
+	SyncEveryInterval SyncPolicy = iota
+	// SyncAlways syncs the active data file after every write, before the write returns.
+	SyncAlways
+)
+
+func (p SyncPolicy) String() string {
+	switch p {
+	case SyncEveryInterval:
+		return "interval"
+	case SyncAlways:
+		return "always"
+	default:
+		return fmt.Sprintf("unknown(%d)", int8(p))
+	}
+}
+
+// ParseSyncPolicy converts a policy name (as returned by String) to a SyncPolicy.
+func ParseSyncPolicy(name string) (SyncPolicy, error) {
+	switch name {
+	case "", "interval":
+		return SyncEveryInterval, nil
+	case "always":
+		return SyncAlways, nil
+	default:
+		return SyncEveryInterval, fmt.Errorf("unknown sync policy: %q", name)
+	}
+}
@@ -29,4 +29,48 @@ var (
 	ErrWalFileNotFound = errors.New("the WAL file is missing for the given File ID")
 	// ErrErrorReadingRecordFromFile is returned when a record couldn't be read from the WAL file
 	ErrErrorReadingRecordFromFile = errors.New("error reading record from WAL file")
+
+	// ErrInvalidNamespaceName is returned when a namespace name has characters other than [A-Za-z0-9_-]
+	ErrInvalidNamespaceName = errors.New("invalid namespace name")
+	// ErrNestedNamespace is returned when namespace operations are called on a namespace
+	ErrNestedNamespace = errors.New("namespaces can't be nested")
+	// ErrNamespaceNotFound is returned when dropping a namespace that doesn't exist
+	ErrNamespaceNotFound = errors.New("namespace not found")
+	// ErrNamespaceNotOpen is returned when closing a namespace that isn't open
+	ErrNamespaceNotOpen = errors.New("namespace is not open")
+
+	// ErrCompressionMismatch is returned when a directory is opened with another compression
+	// than the one its data was written with
+	ErrCompressionMismatch = errors.New("the data was written with another compression")
+
+	// ErrReadOnly is returned when a write operation is called on a database opened in read-only mode
+	ErrReadOnly = errors.New("database is opened in read-only mode")
+	// ErrInvalidLockMode is returned when the lock mode doesn't match the read-only setting
+	ErrInvalidLockMode = errors.New("invalid lock mode")
+	// ErrStoreIsBusy is returned when a lock on the data directory is held by another process
+	ErrStoreIsBusy = errors.New("store is locked by another process")
+
+	// ErrValueIsNotInteger is returned when incrementing a value that isn't a base-10 64 bit integer
+	ErrValueIsNotInteger = errors.New("value is not an integer or out of range")
+	// ErrWrongType is returned when an operation is called on a key holding another data type
+	ErrWrongType = errors.New("operation against a key holding the wrong kind of value")
+	// ErrIncrOverflow is returned when an increment would overflow a 64 bit integer
+	ErrIncrOverflow = errors.New("increment or decrement would overflow")
+	// ErrNotReconfigurable is returned when reconfiguring an option that is fixed once the database is open
+	ErrNotReconfigurable = errors.New("option can't change while the database is open")
+	// ErrSameDatabase is returned when moving a key to the database it is in
+	ErrSameDatabase = errors.New("source and destination databases are the same")
+	// ErrSameKey is returned when copying a key onto itself
+	ErrSameKey = errors.New("source and destination keys are the same")
+	// ErrKeyExists is returned when restoring a key that exists, without replacing it
+	ErrKeyExists = errors.New("target key name already exists")
+	// ErrInvalidDumpPayload is returned when restoring a payload whose version or checksum is wrong
+	ErrInvalidDumpPayload = errors.New("DUMP payload version or checksum are wrong")
+	// ErrBadDumpFormat is returned when restoring a payload that can't be decoded
+	ErrBadDumpFormat = errors.New("bad data format")
+	// ErrKeyDuplicated is returned when a moved key couldn't be deleted from its database,
+	// nor from the one it was moved to: it exists in both
+	ErrKeyDuplicated = errors.New("moved key exists in both databases")
+	// ErrNotSupported is returned by the operations a storage engine doesn't implement yet
+	ErrNotSupported = errors.New("operation not supported by the storage engine")
 )
@@ -1,12 +1,15 @@
 package KeyValor
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
 	"KeyValor/config"
+	"KeyValor/dbops"
 	"KeyValor/internal/storage"
 	"KeyValor/internal/storage/hashtable"
+	"KeyValor/internal/storage/storagecommon"
 )
 
 type KeyValorDatabase struct {
@@ -14,6 +17,23 @@ type KeyValorDatabase struct {
 
 	cfg     *config.DBCfgOpts
 	storage storage.DiskStorage
+	common  *storagecommon.CommonStorage
+
+	// interceptor is the chain built from cfg.Interceptors (nil when there are none)
+	interceptor dbops.Interceptor
+
+	// watches made dirty by the writes
+	watches watchRegistry
+	// collections are the decoded collections, dropped by the writes of their key
+	collections *collectionCache
+	// lists stores the elements of the lists, and wraps storage
+	lists *listStore
+
+	// namespaces opened from this database (nil for a namespace itself)
+	nsMu       sync.Mutex
+	namespaces map[string]*Namespace
+	// drops are the removals of the files of dropped namespaces, waited for by Shutdown
+	drops sync.WaitGroup
 }
 
 func NewKeyValorDB(options ...Option) (*KeyValorDatabase, error) {
@@ -22,23 +42,64 @@ func NewKeyValorDB(options ...Option) (*KeyValorDatabase, error) {
 		option(opts)
 	}
 
-	storage, err := hashtable.NewHashTableStorage(opts)
+	cs, err := storagecommon.NewCommonStorage(opts)
 	if err != nil {
+		return nil, fmt.Errorf("error creating common storage: %w", err)
+	}
+
+	if err := loadOrStoreOptions(opts, OPTIONS_FILENAME); err != nil {
+		cs.Close()
 		return nil, err
 	}
 
-	if err := storage.Init(); err != nil {
+	collections := newCollectionCache()
+	dbStorage, lists, err := openStorage(cs, collections)
+	if err != nil {
+		cs.Close()
 		return nil, err
 	}
 
+	// finish deleting namespaces whose drop was interrupted
+	if !opts.ReadOnly {
+		removeDroppedNamespaces(opts.Directory)
+	}
+
 	kvDB := &KeyValorDatabase{
-		cfg:     opts,
-		storage: storage,
+		cfg:         opts,
+		storage:     dbStorage,
+		common:      cs,
+		collections: collections,
+		lists:       lists,
+		interceptor: dbops.Chain(opts.Interceptors...),
+		namespaces:  make(map[string]*Namespace),
 	}
 
 	return kvDB, nil
 }
 
+// openStorage creates and starts the storage engine for cs.Cfg.Directory, with the store of the
+// elements of its lists, and whose writes drop the entries of collections.
+func openStorage(cs *storagecommon.CommonStorage, collections *collectionCache) (storage.DiskStorage, *listStore, error) {
+	engine, err := hashtable.NewHashTableStorage(cs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := engine.Init(); err != nil {
+		return nil, nil, err
+	}
+
+	lists, err := openListStore(cs, engine)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cs.Cfg.ReadOnly {
+		return storage.NewReadOnlyStorage(lists), lists, nil
+	}
+	return &cacheInvalidatingStorage{DiskStorage: lists, cache: collections}, lists, nil
+}
+
 // Option is a function that configures a DBCfgOpts.
 type Option func(*config.DBCfgOpts)
 
@@ -70,6 +131,13 @@ func WithCheckFileSizeInterval(interval time.Duration) Option {
 	}
 }
 
+// WithActiveExpireInterval sets the activeExpireInterval option.
+func WithActiveExpireInterval(interval time.Duration) Option {
+	return func(cfg *config.DBCfgOpts) {
+		cfg.ActiveExpireInterval = interval
+	}
+}
+
 // WithMaxActiveFileSize sets the maxActiveFileSize option.
 func WithMaxActiveFileSize(size int64) Option {
 	return func(cfg *config.DBCfgOpts) {
@@ -77,6 +145,100 @@ func WithMaxActiveFileSize(size int64) Option {
 	}
 }
 
+// WithSyncPolicy sets when the writes are synced to disk: with every index flush (the
+// default), or after every write.
+func WithSyncPolicy(policy config.SyncPolicy) Option {
+	return func(cfg *config.DBCfgOpts) {
+		cfg.SyncPolicy = policy
+	}
+}
+
+// WithDefaultTTL sets the expiry applied to keys written without an explicit TTL.
+func WithDefaultTTL(ttl time.Duration) Option {
+	return func(cfg *config.DBCfgOpts) {
+		cfg.DefaultTTL = ttl
+	}
+}
+
+// WithReadOnly opens the database in read-only mode: every file is opened read-only,
+// background tasks (compaction, file rotation, index flushes) don't run, and write
+// operations fail with constants.ErrReadOnly. It takes a shared lock on the directory,
+// so that it can be used alongside the process writing to it; that process postpones
+// compactions while read-only processes are attached. A directory that no writer has
+// open and without the lock file, like a checkpoint, is opened without the lock.
+//
+// Reads see the data as of the writer's last index flush.
+func WithReadOnly() Option {
+	return func(cfg *config.DBCfgOpts) {
+		cfg.ReadOnly = true
+		cfg.LockMode = config.LockShared
+	}
+}
+
+// WithLockMode sets how the directory is locked. Read-only databases can use
+// config.LockNone to open a checkpoint (a copy of a data directory) without any lock.
+func WithLockMode(mode config.LockMode) Option {
+	return func(cfg *config.DBCfgOpts) {
+		cfg.LockMode = mode
+	}
+}
+
+// WithInterceptors adds interceptors around every database operation, e.g. for metrics,
+// tracing, auditing or authorization. They run in the order given, the first one being
+// the outermost, after any interceptors already configured. A namespace runs the
+// interceptors of its database, followed by its own.
+func WithInterceptors(interceptors ...dbops.Interceptor) Option {
+	return func(cfg *config.DBCfgOpts) {
+		cfg.Interceptors = append(cfg.Interceptors, interceptors...)
+	}
+}
+
+// WithExpiryListener sets a function called with the keys that the background tasks delete
+// because they expired: the active expiry, every ActiveExpireInterval, and the compaction.
+// It is called outside the locks of the database, from the goroutine of the task, and isn't
+// inherited by the namespaces.
+func WithExpiryListener(listener func(keys []string)) Option {
+	return func(cfg *config.DBCfgOpts) {
+		cfg.ExpiryListener = listener
+	}
+}
+
+// WithLatencyListener sets a function called with the duration of every run of the background
+// tasks that lock the database: the compaction, the file rotation, the index flush and the
+// active expiry (see the config.Latency* events). It is called from the goroutine of the task,
+// once it is done, and is inherited by the namespaces.
+func WithLatencyListener(listener func(event string, duration time.Duration)) Option {
+	return func(cfg *config.DBCfgOpts) {
+		cfg.LatencyListener = listener
+	}
+}
+
+// WithCompression sets the codec used to compress values on disk. It is fixed when the
+// directory is created: opening it with another codec fails with
+// constants.ErrCompressionMismatch.
+func WithCompression(compression config.Compression) Option {
+	return func(cfg *config.DBCfgOpts) {
+		cfg.Compression = compression
+	}
+}
+
+// Shutdown closes the database, and its namespaces: it syncs the data files and persists
+// the index, and releases the lock of the directory.
 func (db *KeyValorDatabase) Shutdown() error {
+	// namespaces share our lock file and scheduler, so they are closed first
+	if err := db.closeNamespaces(true); err != nil {
+		return err
+	}
+	db.drops.Wait()
 	return db.storage.Close()
 }
+
+// ShutdownWithoutCheckpoint is Shutdown, without persisting the index: the database reopens
+// with the index of its last checkpoint, losing the writes made since then.
+func (db *KeyValorDatabase) ShutdownWithoutCheckpoint() error {
+	if err := db.closeNamespaces(false); err != nil {
+		return err
+	}
+	db.drops.Wait()
+	return db.storage.CloseWithoutCheckpoint()
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"KeyValor/dbops"
+	"KeyValor/internal/datatypes"
 )
 
 // Get retrieves the value associated with the given key from the key-value store.
@@ -17,11 +18,37 @@ import (
 // - An error if the key is missing, expired, or the checksum is invalid.
 //
 // Note: This function does not perform any validation on the key or value.
-func (db *KeyValorDatabase) Get(key string) ([]byte, error) {
-	db.RLock()
-	defer db.RUnlock()
+func (db *KeyValorDatabase) Get(key string) (value []byte, err error) {
+	err = db.intercept(dbops.OpGet, false, []string{key}, func() error {
+		db.RLock()
+		defer db.RUnlock()
 
-	return db.storage.Get(key)
+		value, err = db.storage.Get(key)
+		if err != nil {
+			return err
+		}
+		value, err = decodeString(value)
+		return err
+	})
+	return value, err
+}
+
+// GetWithExpiry retrieves the value associated with the given key,
+// and the time at which it expires (zero if it doesn't expire).
+// It acquires a read lock on the database to ensure thread safety.
+func (db *KeyValorDatabase) GetWithExpiry(key string) (value []byte, expiry time.Time, err error) {
+	err = db.intercept(dbops.OpGetWithExpiry, false, []string{key}, func() error {
+		db.RLock()
+		defer db.RUnlock()
+
+		value, expiry, err = db.storage.GetWithExpiry(key)
+		if err != nil {
+			return err
+		}
+		value, err = decodeString(value)
+		return err
+	})
+	return value, expiry, err
 }
 
 // MGet retrieves the values associated with the given keys from the key-value store.
@@ -36,11 +63,20 @@ func (db *KeyValorDatabase) Get(key string) ([]byte, error) {
 //     If the value is successfully retrieved, both the value and error will be nil.
 //
 // Note: This function does not perform any validation on the keys or values.
-func (db *KeyValorDatabase) MGet(keys []string) ([]dbops.Value, error) {
-	db.Lock()
-	defer db.Unlock()
+func (db *KeyValorDatabase) MGet(keys []string) (values []dbops.Value, err error) {
+	err = db.intercept(dbops.OpMGet, false, keys, func() error {
+		db.Lock()
+		defer db.Unlock()
 
-	return db.storage.MGet(keys)
+		values, err = db.storage.MGet(keys)
+		for i := range values {
+			if values[i].Err == nil {
+				values[i].Val, values[i].Err = decodeString(values[i].Val)
+			}
+		}
+		return err
+	})
+	return values, err
 }
 
 // Exists checks if a key exists in the key-value store.
@@ -52,11 +88,15 @@ func (db *KeyValorDatabase) MGet(keys []string) ([]dbops.Value, error) {
 // Returns:
 //   - A boolean value indicating whether the key exists in the store.
 //     Returns true if the key exists, false otherwise.
-func (db *KeyValorDatabase) Exists(key string) bool {
-	db.RLock()
-	defer db.RUnlock()
+func (db *KeyValorDatabase) Exists(key string) (exists bool) {
+	_ = db.intercept(dbops.OpExists, false, []string{key}, func() error {
+		db.RLock()
+		defer db.RUnlock()
 
-	return db.storage.Exists(key)
+		exists = db.storage.Exists(key)
+		return nil
+	})
+	return exists
 }
 
 // Set inserts or updates a key-value pair in the key-value store.
@@ -70,10 +110,12 @@ func (db *KeyValorDatabase) Exists(key string) bool {
 //   - An error if the key or value is invalid or if there is an issue writing to the database.
 //     Otherwise, it returns nil.
 func (db *KeyValorDatabase) Set(key string, value []byte) error {
-	db.Lock()
-	defer db.Unlock()
+	return db.intercept(dbops.OpSet, true, []string{key}, func() error {
+		db.Lock()
+		defer db.Unlock()
 
-	return db.storage.Set(key, value)
+		return db.storage.Set(key, datatypes.EncodeString(value))
+	})
 }
 
 // Delete removes a key-value pair from the key-value store.
@@ -86,69 +128,192 @@ func (db *KeyValorDatabase) Set(key string, value []byte) error {
 //   - An error if there is an issue writing to the database or if the key is missing.
 //     Otherwise, it returns nil.
 func (db *KeyValorDatabase) Delete(key string) error {
-	db.Lock()
-	defer db.Unlock()
+	return db.intercept(dbops.OpDelete, true, []string{key}, func() error {
+		db.Lock()
+		defer db.Unlock()
+
+		return db.storage.Delete(key)
+	})
+}
+
+func (db *KeyValorDatabase) AllKeys() (keys []string, err error) {
+	err = db.intercept(dbops.OpAllKeys, false, nil, func() error {
+		db.RLock()
+		defer db.RUnlock()
 
-	return db.storage.Delete(key)
+		keys, err = db.storage.AllKeys()
+		return err
+	})
+	return keys, err
 }
 
-func (db *KeyValorDatabase) AllKeys() ([]string, error) {
-	db.RLock()
-	defer db.RUnlock()
+// Keys returns the keys matching a Redis glob-style pattern, e.g. "user:*".
+func (db *KeyValorDatabase) Keys(pattern string) (keys []string, err error) {
+	err = db.intercept(dbops.OpKeys, false, []string{pattern}, func() error {
+		db.RLock()
+		defer db.RUnlock()
 
-	return db.storage.AllKeys()
+		keys, err = db.storage.Keys(pattern)
+		return err
+	})
+	return keys, err
 }
 
-func (db *KeyValorDatabase) Keys(regex string) ([]string, error) {
-	db.RLock()
-	defer db.RUnlock()
+// Scan returns about count keys matching a Redis glob-style pattern, from cursor on, and the
+// cursor to pass to the next call (0 once the scan is complete). Scans start with cursor 0.
+// A key that exists during a whole scan is returned exactly once; a key that is added or
+// deleted during the scan may or may not be. Unlike Keys, each call only holds the read lock
+// for about count keys.
+func (db *KeyValorDatabase) Scan(cursor uint64, pattern string, count int) (keys []string, next uint64, err error) {
+	err = db.intercept(dbops.OpScan, false, []string{pattern}, func() error {
+		db.RLock()
+		defer db.RUnlock()
 
-	return db.storage.Keys(regex)
+		keys, next, err = db.storage.Scan(cursor, pattern, count)
+		return err
+	})
+	return keys, next, err
 }
 
 func (db *KeyValorDatabase) Expire(key string, expireTime *time.Time) error {
-	db.Lock()
-	defer db.Unlock()
+	return db.intercept(dbops.OpExpire, true, []string{key}, func() error {
+		db.Lock()
+		defer db.Unlock()
 
-	return db.storage.Expire(key, expireTime)
+		return db.storage.Expire(key, expireTime)
+	})
 }
 
 // Redis-compatible INCR command
 func (db *KeyValorDatabase) Incr(key string) error {
-	db.Lock()
-	defer db.Unlock()
+	return db.intercept(dbops.OpIncr, true, []string{key}, func() error {
+		db.Lock()
+		defer db.Unlock()
 
-	return db.storage.Incr(key)
+		return db.storage.Incr(key)
+	})
 }
 
 // Redis-compatible DECR command
 func (db *KeyValorDatabase) Decr(key string) error {
-	db.Lock()
-	defer db.Unlock()
+	return db.intercept(dbops.OpDecr, true, []string{key}, func() error {
+		db.Lock()
+		defer db.Unlock()
 
-	return db.storage.Decr(key)
+		return db.storage.Decr(key)
+	})
 }
 
 // Redis-compatible TTL command
-func (db *KeyValorDatabase) TTL(key string) (int64, error) {
-	db.RLock()
-	defer db.RUnlock()
+func (db *KeyValorDatabase) TTL(key string) (ttl int64, err error) {
+	err = db.intercept(dbops.OpTTL, false, []string{key}, func() error {
+		db.RLock()
+		defer db.RUnlock()
 
-	return db.storage.TTL(key)
+		ttl, err = db.storage.TTL(key)
+		return err
+	})
+	return ttl, err
+}
+
+// PTTL returns the remaining time to live of a key in milliseconds, -1 if it doesn't expire.
+func (db *KeyValorDatabase) PTTL(key string) (ttl int64, err error) {
+	err = db.intercept(dbops.OpPTTL, false, []string{key}, func() error {
+		db.RLock()
+		defer db.RUnlock()
+
+		ttl, err = db.storage.PTTL(key)
+		return err
+	})
+	return ttl, err
 }
 
 // Redis-compatible SETEX command
 func (db *KeyValorDatabase) SetEx(key string, value []byte, ttlSeconds int64) error {
-	db.Lock()
-	defer db.Unlock()
+	return db.intercept(dbops.OpSetEx, true, []string{key}, func() error {
+		db.Lock()
+		defer db.Unlock()
+
+		return db.storage.SetEx(key, datatypes.EncodeString(value), ttlSeconds)
+	})
+}
+
+// SetWithExpiry inserts or updates a key-value pair, that expires at the given time
+// (never, if expiry is zero). Unlike Set, the default TTL doesn't apply.
+// It acquires a write lock on the database to ensure thread safety.
+func (db *KeyValorDatabase) SetWithExpiry(key string, value []byte, expiry time.Time) error {
+	return db.intercept(dbops.OpSetWithExpiry, true, []string{key}, func() error {
+		db.Lock()
+		defer db.Unlock()
 
-	return db.storage.SetEx(key, value, ttlSeconds)
+		return db.storage.SetWithExpiry(key, datatypes.EncodeString(value), expiry)
+	})
 }
 
 // Redis-compatible PERSIST command
 func (db *KeyValorDatabase) Persist(key string) error {
-	db.Lock()
-	defer db.Unlock()
+	return db.intercept(dbops.OpPersist, true, []string{key}, func() error {
+		db.Lock()
+		defer db.Unlock()
+
+		return db.storage.Persist(key)
+	})
+}
+
+// Rename renames key to newKey atomically, overwriting newKey if it exists.
+// The value keeps its expiry. Renaming a key to itself succeeds if the key exists.
+func (db *KeyValorDatabase) Rename(key, newKey string) error {
+	return db.intercept(dbops.OpRename, true, []string{key, newKey}, func() error {
+		db.Lock()
+		defer db.Unlock()
+
+		return db.storage.Rename(key, newKey)
+	})
+}
+
+// Copy copies the value of key and its expiry to destination, and returns whether it did:
+// it doesn't if destination exists, unless replace is set.
+func (db *KeyValorDatabase) Copy(key, destination string, replace bool) (copied bool, err error) {
+	err = db.intercept(dbops.OpCopy, true, []string{key, destination}, func() error {
+		db.Lock()
+		defer db.Unlock()
+
+		copied, err = db.storage.Copy(key, destination, replace)
+		return err
+	})
+	return copied, err
+}
+
+// intercept runs fn, the body of a DatabaseOperations call, through the interceptor chain.
+// A successful write makes the watches on its keys dirty.
+func (db *KeyValorDatabase) intercept(op string, write bool, keys []string, fn func() error) error {
+	if write {
+		body := fn
+		fn = func() error {
+			err := body()
+			if err == nil {
+				db.watches.touch(keys)
+			}
+			return err
+		}
+	}
+
+	return db.interceptCall(op, write, keys, fn)
+}
+
+// interceptCall is intercept, without making the watches dirty: Move and CopyTo run their
+// writes to the target database through its chain, and only touch its watches if they wrote.
+func (db *KeyValorDatabase) interceptCall(op string, write bool, keys []string, fn func() error) error {
+	if db.interceptor == nil {
+		return fn()
+	}
 
-	return db.storage.Persist(key)
+	call := &dbops.Call{Op: op, Keys: keys, Write: write}
+	return db.interceptor(call, func() error {
+		start := time.Now()
+		call.Err = fn()
+		call.Duration = time.Since(start)
+		call.Invoked = true
+		return call.Err
+	})
 }
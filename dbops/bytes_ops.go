@@ -0,0 +1,35 @@
+package dbops
+
+import "time"
+
+// BytesKeyOperations is the []byte-keyed variant of DatabaseOperations,
+// for binary keys such as encoded tuples and UUIDs.
+type BytesKeyOperations interface {
+	BytesKeyReadOnlyOps
+	BytesKeyWriteOps
+}
+
+type BytesKeyReadOnlyOps interface {
+	Get(key []byte) ([]byte, error)
+	GetWithExpiry(key []byte) ([]byte, time.Time, error)
+	MGet(keys [][]byte) ([]Value, error)
+	Exists(key []byte) bool
+	TTL(key []byte) (int64, error)
+	PTTL(key []byte) (int64, error)
+	AllKeys() ([][]byte, error)
+	Keys(pattern string) ([][]byte, error)
+	Scan(cursor uint64, pattern string, count int) ([][]byte, uint64, error)
+}
+
+type BytesKeyWriteOps interface {
+	Set(key []byte, value []byte) error
+	Delete(key []byte) error
+	SetEx(key []byte, value []byte, ttlSeconds int64) error
+	SetWithExpiry(key []byte, value []byte, expiry time.Time) error
+	Expire(key []byte, expireTime *time.Time) error
+	Persist(key []byte) error
+	Incr(key []byte) error
+	Decr(key []byte) error
+	Rename(key, newKey []byte) error
+	Copy(key, destination []byte, replace bool) (bool, error)
+}
@@ -0,0 +1,95 @@
+package dbops
+
+import "time"
+
+// Names of the operations, as seen by interceptors.
+const (
+	OpGet           = "Get"
+	OpGetWithExpiry = "GetWithExpiry"
+	OpMGet          = "MGet"
+	OpExists        = "Exists"
+	OpTTL           = "TTL"
+	OpPTTL          = "PTTL"
+	OpAllKeys       = "AllKeys"
+	OpKeys          = "Keys"
+	OpScan          = "Scan"
+	OpSet           = "Set"
+	OpDelete        = "Delete"
+	OpSetEx         = "SetEx"
+	OpSetWithExpiry = "SetWithExpiry"
+	OpExpire        = "Expire"
+	OpPersist       = "Persist"
+	OpIncr          = "Incr"
+	OpDecr          = "Decr"
+	OpRename        = "Rename"
+	OpCopy          = "Copy"
+	// OpSetWithOptions is KeyValorDatabase.SetWithOptions, which isn't part of DatabaseOperations
+	OpSetWithOptions = "SetWithOptions"
+	// OpClear is KeyValorDatabase.Clear, which deletes every key
+	OpClear = "Clear"
+	// OpMove is KeyValorDatabase.Move, which moves a key to another database
+	OpMove = "Move"
+	// OpCopyTo is KeyValorDatabase.CopyTo, which copies a key to another database
+	OpCopyTo = "CopyTo"
+	// OpDump and OpRestore are KeyValorDatabase.Dump and Restore, which serialize a key
+	OpDump    = "Dump"
+	OpRestore = "Restore"
+
+	// Data type operations of KeyValorDatabase
+	OpType            = "Type"
+	OpGetHash         = "GetHash"
+	OpUpdateHash      = "UpdateHash"
+	OpGetList         = "GetList"
+	OpUpdateList      = "UpdateList"
+	OpGetSet          = "GetSet"
+	OpUpdateSet       = "UpdateSet"
+	OpGetSortedSet    = "GetSortedSet"
+	OpUpdateSortedSet = "UpdateSortedSet"
+)
+
+// Call describes one DatabaseOperations call going through an interceptor chain.
+type Call struct {
+	// Op is the name of the operation (one of the Op* constants)
+	Op string
+	// Keys are the keys the operation reads or writes
+	// (for Keys and Scan, the pattern; for AllKeys, none)
+	Keys []string
+	// Write tells whether the operation modifies the database
+	Write bool
+
+	// Invoked, Duration and Err are set once the operation itself has returned,
+	// i.e. they can be read by an interceptor after its call to next.
+	// Invoked is false if an inner interceptor short-circuited the call.
+	Invoked  bool
+	Duration time.Duration
+	Err      error
+}
+
+// Invoker runs the rest of the chain, and finally the operation itself.
+type Invoker func() error
+
+// Interceptor wraps DatabaseOperations calls. It must call next to let the call proceed,
+// and return its error (possibly wrapped). Returning without calling next short-circuits
+// the call: the operation returns the interceptor's error, and zero values for its results.
+//
+// Interceptors run outside the database lock, so they can be slow (e.g. do I/O)
+// without blocking other calls, and may be called concurrently.
+type Interceptor func(call *Call, next Invoker) error
+
+// Chain combines interceptors into one, the first one being the outermost.
+func Chain(interceptors ...Interceptor) Interceptor {
+	if len(interceptors) == 0 {
+		return nil
+	}
+
+	chained := interceptors[len(interceptors)-1]
+	for i := len(interceptors) - 2; i >= 0; i-- {
+		outer, inner := interceptors[i], chained
+		chained = func(call *Call, next Invoker) error {
+			return outer(call, func() error {
+				return inner(call, next)
+			})
+		}
+	}
+	return chained
+}
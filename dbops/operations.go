@@ -14,19 +14,33 @@ type DatabaseOperations interface {
 
 type ReadOnlyOps interface {
 	Get(key string) ([]byte, error)
+	// GetWithExpiry returns the value of a key, and its expiry time (zero if it has none)
+	GetWithExpiry(key string) ([]byte, time.Time, error)
 	MGet(keys []string) ([]Value, error)
 	Exists(key string) bool
 	TTL(key string) (int64, error)
+	// PTTL is TTL, in milliseconds
+	PTTL(key string) (int64, error)
 	AllKeys() ([]string, error)
-	Keys(regex string) ([]string, error)
+	// Keys returns the keys matching a Redis glob-style pattern (*, ?, [abc], [^a-z], \x)
+	Keys(pattern string) ([]string, error)
+	// Scan returns about count keys matching the pattern, from cursor on, and the cursor
+	// of the next keys (0 once the scan is complete), like Redis' SCAN
+	Scan(cursor uint64, pattern string, count int) ([]string, uint64, error)
 }
 
 type WriteOps interface {
 	Set(key string, value []byte) error
 	Delete(key string) error
 	SetEx(key string, value []byte, ttlSeconds int64) error
+	// SetWithExpiry sets a key that expires at the given time (never, if it is zero)
+	SetWithExpiry(key string, value []byte, expiry time.Time) error
 	Expire(key string, expireTime *time.Time) error
 	Persist(key string) error
 	Incr(key string) error
 	Decr(key string) error
+	// Rename renames a key, overwriting newKey if it exists; the value keeps its expiry
+	Rename(key, newKey string) error
+	// Copy copies a key and its expiry to destination, unless it exists and replace isn't set
+	Copy(key, destination string, replace bool) (bool, error)
 }
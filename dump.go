@@ -0,0 +1,192 @@
+package KeyValor
+
+import (
+	"math"
+	"time"
+
+	"KeyValor/constants"
+	"KeyValor/dbops"
+	"KeyValor/internal/datatypes"
+	"KeyValor/internal/rdb"
+	"KeyValor/internal/storage/storagecommon"
+)
+
+// Dump returns the serialization of the value of key, and its expiry (zero if it doesn't
+// expire). The payload is versioned and checksummed, in the format of Redis' DUMP: Redis
+// can restore it, and Restore can restore the strings dumped by Redis.
+// It acquires a read lock on the database to ensure thread safety.
+func (db *KeyValorDatabase) Dump(key string) (payload []byte, expiry time.Time, err error) {
+	err = db.intercept(dbops.OpDump, false, []string{key}, func() error {
+		db.RLock()
+		defer db.RUnlock()
+
+		stored, storedExpiry, err := db.storage.GetWithExpiry(key)
+		if err != nil {
+			return err
+		}
+		if stored, err = db.lists.inline(stored); err != nil {
+			return err
+		}
+		payload, err = dumpValue(stored)
+		expiry = storedExpiry
+		return err
+	})
+	return payload, expiry, err
+}
+
+// Restore creates key from a payload of Dump, expiring at expiry (never, if it is zero).
+// It fails with constants.ErrKeyExists if the key exists, unless replace is set, and with
+// constants.ErrInvalidDumpPayload or constants.ErrBadDumpFormat if the payload is invalid.
+// An expiry in the past only deletes the key, if it is replaced.
+// It acquires a write lock on the database to ensure thread safety.
+func (db *KeyValorDatabase) Restore(key string, payload []byte, expiry time.Time, replace bool) error {
+	stored, err := restoreValue(payload)
+	if err != nil {
+		return err
+	}
+
+	return db.intercept(dbops.OpRestore, true, []string{key}, func() error {
+		db.Lock()
+		defer db.Unlock()
+
+		_, _, err := db.storage.GetWithExpiry(key)
+		exists := err == nil
+		if err != nil && !storagecommon.IsMissingKey(err) {
+			return err
+		}
+		if exists && !replace {
+			return constants.ErrKeyExists
+		}
+
+		if !expiry.IsZero() && !expiry.After(time.Now()) {
+			if exists {
+				return db.storage.Delete(key)
+			}
+			return nil
+		}
+		return db.storage.SetWithExpiry(key, stored, expiry)
+	})
+}
+
+// dumpValue returns the payload of a stored value.
+func dumpValue(stored []byte) ([]byte, error) {
+	kind, payload, err := datatypes.Untag(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	var e *rdb.Encoder
+	switch kind {
+	case datatypes.KindString:
+		e = rdb.NewEncoder(rdb.TypeString)
+		e.String(payload)
+	case datatypes.KindHash:
+		h, err := decodeHash(payload)
+		if err != nil {
+			return nil, err
+		}
+		e = rdb.NewEncoder(rdb.TypeHash)
+		e.Length(uint64(h.Len()))
+		for _, field := range h.Fields() {
+			value, _ := h.Get(field)
+			e.String([]byte(field))
+			e.String(value)
+		}
+	case datatypes.KindList:
+		l, err := decodeList(payload)
+		if err != nil {
+			return nil, err
+		}
+		e = rdb.NewEncoder(rdb.TypeList)
+		e.Length(uint64(l.Len()))
+		for _, element := range l.Range(0, -1) {
+			e.String(element)
+		}
+	case datatypes.KindSet:
+		s, err := decodeSet(payload)
+		if err != nil {
+			return nil, err
+		}
+		e = rdb.NewEncoder(rdb.TypeSet)
+		e.Length(uint64(s.Len()))
+		for _, member := range s.Members() {
+			e.String([]byte(member))
+		}
+	case datatypes.KindSortedSet:
+		z, err := decodeSortedSet(payload)
+		if err != nil {
+			return nil, err
+		}
+		e = rdb.NewEncoder(rdb.TypeZSet2)
+		e.Length(uint64(z.Len()))
+		for _, m := range z.RangeByRank(0, -1, false) {
+			e.String([]byte(m.Member))
+			e.Double(m.Score)
+		}
+	default:
+		return nil, datatypes.ErrCorruptValue
+	}
+	return e.Payload(), nil
+}
+
+// restoreValue returns the stored value of a payload. Like Redis, it refuses empty collections.
+func restoreValue(payload []byte) ([]byte, error) {
+	typ, d, err := rdb.NewDecoder(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var c collection
+	switch typ {
+	case rdb.TypeString:
+		s := d.String()
+		if err := d.Done(); err != nil {
+			return nil, err
+		}
+		return datatypes.EncodeString(s), nil
+	case rdb.TypeHash:
+		h := NewHash()
+		for n := d.Length(); n > 0 && d.Err() == nil; n-- {
+			h.Set(string(d.String()), d.String())
+		}
+		c = h
+	case rdb.TypeList:
+		l := NewList()
+		for n := d.Length(); n > 0 && d.Err() == nil; n-- {
+			l.PushRight(d.String())
+		}
+		c = l
+	case rdb.TypeSet:
+		s := NewSet()
+		for n := d.Length(); n > 0 && d.Err() == nil; n-- {
+			s.Add(string(d.String()))
+		}
+		c = s
+	case rdb.TypeZSet, rdb.TypeZSet2:
+		z := NewSortedSet()
+		for n := d.Length(); n > 0 && d.Err() == nil; n-- {
+			member := string(d.String())
+			var score float64
+			if typ == rdb.TypeZSet {
+				score = d.StringDouble()
+			} else {
+				score = d.Double()
+			}
+			if math.IsNaN(score) {
+				return nil, constants.ErrBadDumpFormat
+			}
+			z.Add(member, score)
+		}
+		c = z
+	default:
+		return nil, constants.ErrBadDumpFormat
+	}
+
+	if err := d.Done(); err != nil {
+		return nil, err
+	}
+	if c.Len() == 0 {
+		return nil, constants.ErrBadDumpFormat
+	}
+	return datatypes.Tag(c.kind(), c.encode()), nil
+}
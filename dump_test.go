@@ -0,0 +1,87 @@
+package KeyValor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"KeyValor/constants"
+)
+
+func TestDumpAndRestore(t *testing.T) {
+	db, err := NewKeyValorDB(WithDirectory(t.TempDir()))
+	require.NoError(t, err)
+	defer db.Shutdown()
+	other, err := NewKeyValorDB(WithDirectory(t.TempDir()))
+	require.NoError(t, err)
+	defer other.Shutdown()
+
+	expiry := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	require.NoError(t, db.SetWithExpiry("string", []byte("value"), expiry))
+	require.NoError(t, db.UpdateHash("hash", func(h *Hash) error {
+		h.Set("name", []byte("alice"))
+		h.Set("empty", []byte{})
+		return nil
+	}))
+	require.NoError(t, db.UpdateList("list", func(l *List) error {
+		l.PushRight([]byte("x"), []byte("y"), []byte("x"))
+		return nil
+	}))
+	require.NoError(t, db.UpdateSet("set", func(s *Set) error {
+		s.Add("a")
+		s.Add("b")
+		return nil
+	}))
+	require.NoError(t, db.UpdateSortedSet("zset", func(z *SortedSet) error {
+		z.Add("a", 1.5)
+		z.Add("b", -2)
+		return nil
+	}))
+
+	// every type is restored as it was dumped (the same values dump the same payloads), with
+	// the expiry returned by Dump
+	for _, key := range []string{"string", "hash", "list", "set", "zset"} {
+		payload, gotExpiry, err := db.Dump(key)
+		require.NoError(t, err, key)
+		require.NoError(t, other.Restore(key, payload, gotExpiry, false), key)
+
+		restored, restoredExpiry, err := other.Dump(key)
+		require.NoError(t, err)
+		require.Equal(t, payload, restored, key)
+		require.True(t, gotExpiry.Equal(restoredExpiry), key)
+	}
+	_, gotExpiry, err := db.Dump("string")
+	require.NoError(t, err)
+	require.True(t, expiry.Equal(gotExpiry))
+
+	_, _, err = db.Dump("missing")
+	require.ErrorIs(t, err, constants.ErrKeyMissing)
+
+	// an existing key is only replaced if asked to
+	payload, _, err := db.Dump("list")
+	require.NoError(t, err)
+	require.ErrorIs(t, other.Restore("string", payload, time.Time{}, false), constants.ErrKeyExists)
+	require.NoError(t, other.Restore("string", payload, time.Time{}, true))
+	typ, err := other.Type("string")
+	require.NoError(t, err)
+	require.Equal(t, "list", typ)
+
+	// an expiry in the past only deletes the replaced key
+	require.NoError(t, other.Restore("string", payload, time.Now().Add(-time.Second), true))
+	require.False(t, other.Exists("string"))
+	require.NoError(t, other.Restore("past", payload, time.Now().Add(-time.Second), false))
+	require.False(t, other.Exists("past"))
+
+	// payloads of Redis are restored, and corrupt ones refused
+	require.NoError(t, other.Restore("redis", []byte("\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n"), time.Time{}, false))
+	value, err := other.Get("redis")
+	require.NoError(t, err)
+	require.Equal(t, "10", string(value))
+
+	corrupt := append([]byte(nil), payload...)
+	corrupt[1]++
+	require.ErrorIs(t, other.Restore("corrupt", corrupt, time.Time{}, false), constants.ErrInvalidDumpPayload)
+	require.ErrorIs(t, other.Restore("corrupt", []byte("short"), time.Time{}, false), constants.ErrInvalidDumpPayload)
+	require.False(t, other.Exists("corrupt"))
+}
@@ -0,0 +1,85 @@
+package KeyValor
+
+import (
+	"sort"
+
+	"KeyValor/dbops"
+	"KeyValor/internal/datatypes"
+)
+
+// Hash is the value of a hash key: a map of fields to values, like a Redis hash.
+type Hash struct {
+	fields map[string][]byte
+}
+
+// NewHash returns an empty hash.
+func NewHash() *Hash {
+	return &Hash{fields: make(map[string][]byte)}
+}
+
+// Get returns the value of a field, and whether the field exists.
+func (h *Hash) Get(field string) ([]byte, bool) {
+	value, ok := h.fields[field]
+	return value, ok
+}
+
+// Set sets the value of a field, and returns true if the field is new.
+func (h *Hash) Set(field string, value []byte) bool {
+	_, exists := h.fields[field]
+	h.fields[field] = value
+	return !exists
+}
+
+// Delete removes a field, and returns true if it existed.
+func (h *Hash) Delete(field string) bool {
+	_, exists := h.fields[field]
+	delete(h.fields, field)
+	return exists
+}
+
+// Len returns the number of fields.
+func (h *Hash) Len() int {
+	return len(h.fields)
+}
+
+// Fields returns the fields of the hash, sorted.
+func (h *Hash) Fields() []string {
+	fields := make([]string, 0, len(h.fields))
+	for field := range h.fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func (h *Hash) kind() datatypes.Kind {
+	return datatypes.KindHash
+}
+
+func (h *Hash) encode() []byte {
+	return datatypes.EncodeMap(h.fields)
+}
+
+func decodeHash(payload []byte) (*Hash, error) {
+	fields, err := datatypes.DecodeMap(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Hash{fields: fields}, nil
+}
+
+// GetHash returns the hash stored at key, or an empty hash if the key doesn't exist.
+// It fails with constants.ErrWrongType if the key holds another data type.
+// It acquires a read lock on the database to ensure thread safety.
+func (db *KeyValorDatabase) GetHash(key string) (*Hash, error) {
+	return readCollection(db, dbops.OpGetHash, key, decodeHash, NewHash)
+}
+
+// UpdateHash atomically calls update on the hash stored at key (an empty hash if the key
+// doesn't exist), and stores the result, unless update returns an error. The key keeps its
+// expiry, and is deleted when the hash becomes empty.
+// It fails with constants.ErrWrongType if the key holds another data type.
+// It acquires a write lock on the database to ensure thread safety.
+func (db *KeyValorDatabase) UpdateHash(key string, update func(h *Hash) error) error {
+	return updateCollection(db, dbops.OpUpdateHash, key, decodeHash, NewHash, update)
+}
@@ -0,0 +1,66 @@
+package KeyValor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"KeyValor/constants"
+	"KeyValor/internal/datatypes"
+)
+
+func TestHashes(t *testing.T) {
+	db, err := NewKeyValorDB(WithDirectory(t.TempDir()))
+	require.NoError(t, err)
+	defer db.Shutdown()
+
+	require.NoError(t, db.UpdateHash("user", func(h *Hash) error {
+		require.True(t, h.Set("name", []byte("alice")))
+		require.True(t, h.Set("empty", []byte{}))
+		return nil
+	}))
+
+	h, err := db.GetHash("user")
+	require.NoError(t, err)
+	require.Equal(t, []string{"empty", "name"}, h.Fields())
+	value, ok := h.Get("name")
+	require.True(t, ok)
+	require.Equal(t, "alice", string(value))
+
+	typ, err := db.Type("user")
+	require.NoError(t, err)
+	require.Equal(t, "hash", typ)
+
+	// a failing update doesn't write anything
+	errAbort := errors.New("abort")
+	require.ErrorIs(t, db.UpdateHash("user", func(h *Hash) error {
+		h.Delete("name")
+		return errAbort
+	}), errAbort)
+	h, err = db.GetHash("user")
+	require.NoError(t, err)
+	require.Equal(t, 2, h.Len())
+
+	_, err = db.Get("user")
+	require.ErrorIs(t, err, constants.ErrWrongType)
+
+	// strings that look like tagged values are stored unambiguously
+	tricky := []byte(datatypes.Magic + "\x01payload")
+	require.NoError(t, db.Set("tricky", tricky))
+	value, err = db.Get("tricky")
+	require.NoError(t, err)
+	require.Equal(t, tricky, value)
+	_, err = db.GetHash("tricky")
+	require.ErrorIs(t, err, constants.ErrWrongType)
+
+	// the key is deleted with its last field
+	require.NoError(t, db.UpdateHash("user", func(h *Hash) error {
+		h.Delete("name")
+		h.Delete("empty")
+		return nil
+	}))
+	typ, err = db.Type("user")
+	require.NoError(t, err)
+	require.Equal(t, "none", typ)
+}
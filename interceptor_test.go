@@ -0,0 +1,77 @@
+package KeyValor
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"KeyValor/dbops"
+	"KeyValor/interceptors"
+)
+
+func TestInterceptors(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		trace []string
+	)
+	record := func(name string) dbops.Interceptor {
+		return func(call *dbops.Call, next dbops.Invoker) error {
+			mu.Lock()
+			trace = append(trace, name+" "+call.Op)
+			mu.Unlock()
+			return next()
+		}
+	}
+
+	errDenied := errors.New("denied")
+	denyWrites := func(call *dbops.Call, next dbops.Invoker) error {
+		if call.Write && call.Keys[0] == "protected" {
+			return errDenied
+		}
+		return next()
+	}
+
+	histogram := interceptors.NewLatencyHistogram()
+
+	db, err := NewKeyValorDB(
+		WithDirectory(t.TempDir()),
+		WithInterceptors(record("outer"), histogram.Interceptor(), record("inner")),
+		WithInterceptors(denyWrites, interceptors.Logging(0)),
+	)
+	require.NoError(t, err)
+	defer db.Shutdown()
+
+	require.NoError(t, db.Set("k", []byte("v")))
+	require.Equal(t, []string{"outer Set", "inner Set"}, trace)
+
+	// short-circuited calls return the interceptor's error, and don't reach the storage
+	require.ErrorIs(t, db.Set("protected", []byte("v")), errDenied)
+	require.False(t, db.Exists("protected"))
+
+	_, err = db.Get("missing")
+	require.Error(t, err)
+
+	snapshot := histogram.Snapshot()
+	require.EqualValues(t, 1, snapshot[dbops.OpSet].Count)
+	require.EqualValues(t, 1, snapshot[dbops.OpGet].Count)
+	require.EqualValues(t, 1, snapshot[dbops.OpExists].Count)
+	require.Len(t, snapshot[dbops.OpSet].Counts, len(interceptors.DefaultLatencyBuckets)+1)
+
+	// the []byte-keyed view and namespaces go through the same interceptors
+	trace = nil
+	_, err = db.BytesKeys().Get([]byte("k"))
+	require.NoError(t, err)
+
+	ns, err := db.Namespace("ns", WithInterceptors(record("namespace")))
+	require.NoError(t, err)
+	require.ErrorIs(t, ns.Set("protected", []byte("v")), errDenied)
+	require.NoError(t, ns.Delete("k"))
+
+	require.Equal(t, []string{
+		"outer Get", "inner Get",
+		"outer Set", "inner Set",
+		"outer Delete", "inner Delete", "namespace Delete",
+	}, trace)
+}
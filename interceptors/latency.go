@@ -0,0 +1,119 @@
+package interceptors
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"KeyValor/dbops"
+)
+
+// DefaultLatencyBuckets are the upper bounds used by NewLatencyHistogram when none are given:
+// powers of 4 from 16µs to ~1s.
+var DefaultLatencyBuckets = []time.Duration{
+	16 * time.Microsecond,
+	64 * time.Microsecond,
+	256 * time.Microsecond,
+	1024 * time.Microsecond,
+	4096 * time.Microsecond,
+	16384 * time.Microsecond,
+	65536 * time.Microsecond,
+	262144 * time.Microsecond,
+	1048576 * time.Microsecond,
+}
+
+// LatencyHistogram records the duration of database operations, per operation name.
+type LatencyHistogram struct {
+	buckets []time.Duration
+	ops     sync.Map // op name -> *opHistogram
+}
+
+type opHistogram struct {
+	// counts has one counter per bucket, plus one for durations above the last bucket
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	sum    atomic.Int64
+}
+
+// HistogramSnapshot is a point-in-time copy of the durations recorded for one operation.
+type HistogramSnapshot struct {
+	// Buckets are the upper bounds (inclusive) of the buckets
+	Buckets []time.Duration
+	// Counts[i] is the number of calls that took at most Buckets[i] (and more than Buckets[i-1]);
+	// the last element counts the calls slower than every bucket.
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+}
+
+// NewLatencyHistogram creates a histogram with the given bucket upper bounds, which must be
+// sorted in increasing order. It uses DefaultLatencyBuckets if there are none.
+func NewLatencyHistogram(buckets ...time.Duration) *LatencyHistogram {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	return &LatencyHistogram{buckets: append([]time.Duration(nil), buckets...)}
+}
+
+// Interceptor returns the interceptor that records calls into the histogram.
+// Short-circuited calls are not recorded.
+func (lh *LatencyHistogram) Interceptor() dbops.Interceptor {
+	return func(call *dbops.Call, next dbops.Invoker) error {
+		err := next()
+		if call.Invoked {
+			lh.Observe(call.Op, call.Duration)
+		}
+		return err
+	}
+}
+
+// Observe records one call of op that took d.
+func (lh *LatencyHistogram) Observe(op string, d time.Duration) {
+	h := lh.histogram(op)
+
+	bucket := len(lh.buckets)
+	for i, upperBound := range lh.buckets {
+		if d <= upperBound {
+			bucket = i
+			break
+		}
+	}
+
+	h.counts[bucket].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+}
+
+// Snapshot returns the durations recorded so far, per operation name.
+func (lh *LatencyHistogram) Snapshot() map[string]HistogramSnapshot {
+	snapshots := make(map[string]HistogramSnapshot)
+
+	lh.ops.Range(func(op, value any) bool {
+		h := value.(*opHistogram)
+
+		snapshot := HistogramSnapshot{
+			Buckets: lh.buckets,
+			Counts:  make([]uint64, len(h.counts)),
+			Count:   h.count.Load(),
+			Sum:     time.Duration(h.sum.Load()),
+		}
+		for i := range h.counts {
+			snapshot.Counts[i] = h.counts[i].Load()
+		}
+
+		snapshots[op.(string)] = snapshot
+		return true
+	})
+	return snapshots
+}
+
+func (lh *LatencyHistogram) histogram(op string) *opHistogram {
+	if h, ok := lh.ops.Load(op); ok {
+		return h.(*opHistogram)
+	}
+
+	h, _ := lh.ops.LoadOrStore(op, &opHistogram{
+		counts: make([]atomic.Uint64, len(lh.buckets)+1),
+	})
+	return h.(*opHistogram)
+}
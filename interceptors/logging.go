@@ -0,0 +1,49 @@
+// Package interceptors has reference implementations of dbops.Interceptor.
+package interceptors
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"KeyValor/constants"
+	"KeyValor/dbops"
+	"KeyValor/log"
+)
+
+// maxLoggedKeys is how many keys of a multi-key call are logged
+const maxLoggedKeys = 8
+
+// Logging returns an interceptor that logs every call at debug level, calls slower than
+// slowerThan at info level (0 disables this), and failures at warn level.
+// Missing and expired keys are not failures. Short-circuited calls are logged at info level.
+func Logging(slowerThan time.Duration) dbops.Interceptor {
+	return func(call *dbops.Call, next dbops.Invoker) error {
+		err := next()
+
+		switch {
+		case !call.Invoked:
+			log.Infof("%s %s was short-circuited: %v", call.Op, formatKeys(call.Keys), err)
+		case err != nil && !isMissingKey(err):
+			log.Warnf("%s %s failed after %s: %v", call.Op, formatKeys(call.Keys), call.Duration, err)
+		case slowerThan > 0 && call.Duration >= slowerThan:
+			log.Infof("slow %s %s took %s", call.Op, formatKeys(call.Keys), call.Duration)
+		default:
+			log.Debugf("%s %s took %s", call.Op, formatKeys(call.Keys), call.Duration)
+		}
+		return err
+	}
+}
+
+func isMissingKey(err error) bool {
+	return errors.Is(err, constants.ErrKeyMissing) ||
+		errors.Is(err, constants.ErrKeyIsDeleted) ||
+		errors.Is(err, constants.ErrKeyIsExpired)
+}
+
+func formatKeys(keys []string) string {
+	if len(keys) <= maxLoggedKeys {
+		return "[" + strings.Join(keys, " ") + "]"
+	}
+	return "[" + strings.Join(keys[:maxLoggedKeys], " ") + " ...]"
+}
@@ -0,0 +1,195 @@
+// Package datatypes encodes the values of the Redis-like data types (hashes, lists, ...)
+// into the plain byte values stored by the storage engines.
+//
+// A value that doesn't start with Magic is a string, stored as is. Any other value is
+// Magic, followed by a Kind byte, followed by the encoded payload of that kind.
+// Strings that happen to start with Magic are stored with the KindString tag,
+// so that every value decodes unambiguously, and so is the empty string: the storage
+// engines don't store empty values, which mark deleted keys.
+package datatypes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Magic prefixes every tagged value. 0xc0 never appears in UTF-8 text.
+const Magic = "\x00\xc0KV"
+
+// Kind is the type of a value.
+type Kind byte
+
+const (
+	KindString Kind = iota
+	KindHash
+	KindList
+	KindSet
+	KindSortedSet
+	// KindListRef is a list stored as one record per element, in a store of its database: its
+	// payload is the id of the list there
+	KindListRef
+)
+
+// String returns the name of the kind, as replied by the TYPE command.
+func (k Kind) String() string {
+	switch k {
+	case KindString:
+		return "string"
+	case KindHash:
+		return "hash"
+	case KindList, KindListRef:
+		return "list"
+	case KindSet:
+		return "set"
+	case KindSortedSet:
+		return "zset"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(k))
+	}
+}
+
+// ErrCorruptValue is returned when a tagged value can't be decoded.
+var ErrCorruptValue = errors.New("corrupt encoded value")
+
+// Tag returns the stored form of a payload of the given kind.
+func Tag(kind Kind, payload []byte) []byte {
+	stored := make([]byte, 0, len(Magic)+1+len(payload))
+	stored = append(stored, Magic...)
+	stored = append(stored, byte(kind))
+	return append(stored, payload...)
+}
+
+// EncodeString returns the stored form of a string value: the value itself, unless it is
+// empty or could be mistaken for a tagged value.
+func EncodeString(value []byte) []byte {
+	if len(value) > 0 && !bytes.HasPrefix(value, []byte(Magic)) {
+		return value
+	}
+	return Tag(KindString, value)
+}
+
+// Untag returns the kind and the payload of a stored value.
+func Untag(stored []byte) (Kind, []byte, error) {
+	if !bytes.HasPrefix(stored, []byte(Magic)) {
+		return KindString, stored, nil
+	}
+	if len(stored) == len(Magic) {
+		return 0, nil, ErrCorruptValue
+	}
+	return Kind(stored[len(Magic)]), stored[len(Magic)+1:], nil
+}
+
+// EncodeMap encodes a map as its number of entries, followed by its entries sorted by key,
+// each one as a length-prefixed key and a length-prefixed value.
+func EncodeMap(m map[string][]byte) []byte {
+	keys := make([]string, 0, len(m))
+	size := binary.MaxVarintLen64
+	for key, value := range m {
+		keys = append(keys, key)
+		size += 2*binary.MaxVarintLen64 + len(key) + len(value)
+	}
+	sort.Strings(keys)
+
+	buf := make([]byte, 0, size)
+	buf = binary.AppendUvarint(buf, uint64(len(keys)))
+	for _, key := range keys {
+		buf = appendBytes(buf, []byte(key))
+		buf = appendBytes(buf, m[key])
+	}
+	return buf
+}
+
+// DecodeMap decodes a map encoded by EncodeMap.
+func DecodeMap(payload []byte) (map[string][]byte, error) {
+	r := reader{buf: payload}
+
+	n := r.uvarint()
+	m := make(map[string][]byte, min(n, uint64(len(payload))))
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		key := r.bytes()
+		value := r.bytes()
+		m[string(key)] = value
+	}
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// EncodeSlice encodes a slice as its number of elements, followed by each length-prefixed element.
+func EncodeSlice(elements [][]byte) []byte {
+	size := binary.MaxVarintLen64
+	for _, element := range elements {
+		size += binary.MaxVarintLen64 + len(element)
+	}
+
+	buf := make([]byte, 0, size)
+	buf = binary.AppendUvarint(buf, uint64(len(elements)))
+	for _, element := range elements {
+		buf = appendBytes(buf, element)
+	}
+	return buf
+}
+
+// DecodeSlice decodes a slice encoded by EncodeSlice.
+func DecodeSlice(payload []byte) ([][]byte, error) {
+	r := reader{buf: payload}
+
+	n := r.uvarint()
+	elements := make([][]byte, 0, min(n, uint64(len(payload))))
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		elements = append(elements, r.bytes())
+	}
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	return elements, nil
+}
+
+func appendBytes(buf []byte, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// reader decodes length-prefixed fields, remembering the first error.
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	n, size := binary.Uvarint(r.buf)
+	if size <= 0 {
+		r.err = ErrCorruptValue
+		return 0
+	}
+	r.buf = r.buf[size:]
+	return n
+}
+
+func (r *reader) bytes() []byte {
+	n := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.buf)) {
+		r.err = ErrCorruptValue
+		return nil
+	}
+	b := r.buf[:n:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *reader) done() error {
+	if r.err == nil && len(r.buf) != 0 {
+		r.err = ErrCorruptValue
+	}
+	return r.err
+}
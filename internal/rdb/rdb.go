@@ -0,0 +1,327 @@
+// Package rdb encodes and decodes values in the serialization format of Redis' DUMP and
+// RESTORE: a type byte, the value encoded like in an RDB file, the RDB version (2 bytes)
+// and the CRC64 of everything before it (8 bytes), both little-endian.
+//
+// Values are encoded with the plain RDB types (string, list, set, hash, zset), which every
+// Redis version since 5.0 restores, and decoded from those types only: the compact encodings
+// of Redis 7 (listpacks, intsets, quicklists) can't be decoded.
+package rdb
+
+import (
+	"encoding/binary"
+	"hash/crc64"
+	"math"
+	"strconv"
+
+	"KeyValor/constants"
+)
+
+// Type is the RDB type of a value.
+type Type byte
+
+const (
+	TypeString Type = 0
+	TypeList   Type = 1
+	TypeSet    Type = 2
+	// TypeZSet stores the scores as strings; TypeZSet2 as binary doubles
+	TypeZSet  Type = 3
+	TypeHash  Type = 4
+	TypeZSet2 Type = 5
+)
+
+const (
+	// Version is the RDB version of the payloads of Encoder
+	Version = 9
+	// maxVersion is the latest RDB version decoded (the one of Redis 7.4): the encodings of
+	// the types above didn't change since Version
+	maxVersion = 12
+
+	// footerSize is the size of the RDB version and the CRC64
+	footerSize = 2 + 8
+)
+
+// the prefixes of lengths: 6 bits, 14 bits, 32 bits and 64 bits, or an encoded string
+const (
+	len6Bit    = 0
+	len14Bit   = 1
+	len32Bit   = 0x80
+	len64Bit   = 0x81
+	lenEncoded = 3
+
+	encInt8  = 0
+	encInt16 = 1
+	encInt32 = 2
+	encLZF   = 3
+)
+
+// crcTable is the table of the CRC-64/Jones of Redis (reflected, without the final inversion
+// of hash/crc64: see checksum).
+var crcTable = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+// checksum returns the CRC64 of b, as computed by Redis.
+func checksum(b []byte) uint64 {
+	return ^crc64.Update(^uint64(0), crcTable, b)
+}
+
+// Encoder builds a payload. Its methods append to it, in the order of the RDB format.
+type Encoder struct {
+	buf []byte
+}
+
+// NewEncoder returns an encoder of a value of the given type.
+func NewEncoder(typ Type) *Encoder {
+	return &Encoder{buf: []byte{byte(typ)}}
+}
+
+// Length appends a length, e.g. the number of elements of a collection.
+func (e *Encoder) Length(n uint64) {
+	switch {
+	case n < 1<<6:
+		e.buf = append(e.buf, byte(n))
+	case n < 1<<14:
+		e.buf = append(e.buf, byte(n>>8)|len14Bit<<6, byte(n))
+	case n <= math.MaxUint32:
+		e.buf = append(e.buf, len32Bit)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	default:
+		e.buf = append(e.buf, len64Bit)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, n)
+	}
+}
+
+// String appends a string, not compressed.
+func (e *Encoder) String(s []byte) {
+	e.Length(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// Double appends a score of TypeZSet2.
+func (e *Encoder) Double(f float64) {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(f))
+}
+
+// Payload returns the payload, with its version and checksum.
+func (e *Encoder) Payload() []byte {
+	payload := binary.LittleEndian.AppendUint16(e.buf, Version)
+	return binary.LittleEndian.AppendUint64(payload, checksum(payload))
+}
+
+// Decoder reads the value of a payload. Its first error is kept, and returned by Done:
+// the values read after it are zero.
+type Decoder struct {
+	buf []byte
+	err error
+}
+
+// NewDecoder checks the version and the checksum of a payload, and returns the type of its
+// value and the decoder of the value. A checksum of zero isn't checked, like in Redis.
+func NewDecoder(payload []byte) (Type, *Decoder, error) {
+	if len(payload) < 1+footerSize {
+		return 0, nil, constants.ErrInvalidDumpPayload
+	}
+
+	footer := payload[len(payload)-footerSize:]
+	version := binary.LittleEndian.Uint16(footer)
+	crc := binary.LittleEndian.Uint64(footer[2:])
+	if version > maxVersion || crc != 0 && crc != checksum(payload[:len(payload)-8]) {
+		return 0, nil, constants.ErrInvalidDumpPayload
+	}
+
+	return Type(payload[0]), &Decoder{buf: payload[1 : len(payload)-footerSize]}, nil
+}
+
+// Length reads a length.
+func (d *Decoder) Length() uint64 {
+	n, encoded := d.length()
+	if encoded {
+		d.fail()
+		return 0
+	}
+	return n
+}
+
+// length reads a length, or the encoding of a string if encoded is set.
+func (d *Decoder) length() (n uint64, encoded bool) {
+	first := d.bytes(1)
+	if first == nil {
+		return 0, false
+	}
+
+	switch {
+	case first[0]>>6 == len6Bit:
+		return uint64(first[0] & 0x3f), false
+	case first[0]>>6 == len14Bit:
+		if next := d.bytes(1); next != nil {
+			return uint64(first[0]&0x3f)<<8 | uint64(next[0]), false
+		}
+	case first[0] == len32Bit:
+		if b := d.bytes(4); b != nil {
+			return uint64(binary.BigEndian.Uint32(b)), false
+		}
+	case first[0] == len64Bit:
+		if b := d.bytes(8); b != nil {
+			return binary.BigEndian.Uint64(b), false
+		}
+	case first[0]>>6 == lenEncoded:
+		return uint64(first[0] & 0x3f), true
+	default:
+		d.fail()
+	}
+	return 0, false
+}
+
+// String reads a string, which may be encoded as an integer or compressed with LZF.
+func (d *Decoder) String() []byte {
+	n, encoded := d.length()
+	if !encoded {
+		return d.bytes(n)
+	}
+
+	switch n {
+	case encInt8:
+		if b := d.bytes(1); b != nil {
+			return strconv.AppendInt(nil, int64(int8(b[0])), 10)
+		}
+	case encInt16:
+		if b := d.bytes(2); b != nil {
+			return strconv.AppendInt(nil, int64(int16(binary.LittleEndian.Uint16(b))), 10)
+		}
+	case encInt32:
+		if b := d.bytes(4); b != nil {
+			return strconv.AppendInt(nil, int64(int32(binary.LittleEndian.Uint32(b))), 10)
+		}
+	case encLZF:
+		compressedLen, length := d.Length(), d.Length()
+		if compressed := d.bytes(compressedLen); compressed != nil {
+			s, err := lzfDecompress(compressed, length)
+			if err != nil {
+				d.fail()
+			}
+			return s
+		}
+	default:
+		d.fail()
+	}
+	return nil
+}
+
+// Double reads a score of TypeZSet2.
+func (d *Decoder) Double() float64 {
+	b := d.bytes(8)
+	if b == nil {
+		return 0
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b))
+}
+
+// StringDouble reads a score of TypeZSet: its length (or 253 for NaN, 254 for +inf and 255
+// for -inf), followed by its decimal form.
+func (d *Decoder) StringDouble() float64 {
+	n := d.bytes(1)
+	if n == nil {
+		return 0
+	}
+
+	switch n[0] {
+	case 253:
+		return math.NaN()
+	case 254:
+		return math.Inf(1)
+	case 255:
+		return math.Inf(-1)
+	}
+	s := d.bytes(uint64(n[0]))
+	if s == nil {
+		return 0
+	}
+	f, err := strconv.ParseFloat(string(s), 64)
+	if err != nil {
+		d.fail()
+	}
+	return f
+}
+
+// Done returns the first error of the decoder, or constants.ErrBadDumpFormat if the value
+// was only partly read.
+func (d *Decoder) Done() error {
+	if d.err == nil && len(d.buf) > 0 {
+		d.fail()
+	}
+	return d.err
+}
+
+// Err returns the first error of the decoder, e.g. to stop reading the elements of a
+// collection whose length is corrupt.
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+func (d *Decoder) bytes(n uint64) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.buf)) {
+		d.fail()
+		return nil
+	}
+	b := d.buf[:n:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *Decoder) fail() {
+	if d.err == nil {
+		d.err = constants.ErrBadDumpFormat
+	}
+}
+
+// lzfDecompress decompresses the LZF data in, whose decompressed length is length.
+func lzfDecompress(in []byte, length uint64) ([]byte, error) {
+	if length > uint64(len(in))*256 {
+		return nil, constants.ErrBadDumpFormat
+	}
+
+	out := make([]byte, 0, length)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+
+		if ctrl < 1<<5 {
+			// a run of ctrl+1 literal bytes
+			if i+ctrl+1 > len(in) {
+				return nil, constants.ErrBadDumpFormat
+			}
+			out = append(out, in[i:i+ctrl+1]...)
+			i += ctrl + 1
+			continue
+		}
+
+		// a back reference: its length (minus 2) in 3 bits, or 7 and a length byte, and its
+		// offset (minus 1) in 5 bits followed by a byte
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, constants.ErrBadDumpFormat
+			}
+			n += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, constants.ErrBadDumpFormat
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 {
+			return nil, constants.ErrBadDumpFormat
+		}
+		// the reference may overlap the bytes it appends
+		for j := 0; j < n+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+
+	if uint64(len(out)) != length {
+		return nil, constants.ErrBadDumpFormat
+	}
+	return out, nil
+}
@@ -0,0 +1,79 @@
+package rdb
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"KeyValor/constants"
+)
+
+func TestChecksum(t *testing.T) {
+	// the check value of CRC-64/Jones, as in Redis' crc64.c
+	require.Equal(t, uint64(0xe9c6d914c4b8d9ca), checksum([]byte("123456789")))
+}
+
+func TestDecodeRedisPayload(t *testing.T) {
+	// the DUMP of "SET mykey 10" in the documentation of Redis: an integer-encoded string
+	typ, d, err := NewDecoder([]byte("\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n"))
+	require.NoError(t, err)
+	require.Equal(t, TypeString, typ)
+	require.Equal(t, "10", string(d.String()))
+	require.NoError(t, d.Done())
+
+	_, _, err = NewDecoder([]byte("\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\x0b"))
+	require.ErrorIs(t, err, constants.ErrInvalidDumpPayload)
+	_, _, err = NewDecoder([]byte("\x00\xc0\n\x0d\x00\xbem\x06\x89Z(\x00\n"))
+	require.ErrorIs(t, err, constants.ErrInvalidDumpPayload)
+	_, _, err = NewDecoder([]byte("\x00\xc0"))
+	require.ErrorIs(t, err, constants.ErrInvalidDumpPayload)
+}
+
+func TestRoundTrip(t *testing.T) {
+	long := make([]byte, 20000)
+	for i := range long {
+		long[i] = byte(i)
+	}
+
+	e := NewEncoder(TypeZSet2)
+	e.Length(3)
+	for _, s := range [][]byte{{}, []byte("member"), long} {
+		e.String(s)
+		e.Double(math.Inf(-1))
+	}
+	e.Length(1 << 40)
+	payload := e.Payload()
+
+	typ, d, err := NewDecoder(payload)
+	require.NoError(t, err)
+	require.Equal(t, TypeZSet2, typ)
+	require.Equal(t, uint64(3), d.Length())
+	for _, s := range [][]byte{{}, []byte("member"), long} {
+		require.Equal(t, s, d.String())
+		require.Equal(t, math.Inf(-1), d.Double())
+	}
+	require.Equal(t, uint64(1<<40), d.Length())
+	require.NoError(t, d.Done())
+
+	// reading past the value, or not reading all of it, fails
+	_, d, err = NewDecoder(payload)
+	require.NoError(t, err)
+	d.Length()
+	require.ErrorIs(t, d.Done(), constants.ErrBadDumpFormat)
+	require.Nil(t, d.String())
+}
+
+func TestLZF(t *testing.T) {
+	// a literal "a", a back reference of 24 bytes overlapping the bytes it copies, and another
+	// literal "bc"
+	s, err := lzfDecompress([]byte{0x00, 'a', 0xe0, 0x0f, 0x00, 0x01, 'b', 'c'}, 27)
+	require.NoError(t, err)
+	require.Equal(t, strings.Repeat("a", 25)+"bc", string(s))
+
+	_, err = lzfDecompress([]byte{0x00, 'a', 0x20, 0x05}, 4)
+	require.ErrorIs(t, err, constants.ErrBadDumpFormat)
+	_, err = lzfDecompress([]byte{0x05, 'a'}, 6)
+	require.ErrorIs(t, err, constants.ErrBadDumpFormat)
+}
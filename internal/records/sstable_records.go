@@ -112,7 +112,8 @@ func (r *CommandRecord) IsExpired() bool {
 	if r.Header.Expiry == 0 {
 		return false
 	}
-	return time.Now().Unix() > int64(r.Header.Expiry)
+	// expiry is stored as a unix timestamp in nanoseconds
+	return time.Now().UnixNano() > r.Header.Expiry
 }
 
 func (cr *CommandRecord) DecodeKeyVal(keyAndValue []byte) error {
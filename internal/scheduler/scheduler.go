@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+
+	"KeyValor/log"
+)
+
+// Scheduler runs the periodic background tasks (compaction, file rotation,
+// index flushes) of every storage engine that shares a data directory.
+// Each task runs on its own ticker; cancelling a task, or stopping the
+// scheduler, waits for an in-flight run of that task to finish.
+type Scheduler struct {
+	mu      sync.Mutex
+	stopped bool
+	tasks   map[*task]struct{}
+}
+
+type task struct {
+	name string
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func New() *Scheduler {
+	return &Scheduler{
+		tasks: make(map[*task]struct{}),
+	}
+}
+
+// Every runs fn every interval, until the returned cancel function is called
+// or the scheduler is stopped. A non-positive interval disables the task.
+func (s *Scheduler) Every(name string, interval time.Duration, fn func()) (cancel func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped || interval <= 0 {
+		return func() {}
+	}
+
+	t := &task{
+		name: name,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	s.tasks[t] = struct{}{}
+
+	go t.run(interval, fn)
+
+	return func() {
+		s.mu.Lock()
+		delete(s.tasks, t)
+		s.mu.Unlock()
+		t.cancel()
+	}
+}
+
+// Stop cancels every registered task and waits for them to exit.
+// Tasks registered after Stop are never run.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	tasks := s.tasks
+	s.tasks = make(map[*task]struct{})
+	s.mu.Unlock()
+
+	for t := range tasks {
+		t.cancel()
+	}
+}
+
+func (t *task) run(interval time.Duration, fn func()) {
+	defer close(t.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			// a stop request always wins over a pending tick
+			select {
+			case <-t.stop:
+				return
+			default:
+			}
+			log.Debugf("running background task: %s", t.name)
+			fn()
+		}
+	}
+}
+
+func (t *task) cancel() {
+	t.once.Do(func() { close(t.stop) })
+	<-t.done
+}
@@ -0,0 +1,266 @@
+// Package skiplist implements the score-ordered structure of sorted sets: a skip list of
+// (score, member) pairs, ordered by score and then by member, like Redis' zskiplist.
+// Each link knows how many nodes it spans, so that ranks are found in O(log n) as well.
+package skiplist
+
+import (
+	"math/rand/v2"
+)
+
+const (
+	maxLevel = 32
+	// probability for a node of level n to also be of level n+1
+	levelProbability = 0.25
+)
+
+// Node is an element of the skip list.
+type Node struct {
+	Score  float64
+	Member string
+
+	backward *Node
+	levels   []level
+}
+
+type level struct {
+	forward *Node
+	// number of nodes between this node and forward, forward included
+	span int
+}
+
+// Next returns the next node in order, or nil for the last node.
+func (n *Node) Next() *Node {
+	return n.levels[0].forward
+}
+
+// Prev returns the previous node in order, or nil for the first node.
+func (n *Node) Prev() *Node {
+	return n.backward
+}
+
+// before reports whether the node sorts before (score, member).
+func (n *Node) before(score float64, member string) bool {
+	return n.Score < score || (n.Score == score && n.Member < member)
+}
+
+func (n *Node) is(score float64, member string) bool {
+	return n.Score == score && n.Member == member
+}
+
+// Bound is the lower or the upper bound of a score range.
+type Bound struct {
+	Value     float64
+	Exclusive bool
+}
+
+// InRange reports whether score is within the range from min to max.
+func InRange(score float64, min, max Bound) bool {
+	return min.below(score) && max.above(score)
+}
+
+// below reports whether score is within the range starting at the bound.
+func (b Bound) below(score float64) bool {
+	return score > b.Value || (!b.Exclusive && score == b.Value)
+}
+
+// above reports whether score is within the range ending at the bound.
+func (b Bound) above(score float64) bool {
+	return score < b.Value || (!b.Exclusive && score == b.Value)
+}
+
+// SkipList is a list of (score, member) pairs, sorted by score and then by member.
+// It doesn't check that members are unique: that is up to the caller.
+type SkipList struct {
+	header *Node
+	tail   *Node
+	length int
+	level  int
+}
+
+// New returns an empty skip list.
+func New() *SkipList {
+	return &SkipList{
+		header: &Node{levels: make([]level, maxLevel)},
+		level:  1,
+	}
+}
+
+// Len returns the number of nodes.
+func (sl *SkipList) Len() int {
+	return sl.length
+}
+
+// First returns the first node, or nil if the list is empty.
+func (sl *SkipList) First() *Node {
+	return sl.header.levels[0].forward
+}
+
+// Last returns the last node, or nil if the list is empty.
+func (sl *SkipList) Last() *Node {
+	return sl.tail
+}
+
+// Insert adds a node for (score, member).
+func (sl *SkipList) Insert(score float64, member string) *Node {
+	var (
+		update [maxLevel]*Node
+		rank   [maxLevel]int
+	)
+
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		if i < sl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.levels[i].forward != nil && x.levels[i].forward.before(score, member) {
+			rank[i] += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	lvl := randomLevel()
+	if lvl > sl.level {
+		for i := sl.level; i < lvl; i++ {
+			rank[i] = 0
+			update[i] = sl.header
+			update[i].levels[i].span = sl.length
+		}
+		sl.level = lvl
+	}
+
+	x = &Node{Score: score, Member: member, levels: make([]level, lvl)}
+	for i := 0; i < lvl; i++ {
+		x.levels[i].forward = update[i].levels[i].forward
+		update[i].levels[i].forward = x
+
+		x.levels[i].span = update[i].levels[i].span - (rank[0] - rank[i])
+		update[i].levels[i].span = rank[0] - rank[i] + 1
+	}
+	// the links above the new node now span one more node
+	for i := lvl; i < sl.level; i++ {
+		update[i].levels[i].span++
+	}
+
+	if update[0] != sl.header {
+		x.backward = update[0]
+	}
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x
+	} else {
+		sl.tail = x
+	}
+	sl.length++
+	return x
+}
+
+// Delete removes the node of (score, member), and returns false if there is none.
+func (sl *SkipList) Delete(score float64, member string) bool {
+	var update [maxLevel]*Node
+
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && x.levels[i].forward.before(score, member) {
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.levels[0].forward
+	if x == nil || !x.is(score, member) {
+		return false
+	}
+
+	for i := 0; i < sl.level; i++ {
+		if update[i].levels[i].forward == x {
+			update[i].levels[i].span += x.levels[i].span - 1
+			update[i].levels[i].forward = x.levels[i].forward
+		} else {
+			update[i].levels[i].span--
+		}
+	}
+
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x.backward
+	} else {
+		sl.tail = x.backward
+	}
+	for sl.level > 1 && sl.header.levels[sl.level-1].forward == nil {
+		sl.level--
+	}
+	sl.length--
+	return true
+}
+
+// Rank returns the 0-based rank of (score, member), or -1 if it isn't in the list.
+func (sl *SkipList) Rank(score float64, member string) int {
+	rank := 0
+
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil &&
+			(x.levels[i].forward.before(score, member) || x.levels[i].forward.is(score, member)) {
+			rank += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		if x != sl.header && x.is(score, member) {
+			return rank - 1
+		}
+	}
+	return -1
+}
+
+// ByRank returns the node of the given 0-based rank, or nil if it is out of range.
+func (sl *SkipList) ByRank(rank int) *Node {
+	if rank < 0 || rank >= sl.length {
+		return nil
+	}
+
+	traversed := 0
+	target := rank + 1
+
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && traversed+x.levels[i].span <= target {
+			traversed += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		if traversed == target {
+			return x
+		}
+	}
+	return nil
+}
+
+// FirstInRange returns the first node whose score is within min, or nil if there is none.
+func (sl *SkipList) FirstInRange(min Bound) *Node {
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && !min.below(x.levels[i].forward.Score) {
+			x = x.levels[i].forward
+		}
+	}
+	return x.levels[0].forward
+}
+
+// LastInRange returns the last node whose score is within max, or nil if there is none.
+func (sl *SkipList) LastInRange(max Bound) *Node {
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && max.above(x.levels[i].forward.Score) {
+			x = x.levels[i].forward
+		}
+	}
+	if x == sl.header {
+		return nil
+	}
+	return x
+}
+
+func randomLevel() int {
+	lvl := 1
+	for lvl < maxLevel && rand.Float64() < levelProbability {
+		lvl++
+	}
+	return lvl
+}
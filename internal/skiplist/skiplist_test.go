@@ -0,0 +1,64 @@
+package skiplist
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type pair struct {
+	score  float64
+	member string
+}
+
+func TestSkipList(t *testing.T) {
+	sl := New()
+
+	// a reference sorted slice, compared against after random inserts and deletes
+	var pairs []pair
+	for i := 0; i < 1000; i++ {
+		p := pair{score: float64(rand.IntN(50)), member: fmt.Sprintf("m%d", i)}
+		pairs = append(pairs, p)
+		sl.Insert(p.score, p.member)
+	}
+	for i := 0; i < 300; i++ {
+		j := rand.IntN(len(pairs))
+		require.True(t, sl.Delete(pairs[j].score, pairs[j].member))
+		pairs = append(pairs[:j], pairs[j+1:]...)
+	}
+	require.False(t, sl.Delete(1, "missing"))
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].score < pairs[j].score ||
+			(pairs[i].score == pairs[j].score && pairs[i].member < pairs[j].member)
+	})
+	require.Equal(t, len(pairs), sl.Len())
+
+	rank := 0
+	for n := sl.First(); n != nil; n = n.Next() {
+		require.Equal(t, pairs[rank], pair{n.Score, n.Member})
+		require.Equal(t, rank, sl.Rank(n.Score, n.Member))
+		require.Same(t, n, sl.ByRank(rank))
+		rank++
+	}
+	require.Equal(t, len(pairs), rank)
+	require.Equal(t, pairs[len(pairs)-1].member, sl.Last().Member)
+	require.Equal(t, pairs[len(pairs)-2].member, sl.Last().Prev().Member)
+	require.Equal(t, -1, sl.Rank(1, "missing"))
+	require.Nil(t, sl.ByRank(len(pairs)))
+
+	// score ranges
+	first := sl.FirstInRange(Bound{Value: 10, Exclusive: true})
+	require.Equal(t, 11.0, first.Score)
+	require.Equal(t, 10.0, first.Prev().Score)
+	last := sl.LastInRange(Bound{Value: 20})
+	require.Equal(t, 20.0, last.Score)
+	require.Equal(t, 21.0, last.Next().Score)
+	require.Nil(t, sl.FirstInRange(Bound{Value: 100}))
+	require.Nil(t, sl.LastInRange(Bound{Value: -1}))
+	require.True(t, InRange(10, Bound{Value: 10}, Bound{Value: 10}))
+	require.False(t, InRange(10, Bound{Value: 10, Exclusive: true}, Bound{Value: 20}))
+}
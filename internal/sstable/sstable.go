@@ -5,12 +5,11 @@ import (
 	"fmt"
 	"sync"
 
-	"github.com/emirpasic/gods/utils"
-
 	"KeyValor/constants"
 	"KeyValor/internal/records"
 	"KeyValor/internal/storage/datafile"
 	"KeyValor/internal/treemapgen"
+	"KeyValor/internal/utils/cmputils"
 	"KeyValor/log"
 )
 
@@ -25,6 +24,19 @@ type SSTable struct {
 }
 
 func NewSSTable(filePath string, partSize int) (*SSTable, error) {
+	sst := newSSTable(filePath, partSize)
+
+	var err error
+	sst.activeSstFile, err = datafile.NewAppendOnlyDataFileWithRandomReadsWithPath(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return sst, nil
+}
+
+// newSSTable creates the in-memory structure of an SSTable, without opening its file.
+func newSSTable(filePath string, partSize int) *SSTable {
 
 	metaData := &SSTableMetaData{
 		Version:          0,
@@ -46,15 +58,9 @@ func NewSSTable(filePath string, partSize int) (*SSTable, error) {
 	}
 
 	// sst.sparseIndex = *treemap.NewWithStringComparator()
-	sst.sparseIndex = treemapgen.NewSerializableTreeMap[string, *records.PositionRecord](utils.StringComparator)
+	sst.sparseIndex = treemapgen.NewSerializableTreeMap[string, *records.PositionRecord](cmputils.BytewiseComparator)
 
-	var err error
-	sst.activeSstFile, err = datafile.NewAppendOnlyDataFileWithRandomReadsWithPath(filePath)
-	if err != nil {
-		return nil, err
-	}
-
-	return sst, nil
+	return sst
 }
 
 func NewSSTableFromIndex(filePath string, partSize int, memTable *treemapgen.SerializableTreeMap[string, *records.CommandRecord]) (*SSTable, error) {
@@ -68,15 +74,23 @@ func NewSSTableFromIndex(filePath string, partSize int, memTable *treemapgen.Ser
 		return nil, fmt.Errorf("failed to populate SSTable from index %w", err)
 	}
 
-	return sst, err
-}
-
-func NewSSTableLoadedFromFile(filePath string) (*SSTable, error) {
-	sst, err := NewSSTable(filePath, 0) // partSize not relevant for loading from disk
+	// the table is immutable from now on, queries go through a read-only handle
+	if err := sst.activeSstFile.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync SSTable file: %w", err)
+	}
+	sst.readOnlySstFile, err = datafile.NewReadOnlyDataFileWithRandomReadsWithPath(filePath)
 	if err != nil {
 		return nil, err
 	}
 
+	return sst, nil
+}
+
+func NewSSTableLoadedFromFile(filePath string) (*SSTable, error) {
+	// partSize not relevant for loading from disk, and the file is never written again
+	sst := newSSTable(filePath, 0)
+
+	var err error
 	sst.readOnlySstFile, err = datafile.NewReadOnlyDataFileWithRandomReadsWithPath(filePath)
 	if err != nil {
 		return nil, err
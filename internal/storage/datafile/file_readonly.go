@@ -9,9 +9,9 @@ type ReadOnlyWithRandomReads interface {
 }
 
 func NewReadOnlyDataFileWithRandomReadsWithPath(filePath string) (ReadOnlyWithRandomReads, error) {
-	return newDataFileWithPath(filePath, 0, DF_MODE_READ_WRITE)
+	return newDataFileWithPath(filePath, 0, DF_MODE_READ_ONLY)
 }
 
 func NewReadOnlyDataFileWithRandomReads(directory string, fileNameFormat string, fileID int) (ReadOnlyWithRandomReads, error) {
-	return newDataFile(directory, fileNameFormat, fileID, DF_MODE_READ_WRITE)
+	return newDataFile(directory, fileNameFormat, fileID, DF_MODE_READ_ONLY)
 }
@@ -6,8 +6,10 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"KeyValor/config"
 	"KeyValor/internal/storage/datafile"
 	"KeyValor/internal/storage/storagecommon"
 )
@@ -17,14 +19,41 @@ type HashTableStorage struct {
 	ActiveDataFile      datafile.AppendOnlyWithRandomReads
 	keyLocationIndex    storagecommon.DatabaseIndex
 	olddatafileFilesMap map[int]datafile.ReadOnlyWithRandomReads
+
+	// cancel functions of the background tasks registered in Init()
+	cancelTasks []func()
+
+	// flushMu serializes the writes of the index file, so that an older snapshot
+	// of the index never replaces a newer one
+	flushMu sync.Mutex
+
+	// statistics, for Stats: expiring is the number of keys with an expiry (under the lock)
+	expiring       int
+	changes        atomic.Int64
+	checkpoints    atomic.Int64
+	lastCheckpoint atomic.Int64
+	compactions    atomic.Int64
+	lastCompaction atomic.Int64
+	rotations      atomic.Int64
 }
 
-func NewHashTableStorage(cfg *config.DBCfgOpts) (*HashTableStorage, error) {
+// NewHashTableStorage opens (or creates) a hash-table storage in cs.Cfg.Directory.
+// The caller owns cs; its lock file is released when the storage is closed.
+func NewHashTableStorage(cs *storagecommon.CommonStorage) (*HashTableStorage, error) {
 
 	var (
+		cfg              = cs.Cfg
 		olddatafileFiles = make(map[int]datafile.ReadOnlyWithRandomReads)
 	)
 
+	// the index is loaded before listing the data files, so that a read-only
+	// process never sees an index snapshot referring to files it didn't open
+	indexFilePath := filepath.Join(cfg.Directory, INDEX_FILENAME)
+	keyLocationIndex := NewCheckpointIndex(indexFilePath)
+	if err := keyLocationIndex.Open(); err != nil {
+		return nil, fmt.Errorf("error opening index: %w", err)
+	}
+
 	_, ids, err := listHashTableDataFiles(cfg.Directory)
 	if err != nil {
 		return nil, err
@@ -40,40 +69,45 @@ func NewHashTableStorage(cfg *config.DBCfgOpts) (*HashTableStorage, error) {
 		olddatafileFiles[id] = datafile
 	}
 
-	nextIndex := len(ids) + 1
-	activedatafile, err := datafile.NewAppendOnlyDataFileWithRandomReads(cfg.Directory, HASHTABLE_DATAFILE_NAME_FORMAT, nextIndex)
-	if err != nil {
-		return nil, err
-	}
-
-	indexFilePath := filepath.Join(cfg.Directory, INDEX_FILENAME)
-	keyLocationIndex := NewCheckpointIndex(indexFilePath)
-	if err := keyLocationIndex.Open(); err != nil {
-		return nil, fmt.Errorf("error opening index: %w", err)
-	}
-
-	cs, err := storagecommon.NewCommonStorage(cfg)
-	if err != nil {
-		return nil, fmt.Errorf("error creating common storage: %w", err)
+	// in read-only mode there is no active file: every file is an old (read-only) one
+	var activedatafile datafile.AppendOnlyWithRandomReads
+	if !cfg.ReadOnly {
+		nextIndex := 1
+		if len(ids) > 0 {
+			nextIndex = ids[len(ids)-1] + 1
+		}
+		activedatafile, err = datafile.NewAppendOnlyDataFileWithRandomReads(cfg.Directory, HASHTABLE_DATAFILE_NAME_FORMAT, nextIndex)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return &HashTableStorage{
+	hts := &HashTableStorage{
 		CommonStorage:       cs,
 		ActiveDataFile:      activedatafile,
 		keyLocationIndex:    keyLocationIndex,
 		olddatafileFilesMap: olddatafileFiles,
-	}, nil
+	}
+	keyLocationIndex.Map(func(key string, meta storagecommon.Meta) error {
+		if meta.Expiry != 0 {
+			hts.expiring++
+		}
+		return nil
+	})
+	// the index was last persisted before the storage was opened
+	hts.lastCheckpoint.Store(time.Now().UnixNano())
+	return hts, nil
 }
 
 func listHashTableDataFiles(directory string) (files []string, ids []int, err error) {
-	files, err = filepath.Glob(fmt.Sprintf("%s/%s", directory, HASHTABLE_DATAFILE_EXTENSION))
+	files, err = filepath.Glob(filepath.Join(directory, HASHTABLE_DATAFILE_NAME_PREFIX+"*"+HASHTABLE_DATAFILE_EXTENSION))
 	if err != nil {
 		return nil, nil, err
 	}
 
 	ids = make([]int, len(files))
 
-	// store_file_<int>.db
+	// wal_file_<int>.db
 	for i, file := range files {
 		fileNumber := strings.TrimPrefix(strings.TrimSuffix(filepath.Base(file), HASHTABLE_DATAFILE_EXTENSION), HASHTABLE_DATAFILE_NAME_PREFIX)
 		id, err := strconv.ParseInt(fileNumber, 10, 32)
@@ -89,27 +123,66 @@ func listHashTableDataFiles(directory string) (files []string, ids []int, err er
 }
 
 func (hts *HashTableStorage) Init() error {
-	go hts.CompactionLoop(hts.Cfg.CompactInterval)
-	go hts.FileRotationLoop(hts.Cfg.CheckFileSizeInterval)
-	go hts.IndexFlushLoop(hts.Cfg.SyncWriteInterval)
+	// a read-only storage never compacts, rotates files or flushes its index
+	if hts.Cfg.ReadOnly {
+		return nil
+	}
+
+	hts.cancelTasks = append(hts.cancelTasks,
+		hts.Scheduler.Every("hashtable compaction", hts.Cfg.CompactInterval, hts.compact),
+		hts.Scheduler.Every("hashtable file rotation", hts.Cfg.CheckFileSizeInterval, hts.rotateActiveFile),
+		hts.Scheduler.Every("hashtable index flush", hts.Cfg.SyncWriteInterval, hts.flushIndex),
+		hts.Scheduler.Every("hashtable active expiry", hts.Cfg.ActiveExpireInterval, hts.activeExpire),
+	)
 	return nil
 }
 
+// stopTasks cancels the background tasks registered in Init(), waiting for their runs in flight.
+func (hts *HashTableStorage) stopTasks() {
+	for _, cancel := range hts.cancelTasks {
+		cancel()
+	}
+	hts.cancelTasks = nil
+}
+
+// Close syncs the active data file and persists the index, then closes the files and releases
+// the lock of the directory.
 func (hts *HashTableStorage) Close() error {
-	hts.Lock()
-	if err := hts.keyLocationIndex.Flush(); err != nil {
+	return hts.close(true)
+}
+
+// CloseWithoutCheckpoint is Close, without syncing the active data file or persisting the index.
+func (hts *HashTableStorage) CloseWithoutCheckpoint() error {
+	return hts.close(false)
+}
+
+func (hts *HashTableStorage) close(checkpoint bool) error {
+	// stop the background tasks first, so none of them runs on closed files
+	hts.stopTasks()
+
+	if checkpoint && !hts.Cfg.ReadOnly {
+		hts.Lock()
+		// the index must not point to records that a crash could lose
+		if err := hts.ActiveDataFile.Sync(); err != nil {
+			hts.Unlock()
+			return fmt.Errorf("error syncing active datafile on close: %w", err)
+		}
+		if err := hts.keyLocationIndex.Flush(); err != nil {
+			hts.Unlock()
+			return fmt.Errorf("error flushing index on close: %w", err)
+		}
 		hts.Unlock()
-		return fmt.Errorf("error flushing index on close: %w", err)
 	}
+
 	if err := hts.keyLocationIndex.Close(); err != nil {
-		hts.Unlock()
 		return fmt.Errorf("error closing index: %w", err)
 	}
-	hts.Unlock()
 
 	// close the active file
-	if err := hts.ActiveDataFile.Close(); err != nil {
-		return fmt.Errorf("error closing active datafile file: %w", err)
+	if hts.ActiveDataFile != nil {
+		if err := hts.ActiveDataFile.Close(); err != nil {
+			return fmt.Errorf("error closing active datafile file: %w", err)
+		}
 	}
 
 	// close old files
@@ -119,9 +192,6 @@ func (hts *HashTableStorage) Close() error {
 		}
 	}
 
-	// free the lock file
-	if err := storagecommon.FreeLockFile(hts.LockFile); err != nil {
-		return fmt.Errorf("error freeing lock file: %w", err)
-	}
-	return nil
+	// free the lock file (and stop the scheduler), if we own them
+	return hts.CommonStorage.Close()
 }
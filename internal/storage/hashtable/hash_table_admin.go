@@ -0,0 +1,179 @@
+package hashtable
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"KeyValor/config"
+	"KeyValor/internal/storage/datafile"
+	"KeyValor/internal/storage/storagecommon"
+	"KeyValor/internal/utils/fileutils"
+)
+
+// Stats returns the statistics of the storage.
+func (hts *HashTableStorage) Stats() storagecommon.EngineStats {
+	hts.RLock()
+	stats := storagecommon.EngineStats{
+		Keys:           hts.keyLocationIndex.Len(),
+		KeysWithExpiry: hts.expiring,
+		DataFiles:      len(hts.olddatafileFilesMap),
+	}
+	if hts.ActiveDataFile != nil {
+		stats.DataFiles++
+	}
+	hts.RUnlock()
+
+	stats.DiskBytes = hts.diskBytes()
+	stats.ChangesSinceCheckpoint = hts.changes.Load()
+	stats.LastCheckpoint = unixNanoTime(hts.lastCheckpoint.Load())
+	stats.Checkpoints = hts.checkpoints.Load()
+	stats.LastCompaction = unixNanoTime(hts.lastCompaction.Load())
+	stats.Compactions = hts.compactions.Load()
+	stats.FileRotations = hts.rotations.Load()
+	return stats
+}
+
+// diskBytes returns the size of the data files and of the index.
+func (hts *HashTableStorage) diskBytes() int64 {
+	entries, err := os.ReadDir(hts.Cfg.Directory)
+	if err != nil {
+		return 0
+	}
+
+	var size int64
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != HASHTABLE_DATAFILE_EXTENSION && entry.Name() != INDEX_FILENAME {
+			continue
+		}
+		// the compaction may have deleted the file since
+		if info, err := entry.Info(); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+func unixNanoTime(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// Checkpoint syncs the active data file and persists the index, so that the data written
+// so far survives a crash. The writes are only blocked while the index is copied, not while
+// the copy is written.
+func (hts *HashTableStorage) Checkpoint() error {
+	hts.flushMu.Lock()
+	defer hts.flushMu.Unlock()
+
+	hts.RLock()
+	if err := hts.ActiveDataFile.Sync(); err != nil {
+		hts.RUnlock()
+		return fmt.Errorf("error syncing active datafile: %w", err)
+	}
+	snapshot := make(map[string]storagecommon.Meta, hts.keyLocationIndex.Len())
+	hts.keyLocationIndex.Map(func(key string, meta storagecommon.Meta) error {
+		snapshot[key] = meta
+		return nil
+	})
+	changes := hts.changes.Load()
+	hts.RUnlock()
+
+	if err := hts.keyLocationIndex.FlushSnapshot(snapshot); err != nil {
+		return err
+	}
+	hts.checkpointed(changes)
+	return nil
+}
+
+// checkpointed records that the index was persisted, with changes writes since the last time.
+func (hts *HashTableStorage) checkpointed(changes int64) {
+	hts.changes.Add(-changes)
+	hts.checkpoints.Add(1)
+	hts.lastCheckpoint.Store(time.Now().UnixNano())
+}
+
+// Clear deletes every key, and the data files. A crash leaves either every key, or none:
+// a new active file and an empty index are persisted before the old files are deleted.
+// Like the compaction, it fails with constants.ErrStoreIsBusy while read-only processes
+// are attached.
+func (hts *HashTableStorage) Clear() error {
+	hts.flushMu.Lock()
+	defer hts.flushMu.Unlock()
+
+	hts.Lock()
+	defer hts.Unlock()
+
+	releaseReaders, err := hts.ExcludeReaders()
+	if err != nil {
+		return err
+	}
+	defer releaseReaders()
+
+	// the active file always has the highest id
+	activeFile, err := datafile.NewAppendOnlyDataFileWithRandomReads(hts.Cfg.Directory, HASHTABLE_DATAFILE_NAME_FORMAT, hts.ActiveDataFile.ID()+1)
+	if err != nil {
+		return err
+	}
+
+	index := NewCheckpointIndex(filepath.Join(hts.Cfg.Directory, INDEX_FILENAME))
+	if err := index.Flush(); err != nil {
+		activeFile.Close()
+		return fmt.Errorf("error flushing empty index: %w", err)
+	}
+
+	oldFiles := []datafile.ReadOnlyWithRandomReads{hts.ActiveDataFile}
+	for _, file := range hts.olddatafileFilesMap {
+		oldFiles = append(oldFiles, file)
+	}
+
+	hts.ActiveDataFile = activeFile
+	hts.olddatafileFilesMap = make(map[int]datafile.ReadOnlyWithRandomReads)
+	hts.keyLocationIndex = index
+	hts.expiring = 0
+	hts.checkpointed(hts.changes.Load())
+
+	for _, file := range oldFiles {
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("error closing datafile file: %w", err)
+		}
+		path := filepath.Join(hts.Cfg.Directory, fmt.Sprintf(HASHTABLE_DATAFILE_NAME_FORMAT, file.ID()))
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("error deleting datafile file: %w", err)
+		}
+	}
+
+	if err := fileutils.SyncFile(hts.Cfg.Directory); err != nil {
+		return fmt.Errorf("error syncing directory: %w", err)
+	}
+	return nil
+}
+
+// Reconfigure applies the options of cfg that can change while the storage runs: the
+// intervals of the background tasks, which are restarted if they changed, the maximum size
+// of the active file, the sync policy and the default TTL. It must not be called concurrently with Close.
+func (hts *HashTableStorage) Reconfigure(cfg *config.DBCfgOpts) error {
+	hts.Lock()
+	restart := cfg.SyncWriteInterval != hts.Cfg.SyncWriteInterval ||
+		cfg.CompactInterval != hts.Cfg.CompactInterval ||
+		cfg.CheckFileSizeInterval != hts.Cfg.CheckFileSizeInterval ||
+		cfg.ActiveExpireInterval != hts.Cfg.ActiveExpireInterval
+
+	hts.Cfg.SyncWriteInterval = cfg.SyncWriteInterval
+	hts.Cfg.CompactInterval = cfg.CompactInterval
+	hts.Cfg.CheckFileSizeInterval = cfg.CheckFileSizeInterval
+	hts.Cfg.ActiveExpireInterval = cfg.ActiveExpireInterval
+	hts.Cfg.MaxActiveFileSize = cfg.MaxActiveFileSize
+	hts.Cfg.SyncPolicy = cfg.SyncPolicy
+	hts.Cfg.DefaultTTL = cfg.DefaultTTL
+	hts.Unlock()
+
+	if !restart {
+		return nil
+	}
+	hts.stopTasks()
+	return hts.Init()
+}
@@ -1,44 +1,35 @@
 package hashtable
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 
+	"KeyValor/config"
+	"KeyValor/constants"
 	"KeyValor/internal/storage/datafile"
 	"KeyValor/internal/storage/storagecommon"
 	"KeyValor/internal/utils/fileutils"
 	"KeyValor/log"
 )
 
-func (hts *HashTableStorage) FileRotationLoop(interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+// rotateActiveFile is run periodically by the scheduler (every CheckFileSizeInterval).
+func (hts *HashTableStorage) rotateActiveFile() {
+	defer hts.reportLatency(config.LatencyFileRotation, time.Now())
 
-	for range ticker.C {
-		if err := hts.maybeRotateActiveFile(); err != nil {
-			return
-		}
+	if err := hts.maybeRotateActiveFile(); err != nil {
+		log.Errorf("file rotation error: %v", err)
 	}
 }
 
-func (hts *HashTableStorage) IndexFlushLoop(interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		hts.RLock()
-		snapshot := make(map[string]storagecommon.Meta)
-		hts.keyLocationIndex.Map(func(key string, meta storagecommon.Meta) error {
-			snapshot[key] = meta
-			return nil
-		})
-		hts.RUnlock()
+// flushIndex is run periodically by the scheduler (every SyncWriteInterval).
+func (hts *HashTableStorage) flushIndex() {
+	defer hts.reportLatency(config.LatencyIndexFlush, time.Now())
 
-		if err := hts.keyLocationIndex.FlushSnapshot(snapshot); err != nil {
-			log.Errorf("index flush error: %v", err)
-		}
+	if err := hts.Checkpoint(); err != nil {
+		log.Errorf("index flush error: %v", err)
 	}
 }
 
@@ -66,33 +57,102 @@ func (hts *HashTableStorage) maybeRotateActiveFile() error {
 	}
 
 	hts.ActiveDataFile = df
+	hts.rotations.Add(1)
 	return nil
 }
 
-func (hts *HashTableStorage) CompactionLoop(interval time.Duration) {
-	ticker := time.NewTicker(interval)
+// activeExpire is run periodically by the scheduler (every ActiveExpireInterval): it deletes
+// the keys whose expiry, kept in the index, has passed.
+func (hts *HashTableStorage) activeExpire() {
+	defer hts.reportLatency(config.LatencyExpireCycle, time.Now())
 
-	for range ticker.C {
-		func() {
-			hts.Lock()
-			defer hts.Unlock()
+	expiredKeys, err := hts.deleteExpiredIndexedKeys()
+	if err != nil {
+		log.Errorf("active expiry error: %v", err)
+	}
+	hts.notifyExpired(expiredKeys)
+}
 
-			// delete the expired keys from the index, and persist the index
-			if err := hts.deleteExpiredKeysFromIndex(); err != nil {
-				return
-			}
+func (hts *HashTableStorage) deleteExpiredIndexedKeys() ([]string, error) {
+	hts.Lock()
+	defer hts.Unlock()
 
-			// merge old files into a new temp file, and keep updating indexes
-			if err := hts.garbageCollectOldFilesDBMuLocked(); err != nil {
-				return
-			}
+	if hts.expiring == 0 {
+		return nil, nil
+	}
+
+	now := time.Now().UnixNano()
+	var expiredKeys []string
+	hts.keyLocationIndex.Map(func(key string, metaData storagecommon.Meta) error {
+		if metaData.Expiry != 0 && now > metaData.Expiry {
+			expiredKeys = append(expiredKeys, key)
+		}
+		return nil
+	})
+	return hts.deleteKeysMuLocked(expiredKeys)
+}
+
+// notifyExpired passes the keys deleted because they expired to the expiry listener, if any.
+// It must be called without the lock, which the listener may need.
+func (hts *HashTableStorage) notifyExpired(keys []string) {
+	if len(keys) > 0 && hts.Cfg.ExpiryListener != nil {
+		hts.Cfg.ExpiryListener(keys)
+	}
+}
+
+// reportLatency passes the duration of a background task that started at start to the latency
+// listener, if any. It must be called without the lock, like notifyExpired.
+func (hts *HashTableStorage) reportLatency(event string, start time.Time) {
+	if hts.Cfg.LatencyListener != nil {
+		hts.Cfg.LatencyListener(event, time.Since(start))
+	}
+}
+
+// compact is run periodically by the scheduler (every CompactInterval).
+func (hts *HashTableStorage) compact() {
+	var expiredKeys []string
+	// the listeners are notified once the locks are released
+	defer hts.reportLatency(config.LatencyCompaction, time.Now())
+	defer func() { hts.notifyExpired(expiredKeys) }()
+
+	hts.flushMu.Lock()
+	defer hts.flushMu.Unlock()
+
+	hts.Lock()
+	defer hts.Unlock()
+
+	// delete the expired keys from the index, and persist the index
+	expiredKeys, err := hts.deleteExpiredKeysFromIndex()
+	if err != nil {
+		log.Errorf("compaction error: %v", err)
+		return
+	}
+
+	// read-only processes may have loaded the current files and index
+	// snapshot, so the files can't be swapped while they are attached
+	releaseReaders, err := hts.ExcludeReaders()
+	if errors.Is(err, constants.ErrStoreIsBusy) {
+		log.Infof("read-only processes are attached to %s, postponing compaction", hts.Cfg.Directory)
+		return
+	}
+	if err != nil {
+		log.Errorf("compaction error: %v", err)
+		return
+	}
+	defer releaseReaders()
 
-		}()
+	// merge old files into a new temp file, and keep updating indexes
+	if err := hts.garbageCollectOldFilesDBMuLocked(); err != nil {
+		log.Errorf("compaction error: %v", err)
+		return
 	}
+	hts.compactions.Add(1)
+	hts.lastCompaction.Store(time.Now().UnixNano())
 }
 
-func (hts *HashTableStorage) deleteExpiredKeysFromIndex() error {
+func (hts *HashTableStorage) deleteExpiredKeysFromIndex() ([]string, error) {
 
+	var expiredKeys []string
 	hts.keyLocationIndex.Map(func(key string, metaData storagecommon.Meta) error {
 		record, err := hts.get(key)
 		if err != nil {
@@ -100,15 +160,22 @@ func (hts *HashTableStorage) deleteExpiredKeysFromIndex() error {
 		}
 
 		if record.IsExpired() {
-			err := hts.Delete(key)
-			if err != nil {
-				return fmt.Errorf("unable to delete expired record: %w", err)
-			}
+			expiredKeys = append(expiredKeys, key)
 		}
 		return nil
 	})
 
-	return nil
+	return hts.deleteKeysMuLocked(expiredKeys)
+}
+
+// deleteKeysMuLocked deletes expired keys, and returns those it deleted.
+func (hts *HashTableStorage) deleteKeysMuLocked(expiredKeys []string) ([]string, error) {
+	for i, key := range expiredKeys {
+		if err := hts.deleteMuLocked(key); err != nil {
+			return expiredKeys[:i], fmt.Errorf("unable to delete expired record: %w", err)
+		}
+	}
+	return expiredKeys, nil
 }
 
 func (hts *HashTableStorage) garbageCollectOldFilesDBMuLocked() error {
@@ -125,6 +192,7 @@ func (hts *HashTableStorage) garbageCollectOldFilesDBMuLocked() error {
 	if err := hts.keyLocationIndex.Flush(); err != nil {
 		return err
 	}
+	hts.checkpointed(hts.changes.Load())
 
 	// close all the old datafile files
 	// empty the old files map
@@ -157,6 +225,11 @@ func (hts *HashTableStorage) garbageCollectOldFilesDBMuLocked() error {
 }
 
 func (hts *HashTableStorage) cleanupOldFiles() error {
+	// the active file's records were merged too, so it is removed along with the old files
+	if err := hts.ActiveDataFile.Close(); err != nil {
+		log.Errorf("error closing active datafile file: %v", err)
+	}
+
 	for _, datafileFile := range hts.olddatafileFilesMap {
 		if err := datafileFile.Close(); err != nil {
 			log.Errorf("error closing datafile file: %v", err)
@@ -166,30 +239,23 @@ func (hts *HashTableStorage) cleanupOldFiles() error {
 
 	hts.olddatafileFilesMap = make(map[int]datafile.ReadOnlyWithRandomReads)
 
-	deleteExistingDBFiles := func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			return nil
-		}
-		if filepath.Base(path) == storagecommon.LOCKFILE {
-			return nil
+	// only look at the top-level directory: sub-directories hold
+	// other keyspaces (namespaces), whose files must be left alone
+	entries, err := os.ReadDir(hts.Cfg.Directory)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == storagecommon.LOCKFILE {
+			continue
 		}
 
-		if filepath.Ext(path) == HASHTABLE_DATAFILE_EXTENSION {
-			err = os.Remove(path)
-			if err != nil {
+		if filepath.Ext(entry.Name()) == HASHTABLE_DATAFILE_EXTENSION {
+			if err := os.Remove(filepath.Join(hts.Cfg.Directory, entry.Name())); err != nil {
 				return err
 			}
 		}
-
-		return nil
-	}
-
-	err := filepath.Walk(hts.Cfg.Directory, deleteExistingDBFiles)
-	if err != nil {
-		return err
 	}
 	return nil
 }
@@ -2,14 +2,12 @@ package hashtable
 
 import (
 	"errors"
-	"fmt"
-	"regexp"
 	"time"
 
+	"KeyValor/constants"
 	"KeyValor/dbops"
 	"KeyValor/internal/storage/storagecommon"
-	"KeyValor/internal/utils/dataconvutils"
-	"KeyValor/internal/utils/timeutils"
+	"KeyValor/internal/utils/globutils"
 )
 
 // Get retrieves the value associated with the given key from the key-value store.
@@ -30,6 +28,15 @@ func (hts *HashTableStorage) Get(key string) ([]byte, error) {
 	return hts.getAndValidateMuLocked(key)
 }
 
+// GetWithExpiry retrieves the value associated with the given key,
+// and the time at which it expires (zero if it doesn't expire).
+func (hts *HashTableStorage) GetWithExpiry(key string) ([]byte, time.Time, error) {
+	hts.RLock()
+	defer hts.RUnlock()
+
+	return hts.getWithExpiryMuLocked(key)
+}
+
 // MGet retrieves the values associated with the given keys from the key-value store.
 // It acquires a write lock on the database to ensure thread safety.
 //
@@ -99,7 +106,7 @@ func (hts *HashTableStorage) Set(key string, value []byte) error {
 		return errors.New("invalid key or value")
 	}
 
-	return hts.set(hts.ActiveDataFile, key, value, nil)
+	return hts.setValue(key, value, hts.defaultExpiry())
 }
 
 // Delete removes a key-value pair from the key-value store.
@@ -115,59 +122,59 @@ func (hts *HashTableStorage) Delete(key string) error {
 	hts.Lock()
 	defer hts.Unlock()
 
-	// write a tombstone to the database
-	if err := hts.set(hts.ActiveDataFile, key, []byte{}, nil); err != nil {
-		return err
-	}
-
-	// delete the value from in-memory index
-	hts.keyLocationIndex.Delete(key)
-	return nil
+	return hts.deleteMuLocked(key)
 }
 
 func (hts *HashTableStorage) AllKeys() ([]string, error) {
 	hts.RLock()
 	defer hts.RUnlock()
 
-	return keysMatchingRegex(hts.keyLocationIndex, "*")
+	return keysMatching(hts.keyLocationIndex, "*"), nil
 }
 
-func (hts *HashTableStorage) Keys(regex string) ([]string, error) {
+// Keys returns the keys matching a Redis glob-style pattern.
+func (hts *HashTableStorage) Keys(pattern string) ([]string, error) {
 	hts.RLock()
 	defer hts.RUnlock()
 
-	return keysMatchingRegex(hts.keyLocationIndex, regex)
+	return keysMatching(hts.keyLocationIndex, pattern), nil
 }
 
-func keysMatchingRegex(dbIndex storagecommon.DatabaseIndex, pattern string) ([]string, error) {
-	// Compile the regex pattern
-	var re *regexp.Regexp
-	var err error
-	if pattern != "*" {
-		re, err = regexp.Compile(pattern)
-		if err != nil {
-			return nil, fmt.Errorf("invalid regex pattern: %w", err)
+// Scan returns about count keys matching a Redis glob-style pattern, from cursor on,
+// and the cursor of the next keys (0 once the scan is complete).
+// It only holds the read lock while visiting those keys, not the whole index.
+func (hts *HashTableStorage) Scan(cursor uint64, pattern string, count int) ([]string, uint64, error) {
+	hts.RLock()
+	defer hts.RUnlock()
+
+	var keys []string
+	next := hts.keyLocationIndex.Scan(cursor, count, func(key string, metaData storagecommon.Meta) {
+		if pattern == "*" || globutils.Match(pattern, key) {
+			keys = append(keys, key)
 		}
-	}
+	})
+	return keys, next, nil
+}
 
+func keysMatching(dbIndex storagecommon.DatabaseIndex, pattern string) []string {
 	var matchingKeys []string
 
 	// Iterate over the map and add matching keys to the slice
 	dbIndex.Map(func(key string, metaData storagecommon.Meta) error {
-		if pattern == "*" || re.MatchString(key) {
+		if pattern == "*" || globutils.Match(pattern, key) {
 			matchingKeys = append(matchingKeys, key)
 		}
 		return nil
 	})
 
-	return matchingKeys, nil
+	return matchingKeys
 }
 
 func (hts *HashTableStorage) Expire(key string, expireTime *time.Time) error {
 	hts.Lock()
 	defer hts.Unlock()
 
-	record, err := hts.get(key)
+	record, err := hts.getLiveMuLocked(key)
 	if err != nil {
 		return err
 	}
@@ -181,18 +188,7 @@ func (hts *HashTableStorage) Incr(key string) error {
 	hts.Lock()
 	defer hts.Unlock()
 
-	value, err := hts.getAndValidateMuLocked(key)
-	if err != nil {
-		return err
-	}
-
-	intValue, err := dataconvutils.BytesToInt(value)
-	if err != nil {
-		return err
-	}
-
-	intValue++
-	return hts.Set(key, dataconvutils.IntToBytes(intValue))
+	return hts.incrByMuLocked(key, 1)
 }
 
 // Redis-compatible DECR command
@@ -200,18 +196,7 @@ func (hts *HashTableStorage) Decr(key string) error {
 	hts.Lock()
 	defer hts.Unlock()
 
-	value, err := hts.getAndValidateMuLocked(key)
-	if err != nil {
-		return err
-	}
-
-	intValue, err := dataconvutils.BytesToInt(value)
-	if err != nil {
-		return err
-	}
-
-	intValue--
-	return hts.Set(key, dataconvutils.IntToBytes(intValue))
+	return hts.incrByMuLocked(key, -1)
 }
 
 // Redis-compatible TTL command
@@ -219,21 +204,15 @@ func (hts *HashTableStorage) TTL(key string) (int64, error) {
 	hts.RLock()
 	defer hts.RUnlock()
 
-	record, err := hts.get(key)
-	if err != nil {
-		return -1, err
-	}
-
-	if record.Header.GetExpiry() == 0 {
-		return -1, nil
-	}
+	return hts.ttlMuLocked(key, time.Second)
+}
 
-	ttl := record.Header.GetExpiry() - timeutils.CurrentTimeNanos()
-	if ttl <= 0 {
-		return -1, nil
-	}
+// PTTL returns the remaining time to live of a key in milliseconds, -1 if it doesn't expire.
+func (hts *HashTableStorage) PTTL(key string) (int64, error) {
+	hts.RLock()
+	defer hts.RUnlock()
 
-	return ttl / int64(time.Second), nil
+	return hts.ttlMuLocked(key, time.Millisecond)
 }
 
 // Redis-compatible SETEX command
@@ -242,7 +221,22 @@ func (hts *HashTableStorage) SetEx(key string, value []byte, ttlSeconds int64) e
 	defer hts.Unlock()
 
 	expireTime := time.Now().Add(time.Duration(ttlSeconds) * time.Second)
-	return hts.set(hts.ActiveDataFile, key, value, &expireTime)
+	return hts.setValue(key, value, &expireTime)
+}
+
+// SetWithExpiry sets a key that expires at the given time (never, if expiry is zero).
+func (hts *HashTableStorage) SetWithExpiry(key string, value []byte, expiry time.Time) error {
+	hts.Lock()
+	defer hts.Unlock()
+
+	if err := validateEntry(key, value); err != nil {
+		return err
+	}
+
+	if expiry.IsZero() {
+		return hts.setValue(key, value, nil)
+	}
+	return hts.setValue(key, value, &expiry)
 }
 
 // Redis-compatible PERSIST command
@@ -250,7 +244,7 @@ func (hts *HashTableStorage) Persist(key string) error {
 	hts.Lock()
 	defer hts.Unlock()
 
-	record, err := hts.get(key)
+	record, err := hts.getLiveMuLocked(key)
 	if err != nil {
 		return err
 	}
@@ -258,3 +252,50 @@ func (hts *HashTableStorage) Persist(key string) error {
 	record.Header.SetExpiry(0)
 	return hts.set(hts.ActiveDataFile, key, record.Value, nil)
 }
+
+// Rename renames key to newKey, which is overwritten if it exists. The value keeps its expiry.
+func (hts *HashTableStorage) Rename(key, newKey string) error {
+	hts.Lock()
+	defer hts.Unlock()
+
+	record, err := hts.getLiveMuLocked(key)
+	if err != nil || key == newKey {
+		return err
+	}
+
+	if err := hts.set(hts.ActiveDataFile, newKey, record.Value, recordExpiry(record)); err != nil {
+		return err
+	}
+	return hts.deleteMuLocked(key)
+}
+
+// Copy copies the value of key, and its expiry, to destination. It returns false without
+// copying anything if destination exists, unless replace is set.
+func (hts *HashTableStorage) Copy(key, destination string, replace bool) (bool, error) {
+	hts.Lock()
+	defer hts.Unlock()
+
+	if key == destination {
+		return false, constants.ErrSameKey
+	}
+
+	record, err := hts.getLiveMuLocked(key)
+	if err != nil {
+		return false, err
+	}
+
+	if !replace {
+		_, err := hts.getLiveMuLocked(destination)
+		if err == nil {
+			return false, nil
+		}
+		if !storagecommon.IsMissingKey(err) {
+			return false, err
+		}
+	}
+
+	if err := hts.set(hts.ActiveDataFile, destination, record.Value, recordExpiry(record)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
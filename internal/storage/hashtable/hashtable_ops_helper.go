@@ -5,26 +5,74 @@ import (
 	"fmt"
 	"time"
 
+	"KeyValor/config"
 	"KeyValor/constants"
 	"KeyValor/internal/storage/datafile"
 	"KeyValor/internal/storage/storagecommon"
+	"KeyValor/internal/utils/timeutils"
 )
 
 func (hts *HashTableStorage) getAndValidateMuLocked(key string) ([]byte, error) {
-	record, err := hts.get(key)
+	record, err := hts.getLiveMuLocked(key)
 	if err != nil {
 		return nil, err
 	}
 
+	return hts.DecompressValue(record.Value)
+}
+
+// getLiveMuLocked returns the record of a key that isn't expired, and whose checksum is valid.
+// Its value is the stored one, compressed as configured.
+func (hts *HashTableStorage) getLiveMuLocked(key string) (storagecommon.DataRecord, error) {
+	record, err := hts.get(key)
+	if err != nil {
+		return record, err
+	}
+
 	if record.IsExpired() {
-		return nil, constants.ErrKeyIsExpired
+		return record, constants.ErrKeyIsExpired
 	}
 
 	if !record.IsChecksumValid() {
-		return nil, constants.ErrChecksumIsInvalid
+		return record, constants.ErrChecksumIsInvalid
+	}
+	return record, nil
+}
+
+func (hts *HashTableStorage) getWithExpiryMuLocked(key string) ([]byte, time.Time, error) {
+	record, err := hts.getLiveMuLocked(key)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	value, err := hts.DecompressValue(record.Value)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var expiry time.Time
+	if record.Header.GetExpiry() != 0 {
+		expiry = time.Unix(0, record.Header.GetExpiry())
+	}
+	return value, expiry, nil
+}
+
+// incrByMuLocked adds delta to the integer value of a key (0 if it is missing), keeping its expiry.
+func (hts *HashTableStorage) incrByMuLocked(key string, delta int64) error {
+	value, expiry, err := hts.getWithExpiryMuLocked(key)
+	if err != nil && !storagecommon.IsMissingKey(err) {
+		return err
 	}
 
-	return record.Value, nil
+	newValue, err := storagecommon.IncrBy(value, delta)
+	if err != nil {
+		return err
+	}
+
+	if expiry.IsZero() {
+		return hts.setValue(key, newValue, nil)
+	}
+	return hts.setValue(key, newValue, &expiry)
 }
 
 func (hts *HashTableStorage) get(key string) (storagecommon.DataRecord, error) {
@@ -63,7 +111,7 @@ func (hts *HashTableStorage) get(key string) (storagecommon.DataRecord, error) {
 }
 
 func (hts *HashTableStorage) getAppropriateFile(meta storagecommon.Meta) (datafile.ReadOnlyWithRandomReads, error) {
-	if meta.FileID == hts.ActiveDataFile.ID() {
+	if hts.ActiveDataFile != nil && meta.FileID == hts.ActiveDataFile.ID() {
 		return hts.ActiveDataFile, nil
 	}
 	file, ok := hts.olddatafileFilesMap[meta.FileID]
@@ -74,6 +122,62 @@ func (hts *HashTableStorage) getAppropriateFile(meta storagecommon.Meta) (datafi
 	return file, nil
 }
 
+// setValue compresses a user-supplied value (as configured) and appends it to the active file.
+func (hts *HashTableStorage) setValue(key string, value []byte, expiryTime *time.Time) error {
+	stored, err := hts.CompressValue(value)
+	if err != nil {
+		return err
+	}
+	return hts.set(hts.ActiveDataFile, key, stored, expiryTime)
+}
+
+// recordExpiry returns the expiry time of a record, nil if it doesn't expire.
+func recordExpiry(record storagecommon.DataRecord) *time.Time {
+	if record.Header.GetExpiry() == 0 {
+		return nil
+	}
+	expiry := time.Unix(0, record.Header.GetExpiry())
+	return &expiry
+}
+
+// ttlMuLocked returns the remaining time to live of a key, rounded to the nearest unit like
+// Redis does, or -1 if it doesn't expire.
+func (hts *HashTableStorage) ttlMuLocked(key string, unit time.Duration) (int64, error) {
+	record, err := hts.getLiveMuLocked(key)
+	if err != nil {
+		return -1, err
+	}
+
+	if record.Header.GetExpiry() == 0 {
+		return -1, nil
+	}
+
+	ttl := record.Header.GetExpiry() - timeutils.CurrentTimeNanos()
+	if ttl <= 0 {
+		return -1, constants.ErrKeyIsExpired
+	}
+	return (ttl + int64(unit/2)) / int64(unit), nil
+}
+
+// defaultExpiry returns the expiry for keys written without an explicit TTL.
+func (hts *HashTableStorage) defaultExpiry() *time.Time {
+	if hts.Cfg.DefaultTTL <= 0 {
+		return nil
+	}
+	expiryTime := time.Now().Add(hts.Cfg.DefaultTTL)
+	return &expiryTime
+}
+
+func (hts *HashTableStorage) deleteMuLocked(key string) error {
+	// write a tombstone to the database
+	if err := hts.set(hts.ActiveDataFile, key, []byte{}, nil); err != nil {
+		return err
+	}
+
+	// delete the value from in-memory index
+	return hts.keyLocationIndex.Delete(key)
+}
+
 func (hts *HashTableStorage) set(
 	file datafile.AppendOnlyFile,
 	key string,
@@ -111,12 +215,29 @@ func (hts *HashTableStorage) set(
 	if err != nil {
 		return err
 	}
+	if file == hts.ActiveDataFile && hts.Cfg.SyncPolicy == config.SyncAlways {
+		if err := file.Sync(); err != nil {
+			return err
+		}
+	}
+
+	if previous, err := hts.keyLocationIndex.Get(key); err == nil && previous.Expiry != 0 {
+		hts.expiring--
+	}
+	if expiryTime != nil {
+		hts.expiring++
+	}
+	// the compaction also writes records, into the file it merges the others into
+	if file == hts.ActiveDataFile {
+		hts.changes.Add(1)
+	}
 
 	hts.keyLocationIndex.Put(key, storagecommon.Meta{
 		Timestamp:    record.Header.GetTs(),
 		FileID:       file.ID(),
 		RecordOffset: recordStartOffset,
 		RecordSize:   len(buf.Bytes()),
+		Expiry:       record.Header.GetExpiry(),
 	})
 	return nil
 }
@@ -16,12 +16,16 @@ import (
 type CheckpointIndex struct {
 	hashMap       map[string]storagecommon.Meta
 	indexFilePath string
+
+	// the keys of hashMap again, for SCAN
+	scanTable *scanTable
 }
 
 func NewCheckpointIndex(indexFilePath string) *CheckpointIndex {
 	return &CheckpointIndex{
 		hashMap:       make(map[string]storagecommon.Meta),
 		indexFilePath: indexFilePath,
+		scanTable:     newScanTable(),
 	}
 }
 
@@ -44,6 +48,11 @@ func (ci *CheckpointIndex) Open() error {
 	if err := decoder.Decode(&ci.hashMap); err != nil {
 		return fmt.Errorf("error decoding index file: %w", err)
 	}
+
+	ci.scanTable = newScanTable()
+	for key := range ci.hashMap {
+		ci.scanTable.add(key)
+	}
 	return nil
 }
 
@@ -78,15 +87,26 @@ func (ci *CheckpointIndex) Get(key string) (storagecommon.Meta, error) {
 }
 
 func (ci *CheckpointIndex) Put(key string, metaData storagecommon.Meta) error {
+	if _, exists := ci.hashMap[key]; !exists {
+		ci.scanTable.add(key)
+	}
 	ci.hashMap[key] = metaData
 	return nil
 }
 
 func (ci *CheckpointIndex) Delete(key string) error {
+	if _, exists := ci.hashMap[key]; exists {
+		ci.scanTable.remove(key)
+	}
 	delete(ci.hashMap, key)
 	return nil
 }
 
+// Len returns the number of keys in the index.
+func (ci *CheckpointIndex) Len() int {
+	return len(ci.hashMap)
+}
+
 func (ci *CheckpointIndex) Map(f func(key string, metaData storagecommon.Meta) error) {
 	for key, value := range ci.hashMap {
 		if err := f(key, value); err != nil {
@@ -94,3 +114,11 @@ func (ci *CheckpointIndex) Map(f func(key string, metaData storagecommon.Meta) e
 		}
 	}
 }
+
+// Scan calls f for about count keys from cursor on, and returns the cursor of the next keys
+// (0 once every key was visited). A key present during a whole scan is visited exactly once.
+func (ci *CheckpointIndex) Scan(cursor uint64, count int, f func(key string, metaData storagecommon.Meta)) uint64 {
+	return ci.scanTable.scan(cursor, count, func(key string) {
+		f(key, ci.hashMap[key])
+	})
+}
@@ -0,0 +1,109 @@
+package hashtable
+
+import (
+	"hash/maphash"
+	"math/bits"
+)
+
+const (
+	minScanTableSize = 16
+	// maximum average number of keys per bucket, before the table doubles
+	maxScanTableLoad = 4
+	// SCAN visits at most this many empty buckets per requested key, like Redis
+	emptyBucketsPerKey = 10
+)
+
+// scanTable is a second view of the keys of the index, hashed into 2^n buckets, that can be
+// iterated incrementally with a stable cursor, like Redis' SCAN:
+//
+//   - the cursor is the next bucket to visit, incremented on its reversed bits,
+//     so that the buckets already visited stay visited when the table doubles;
+//   - a key that is in the table during a whole scan is returned exactly once (the table only
+//     grows, which never causes duplicates), and a key added or deleted during a scan
+//     may or may not be returned.
+//
+// The table isn't persisted: the cursors are only valid until the process restarts.
+type scanTable struct {
+	seed    maphash.Seed
+	buckets [][]string
+	size    int
+}
+
+func newScanTable() *scanTable {
+	return &scanTable{
+		seed:    maphash.MakeSeed(),
+		buckets: make([][]string, minScanTableSize),
+	}
+}
+
+func (st *scanTable) mask() uint64 {
+	return uint64(len(st.buckets) - 1)
+}
+
+func (st *scanTable) bucket(key string) uint64 {
+	return maphash.String(st.seed, key) & st.mask()
+}
+
+// add adds a key that isn't in the table yet.
+func (st *scanTable) add(key string) {
+	if st.size >= maxScanTableLoad*len(st.buckets) {
+		st.grow()
+	}
+
+	b := st.bucket(key)
+	st.buckets[b] = append(st.buckets[b], key)
+	st.size++
+}
+
+// remove removes a key, if it is in the table.
+func (st *scanTable) remove(key string) {
+	b := st.bucket(key)
+	bucket := st.buckets[b]
+	for i, k := range bucket {
+		if k == key {
+			bucket[i] = bucket[len(bucket)-1]
+			st.buckets[b] = bucket[:len(bucket)-1]
+			st.size--
+			return
+		}
+	}
+}
+
+func (st *scanTable) grow() {
+	old := st.buckets
+	st.buckets = make([][]string, 2*len(old))
+	for _, bucket := range old {
+		for _, key := range bucket {
+			b := st.bucket(key)
+			st.buckets[b] = append(st.buckets[b], key)
+		}
+	}
+}
+
+// scan calls f for the keys of the buckets from cursor on, until about count keys were
+// visited, and returns the cursor to continue from (0 once every bucket was visited).
+func (st *scanTable) scan(cursor uint64, count int, f func(key string)) uint64 {
+	mask := st.mask()
+	visited := 0
+	emptyBudget := count * emptyBucketsPerKey
+
+	for {
+		bucket := st.buckets[cursor&mask]
+		for _, key := range bucket {
+			f(key)
+		}
+		visited += len(bucket)
+		if len(bucket) == 0 {
+			emptyBudget--
+		}
+
+		// increment the reversed cursor: set the bits above the mask, so that the
+		// increment carries over into the bits of the mask, from the highest one
+		cursor |= ^mask
+		cursor = bits.Reverse64(bits.Reverse64(cursor) + 1)
+
+		if cursor == 0 || visited >= count || emptyBudget <= 0 {
+			return cursor
+		}
+	}
+}
@@ -11,12 +11,12 @@ import (
 
 	"github.com/emirpasic/gods/utils"
 
-	"KeyValor/config"
 	"KeyValor/internal/records"
 	"KeyValor/internal/sstable"
 	"KeyValor/internal/storage/datafile"
 	"KeyValor/internal/storage/storagecommon"
 	"KeyValor/internal/treemapgen"
+	"KeyValor/internal/utils/cmputils"
 	"KeyValor/log"
 )
 
@@ -32,15 +32,10 @@ type LSMTreeStorage struct {
 	ssTables []*sstable.SSTable
 }
 
-func NewLSMTreeStorage(cfg *config.DBCfgOpts) (*LSMTreeStorage, error) {
+func NewLSMTreeStorage(cs *storagecommon.CommonStorage) (*LSMTreeStorage, error) {
 
-	memTable := treemapgen.NewSerializableTreeMap[string, *records.CommandRecord](utils.StringComparator)
-
-	// create cs with nil WAL file for now
-	cs, err := storagecommon.NewCommonStorage(cfg)
-	if err != nil {
-		return nil, fmt.Errorf("error creating common storage: %w", err)
-	}
+	cfg := cs.Cfg
+	memTable := treemapgen.NewSerializableTreeMap[string, *records.CommandRecord](cmputils.BytewiseComparator)
 
 	lsmTree := &LSMTreeStorage{
 		CommonStorage: cs,
@@ -61,28 +56,21 @@ func NewLSMTreeStorage(cfg *config.DBCfgOpts) (*LSMTreeStorage, error) {
 		return nil, err
 	}
 
-	if len(files) == 0 {
-		// we have an empty directory
+	// load existing files from the directory
+	if err := lsmTree.processExistingFiles(files); err != nil {
+		return nil, err
+	}
+
+	// in read-only mode the WAL is only replayed, never appended to
+	if !cfg.ReadOnly {
 		currentWalFilePath := filepath.Join(cfg.Directory, CURRENT_WAL_FILE_NAME)
 		lsmTree.ActiveWALFile, err = datafile.NewAppendOnlyDataFileWithPath(currentWalFilePath)
 		if err != nil {
 			return nil, err
 		}
-	} else {
-		// load existing files from the directory
-		lsmTree.processExistingFiles(files)
 	}
 
-	return &LSMTreeStorage{
-		CommonStorage: cs,
-		bufferPool: sync.Pool{
-			New: func() interface{} {
-				return make([]byte, 0, 1024)
-			},
-		},
-		activeMemTable:        memTable,
-		prevMemTableImmutable: nil,
-	}, nil
+	return lsmTree, nil
 }
 
 func (lsmt *LSMTreeStorage) processExistingFiles(files []fs.DirEntry) error {
@@ -91,7 +79,8 @@ func (lsmt *LSMTreeStorage) processExistingFiles(files []fs.DirEntry) error {
 
 	for _, dirEntry := range files {
 		if dirEntry.IsDir() {
-			log.Errorf("found a directory, skipping: %s\n", dirEntry.Name())
+			// sub-directories hold other keyspaces (namespaces)
+			log.Debugf("found a directory, skipping: %s\n", dirEntry.Name())
 			continue
 		}
 
@@ -124,15 +113,11 @@ func (lsmt *LSMTreeStorage) processFile(
 			return err
 		}
 	} else if fileName == CURRENT_WAL_FILE_NAME {
-		// load the treemap from the WAL file
+		// load the treemap from the WAL file (it's re-opened for appends by the caller)
 		err := lsmt.restoreMemtableFromWalFile(filePath)
 		if err != nil {
 			return err
 		}
-		lsmt.ActiveWALFile, err = datafile.NewAppendOnlyDataFileWithPath(filePath)
-		if err != nil {
-			return err
-		}
 	} else if filepath.Ext(filePath) == SSTABLE_FILE_EXTENSION {
 		// it's an SST file (SSTable)
 		fileNumber := strings.TrimPrefix(strings.TrimSuffix(filepath.Base(filePath), SSTABLE_FILE_EXTENSION), SSTABLE_FILE_PREFIX)
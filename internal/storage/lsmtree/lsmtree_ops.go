@@ -6,8 +6,7 @@ import (
 
 	"KeyValor/constants"
 	"KeyValor/dbops"
-	"KeyValor/internal/utils/dataconvutils"
-	"KeyValor/internal/utils/timeutils"
+	"KeyValor/internal/storage/storagecommon"
 )
 
 // Get retrieves the value associated with the given key from the key-value store.
@@ -28,6 +27,15 @@ func (lts *LSMTreeStorage) Get(key string) ([]byte, error) {
 	return lts.getAndValidateMuLocked(key)
 }
 
+// GetWithExpiry retrieves the value associated with the given key,
+// and the time at which it expires (zero if it doesn't expire).
+func (lts *LSMTreeStorage) GetWithExpiry(key string) ([]byte, time.Time, error) {
+	lts.RLock()
+	defer lts.RUnlock()
+
+	return lts.getWithExpiryMuLocked(key)
+}
+
 // MGet retrieves the values associated with the given keys from the key-value store.
 // It acquires a write lock on the database to ensure thread safety.
 //
@@ -120,19 +128,25 @@ func (lts *LSMTreeStorage) Delete(key string) error {
 	return nil
 }
 
+// AllKeys, Keys and Scan return constants.ErrNotSupported: the keys of the SSTables can't be
+// iterated yet, since their records are only read through the sparse index of Query.
 func (lts *LSMTreeStorage) AllKeys() ([]string, error) {
-	panic(constants.NotImplemented)
+	return nil, constants.ErrNotSupported
 }
 
-func (lts *LSMTreeStorage) Keys(regex string) ([]string, error) {
-	panic(constants.NotImplemented)
+func (lts *LSMTreeStorage) Keys(pattern string) ([]string, error) {
+	return nil, constants.ErrNotSupported
+}
+
+func (lts *LSMTreeStorage) Scan(cursor uint64, pattern string, count int) ([]string, uint64, error) {
+	return nil, 0, constants.ErrNotSupported
 }
 
 func (lts *LSMTreeStorage) Expire(key string, expireTime *time.Time) error {
 	lts.Lock()
 	defer lts.Unlock()
 
-	record, err := lts.get(key)
+	record, err := lts.getLiveMuLocked(key)
 	if err != nil {
 		return err
 	}
@@ -146,18 +160,7 @@ func (lts *LSMTreeStorage) Incr(key string) error {
 	lts.Lock()
 	defer lts.Unlock()
 
-	value, err := lts.getAndValidateMuLocked(key)
-	if err != nil {
-		return err
-	}
-
-	intValue, err := dataconvutils.BytesToInt(value)
-	if err != nil {
-		return err
-	}
-
-	intValue++
-	return lts.Set(key, dataconvutils.IntToBytes(intValue))
+	return lts.incrByMuLocked(key, 1)
 }
 
 // Redis-compatible DECR command
@@ -165,18 +168,7 @@ func (lts *LSMTreeStorage) Decr(key string) error {
 	lts.Lock()
 	defer lts.Unlock()
 
-	value, err := lts.getAndValidateMuLocked(key)
-	if err != nil {
-		return err
-	}
-
-	intValue, err := dataconvutils.BytesToInt(value)
-	if err != nil {
-		return err
-	}
-
-	intValue--
-	return lts.Set(key, dataconvutils.IntToBytes(intValue))
+	return lts.incrByMuLocked(key, -1)
 }
 
 // Redis-compatible TTL command
@@ -184,21 +176,15 @@ func (lts *LSMTreeStorage) TTL(key string) (int64, error) {
 	lts.RLock()
 	defer lts.RUnlock()
 
-	record, err := lts.get(key)
-	if err != nil {
-		return -1, err
-	}
-
-	if record.Header.GetExpiry() == 0 {
-		return -1, nil
-	}
+	return lts.ttlMuLocked(key, time.Second)
+}
 
-	ttl := record.Header.GetExpiry() - timeutils.CurrentTimeNanos()
-	if ttl <= 0 {
-		return -1, nil
-	}
+// PTTL returns the remaining time to live of a key in milliseconds, -1 if it doesn't expire.
+func (lts *LSMTreeStorage) PTTL(key string) (int64, error) {
+	lts.RLock()
+	defer lts.RUnlock()
 
-	return ttl / int64(time.Second), nil
+	return lts.ttlMuLocked(key, time.Millisecond)
 }
 
 // Redis-compatible SETEX command
@@ -210,12 +196,27 @@ func (lts *LSMTreeStorage) SetEx(key string, value []byte, ttlSeconds int64) err
 	return lts.set(lts.ActiveWALFile, key, value, &expireTime)
 }
 
+// SetWithExpiry sets a key that expires at the given time (never, if expiry is zero).
+func (lts *LSMTreeStorage) SetWithExpiry(key string, value []byte, expiry time.Time) error {
+	lts.Lock()
+	defer lts.Unlock()
+
+	if err := validateEntry(key, value); err != nil {
+		return err
+	}
+
+	if expiry.IsZero() {
+		return lts.set(lts.ActiveWALFile, key, value, nil)
+	}
+	return lts.set(lts.ActiveWALFile, key, value, &expiry)
+}
+
 // Redis-compatible PERSIST command
 func (lts *LSMTreeStorage) Persist(key string) error {
 	lts.Lock()
 	defer lts.Unlock()
 
-	record, err := lts.get(key)
+	record, err := lts.getLiveMuLocked(key)
 	if err != nil {
 		return err
 	}
@@ -223,3 +224,50 @@ func (lts *LSMTreeStorage) Persist(key string) error {
 	record.Header.SetExpiry(0)
 	return lts.set(lts.ActiveWALFile, key, record.Value, nil)
 }
+
+// Rename renames key to newKey, which is overwritten if it exists. The value keeps its expiry.
+func (lts *LSMTreeStorage) Rename(key, newKey string) error {
+	lts.Lock()
+	defer lts.Unlock()
+
+	record, err := lts.getLiveMuLocked(key)
+	if err != nil || key == newKey {
+		return err
+	}
+
+	if err := lts.set(lts.ActiveWALFile, newKey, record.Value, recordExpiry(record)); err != nil {
+		return err
+	}
+	return lts.del(lts.ActiveWALFile, key)
+}
+
+// Copy copies the value of key, and its expiry, to destination. It returns false without
+// copying anything if destination exists, unless replace is set.
+func (lts *LSMTreeStorage) Copy(key, destination string, replace bool) (bool, error) {
+	lts.Lock()
+	defer lts.Unlock()
+
+	if key == destination {
+		return false, constants.ErrSameKey
+	}
+
+	record, err := lts.getLiveMuLocked(key)
+	if err != nil {
+		return false, err
+	}
+
+	if !replace {
+		_, err := lts.getLiveMuLocked(destination)
+		if err == nil {
+			return false, nil
+		}
+		if !storagecommon.IsMissingKey(err) {
+			return false, err
+		}
+	}
+
+	if err := lts.set(lts.ActiveWALFile, destination, record.Value, recordExpiry(record)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
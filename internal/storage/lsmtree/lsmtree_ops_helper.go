@@ -8,32 +8,104 @@ import (
 	"path/filepath"
 	"time"
 
-	"github.com/emirpasic/gods/utils"
-
 	"KeyValor/constants"
 	"KeyValor/internal/records"
 	"KeyValor/internal/sstable"
 	"KeyValor/internal/storage/datafile"
 	"KeyValor/internal/storage/storagecommon"
 	"KeyValor/internal/treemapgen"
+	"KeyValor/internal/utils/cmputils"
 	"KeyValor/internal/utils/fileutils"
+	"KeyValor/internal/utils/timeutils"
 )
 
 func (lts *LSMTreeStorage) getAndValidateMuLocked(key string) ([]byte, error) {
-	record, err := lts.get(key)
+	record, err := lts.getLiveMuLocked(key)
 	if err != nil {
 		return nil, err
 	}
 
+	return record.Value, nil
+}
+
+// getLiveMuLocked returns the record of a key that isn't expired, and whose checksum is valid.
+func (lts *LSMTreeStorage) getLiveMuLocked(key string) (storagecommon.DataRecord, error) {
+	record, err := lts.get(key)
+	if err != nil {
+		return record, err
+	}
+
 	if record.IsExpired() {
-		return nil, constants.ErrKeyIsExpired
+		return record, constants.ErrKeyIsExpired
 	}
 
 	if !record.IsChecksumValid() {
-		return nil, constants.ErrChecksumIsInvalid
+		return record, constants.ErrChecksumIsInvalid
+	}
+	return record, nil
+}
+
+// recordExpiry returns the expiry time of a record, nil if it doesn't expire.
+func recordExpiry(record storagecommon.DataRecord) *time.Time {
+	if record.Header.GetExpiry() == 0 {
+		return nil
 	}
+	expiry := time.Unix(0, record.Header.GetExpiry())
+	return &expiry
+}
 
-	return record.Value, nil
+// ttlMuLocked returns the remaining time to live of a key, rounded to the nearest unit like
+// Redis does, or -1 if it doesn't expire.
+func (lts *LSMTreeStorage) ttlMuLocked(key string, unit time.Duration) (int64, error) {
+	record, err := lts.getLiveMuLocked(key)
+	if err != nil {
+		return -1, err
+	}
+
+	if record.Header.GetExpiry() == 0 {
+		return -1, nil
+	}
+
+	ttl := record.Header.GetExpiry() - timeutils.CurrentTimeNanos()
+	if ttl <= 0 {
+		return -1, constants.ErrKeyIsExpired
+	}
+	return (ttl + int64(unit/2)) / int64(unit), nil
+}
+
+func (lts *LSMTreeStorage) getWithExpiryMuLocked(key string) ([]byte, time.Time, error) {
+	record, err := lts.get(key)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if record.IsExpired() {
+		return nil, time.Time{}, constants.ErrKeyIsExpired
+	}
+
+	var expiry time.Time
+	if record.Header.GetExpiry() != 0 {
+		expiry = time.Unix(0, record.Header.GetExpiry())
+	}
+	return record.Value, expiry, nil
+}
+
+// incrByMuLocked adds delta to the integer value of a key (0 if it is missing), keeping its expiry.
+func (lts *LSMTreeStorage) incrByMuLocked(key string, delta int64) error {
+	value, expiry, err := lts.getWithExpiryMuLocked(key)
+	if err != nil && !storagecommon.IsMissingKey(err) {
+		return err
+	}
+
+	newValue, err := storagecommon.IncrBy(value, delta)
+	if err != nil {
+		return err
+	}
+
+	if expiry.IsZero() {
+		return lts.set(lts.ActiveWALFile, key, newValue, nil)
+	}
+	return lts.set(lts.ActiveWALFile, key, newValue, &expiry)
 }
 
 func (lts *LSMTreeStorage) get(key string) (storagecommon.DataRecord, error) {
@@ -172,7 +244,7 @@ func (lts *LSMTreeStorage) rotateMemTableIndex() error {
 	defer lts.Unlock()
 
 	lts.prevMemTableImmutable = lts.activeMemTable
-	lts.activeMemTable = treemapgen.NewSerializableTreeMap[string, *records.CommandRecord](utils.StringComparator)
+	lts.activeMemTable = treemapgen.NewSerializableTreeMap[string, *records.CommandRecord](cmputils.BytewiseComparator)
 
 	lts.ActiveWALFile.Close()
 
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"time"
+
+	"KeyValor/config"
+	"KeyValor/constants"
+)
+
+// readOnlyStorage wraps a DiskStorage opened in read-only mode,
+// and rejects every write operation with constants.ErrReadOnly.
+type readOnlyStorage struct {
+	DiskStorage
+}
+
+// NewReadOnlyStorage returns a DiskStorage that serves the reads of s, and rejects its writes.
+func NewReadOnlyStorage(s DiskStorage) DiskStorage {
+	return &readOnlyStorage{DiskStorage: s}
+}
+
+func (ros *readOnlyStorage) Set(key string, value []byte) error {
+	return constants.ErrReadOnly
+}
+
+func (ros *readOnlyStorage) Delete(key string) error {
+	return constants.ErrReadOnly
+}
+
+func (ros *readOnlyStorage) SetEx(key string, value []byte, ttlSeconds int64) error {
+	return constants.ErrReadOnly
+}
+
+func (ros *readOnlyStorage) SetWithExpiry(key string, value []byte, expiry time.Time) error {
+	return constants.ErrReadOnly
+}
+
+func (ros *readOnlyStorage) Expire(key string, expireTime *time.Time) error {
+	return constants.ErrReadOnly
+}
+
+func (ros *readOnlyStorage) Persist(key string) error {
+	return constants.ErrReadOnly
+}
+
+func (ros *readOnlyStorage) Incr(key string) error {
+	return constants.ErrReadOnly
+}
+
+func (ros *readOnlyStorage) Decr(key string) error {
+	return constants.ErrReadOnly
+}
+
+func (ros *readOnlyStorage) Rename(key, newKey string) error {
+	return constants.ErrReadOnly
+}
+
+func (ros *readOnlyStorage) Copy(key, destination string, replace bool) (bool, error) {
+	return false, constants.ErrReadOnly
+}
+
+func (ros *readOnlyStorage) Checkpoint() error {
+	return constants.ErrReadOnly
+}
+
+func (ros *readOnlyStorage) Clear() error {
+	return constants.ErrReadOnly
+}
+
+func (ros *readOnlyStorage) Reconfigure(cfg *config.DBCfgOpts) error {
+	return constants.ErrReadOnly
+}
@@ -1,11 +1,25 @@
 package storage
 
 import (
+	"KeyValor/config"
 	"KeyValor/dbops"
+	"KeyValor/internal/storage/storagecommon"
 )
 
 type DiskStorage interface {
 	Init() error
 	Close() error
+	// CloseWithoutCheckpoint closes the storage without persisting its index, which then
+	// reopens as of the last checkpoint
+	CloseWithoutCheckpoint() error
 	dbops.DatabaseOperations
+
+	// Stats returns the statistics of the storage
+	Stats() storagecommon.EngineStats
+	// Checkpoint persists what was written so far
+	Checkpoint() error
+	// Clear deletes every key
+	Clear() error
+	// Reconfigure applies the options of cfg that can change while the storage runs
+	Reconfigure(cfg *config.DBCfgOpts) error
 }
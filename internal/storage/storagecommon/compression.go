@@ -0,0 +1,60 @@
+package storagecommon
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"sync"
+
+	"KeyValor/config"
+)
+
+var flateWriterPool = sync.Pool{
+	New: func() interface{} {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	},
+}
+
+// CompressValue encodes a value with the configured codec before it is written to disk.
+func (cs *CommonStorage) CompressValue(value []byte) ([]byte, error) {
+	switch cs.Cfg.Compression {
+	case config.CompressionNone:
+		return value, nil
+	case config.CompressionFlate:
+		var buf bytes.Buffer
+		w := flateWriterPool.Get().(*flate.Writer)
+		defer flateWriterPool.Put(w)
+
+		w.Reset(&buf)
+		if _, err := w.Write(value); err != nil {
+			return nil, fmt.Errorf("error compressing value: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("error compressing value: %w", err)
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", cs.Cfg.Compression)
+	}
+}
+
+// DecompressValue decodes a value read from disk with the configured codec.
+func (cs *CommonStorage) DecompressValue(stored []byte) ([]byte, error) {
+	switch cs.Cfg.Compression {
+	case config.CompressionNone:
+		return stored, nil
+	case config.CompressionFlate:
+		r := flate.NewReader(bytes.NewReader(stored))
+		defer r.Close()
+
+		value, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing value: %w", err)
+		}
+		return value, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", cs.Cfg.Compression)
+	}
+}
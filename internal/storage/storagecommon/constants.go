@@ -3,4 +3,7 @@ package storagecommon
 // common constants
 const (
 	LOCKFILE = "store.lock"
+	// READERS_LOCKFILE is share-locked by read-only processes, and
+	// exclusively locked by the writer while it swaps data files
+	READERS_LOCKFILE = "store.readers.lock"
 )
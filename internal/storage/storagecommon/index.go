@@ -4,7 +4,9 @@ type DatabaseIndex interface {
 	Get(key string) (Meta, error)
 	Put(key string, metaData Meta) error
 	Delete(key string) error
+	Len() int
 	Map(f func(key string, metaData Meta) error)
+	Scan(cursor uint64, count int, f func(key string, metaData Meta)) uint64
 	Open() error
 	Flush() error
 	FlushSnapshot(snapshot map[string]Meta) error
@@ -1,10 +1,13 @@
 package storagecommon
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"golang.org/x/sys/unix"
+
+	"KeyValor/constants"
 )
 
 // createLockFile creates a lock file at the specified path and acquires an exclusive lock on it.
@@ -23,6 +26,7 @@ func AcquireLockFile(lockFilePath string) (*os.File, error) {
 	}
 
 	if err := unix.Flock(int(lockFile.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		lockFile.Close()
 		return nil, fmt.Errorf("error acquiring lock on file (%s) error: %w", lockFilePath, err)
 	}
 	return lockFile, nil
@@ -45,3 +49,67 @@ func FreeLockFile(lockFile *os.File) error {
 	}
 	return nil
 }
+
+// CreateSharedLockFile creates the lock file at the given path if it doesn't exist yet, for
+// AcquireSharedLockFile, which doesn't create it.
+func CreateSharedLockFile(lockFilePath string) error {
+	lockFile, err := os.OpenFile(lockFilePath, os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("error creating lockfile (%s) error: %w", lockFilePath, err)
+	}
+	return lockFile.Close()
+}
+
+// AcquireSharedLockFile opens the existing lock file at the given path, and acquires a shared
+// lock on it. Unlike AcquireLockFile, many processes can hold it. The file isn't created,
+// so that read-only processes can lock read-only directories: the error wraps
+// fs.ErrNotExist if it is missing.
+func AcquireSharedLockFile(lockFilePath string) (*os.File, error) {
+	lockFile, err := os.Open(lockFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lockfile (%s) error: %w", lockFilePath, err)
+	}
+
+	if err := unix.Flock(int(lockFile.Fd()), unix.LOCK_SH|unix.LOCK_NB); err != nil {
+		lockFile.Close()
+		if errors.Is(err, unix.EWOULDBLOCK) {
+			return nil, fmt.Errorf("error acquiring shared lock on file (%s) error: %w", lockFilePath, constants.ErrStoreIsBusy)
+		}
+		return nil, fmt.Errorf("error acquiring shared lock on file (%s) error: %w", lockFilePath, err)
+	}
+	return lockFile, nil
+}
+
+// FreeSharedLockFile releases a lock taken with AcquireSharedLockFile.
+// The file itself is left in place, as other processes may hold it.
+func FreeSharedLockFile(lockFile *os.File) error {
+	if err := unix.Flock(int(lockFile.Fd()), unix.LOCK_UN); err != nil {
+		return fmt.Errorf("error unlocking lock file, error: %w", err)
+	}
+	if err := lockFile.Close(); err != nil {
+		return fmt.Errorf("error closing lock file, error: %w", err)
+	}
+	return nil
+}
+
+// TryExclusiveLock tries to acquire an exclusive lock on the lock file at the given path,
+// without blocking. It returns constants.ErrStoreIsBusy if another process holds a lock on it.
+func TryExclusiveLock(lockFilePath string) (release func(), err error) {
+	lockFile, err := os.OpenFile(lockFilePath, os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lockfile (%s) error: %w", lockFilePath, err)
+	}
+
+	if err := unix.Flock(int(lockFile.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		lockFile.Close()
+		if errors.Is(err, unix.EWOULDBLOCK) {
+			return nil, constants.ErrStoreIsBusy
+		}
+		return nil, fmt.Errorf("error acquiring lock on file (%s) error: %w", lockFilePath, err)
+	}
+
+	return func() {
+		unix.Flock(int(lockFile.Fd()), unix.LOCK_UN)
+		lockFile.Close()
+	}, nil
+}
@@ -7,4 +7,8 @@ type Meta struct {
 	FileID       int
 	RecordOffset int64
 	RecordSize   int
+
+	// Expiry of the record, in Unix nanoseconds (0 if it doesn't expire, or if the index
+	// entry was written before expiries were kept in the index)
+	Expiry int64
 }
@@ -0,0 +1,24 @@
+package storagecommon
+
+import "time"
+
+// EngineStats are the statistics of a storage engine, for monitoring.
+type EngineStats struct {
+	// Keys is the number of keys in the index, including the expired keys that the
+	// compaction didn't delete yet; KeysWithExpiry is how many of them have an expiry
+	Keys           int
+	KeysWithExpiry int
+
+	// DataFiles is the number of data files, and DiskBytes the size of the data files and index
+	DataFiles int
+	DiskBytes int64
+
+	// ChangesSinceCheckpoint is the number of writes since the index was last persisted
+	ChangesSinceCheckpoint int64
+	LastCheckpoint         time.Time
+	Checkpoints            int64
+
+	LastCompaction time.Time
+	Compactions    int64
+	FileRotations  int64
+}
@@ -2,38 +2,138 @@ package storagecommon
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sync"
 
 	"KeyValor/config"
+	"KeyValor/constants"
+	"KeyValor/internal/scheduler"
+	"KeyValor/internal/utils/fileutils"
 )
 
 type CommonStorage struct {
 	sync.RWMutex
 	Cfg        *config.DBCfgOpts
 	LockFile   *os.File
+	Scheduler  *scheduler.Scheduler
 	BufferPool sync.Pool // crate an object pool to reuse buffers
+
+	// ownsLock is false for storages derived with NewChild, which share
+	// the lock file and scheduler of the storage that created them
+	ownsLock bool
+	// readersLockPath is the READERS_LOCKFILE of the (root) data directory
+	readersLockPath string
 }
 
 func NewCommonStorage(
 	cfg *config.DBCfgOpts,
 ) (*CommonStorage, error) {
 
-	lockFilePath := filepath.Join(cfg.Directory, LOCKFILE)
-	lockFile, err := AcquireLockFile(lockFilePath)
+	readersLockPath := filepath.Join(cfg.Directory, READERS_LOCKFILE)
+
+	var (
+		lockFile *os.File
+		err      error
+	)
+
+	switch cfg.LockMode {
+	case config.LockExclusive:
+		if cfg.ReadOnly {
+			return nil, fmt.Errorf("%w: read-only mode can't take an exclusive lock", constants.ErrInvalidLockMode)
+		}
+		lockFile, err = AcquireLockFile(filepath.Join(cfg.Directory, LOCKFILE))
+		// the readers can't create the file they lock in a read-only directory
+		if err == nil {
+			if err = CreateSharedLockFile(readersLockPath); err != nil {
+				FreeLockFile(lockFile)
+			}
+		}
+	case config.LockShared:
+		if !cfg.ReadOnly {
+			return nil, fmt.Errorf("%w: only read-only mode can take a shared lock", constants.ErrInvalidLockMode)
+		}
+		lockFile, err = AcquireSharedLockFile(readersLockPath)
+		// a directory without the file and without a writer, like a checkpoint (a copy of a
+		// data directory), needs no lock
+		if errors.Is(err, fs.ErrNotExist) && !fileutils.FileExists(filepath.Join(cfg.Directory, LOCKFILE)) {
+			err = nil
+		}
+	case config.LockNone:
+		if !cfg.ReadOnly {
+			return nil, fmt.Errorf("%w: only read-only mode can run without a lock", constants.ErrInvalidLockMode)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", constants.ErrInvalidLockMode, cfg.LockMode)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error creating lockfile: %w", err)
 	}
 
 	return &CommonStorage{
-		Cfg:      cfg,
-		LockFile: lockFile,
-		BufferPool: sync.Pool{
-			New: func() interface{} {
-				return bytes.NewBuffer([]byte{})
-			},
-		},
+		Cfg:             cfg,
+		LockFile:        lockFile,
+		Scheduler:       scheduler.New(),
+		BufferPool:      newBufferPool(),
+		ownsLock:        true,
+		readersLockPath: readersLockPath,
 	}, nil
 }
+
+// NewChild creates a CommonStorage for a storage engine living in a
+// sub-directory of cs (e.g. a namespace). The child has its own
+// configuration and mutex, but shares the lock file and the background
+// scheduler of cs, so they are not released when the child is closed.
+func (cs *CommonStorage) NewChild(cfg *config.DBCfgOpts) *CommonStorage {
+	return &CommonStorage{
+		Cfg:             cfg,
+		LockFile:        cs.LockFile,
+		Scheduler:       cs.Scheduler,
+		BufferPool:      newBufferPool(),
+		ownsLock:        false,
+		readersLockPath: cs.readersLockPath,
+	}
+}
+
+// ExcludeReaders keeps read-only processes (LockShared) from opening the data
+// directory, until release is called. It returns constants.ErrStoreIsBusy if
+// readers are attached: files they may have loaded must not be swapped.
+func (cs *CommonStorage) ExcludeReaders() (release func(), err error) {
+	return TryExclusiveLock(cs.readersLockPath)
+}
+
+// Close stops the background scheduler and frees the lock file,
+// if this CommonStorage owns them. It is a no-op for children.
+func (cs *CommonStorage) Close() error {
+	if !cs.ownsLock {
+		return nil
+	}
+
+	cs.Scheduler.Stop()
+
+	var err error
+	switch cs.Cfg.LockMode {
+	case config.LockExclusive:
+		err = FreeLockFile(cs.LockFile)
+	case config.LockShared:
+		if cs.LockFile != nil {
+			err = FreeSharedLockFile(cs.LockFile)
+		}
+	case config.LockNone:
+	}
+	if err != nil {
+		return fmt.Errorf("error freeing lock file: %w", err)
+	}
+	return nil
+}
+
+func newBufferPool() sync.Pool {
+	return sync.Pool{
+		New: func() interface{} {
+			return bytes.NewBuffer([]byte{})
+		},
+	}
+}
@@ -0,0 +1,44 @@
+package storagecommon
+
+import (
+	"errors"
+	"math"
+	"strconv"
+
+	"KeyValor/constants"
+)
+
+// IsMissingKey tells whether a read error means that the key has no (live) value.
+func IsMissingKey(err error) bool {
+	return errors.Is(err, constants.ErrKeyMissing) ||
+		errors.Is(err, constants.ErrKeyIsDeleted) ||
+		errors.Is(err, constants.ErrKeyIsExpired)
+}
+
+// IncrBy adds delta to a value holding a base-10 64 bit integer (nil counts as 0),
+// and returns the new value in the same format.
+func IncrBy(value []byte, delta int64) ([]byte, error) {
+	var current int64
+	if value != nil {
+		var err error
+		if current, err = ParseInt(value); err != nil {
+			return nil, err
+		}
+	}
+
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return nil, constants.ErrIncrOverflow
+	}
+	return strconv.AppendInt(nil, current+delta, 10), nil
+}
+
+// ParseInt parses a value holding a base-10 64 bit integer, the way Redis does:
+// no sign other than a leading '-', no leading zeros or spaces.
+func ParseInt(value []byte) (int64, error) {
+	s := string(value)
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || s != strconv.FormatInt(n, 10) {
+		return 0, constants.ErrValueIsNotInteger
+	}
+	return n, nil
+}
@@ -66,7 +66,7 @@ func (tm *TreeMap[K, V]) Get(key K) (V, bool) {
 }
 
 func (tm *TreeMap[K, V]) Values() []V {
-	values := make([]V, 0, tm.Size())
+	values := make([]V, tm.Size())
 
 	for i, value := range tm.internalMap.Values() {
 		typedValue, ok := value.(V)
@@ -0,0 +1,12 @@
+package cmputils
+
+import "strings"
+
+// BytewiseComparator orders string keys by comparing their bytes as unsigned values,
+// the way bytes.Compare does. It is the key order of the LSM memtables and SSTables,
+// so binary composite keys (e.g. big-endian encoded tuples) sort by their components.
+//
+// It doesn't depend on the keys being valid UTF-8, nor on any collation.
+func BytewiseComparator(a, b interface{}) int {
+	return strings.Compare(a.(string), b.(string))
+}
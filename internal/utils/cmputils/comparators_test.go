@@ -0,0 +1,26 @@
+package cmputils
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBytewiseComparator(t *testing.T) {
+	require.Equal(t, 0, BytewiseComparator("abc", "abc"))
+	require.Equal(t, -1, BytewiseComparator("ab", "abc"))
+	require.Equal(t, 1, BytewiseComparator("b", "abc"))
+
+	// bytes are compared unsigned, and invalid UTF-8 is fine
+	require.Equal(t, -1, BytewiseComparator("\x7f", "\x80"))
+	require.Equal(t, -1, BytewiseComparator("\x00\xff", "\x01\x00"))
+
+	// big-endian composite keys sort by their components
+	tuple := func(a uint16, b uint32) string {
+		buf := binary.BigEndian.AppendUint16(nil, a)
+		return string(binary.BigEndian.AppendUint32(buf, b))
+	}
+	require.Equal(t, -1, BytewiseComparator(tuple(1, 300), tuple(2, 1)))
+	require.Equal(t, -1, BytewiseComparator(tuple(1, 255), tuple(1, 256)))
+}
@@ -3,6 +3,7 @@ package dataconvutils
 import (
 	"encoding/binary"
 	"strconv"
+	"unsafe"
 )
 
 // Helper function to convert bytes to int
@@ -34,3 +35,19 @@ func Int64ToBytes(i int64) []byte {
 func IntToBytes(i int) []byte {
 	return []byte(strconv.Itoa(i))
 }
+
+// UnsafeString returns a string that shares its memory with b, without copying it.
+// b must not be modified while the returned string (or anything derived from it) is in use,
+// so it is only suitable for short-lived lookups, never for keys that get stored.
+func UnsafeString(b []byte) string {
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
+
+// UnsafeStrings returns UnsafeString for every element of bs.
+func UnsafeStrings(bs [][]byte) []string {
+	strs := make([]string, len(bs))
+	for i, b := range bs {
+		strs[i] = UnsafeString(b)
+	}
+	return strs
+}
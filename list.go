@@ -0,0 +1,415 @@
+package KeyValor
+
+import (
+	"bytes"
+	"time"
+
+	"KeyValor/constants"
+	"KeyValor/dbops"
+	"KeyValor/internal/datatypes"
+	"KeyValor/internal/storage/storagecommon"
+)
+
+// List is the value of a list key: a sequence of elements, like a Redis list.
+// Indexes can be negative, to count from the tail (-1 is the last element).
+//
+// A list is stored as one record per element (see listStore): the list given to UpdateList or
+// ViewList reads the elements it accesses only, and UpdateList writes those it changed, so that
+// pushing or popping an element doesn't read or write the others.
+type List struct {
+	// head is the index of the first element, and tail the index after the last one: pushing
+	// an element moves them outwards, popping one inwards
+	head, tail int64
+	// elements are the elements read or written so far, by index: all of them, unless the
+	// list is stored
+	elements map[int64][]byte
+	// stored is the list as it was loaded from the store, nil for a list that isn't stored
+	stored *storedList
+	// err is the first error reading an element from the store
+	err error
+}
+
+// storedList is a list of a listStore, as it was loaded.
+type storedList struct {
+	lists *listStore
+	id    uint64
+	meta  listMeta
+	// dirty are the indexes of the elements written since
+	dirty map[int64]struct{}
+}
+
+// NewList returns an empty list.
+func NewList() *List {
+	return &List{elements: make(map[int64][]byte)}
+}
+
+// Len returns the number of elements.
+func (l *List) Len() int {
+	return int(l.tail - l.head)
+}
+
+// Index returns the element at index, and false if the index is out of range.
+func (l *List) Index(index int) ([]byte, bool) {
+	i, ok := l.normalize(index)
+	if !ok {
+		return nil, false
+	}
+	return l.at(l.head + int64(i)), true
+}
+
+// Range returns the elements from start to stop, both included, with the clamping of LRANGE.
+func (l *List) Range(start, stop int) [][]byte {
+	start, stop, ok := l.clampRange(start, stop)
+	if !ok {
+		return [][]byte{}
+	}
+
+	elements := make([][]byte, 0, stop-start+1)
+	for i := start; i <= stop; i++ {
+		elements = append(elements, l.at(l.head+int64(i)))
+	}
+	return elements
+}
+
+// PushLeft inserts elements at the head, one after the other (so they end up in reverse order).
+func (l *List) PushLeft(elements ...[]byte) {
+	for _, element := range elements {
+		l.head--
+		l.put(l.head, element)
+	}
+}
+
+// PushRight appends elements at the tail.
+func (l *List) PushRight(elements ...[]byte) {
+	for _, element := range elements {
+		l.put(l.tail, element)
+		l.tail++
+	}
+}
+
+// PopLeft removes and returns the first element, and false if the list is empty.
+func (l *List) PopLeft() ([]byte, bool) {
+	if l.Len() == 0 {
+		return nil, false
+	}
+	element := l.at(l.head)
+	delete(l.elements, l.head)
+	l.head++
+	return element, true
+}
+
+// PopRight removes and returns the last element, and false if the list is empty.
+func (l *List) PopRight() ([]byte, bool) {
+	if l.Len() == 0 {
+		return nil, false
+	}
+	l.tail--
+	element := l.at(l.tail)
+	delete(l.elements, l.tail)
+	return element, true
+}
+
+// Set replaces the element at index, and returns false if the index is out of range.
+func (l *List) Set(index int, element []byte) bool {
+	i, ok := l.normalize(index)
+	if !ok {
+		return false
+	}
+	l.put(l.head+int64(i), element)
+	return true
+}
+
+// Insert inserts element before (or after) the first occurrence of pivot, and returns false
+// if pivot isn't in the list.
+func (l *List) Insert(before bool, pivot, element []byte) bool {
+	for i := l.head; i < l.tail; i++ {
+		if !bytes.Equal(l.at(i), pivot) {
+			continue
+		}
+		if !before {
+			i++
+		}
+		for j := l.tail; j > i; j-- {
+			l.put(j, l.at(j-1))
+		}
+		l.put(i, element)
+		l.tail++
+		return true
+	}
+	return false
+}
+
+// Remove removes the first count occurrences of element (the last -count ones if count
+// is negative, all of them if it is 0), and returns the number of removed elements.
+func (l *List) Remove(count int, element []byte) int {
+	elements := l.all()
+	removed := 0
+	kept := make([][]byte, 0, len(elements))
+
+	if count >= 0 {
+		for _, e := range elements {
+			if bytes.Equal(e, element) && (count == 0 || removed < count) {
+				removed++
+				continue
+			}
+			kept = append(kept, e)
+		}
+	} else {
+		for i := len(elements) - 1; i >= 0; i-- {
+			e := elements[i]
+			if bytes.Equal(e, element) && removed < -count {
+				removed++
+				continue
+			}
+			kept = append(kept, e)
+		}
+		for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+			kept[i], kept[j] = kept[j], kept[i]
+		}
+	}
+
+	// only the elements after the first removed one move
+	for i, e := range kept {
+		if !bytes.Equal(elements[i], e) {
+			l.put(l.head+int64(i), e)
+		}
+	}
+	for i := l.head + int64(len(kept)); i < l.tail; i++ {
+		delete(l.elements, i)
+	}
+	l.tail = l.head + int64(len(kept))
+	return removed
+}
+
+// Trim keeps only the elements from start to stop, both included, with the clamping of LTRIM.
+func (l *List) Trim(start, stop int) {
+	start, stop, ok := l.clampRange(start, stop)
+	if !ok {
+		l.head = l.tail
+		return
+	}
+	l.head, l.tail = l.head+int64(start), l.head+int64(stop)+1
+}
+
+// at returns the element at the index i (l.head is the index of the first element), reading it
+// from the store if needed.
+func (l *List) at(i int64) []byte {
+	element, ok := l.elements[i]
+	if ok || l.stored == nil {
+		return element
+	}
+
+	element, err := l.stored.lists.element(l.stored.id, i)
+	if err != nil {
+		if l.err == nil {
+			l.err = err
+		}
+		return nil
+	}
+	l.elements[i] = element
+	return element
+}
+
+// put writes the element at the index i, like at.
+func (l *List) put(i int64, element []byte) {
+	l.elements[i] = element
+	if l.stored != nil {
+		l.stored.dirty[i] = struct{}{}
+	}
+}
+
+// all returns the elements.
+func (l *List) all() [][]byte {
+	elements := make([][]byte, 0, l.Len())
+	for i := l.head; i < l.tail; i++ {
+		elements = append(elements, l.at(i))
+	}
+	return elements
+}
+
+func (l *List) normalize(index int) (int, bool) {
+	if index < 0 {
+		index += l.Len()
+	}
+	if index < 0 || index >= l.Len() {
+		return 0, false
+	}
+	return index, true
+}
+
+// clampRange converts LRANGE-style indexes into a valid range, or returns false if it is empty.
+func (l *List) clampRange(start, stop int) (int, int, bool) {
+	length := l.Len()
+	if start < 0 {
+		start = max(length+start, 0)
+	}
+	if stop < 0 {
+		stop = length + stop
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start > stop || start >= length {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
+
+func (l *List) kind() datatypes.Kind {
+	return datatypes.KindList
+}
+
+func (l *List) encode() []byte {
+	return datatypes.EncodeSlice(l.all())
+}
+
+func decodeList(payload []byte) (*List, error) {
+	elements, err := datatypes.DecodeSlice(payload)
+	if err != nil {
+		return nil, err
+	}
+	l := NewList()
+	l.PushRight(elements...)
+	return l, nil
+}
+
+// GetList returns a copy of the list stored at key, with all its elements, or an empty list if
+// the key doesn't exist. ViewList reads only the elements it accesses.
+// It fails with constants.ErrWrongType if the key holds another data type.
+// It acquires a read lock on the database to ensure thread safety.
+func (db *KeyValorDatabase) GetList(key string) (l *List, err error) {
+	err = db.ViewList(key, func(view *List) error {
+		view.all()
+		view.stored = nil
+		l = view
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// ViewList calls view on the list stored at key (an empty list if the key doesn't exist), which
+// reads the elements it accesses from the storage: view must not keep the list, and its changes
+// aren't stored.
+// It fails with constants.ErrWrongType if the key holds another data type.
+// It acquires a read lock on the database to ensure thread safety.
+func (db *KeyValorDatabase) ViewList(key string, view func(l *List) error) error {
+	return db.intercept(dbops.OpGetList, false, []string{key}, func() error {
+		db.RLock()
+		defer db.RUnlock()
+
+		l, _, _, err := db.loadListMuLocked(key)
+		if err != nil {
+			return err
+		}
+		if err := view(l); err != nil {
+			return err
+		}
+		return l.err
+	})
+}
+
+// UpdateList atomically calls update on the list stored at key (an empty list if the key
+// doesn't exist), and stores the elements it changed, unless update returns an error. The key
+// keeps its expiry, and is deleted when the list becomes empty.
+// It fails with constants.ErrWrongType if the key holds another data type.
+// It acquires a write lock on the database to ensure thread safety.
+func (db *KeyValorDatabase) UpdateList(key string, update func(l *List) error) error {
+	return db.UpdateLists([]string{key}, func(lists []*List) error {
+		return update(lists[0])
+	})
+}
+
+// UpdateLists is UpdateList for several keys at once (e.g. to move elements between lists):
+// lists[i] is the list stored at keys[i], and a key given more than once gets the same list.
+func (db *KeyValorDatabase) UpdateLists(keys []string, update func(lists []*List) error) error {
+	return db.intercept(dbops.OpUpdateList, true, keys, func() error {
+		db.Lock()
+		defer db.Unlock()
+
+		type loaded struct {
+			l      *List
+			expiry time.Time
+			found  bool
+		}
+
+		byKey := make(map[string]*loaded, len(keys))
+		lists := make([]*List, len(keys))
+		for i, key := range keys {
+			if l, ok := byKey[key]; ok {
+				lists[i] = l.l
+				continue
+			}
+
+			l, expiry, found, err := db.loadListMuLocked(key)
+			if err != nil {
+				return err
+			}
+			byKey[key] = &loaded{l: l, expiry: expiry, found: found}
+			lists[i] = l
+		}
+
+		if err := update(lists); err != nil {
+			return err
+		}
+		// update may have seen a missing element instead of an element it couldn't read
+		for _, l := range byKey {
+			if l.l.err != nil {
+				return l.l.err
+			}
+		}
+
+		for key, l := range byKey {
+			var err error
+			switch {
+			case l.l.Len() == 0 && l.found:
+				err = db.storage.Delete(key)
+			case l.l.Len() == 0:
+			case l.l.stored != nil:
+				err = l.l.stored.lists.save(l.l)
+			case l.found:
+				// a list stored whole, before the lists were stored by element
+				err = db.storage.SetWithExpiry(key, datatypes.Tag(l.l.kind(), l.l.encode()), l.expiry)
+			default:
+				// the storage stores the elements of a whole list as records
+				err = db.storage.Set(key, datatypes.Tag(l.l.kind(), l.l.encode()))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// loadListMuLocked returns the list stored at key with its expiry, and whether the key exists.
+func (db *KeyValorDatabase) loadListMuLocked(key string) (*List, time.Time, bool, error) {
+	stored, expiry, err := db.storage.GetWithExpiry(key)
+	if err != nil {
+		if storagecommon.IsMissingKey(err) {
+			return NewList(), time.Time{}, false, nil
+		}
+		return nil, time.Time{}, false, err
+	}
+
+	kind, payload, err := datatypes.Untag(stored)
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+
+	var l *List
+	switch kind {
+	case datatypes.KindListRef:
+		l, err = db.lists.load(payload)
+	case datatypes.KindList:
+		l, err = decodeList(payload)
+	default:
+		err = constants.ErrWrongType
+	}
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	return l, expiry, true, nil
+}
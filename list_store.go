@@ -0,0 +1,593 @@
+package KeyValor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"KeyValor/config"
+	"KeyValor/constants"
+	"KeyValor/internal/datatypes"
+	"KeyValor/internal/scheduler"
+	"KeyValor/internal/storage"
+	"KeyValor/internal/storage/hashtable"
+	"KeyValor/internal/storage/storagecommon"
+	"KeyValor/internal/utils/fileutils"
+	"KeyValor/log"
+)
+
+// LISTS_DIR is the sub-directory (of the database directory) storing the elements of its lists
+const LISTS_DIR = "lists"
+
+// listStore wraps the storage of a database, and stores its lists as one record per element,
+// so that pushing or popping an element writes a record or two instead of the whole list.
+//
+// The key of a list holds a reference (datatypes.KindListRef) to the id of the list. The
+// elements store, a storage engine in LISTS_DIR, holds the meta record of the list: the index
+// of its first element, the index after its last one, and its key. Each element is a record
+// at its index: pushing to the head decrements the first index, pushing to the tail increments
+// the last one.
+//
+// The elements of a list are freed once its key is overwritten, deleted or renamed over, and
+// those of the lists whose key expired with the compaction. On open, the store frees the lists
+// that no key references, like those whose key was written before a crash but not persisted.
+type listStore struct {
+	storage.DiskStorage
+
+	// mu serializes the writes of keys, with the frees of the lists they referenced
+	mu sync.Mutex
+	// elements is nil for a read-only database without lists
+	elements storage.DiskStorage
+	// refs are the ids of the lists referenced by the keys (unused in read-only mode)
+	refs     map[string]uint64
+	readOnly bool
+
+	scheduler     *scheduler.Scheduler
+	cancelRelease func()
+}
+
+// listMeta is the meta record of a list.
+type listMeta struct {
+	head, tail int64
+	key        string
+}
+
+// openListStore opens the store of the elements of the lists of the database stored by engine,
+// in the directory cs.Cfg.Directory.
+func openListStore(cs *storagecommon.CommonStorage, engine storage.DiskStorage) (*listStore, error) {
+	cfg := listsConfig(cs.Cfg)
+	ls := &listStore{
+		DiskStorage:   engine,
+		refs:          make(map[string]uint64),
+		readOnly:      cfg.ReadOnly,
+		scheduler:     cs.Scheduler,
+		cancelRelease: func() {},
+	}
+
+	if cfg.ReadOnly {
+		if !fileutils.FileExists(cfg.Directory) {
+			return ls, nil
+		}
+	} else if err := os.MkdirAll(cfg.Directory, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("error creating lists directory: %w", err)
+	}
+	if err := loadOrStoreOptions(cfg, OPTIONS_FILENAME); err != nil {
+		return nil, err
+	}
+
+	elements, err := hashtable.NewHashTableStorage(cs.NewChild(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("error opening lists: %w", err)
+	}
+	if err := elements.Init(); err != nil {
+		return nil, fmt.Errorf("error opening lists: %w", err)
+	}
+	ls.elements = elements
+
+	if cfg.ReadOnly {
+		return ls, nil
+	}
+	if err := ls.collect(); err != nil {
+		elements.Close()
+		return nil, fmt.Errorf("error opening lists: %w", err)
+	}
+	ls.cancelRelease = ls.scheduler.Every("lists release", cfg.CompactInterval, ls.releaseExpired)
+	return ls, nil
+}
+
+// listsConfig returns the options of the elements store of a database with the options cfg.
+func listsConfig(cfg *config.DBCfgOpts) *config.DBCfgOpts {
+	lists := cfg.Clone()
+	lists.Directory = filepath.Join(cfg.Directory, LISTS_DIR)
+	// the elements live as long as their list, whose key has the expiry
+	lists.DefaultTTL = 0
+	lists.ExpiryListener = nil
+	return lists
+}
+
+// collect records the lists referenced by the keys, and frees the others.
+func (ls *listStore) collect() error {
+	keys, err := ls.elements.AllKeys()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		id, ok := parseMetaKey(key)
+		if !ok {
+			continue
+		}
+		meta, err := ls.meta(id)
+		if err != nil {
+			return err
+		}
+
+		stored, err := ls.DiskStorage.Get(meta.key)
+		if err != nil && !storagecommon.IsMissingKey(err) {
+			return err
+		}
+		if err == nil && bytes.Equal(stored, listRef(id)) {
+			ls.refs[meta.key] = id
+			continue
+		}
+		if err := ls.free(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseExpired frees the lists whose key expired, once the storage deleted it.
+func (ls *listStore) releaseExpired() {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	for key := range ls.refs {
+		if !ls.DiskStorage.Exists(key) {
+			ls.releaseMuLocked(key)
+		}
+	}
+}
+
+// load returns the list whose reference is payload.
+func (ls *listStore) load(payload []byte) (*List, error) {
+	id, err := decodeListRef(payload)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := ls.meta(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &List{
+		head:     meta.head,
+		tail:     meta.tail,
+		elements: make(map[int64][]byte),
+		stored: &storedList{
+			lists: ls,
+			id:    id,
+			meta:  meta,
+			dirty: make(map[int64]struct{}),
+		},
+	}, nil
+}
+
+// save writes the changes of l, a list loaded from the store.
+func (ls *listStore) save(l *List) error {
+	if ls.readOnly {
+		return constants.ErrReadOnly
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	s := l.stored
+	// the elements are written before the meta record and deleted after it, so that it never
+	// covers a missing element
+	for index := range s.dirty {
+		if index >= l.head && index < l.tail {
+			if err := ls.elements.Set(elementKey(s.id, index), encodeElement(l.elements[index])); err != nil {
+				return err
+			}
+		}
+	}
+
+	if l.head == s.meta.head && l.tail == s.meta.tail {
+		return nil
+	}
+	if err := ls.elements.Set(metaKey(s.id), listMeta{head: l.head, tail: l.tail, key: s.meta.key}.encode()); err != nil {
+		return err
+	}
+
+	// the elements popped, or trimmed, at both ends
+	for index := s.meta.head; index < min(s.meta.tail, l.head); index++ {
+		if err := ls.deleteElement(s.id, index); err != nil {
+			return err
+		}
+	}
+	for index := max(s.meta.head, l.tail); index < s.meta.tail; index++ {
+		if err := ls.deleteElement(s.id, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inline returns stored, the value of a key, with the elements of the list it references (if
+// it does) in the encoding of a whole list: for the values copied out of the database.
+func (ls *listStore) inline(stored []byte) ([]byte, error) {
+	kind, payload, err := datatypes.Untag(stored)
+	if err != nil || kind != datatypes.KindListRef {
+		return stored, nil
+	}
+
+	id, err := decodeListRef(payload)
+	if err != nil {
+		return nil, err
+	}
+	elements, err := ls.all(id)
+	if err != nil {
+		return nil, err
+	}
+	return datatypes.Tag(datatypes.KindList, datatypes.EncodeSlice(elements)), nil
+}
+
+// meta returns the meta record of the list id.
+func (ls *listStore) meta(id uint64) (listMeta, error) {
+	if ls.elements == nil {
+		return listMeta{}, datatypes.ErrCorruptValue
+	}
+
+	stored, err := ls.elements.Get(metaKey(id))
+	if err != nil {
+		if storagecommon.IsMissingKey(err) {
+			return listMeta{}, datatypes.ErrCorruptValue
+		}
+		return listMeta{}, err
+	}
+	return decodeListMeta(stored)
+}
+
+// element returns the element at index of the list id.
+func (ls *listStore) element(id uint64, index int64) ([]byte, error) {
+	stored, err := ls.elements.Get(elementKey(id, index))
+	if err != nil {
+		if storagecommon.IsMissingKey(err) {
+			return nil, datatypes.ErrCorruptValue
+		}
+		return nil, err
+	}
+	return decodeElement(stored)
+}
+
+// all returns the elements of the list id.
+func (ls *listStore) all(id uint64) ([][]byte, error) {
+	meta, err := ls.meta(id)
+	if err != nil {
+		return nil, err
+	}
+
+	elements := make([][]byte, 0, meta.tail-meta.head)
+	for index := meta.head; index < meta.tail; index++ {
+		element, err := ls.element(id, index)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+	return elements, nil
+}
+
+// create stores a new list of the key, and returns its id. Its meta record is written first:
+// if the elements can't all be written, the list is freed, by create or on the next open.
+func (ls *listStore) create(key string, elements [][]byte) (uint64, error) {
+	id := rand.Uint64()
+
+	meta := listMeta{head: 0, tail: int64(len(elements)), key: key}
+	if err := ls.elements.Set(metaKey(id), meta.encode()); err != nil {
+		return 0, err
+	}
+	for i, element := range elements {
+		if err := ls.elements.Set(elementKey(id, int64(i)), encodeElement(element)); err != nil {
+			ls.freeOrLog(id, key)
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// free deletes the records of the list id, its meta record last.
+func (ls *listStore) free(id uint64) error {
+	meta, err := ls.meta(id)
+	if err != nil {
+		return err
+	}
+
+	for index := meta.head; index < meta.tail; index++ {
+		if err := ls.deleteElement(id, index); err != nil {
+			return err
+		}
+	}
+	return ls.elements.Delete(metaKey(id))
+}
+
+// freeOrLog frees the list id of key, logging the error: the list is then freed on the next
+// open, since no key references it.
+func (ls *listStore) freeOrLog(id uint64, key string) {
+	if err := ls.free(id); err != nil {
+		log.Errorf("error freeing the elements of list %q: %v", key, err)
+	}
+}
+
+func (ls *listStore) deleteElement(id uint64, index int64) error {
+	if err := ls.elements.Delete(elementKey(id, index)); err != nil && !storagecommon.IsMissingKey(err) {
+		return err
+	}
+	return nil
+}
+
+// releaseMuLocked frees the list referenced by key, if any, once key was overwritten or deleted.
+func (ls *listStore) releaseMuLocked(key string) {
+	id, ok := ls.refs[key]
+	if !ok {
+		return
+	}
+	delete(ls.refs, key)
+	ls.freeOrLog(id, key)
+}
+
+// write writes value to key with set, storing the elements of a whole list (like one restored
+// or moved from another database) as records first.
+func (ls *listStore) write(key string, value []byte, set func(value []byte) error) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	kind, payload, err := datatypes.Untag(value)
+	if err != nil || kind != datatypes.KindList {
+		if err := set(value); err != nil {
+			return err
+		}
+		ls.releaseMuLocked(key)
+		return nil
+	}
+
+	elements, err := datatypes.DecodeSlice(payload)
+	if err != nil {
+		return err
+	}
+	id, err := ls.create(key, elements)
+	if err != nil {
+		return err
+	}
+	if err := set(listRef(id)); err != nil {
+		ls.freeOrLog(id, key)
+		return err
+	}
+	ls.releaseMuLocked(key)
+	ls.refs[key] = id
+	return nil
+}
+
+func (ls *listStore) Set(key string, value []byte) error {
+	return ls.write(key, value, func(value []byte) error {
+		return ls.DiskStorage.Set(key, value)
+	})
+}
+
+func (ls *listStore) SetEx(key string, value []byte, ttlSeconds int64) error {
+	return ls.write(key, value, func(value []byte) error {
+		return ls.DiskStorage.SetEx(key, value, ttlSeconds)
+	})
+}
+
+func (ls *listStore) SetWithExpiry(key string, value []byte, expiry time.Time) error {
+	return ls.write(key, value, func(value []byte) error {
+		return ls.DiskStorage.SetWithExpiry(key, value, expiry)
+	})
+}
+
+func (ls *listStore) Delete(key string) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	err := ls.DiskStorage.Delete(key)
+	if err == nil || storagecommon.IsMissingKey(err) {
+		ls.releaseMuLocked(key)
+	}
+	return err
+}
+
+func (ls *listStore) Rename(key, newKey string) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if err := ls.DiskStorage.Rename(key, newKey); err != nil || key == newKey {
+		return err
+	}
+
+	ls.releaseMuLocked(newKey)
+	id, ok := ls.refs[key]
+	if !ok {
+		return nil
+	}
+	delete(ls.refs, key)
+	ls.refs[newKey] = id
+
+	meta, err := ls.meta(id)
+	if err != nil {
+		return err
+	}
+	meta.key = newKey
+	return ls.elements.Set(metaKey(id), meta.encode())
+}
+
+// Copy copies a list with its elements, which the two keys don't share.
+func (ls *listStore) Copy(key, destination string, replace bool) (bool, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	id, ok := ls.refs[key]
+	if !ok || key == destination {
+		copied, err := ls.DiskStorage.Copy(key, destination, replace)
+		if copied {
+			ls.releaseMuLocked(destination)
+		}
+		return copied, err
+	}
+
+	_, expiry, err := ls.DiskStorage.GetWithExpiry(key)
+	if err != nil {
+		return false, err
+	}
+	if !replace {
+		_, _, err := ls.DiskStorage.GetWithExpiry(destination)
+		if err == nil {
+			return false, nil
+		}
+		if !storagecommon.IsMissingKey(err) {
+			return false, err
+		}
+	}
+
+	elements, err := ls.all(id)
+	if err != nil {
+		return false, err
+	}
+	copyID, err := ls.create(destination, elements)
+	if err != nil {
+		return false, err
+	}
+	if err := ls.DiskStorage.SetWithExpiry(destination, listRef(copyID), expiry); err != nil {
+		ls.freeOrLog(copyID, destination)
+		return false, err
+	}
+	ls.releaseMuLocked(destination)
+	ls.refs[destination] = copyID
+	return true, nil
+}
+
+func (ls *listStore) Clear() error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if err := ls.DiskStorage.Clear(); err != nil {
+		return err
+	}
+	clear(ls.refs)
+	return ls.elements.Clear()
+}
+
+func (ls *listStore) Checkpoint() error {
+	if ls.elements != nil {
+		if err := ls.elements.Checkpoint(); err != nil {
+			return err
+		}
+	}
+	return ls.DiskStorage.Checkpoint()
+}
+
+func (ls *listStore) Reconfigure(cfg *config.DBCfgOpts) error {
+	if err := ls.DiskStorage.Reconfigure(cfg); err != nil {
+		return err
+	}
+	if ls.elements == nil {
+		return nil
+	}
+	if err := ls.elements.Reconfigure(listsConfig(cfg)); err != nil {
+		return err
+	}
+
+	ls.cancelRelease()
+	ls.cancelRelease = ls.scheduler.Every("lists release", cfg.CompactInterval, ls.releaseExpired)
+	return nil
+}
+
+func (ls *listStore) Close() error {
+	return ls.close(true)
+}
+
+func (ls *listStore) CloseWithoutCheckpoint() error {
+	return ls.close(false)
+}
+
+// close closes the elements store, then the storage, which may own the lock of the directory.
+func (ls *listStore) close(checkpoint bool) error {
+	ls.cancelRelease()
+
+	var err error
+	if ls.elements != nil {
+		if checkpoint {
+			err = ls.elements.Close()
+		} else {
+			err = ls.elements.CloseWithoutCheckpoint()
+		}
+	}
+	if checkpoint {
+		return errors.Join(err, ls.DiskStorage.Close())
+	}
+	return errors.Join(err, ls.DiskStorage.CloseWithoutCheckpoint())
+}
+
+func metaKey(id uint64) string {
+	return string(binary.BigEndian.AppendUint64([]byte{'m'}, id))
+}
+
+func parseMetaKey(key string) (uint64, bool) {
+	if len(key) != 9 || key[0] != 'm' {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64([]byte(key[1:])), true
+}
+
+func elementKey(id uint64, index int64) string {
+	key := binary.BigEndian.AppendUint64([]byte{'e'}, id)
+	return string(binary.BigEndian.AppendUint64(key, uint64(index)))
+}
+
+// encodeElement returns the record of an element, which the storage requires to be non-empty.
+func encodeElement(element []byte) []byte {
+	return append([]byte{0}, element...)
+}
+
+func decodeElement(stored []byte) ([]byte, error) {
+	if len(stored) == 0 {
+		return nil, datatypes.ErrCorruptValue
+	}
+	return stored[1:], nil
+}
+
+func (m listMeta) encode() []byte {
+	buf := binary.BigEndian.AppendUint64(nil, uint64(m.head))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(m.tail))
+	return append(buf, m.key...)
+}
+
+func decodeListMeta(stored []byte) (listMeta, error) {
+	if len(stored) < 16 {
+		return listMeta{}, datatypes.ErrCorruptValue
+	}
+	return listMeta{
+		head: int64(binary.BigEndian.Uint64(stored)),
+		tail: int64(binary.BigEndian.Uint64(stored[8:])),
+		key:  string(stored[16:]),
+	}, nil
+}
+
+// listRef returns the value of the key of the list id.
+func listRef(id uint64) []byte {
+	return datatypes.Tag(datatypes.KindListRef, binary.BigEndian.AppendUint64(nil, id))
+}
+
+func decodeListRef(payload []byte) (uint64, error) {
+	if len(payload) != 8 {
+		return 0, datatypes.ErrCorruptValue
+	}
+	return binary.BigEndian.Uint64(payload), nil
+}
@@ -0,0 +1,176 @@
+package KeyValor
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"KeyValor/constants"
+	"KeyValor/internal/datatypes"
+)
+
+func TestLists(t *testing.T) {
+	db, err := NewKeyValorDB(WithDirectory(t.TempDir()))
+	require.NoError(t, err)
+	defer db.Shutdown()
+
+	require.NoError(t, db.UpdateList("l", func(l *List) error {
+		l.PushRight([]byte("a"), []byte("b"), []byte("a"), []byte("c"))
+		l.PushLeft([]byte("x"), []byte("y"))
+		return nil
+	}))
+
+	l, err := db.GetList("l")
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("y"), []byte("x"), []byte("a"), []byte("b"), []byte("a"), []byte("c")}, l.Range(0, -1))
+	element, ok := l.Index(-2)
+	require.True(t, ok)
+	require.Equal(t, "a", string(element))
+	require.Empty(t, l.Range(4, 2))
+
+	require.Equal(t, 1, l.Remove(-1, []byte("a")))
+	require.Equal(t, [][]byte{[]byte("y"), []byte("x"), []byte("a"), []byte("b"), []byte("c")}, l.Range(0, -1))
+	l.Trim(1, -2)
+	require.Equal(t, [][]byte{[]byte("x"), []byte("a"), []byte("b")}, l.Range(-100, 100))
+
+	// moving an element between two lists, atomically
+	require.NoError(t, db.UpdateLists([]string{"l", "other"}, func(lists []*List) error {
+		element, ok := lists[0].PopRight()
+		require.True(t, ok)
+		lists[1].PushLeft(element)
+		return nil
+	}))
+	l, err = db.GetList("other")
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("c")}, l.Range(0, -1))
+
+	typ, err := db.Type("other")
+	require.NoError(t, err)
+	require.Equal(t, "list", typ)
+
+	_, err = db.GetHash("l")
+	require.ErrorIs(t, err, constants.ErrWrongType)
+}
+
+func TestListRecords(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewKeyValorDB(WithDirectory(dir))
+	require.NoError(t, err)
+
+	push := func(key string, elements ...string) {
+		require.NoError(t, db.UpdateList(key, func(l *List) error {
+			for _, element := range elements {
+				l.PushRight([]byte(element))
+			}
+			return nil
+		}))
+	}
+	elementsOf := func(key string) []string {
+		l, err := db.GetList(key)
+		require.NoError(t, err)
+		elements := []string{}
+		for _, element := range l.Range(0, -1) {
+			elements = append(elements, string(element))
+		}
+		return elements
+	}
+	records := func() int {
+		keys, err := db.lists.elements.AllKeys()
+		require.NoError(t, err)
+		return len(keys)
+	}
+
+	elements := make([]string, 100)
+	for i := range elements {
+		elements[i] = strconv.Itoa(i)
+	}
+	push("l", elements...)
+	require.Equal(t, 101, records())
+
+	// pushing and popping an element writes its record and the meta record of the list
+	changes := db.lists.elements.Stats().ChangesSinceCheckpoint
+	require.NoError(t, db.UpdateList("l", func(l *List) error {
+		l.PushLeft([]byte(""))
+		return nil
+	}))
+	require.Equal(t, changes+2, db.lists.elements.Stats().ChangesSinceCheckpoint)
+	require.NoError(t, db.UpdateList("l", func(l *List) error {
+		element, ok := l.PopRight()
+		require.True(t, ok)
+		require.Equal(t, "99", string(element))
+		return nil
+	}))
+	require.Equal(t, changes+4, db.lists.elements.Stats().ChangesSinceCheckpoint)
+
+	// the other changes go through the records too
+	require.NoError(t, db.UpdateList("l", func(l *List) error {
+		require.True(t, l.Insert(false, []byte("1"), []byte("x")))
+		require.Equal(t, 1, l.Remove(1, []byte("3")))
+		require.True(t, l.Set(-1, []byte("y")))
+		l.Trim(1, 4)
+		return nil
+	}))
+	require.Equal(t, []string{"0", "1", "x", "2"}, elementsOf("l"))
+	require.Equal(t, 5, records())
+
+	// ViewList reads the elements it accesses only
+	require.NoError(t, db.ViewList("l", func(l *List) error {
+		element, ok := l.Index(2)
+		require.True(t, ok)
+		require.Equal(t, "x", string(element))
+		require.Len(t, l.elements, 1)
+		return nil
+	}))
+
+	// a copy has its own elements, and the overwritten or deleted lists are freed
+	copied, err := db.Copy("l", "c", false)
+	require.NoError(t, err)
+	require.True(t, copied)
+	push("c", "z")
+	require.Equal(t, []string{"0", "1", "x", "2"}, elementsOf("l"))
+	require.Equal(t, []string{"0", "1", "x", "2", "z"}, elementsOf("c"))
+	require.NoError(t, db.Rename("c", "l"))
+	require.Equal(t, []string{"0", "1", "x", "2", "z"}, elementsOf("l"))
+	require.Equal(t, 6, records())
+	require.NoError(t, db.Set("l", []byte("string")))
+	require.Zero(t, records())
+
+	// a list dumped, restored or moved is stored as records by its new database
+	push("d", "a", "b")
+	payload, _, err := db.Dump("d")
+	require.NoError(t, err)
+	require.NoError(t, db.Restore("r", payload, time.Time{}, false))
+	require.Equal(t, []string{"a", "b"}, elementsOf("r"))
+	other, err := db.Namespace("other")
+	require.NoError(t, err)
+	moved, err := db.Move("r", other.KeyValorDatabase)
+	require.NoError(t, err)
+	require.True(t, moved)
+	require.Equal(t, 3, records())
+	l, err := other.GetList("r")
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("a"), []byte("b")}, l.Range(0, -1))
+
+	// a list stored whole is stored as records once it is updated
+	require.NoError(t, db.lists.DiskStorage.Set("whole", datatypes.Tag(datatypes.KindList, datatypes.EncodeSlice([][]byte{[]byte("a")}))))
+	push("whole", "b")
+	require.Equal(t, []string{"a", "b"}, elementsOf("whole"))
+	require.Equal(t, 6, records())
+
+	// the lists whose key expired are freed with the compaction
+	push("e", "x")
+	require.NoError(t, db.lists.DiskStorage.Delete("e"))
+	db.lists.releaseExpired()
+	require.Equal(t, 6, records())
+
+	// the lists that no key references are freed on open
+	require.NoError(t, db.lists.DiskStorage.Delete("whole"))
+	require.NoError(t, db.Shutdown())
+	db, err = NewKeyValorDB(WithDirectory(dir))
+	require.NoError(t, err)
+	defer db.Shutdown()
+	require.Equal(t, 3, records())
+	require.Equal(t, []string{"a", "b"}, elementsOf("d"))
+}
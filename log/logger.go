@@ -28,6 +28,37 @@ func InitLogger(logDir string) {
 	l = NewDefaultLogger(logDir)
 }
 
+// Level is the minimum level of the messages logged.
+type Level = zapcore.Level
+
+const (
+	DebugLevel = zapcore.DebugLevel
+	InfoLevel  = zapcore.InfoLevel
+	WarnLevel  = zapcore.WarnLevel
+	ErrorLevel = zapcore.ErrorLevel
+)
+
+// ParseLevel parses a level name: debug, info, warn or error.
+func ParseLevel(name string) (Level, error) {
+	switch name {
+	case "debug":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warn":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	default:
+		return InfoLevel, fmt.Errorf("unknown log level: %q", name)
+	}
+}
+
+// InitLoggerAtLevel is InitLogger, only logging the messages of the given level and above.
+func InitLoggerAtLevel(logDir string, level Level) {
+	l = newZapLogger(logDir, level)
+}
+
 // SetLogger allows overriding the global logger instance
 func SetLogger(customLogger Logger) {
 	l = customLogger
@@ -35,6 +66,10 @@ func SetLogger(customLogger Logger) {
 
 // NewZapLogger creates a new ZapLogger instance with custom configuration
 func NewDefaultLogger(logDir string) *ZapLogger {
+	return newZapLogger(logDir, InfoLevel)
+}
+
+func newZapLogger(logDir string, level Level) *ZapLogger {
 
 	err := os.MkdirAll(logDir, os.ModePerm)
 	if err != nil {
@@ -42,6 +77,7 @@ func NewDefaultLogger(logDir string) *ZapLogger {
 	}
 
 	config := zap.NewProductionConfig()
+	config.Level = zap.NewAtomicLevelAt(level)
 	config.OutputPaths = []string{
 		logDir + "/app.log",
 		"stdout",
@@ -0,0 +1,244 @@
+package KeyValor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"KeyValor/constants"
+	"KeyValor/dbops"
+	"KeyValor/internal/utils/fileutils"
+	"KeyValor/log"
+)
+
+const (
+	// NAMESPACES_DIR is the sub-directory (of the database directory) holding one directory per namespace
+	NAMESPACES_DIR = "namespaces"
+	// NAMESPACE_OPTIONS_FILENAME stores the options that can't change once a namespace has data
+	NAMESPACE_OPTIONS_FILENAME = "namespace.json"
+	// droppedNamespacePrefix marks a namespace directory that is being deleted
+	droppedNamespacePrefix = ".dropped-"
+)
+
+var validNamespaceName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Namespace is an isolated keyspace (a "column family") of a KeyValorDatabase.
+// It stores its data files and index in its own sub-directory, and has its own
+// options (max file size, compaction interval, default TTL, compression),
+// but it shares the lock file and the background scheduler of its database.
+//
+// A Namespace supports every operation of KeyValorDatabase.
+type Namespace struct {
+	*KeyValorDatabase
+	name   string
+	parent *KeyValorDatabase
+}
+
+// Name returns the name of the namespace.
+func (ns *Namespace) Name() string {
+	return ns.name
+}
+
+// Shutdown closes the namespace. The database (and other namespaces) stay open.
+func (ns *Namespace) Shutdown() error {
+	return ns.parent.closeNamespace(ns.name, true)
+}
+
+// Namespace opens (creating it if needed) the namespace with the given name.
+// The namespace inherits the options of the database; the given options
+// override them. Options are only applied when the namespace is opened for
+// the first time by this process, subsequent calls return the same handle.
+//
+// The compression of a namespace is fixed when it is created.
+func (db *KeyValorDatabase) Namespace(name string, options ...Option) (*Namespace, error) {
+	if db.namespaces == nil {
+		return nil, constants.ErrNestedNamespace
+	}
+	if !validNamespaceName.MatchString(name) {
+		return nil, fmt.Errorf("%w: %q", constants.ErrInvalidNamespaceName, name)
+	}
+
+	db.nsMu.Lock()
+	defer db.nsMu.Unlock()
+
+	if ns, ok := db.namespaces[name]; ok {
+		return ns, nil
+	}
+
+	cfg := db.cfg.Clone()
+	cfg.Directory = namespaceDir(db.cfg.Directory, name)
+	cfg.ExpiryListener = nil
+	for _, option := range options {
+		option(cfg)
+	}
+
+	if cfg.ReadOnly {
+		if !fileutils.FileExists(cfg.Directory) {
+			return nil, fmt.Errorf("%w: %q", constants.ErrNamespaceNotFound, name)
+		}
+	} else if err := os.MkdirAll(cfg.Directory, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("error creating namespace directory: %w", err)
+	}
+
+	if err := loadOrStoreOptions(cfg, NAMESPACE_OPTIONS_FILENAME); err != nil {
+		return nil, err
+	}
+
+	collections := newCollectionCache()
+	storage, lists, err := openStorage(db.common.NewChild(cfg), collections)
+	if err != nil {
+		return nil, fmt.Errorf("error opening namespace %q: %w", name, err)
+	}
+
+	ns := &Namespace{
+		KeyValorDatabase: &KeyValorDatabase{
+			cfg:         cfg,
+			storage:     storage,
+			common:      db.common,
+			collections: collections,
+			lists:       lists,
+			interceptor: dbops.Chain(cfg.Interceptors...),
+		},
+		name:   name,
+		parent: db,
+	}
+	db.namespaces[name] = ns
+
+	return ns, nil
+}
+
+// Namespaces lists the names of all the namespaces stored in the database, open or not.
+func (db *KeyValorDatabase) Namespaces() ([]string, error) {
+	if db.namespaces == nil {
+		return nil, constants.ErrNestedNamespace
+	}
+
+	entries, err := os.ReadDir(filepath.Join(db.cfg.Directory, NAMESPACES_DIR))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error listing namespaces: %w", err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() && validNamespaceName.MatchString(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// DropNamespace closes the namespace (if open) and deletes all of its data.
+// The namespace directory is first renamed away, so the namespace disappears
+// atomically regardless of how many keys it holds; its files are then removed in the
+// background (Shutdown waits for it). The namespace can't be reopened until the rename is done.
+func (db *KeyValorDatabase) DropNamespace(name string) error {
+	if db.namespaces == nil {
+		return constants.ErrNestedNamespace
+	}
+	if !validNamespaceName.MatchString(name) {
+		return fmt.Errorf("%w: %q", constants.ErrInvalidNamespaceName, name)
+	}
+	if db.cfg.ReadOnly {
+		return constants.ErrReadOnly
+	}
+
+	// nsMu is held until the directory is renamed, so that Namespace can't reopen it meanwhile
+	db.nsMu.Lock()
+	defer db.nsMu.Unlock()
+
+	if err := db.closeNamespaceLocked(name, true); err != nil && !errors.Is(err, constants.ErrNamespaceNotOpen) {
+		return err
+	}
+
+	dir := namespaceDir(db.cfg.Directory, name)
+	if !fileutils.FileExists(dir) {
+		return fmt.Errorf("%w: %q", constants.ErrNamespaceNotFound, name)
+	}
+
+	parentDir := filepath.Dir(dir)
+	droppedDir := filepath.Join(parentDir, fmt.Sprintf("%s%s-%d", droppedNamespacePrefix, name, time.Now().UnixNano()))
+	if err := os.Rename(dir, droppedDir); err != nil {
+		return fmt.Errorf("error dropping namespace %q: %w", name, err)
+	}
+	if err := fileutils.SyncDir(parentDir); err != nil {
+		return fmt.Errorf("error syncing directory: %w", err)
+	}
+
+	// a crash before the removal is done is recovered from by removeDroppedNamespaces
+	db.drops.Add(1)
+	go func() {
+		defer db.drops.Done()
+		if err := os.RemoveAll(droppedDir); err != nil {
+			log.Errorf("error deleting files of namespace %q: %v", name, err)
+		}
+	}()
+	return nil
+}
+
+func (db *KeyValorDatabase) closeNamespace(name string, checkpoint bool) error {
+	db.nsMu.Lock()
+	defer db.nsMu.Unlock()
+
+	return db.closeNamespaceLocked(name, checkpoint)
+}
+
+// closeNamespaceLocked is closeNamespace, with nsMu held.
+func (db *KeyValorDatabase) closeNamespaceLocked(name string, checkpoint bool) error {
+	ns, ok := db.namespaces[name]
+	delete(db.namespaces, name)
+
+	if !ok {
+		return fmt.Errorf("%w: %q", constants.ErrNamespaceNotOpen, name)
+	}
+	if !checkpoint {
+		return ns.storage.CloseWithoutCheckpoint()
+	}
+	return ns.storage.Close()
+}
+
+func (db *KeyValorDatabase) closeNamespaces(checkpoint bool) error {
+	db.nsMu.Lock()
+	names := make([]string, 0, len(db.namespaces))
+	for name := range db.namespaces {
+		names = append(names, name)
+	}
+	db.nsMu.Unlock()
+
+	for _, name := range names {
+		if err := db.closeNamespace(name, checkpoint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func namespaceDir(directory string, name string) string {
+	return filepath.Join(directory, NAMESPACES_DIR, name)
+}
+
+// removeDroppedNamespaces deletes the leftovers of DropNamespace calls
+// that were interrupted (e.g. by a crash) after the rename.
+func removeDroppedNamespaces(directory string) {
+	entries, err := os.ReadDir(filepath.Join(directory, NAMESPACES_DIR))
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), droppedNamespacePrefix) {
+			path := filepath.Join(directory, NAMESPACES_DIR, entry.Name())
+			if err := os.RemoveAll(path); err != nil {
+				log.Errorf("error removing dropped namespace directory %s: %v", path, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package KeyValor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"KeyValor/config"
+	"KeyValor/constants"
+)
+
+func TestNamespacesAreIsolated(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewKeyValorDB(WithDirectory(dir))
+	require.NoError(t, err)
+
+	users, err := db.Namespace("users", WithCompression(config.CompressionFlate))
+	require.NoError(t, err)
+	require.Equal(t, "users", users.Name())
+
+	require.NoError(t, db.Set("k", []byte("root")))
+	require.NoError(t, users.Set("k", []byte("namespaced")))
+
+	val, err := db.Get("k")
+	require.NoError(t, err)
+	require.Equal(t, "root", string(val))
+
+	val, err = users.Get("k")
+	require.NoError(t, err)
+	require.Equal(t, "namespaced", string(val))
+
+	// the same handle is returned while the namespace is open
+	again, err := db.Namespace("users")
+	require.NoError(t, err)
+	require.Same(t, users, again)
+
+	_, err = users.Namespace("nested")
+	require.ErrorIs(t, err, constants.ErrNestedNamespace)
+
+	_, err = db.Namespace("../escape")
+	require.ErrorIs(t, err, constants.ErrInvalidNamespaceName)
+
+	require.NoError(t, db.Shutdown())
+
+	// data survives a restart, and compression is fixed at creation
+	db, err = NewKeyValorDB(WithDirectory(dir))
+	require.NoError(t, err)
+	defer db.Shutdown()
+
+	_, err = db.Namespace("users")
+	require.Error(t, err)
+
+	users, err = db.Namespace("users", WithCompression(config.CompressionFlate))
+	require.NoError(t, err)
+
+	val, err = users.Get("k")
+	require.NoError(t, err)
+	require.Equal(t, "namespaced", string(val))
+
+	names, err := db.Namespaces()
+	require.NoError(t, err)
+	require.Equal(t, []string{"users"}, names)
+}
+
+func TestDropNamespace(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewKeyValorDB(WithDirectory(dir))
+	require.NoError(t, err)
+	defer db.Shutdown()
+
+	sessions, err := db.Namespace("sessions")
+	require.NoError(t, err)
+	require.NoError(t, sessions.Set("s1", []byte("v")))
+
+	require.NoError(t, db.DropNamespace("sessions"))
+
+	_, err = os.Stat(filepath.Join(dir, NAMESPACES_DIR, "sessions"))
+	require.True(t, os.IsNotExist(err))
+
+	require.ErrorIs(t, db.DropNamespace("sessions"), constants.ErrNamespaceNotFound)
+
+	// a re-created namespace starts empty
+	sessions, err = db.Namespace("sessions")
+	require.NoError(t, err)
+	require.False(t, sessions.Exists("s1"))
+
+	// a namespace reopened while it is dropped keeps its directory
+	for i := 0; i < 20; i++ {
+		opened := make(chan error)
+		go func() {
+			ns, err := db.Namespace("race")
+			if err == nil {
+				err = ns.Set("k", []byte("v"))
+			}
+			opened <- err
+		}()
+		if err := db.DropNamespace("race"); err != nil {
+			require.ErrorIs(t, err, constants.ErrNamespaceNotFound)
+		}
+		require.NoError(t, <-opened)
+
+		ns, err := db.Namespace("race")
+		require.NoError(t, err)
+		require.NoError(t, ns.Set("k", []byte("v")))
+		require.DirExists(t, filepath.Join(dir, NAMESPACES_DIR, "race"))
+		require.NoError(t, db.DropNamespace("race"))
+	}
+
+	// the files of the dropped namespaces are removed in the background
+	require.Eventually(t, func() bool {
+		entries, err := os.ReadDir(filepath.Join(dir, NAMESPACES_DIR))
+		require.NoError(t, err)
+		return len(entries) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNamespaceDefaultTTL(t *testing.T) {
+	db, err := NewKeyValorDB(WithDirectory(t.TempDir()))
+	require.NoError(t, err)
+	defer db.Shutdown()
+
+	cache, err := db.Namespace("cache", WithDefaultTTL(50*time.Millisecond))
+	require.NoError(t, err)
+
+	require.NoError(t, cache.Set("k", []byte("v")))
+	_, err = cache.Get("k")
+	require.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+
+	_, err = cache.Get("k")
+	require.ErrorIs(t, err, constants.ErrKeyIsExpired)
+}
@@ -0,0 +1,105 @@
+package KeyValor
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"KeyValor/config"
+	"KeyValor/constants"
+	"KeyValor/internal/storage/storagecommon"
+)
+
+func TestReadOnlyAlongsideWriter(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewKeyValorDB(WithDirectory(dir))
+	require.NoError(t, err)
+	require.NoError(t, db.Set("k", []byte("v")))
+	_, err = db.Namespace("users")
+	require.NoError(t, err)
+	require.NoError(t, db.Shutdown())
+
+	writer, err := NewKeyValorDB(WithDirectory(dir))
+	require.NoError(t, err)
+	defer writer.Shutdown()
+
+	// a second writer is still refused
+	_, err = NewKeyValorDB(WithDirectory(dir))
+	require.Error(t, err)
+
+	reader, err := NewKeyValorDB(WithDirectory(dir), WithReadOnly())
+	require.NoError(t, err)
+
+	val, err := reader.Get("k")
+	require.NoError(t, err)
+	require.Equal(t, "v", string(val))
+
+	require.ErrorIs(t, reader.Set("k", []byte("x")), constants.ErrReadOnly)
+	require.ErrorIs(t, reader.Delete("k"), constants.ErrReadOnly)
+	require.ErrorIs(t, reader.DropNamespace("users"), constants.ErrReadOnly)
+
+	_, err = reader.Namespace("users")
+	require.NoError(t, err)
+	_, err = reader.Namespace("missing")
+	require.ErrorIs(t, err, constants.ErrNamespaceNotFound)
+
+	// several readers can share the directory
+	other, err := NewKeyValorDB(WithDirectory(dir), WithReadOnly())
+	require.NoError(t, err)
+	require.NoError(t, other.Shutdown())
+	require.NoError(t, reader.Shutdown())
+
+	// the writer is unaffected
+	require.NoError(t, writer.Set("k", []byte("w")))
+}
+
+func TestLockModeValidation(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := NewKeyValorDB(WithDirectory(dir), WithLockMode(config.LockNone))
+	require.ErrorIs(t, err, constants.ErrInvalidLockMode)
+
+	db, err := NewKeyValorDB(WithDirectory(dir))
+	require.NoError(t, err)
+	require.NoError(t, db.Set("k", []byte("v")))
+	require.NoError(t, db.Shutdown())
+
+	checkpoint, err := NewKeyValorDB(WithDirectory(dir), WithReadOnly(), WithLockMode(config.LockNone))
+	require.NoError(t, err)
+	defer checkpoint.Shutdown()
+
+	val, err := checkpoint.Get("k")
+	require.NoError(t, err)
+	require.Equal(t, "v", string(val))
+}
+
+func TestReadOnlyWithoutReadersLockFile(t *testing.T) {
+	dir := t.TempDir()
+	readersLock := filepath.Join(dir, storagecommon.READERS_LOCKFILE)
+
+	// the writer creates the lock file of the readers
+	db, err := NewKeyValorDB(WithDirectory(dir))
+	require.NoError(t, err)
+	require.NoError(t, db.Set("k", []byte("v")))
+	require.FileExists(t, readersLock)
+	require.NoError(t, db.Shutdown())
+
+	// a checkpoint copied without the lock file is opened without creating it
+	require.NoError(t, os.Remove(readersLock))
+	reader, err := NewKeyValorDB(WithDirectory(dir), WithReadOnly())
+	require.NoError(t, err)
+	val, err := reader.Get("k")
+	require.NoError(t, err)
+	require.Equal(t, "v", string(val))
+	require.NoError(t, reader.Shutdown())
+	require.NoFileExists(t, readersLock)
+
+	// with a writer attached, the lock file is required
+	require.NoError(t, os.WriteFile(filepath.Join(dir, storagecommon.LOCKFILE), nil, 0644))
+	_, err = NewKeyValorDB(WithDirectory(dir), WithReadOnly())
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
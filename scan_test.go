@@ -0,0 +1,56 @@
+package KeyValor
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScan(t *testing.T) {
+	db, err := NewKeyValorDB(WithDirectory(t.TempDir()))
+	require.NoError(t, err)
+	defer db.Shutdown()
+
+	for i := 0; i < 500; i++ {
+		require.NoError(t, db.Set(fmt.Sprintf("user:%d", i), []byte("v")))
+	}
+	require.NoError(t, db.Set("other", []byte("v")))
+
+	// keys present during the whole scan are returned exactly once,
+	// even though the keys added meanwhile make the scan table grow
+	seen := make(map[string]int)
+	cursor, calls := uint64(0), 0
+	for {
+		keys, next, err := db.Scan(cursor, "user:*", 20)
+		require.NoError(t, err)
+		for _, key := range keys {
+			seen[key]++
+		}
+
+		for i := 0; i < 50; i++ {
+			require.NoError(t, db.Set(fmt.Sprintf("new:%d:%d", calls, i), []byte("v")))
+		}
+		calls++
+
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+
+	for i := 0; i < 500; i++ {
+		require.Equal(t, 1, seen[fmt.Sprintf("user:%d", i)], "user:%d", i)
+	}
+	require.Len(t, seen, 500)
+	require.Greater(t, calls, 10)
+
+	// KEYS uses the same glob patterns
+	keys, err := db.Keys("user:1?")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"user:10", "user:11", "user:12", "user:13", "user:14",
+		"user:15", "user:16", "user:17", "user:18", "user:19"}, keys)
+	keys, err = db.Keys("oth[a-f]r")
+	require.NoError(t, err)
+	require.Equal(t, []string{"other"}, keys)
+}
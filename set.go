@@ -0,0 +1,150 @@
+package KeyValor
+
+import (
+	"sort"
+
+	"KeyValor/dbops"
+	"KeyValor/internal/datatypes"
+)
+
+// Set is the value of a set key: an unordered collection of unique members, like a Redis set.
+type Set struct {
+	members map[string]struct{}
+}
+
+// NewSet returns an empty set.
+func NewSet() *Set {
+	return &Set{members: make(map[string]struct{})}
+}
+
+// Add adds a member, and returns true if it is new.
+func (s *Set) Add(member string) bool {
+	if _, exists := s.members[member]; exists {
+		return false
+	}
+	s.members[member] = struct{}{}
+	return true
+}
+
+// Remove removes a member, and returns true if it existed.
+func (s *Set) Remove(member string) bool {
+	if _, exists := s.members[member]; !exists {
+		return false
+	}
+	delete(s.members, member)
+	return true
+}
+
+// Contains returns whether member is in the set.
+func (s *Set) Contains(member string) bool {
+	_, exists := s.members[member]
+	return exists
+}
+
+// Len returns the number of members.
+func (s *Set) Len() int {
+	return len(s.members)
+}
+
+// Members returns the members of the set, sorted.
+func (s *Set) Members() []string {
+	members := make([]string, 0, len(s.members))
+	for member := range s.members {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// Inter returns the members of s that are in all the others.
+func (s *Set) Inter(others ...*Set) *Set {
+	inter := NewSet()
+	for member := range s.members {
+		if containedInAll(member, others) {
+			inter.Add(member)
+		}
+	}
+	return inter
+}
+
+// Union returns the members of s and of the others.
+func (s *Set) Union(others ...*Set) *Set {
+	union := NewSet()
+	for _, set := range append([]*Set{s}, others...) {
+		for member := range set.members {
+			union.Add(member)
+		}
+	}
+	return union
+}
+
+// Diff returns the members of s that aren't in any of the others.
+func (s *Set) Diff(others ...*Set) *Set {
+	diff := NewSet()
+	for member := range s.members {
+		if !containedInAny(member, others) {
+			diff.Add(member)
+		}
+	}
+	return diff
+}
+
+func containedInAll(member string, sets []*Set) bool {
+	for _, set := range sets {
+		if !set.Contains(member) {
+			return false
+		}
+	}
+	return true
+}
+
+func containedInAny(member string, sets []*Set) bool {
+	for _, set := range sets {
+		if set.Contains(member) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Set) kind() datatypes.Kind {
+	return datatypes.KindSet
+}
+
+func (s *Set) encode() []byte {
+	members := s.Members()
+	elements := make([][]byte, len(members))
+	for i, member := range members {
+		elements[i] = []byte(member)
+	}
+	return datatypes.EncodeSlice(elements)
+}
+
+func decodeSet(payload []byte) (*Set, error) {
+	elements, err := datatypes.DecodeSlice(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Set{members: make(map[string]struct{}, len(elements))}
+	for _, element := range elements {
+		s.members[string(element)] = struct{}{}
+	}
+	return s, nil
+}
+
+// GetSet returns the set stored at key, or an empty set if the key doesn't exist.
+// It fails with constants.ErrWrongType if the key holds another data type.
+// It acquires a read lock on the database to ensure thread safety.
+func (db *KeyValorDatabase) GetSet(key string) (*Set, error) {
+	return readCollection(db, dbops.OpGetSet, key, decodeSet, NewSet)
+}
+
+// UpdateSet atomically calls update on the set stored at key (an empty set if the key
+// doesn't exist), and stores the result, unless update returns an error. The key keeps its
+// expiry, and is deleted when the set becomes empty.
+// It fails with constants.ErrWrongType if the key holds another data type.
+// It acquires a write lock on the database to ensure thread safety.
+func (db *KeyValorDatabase) UpdateSet(key string, update func(s *Set) error) error {
+	return updateCollection(db, dbops.OpUpdateSet, key, decodeSet, NewSet, update)
+}
@@ -0,0 +1,88 @@
+package KeyValor
+
+import (
+	"time"
+
+	"KeyValor/dbops"
+	"KeyValor/internal/datatypes"
+	"KeyValor/internal/storage/storagecommon"
+)
+
+// SetCondition restricts when SetWithOptions writes a key.
+type SetCondition int8
+
+const (
+	// SetAlways writes the key whether it exists or not
+	SetAlways SetCondition = iota
+	// SetIfNotExists only writes the key if it doesn't exist (Redis' NX)
+	SetIfNotExists
+	// SetIfExists only writes the key if it already exists (Redis' XX)
+	SetIfExists
+)
+
+// SetOptions are the options of SetWithOptions, mirroring the ones of Redis' SET.
+type SetOptions struct {
+	Condition SetCondition
+	// Expiry is when the key expires; if it's zero, the key gets the default TTL (if any),
+	// unless KeepTTL is set
+	Expiry time.Time
+	// KeepTTL keeps the current expiry of the key, without rewriting it
+	KeepTTL bool
+	// Get makes the call fail with constants.ErrWrongType, without writing anything,
+	// if the key holds another data type than a string (its previous value couldn't be returned)
+	Get bool
+}
+
+// SetResult tells what SetWithOptions did.
+type SetResult struct {
+	// Written is false if the key wasn't written because of the condition
+	Written bool
+	// Existed tells whether the key existed before the call, and Previous is its value then
+	// (nil if it wasn't a string)
+	Existed  bool
+	Previous []byte
+}
+
+// SetWithOptions inserts or updates a key-value pair like Set, with the options of Redis' SET.
+// The check of the condition, the read of the previous value and the write happen atomically.
+// It acquires a write lock on the database to ensure thread safety.
+func (db *KeyValorDatabase) SetWithOptions(key string, value []byte, opts SetOptions) (result SetResult, err error) {
+	err = db.intercept(dbops.OpSetWithOptions, true, []string{key}, func() error {
+		db.Lock()
+		defer db.Unlock()
+
+		stored, expiry, err := db.storage.GetWithExpiry(key)
+		switch {
+		case err == nil:
+			result.Existed = true
+			if result.Previous, err = decodeString(stored); err != nil && opts.Get {
+				return err
+			}
+		case !storagecommon.IsMissingKey(err):
+			return err
+		}
+
+		value := datatypes.EncodeString(value)
+
+		if (opts.Condition == SetIfNotExists && result.Existed) ||
+			(opts.Condition == SetIfExists && !result.Existed) {
+			return nil
+		}
+
+		switch {
+		case opts.KeepTTL:
+			err = db.storage.SetWithExpiry(key, value, expiry)
+		case !opts.Expiry.IsZero():
+			err = db.storage.SetWithExpiry(key, value, opts.Expiry)
+		default:
+			err = db.storage.Set(key, value)
+		}
+		if err != nil {
+			return err
+		}
+
+		result.Written = true
+		return nil
+	})
+	return result, err
+}
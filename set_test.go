@@ -0,0 +1,31 @@
+package KeyValor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSets(t *testing.T) {
+	db, err := NewKeyValorDB(WithDirectory(t.TempDir()))
+	require.NoError(t, err)
+	defer db.Shutdown()
+
+	require.NoError(t, db.UpdateSet("tags", func(s *Set) error {
+		require.True(t, s.Add("go"))
+		require.False(t, s.Add("go"))
+		s.Add("db")
+		return nil
+	}))
+
+	s, err := db.GetSet("tags")
+	require.NoError(t, err)
+	require.Equal(t, []string{"db", "go"}, s.Members())
+
+	other := NewSet()
+	other.Add("go")
+	other.Add("redis")
+	require.Equal(t, []string{"go"}, s.Inter(other).Members())
+	require.Equal(t, []string{"db", "go", "redis"}, s.Union(other).Members())
+	require.Equal(t, []string{"db"}, s.Diff(other).Members())
+}
@@ -0,0 +1,249 @@
+package KeyValor
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"KeyValor/dbops"
+	"KeyValor/internal/datatypes"
+	"KeyValor/internal/skiplist"
+)
+
+// ScoredMember is a member of a sorted set, with its score.
+type ScoredMember struct {
+	Member string
+	Score  float64
+}
+
+// ScoreBound is the minimum or the maximum of a range of scores.
+// An exclusive bound is not part of the range (like "(1.5" in ZRANGEBYSCORE).
+type ScoreBound = skiplist.Bound
+
+// SortedSet is the value of a sorted set key: unique members ordered by score (and then by
+// member), like a Redis sorted set. Ranks are 0-based, in increasing order of scores.
+type SortedSet struct {
+	scores  map[string]float64
+	byScore *skiplist.SkipList
+	// shared is set once the members are shared with another sorted set, like the one cached
+	// by the database (see share): they are copied before the first modification
+	shared bool
+}
+
+// NewSortedSet returns an empty sorted set.
+func NewSortedSet() *SortedSet {
+	return &SortedSet{
+		scores:  make(map[string]float64),
+		byScore: skiplist.New(),
+	}
+}
+
+// Len returns the number of members.
+func (z *SortedSet) Len() int {
+	return len(z.scores)
+}
+
+// Score returns the score of a member, and whether the member exists.
+func (z *SortedSet) Score(member string) (float64, bool) {
+	score, ok := z.scores[member]
+	return score, ok
+}
+
+// Add adds a member with the given score, or updates its score if it exists already.
+// It returns true if the member is new.
+func (z *SortedSet) Add(member string, score float64) bool {
+	current, exists := z.scores[member]
+	if exists && current == score {
+		return false
+	}
+
+	z.own()
+	if exists {
+		z.byScore.Delete(current, member)
+	}
+
+	z.scores[member] = score
+	z.byScore.Insert(score, member)
+	return !exists
+}
+
+// Remove removes a member, and returns true if it existed.
+func (z *SortedSet) Remove(member string) bool {
+	score, exists := z.scores[member]
+	if !exists {
+		return false
+	}
+
+	z.own()
+	delete(z.scores, member)
+	z.byScore.Delete(score, member)
+	return true
+}
+
+// share returns a sorted set with the same members as z, that they both copy before their
+// first modification.
+func (z *SortedSet) share() collection {
+	if !z.shared {
+		z.shared = true
+	}
+	shared := *z
+	return &shared
+}
+
+// own copies the members of z, if they are shared, so that it can modify them.
+func (z *SortedSet) own() {
+	if !z.shared {
+		return
+	}
+
+	scores := make(map[string]float64, len(z.scores))
+	byScore := skiplist.New()
+	for n := z.byScore.First(); n != nil; n = n.Next() {
+		scores[n.Member] = n.Score
+		byScore.Insert(n.Score, n.Member)
+	}
+	z.scores, z.byScore, z.shared = scores, byScore, false
+}
+
+// Rank returns the rank of a member (in decreasing order of scores if reverse is set),
+// and whether the member exists.
+func (z *SortedSet) Rank(member string, reverse bool) (int, bool) {
+	score, exists := z.scores[member]
+	if !exists {
+		return 0, false
+	}
+
+	rank := z.byScore.Rank(score, member)
+	if reverse {
+		rank = z.Len() - 1 - rank
+	}
+	return rank, true
+}
+
+// RangeByRank returns the members from rank start to rank stop, both included, with the
+// clamping of ZRANGE: negative ranks count from the end. With reverse, ranks are in
+// decreasing order of scores, and so are the returned members.
+func (z *SortedSet) RangeByRank(start, stop int, reverse bool) []ScoredMember {
+	length := z.Len()
+	if start < 0 {
+		start = max(length+start, 0)
+	}
+	if stop < 0 {
+		stop = length + stop
+	}
+	stop = min(stop, length-1)
+	if start > stop || start >= length {
+		return []ScoredMember{}
+	}
+
+	members := make([]ScoredMember, 0, stop-start+1)
+	if reverse {
+		for n := z.byScore.ByRank(length - 1 - start); len(members) < cap(members); n = n.Prev() {
+			members = append(members, ScoredMember{Member: n.Member, Score: n.Score})
+		}
+	} else {
+		for n := z.byScore.ByRank(start); len(members) < cap(members); n = n.Next() {
+			members = append(members, ScoredMember{Member: n.Member, Score: n.Score})
+		}
+	}
+	return members
+}
+
+// RangeByScore returns the members whose score is between min and max, skipping the first
+// offset ones, and returning at most count of them (all of them if count is negative).
+// With reverse, the members are in decreasing order of scores.
+func (z *SortedSet) RangeByScore(min, max ScoreBound, reverse bool, offset, count int) []ScoredMember {
+	var n *skiplist.Node
+	if reverse {
+		n = z.byScore.LastInRange(max)
+	} else {
+		n = z.byScore.FirstInRange(min)
+	}
+
+	members := []ScoredMember{}
+	for ; n != nil && skiplist.InRange(n.Score, min, max) && count != 0; offset-- {
+		if offset <= 0 {
+			members = append(members, ScoredMember{Member: n.Member, Score: n.Score})
+			count--
+		}
+
+		if reverse {
+			n = n.Prev()
+		} else {
+			n = n.Next()
+		}
+	}
+	return members
+}
+
+// Count returns the number of members whose score is between min and max.
+func (z *SortedSet) Count(min, max ScoreBound) int {
+	first := z.byScore.FirstInRange(min)
+	last := z.byScore.LastInRange(max)
+	if first == nil || last == nil || !skiplist.InRange(first.Score, min, max) {
+		return 0
+	}
+
+	return z.byScore.Rank(last.Score, last.Member) - z.byScore.Rank(first.Score, first.Member) + 1
+}
+
+// Members returns the members of the sorted set, sorted by member (not by score).
+func (z *SortedSet) Members() []string {
+	members := make([]string, 0, len(z.scores))
+	for member := range z.scores {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+func (z *SortedSet) kind() datatypes.Kind {
+	return datatypes.KindSortedSet
+}
+
+// encode encodes the members in order, each one followed by its 8-byte score.
+func (z *SortedSet) encode() []byte {
+	elements := make([][]byte, 0, 2*z.Len())
+	for n := z.byScore.First(); n != nil; n = n.Next() {
+		elements = append(elements, []byte(n.Member), binary.BigEndian.AppendUint64(nil, math.Float64bits(n.Score)))
+	}
+	return datatypes.EncodeSlice(elements)
+}
+
+func decodeSortedSet(payload []byte) (*SortedSet, error) {
+	elements, err := datatypes.DecodeSlice(payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(elements)%2 != 0 {
+		return nil, datatypes.ErrCorruptValue
+	}
+
+	z := NewSortedSet()
+	for i := 0; i < len(elements); i += 2 {
+		if len(elements[i+1]) != 8 {
+			return nil, datatypes.ErrCorruptValue
+		}
+		z.Add(string(elements[i]), math.Float64frombits(binary.BigEndian.Uint64(elements[i+1])))
+	}
+	return z, nil
+}
+
+// GetSortedSet returns the sorted set stored at key, or an empty one if the key doesn't exist.
+// The sorted set is kept decoded until the key is written, and shared by the readers: it must
+// not be modified (see UpdateSortedSet).
+// It fails with constants.ErrWrongType if the key holds another data type.
+// It acquires a read lock on the database to ensure thread safety.
+func (db *KeyValorDatabase) GetSortedSet(key string) (*SortedSet, error) {
+	return readCollection(db, dbops.OpGetSortedSet, key, decodeSortedSet, NewSortedSet)
+}
+
+// UpdateSortedSet atomically calls update on the sorted set stored at key (an empty one if
+// the key doesn't exist), and stores the result, unless update returns an error. The key keeps
+// its expiry, and is deleted when the sorted set becomes empty. z is then kept decoded for the
+// next reads, so update must not retain it.
+// It fails with constants.ErrWrongType if the key holds another data type.
+// It acquires a write lock on the database to ensure thread safety.
+func (db *KeyValorDatabase) UpdateSortedSet(key string, update func(z *SortedSet) error) error {
+	return updateCollection(db, dbops.OpUpdateSortedSet, key, decodeSortedSet, NewSortedSet, update)
+}
@@ -0,0 +1,119 @@
+package KeyValor
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"KeyValor/constants"
+)
+
+func TestSortedSets(t *testing.T) {
+	db, err := NewKeyValorDB(WithDirectory(t.TempDir()))
+	require.NoError(t, err)
+	defer db.Shutdown()
+
+	require.NoError(t, db.UpdateSortedSet("board", func(z *SortedSet) error {
+		require.True(t, z.Add("alice", 10))
+		require.True(t, z.Add("bob", 20))
+		require.True(t, z.Add("carol", 20))
+		require.True(t, z.Add("dave", math.Inf(-1)))
+		require.False(t, z.Add("alice", 30))
+		return nil
+	}))
+
+	// the scores survive the round trip through the storage
+	z, err := db.GetSortedSet("board")
+	require.NoError(t, err)
+	require.Equal(t, []ScoredMember{
+		{Member: "dave", Score: math.Inf(-1)},
+		{Member: "bob", Score: 20},
+		{Member: "carol", Score: 20},
+		{Member: "alice", Score: 30},
+	}, z.RangeByRank(0, -1, false))
+
+	rank, ok := z.Rank("carol", false)
+	require.True(t, ok)
+	require.Equal(t, 2, rank)
+	rank, ok = z.Rank("carol", true)
+	require.True(t, ok)
+	require.Equal(t, 1, rank)
+
+	require.Equal(t, []ScoredMember{{Member: "alice", Score: 30}, {Member: "carol", Score: 20}},
+		z.RangeByRank(0, 1, true))
+	require.Equal(t, []ScoredMember{{Member: "carol", Score: 20}},
+		z.RangeByScore(ScoreBound{Value: 20}, ScoreBound{Value: 30, Exclusive: true}, false, 1, -1))
+	require.Equal(t, []ScoredMember{{Member: "alice", Score: 30}, {Member: "carol", Score: 20}},
+		z.RangeByScore(ScoreBound{Value: 20}, ScoreBound{Value: math.Inf(1)}, true, 0, 2))
+	require.Equal(t, 3, z.Count(ScoreBound{Value: 0}, ScoreBound{Value: 30}))
+	require.Equal(t, 0, z.Count(ScoreBound{Value: 21}, ScoreBound{Value: 29}))
+
+	require.True(t, z.Remove("bob"))
+	require.False(t, z.Remove("bob"))
+	require.Equal(t, []string{"alice", "carol", "dave"}, z.Members())
+}
+
+func TestSortedSetCache(t *testing.T) {
+	db, err := NewKeyValorDB(WithDirectory(t.TempDir()))
+	require.NoError(t, err)
+	defer db.Shutdown()
+
+	require.NoError(t, db.UpdateSortedSet("board", func(z *SortedSet) error {
+		z.Add("alice", 1)
+		z.Add("bob", 2)
+		return nil
+	}))
+	// a new key may get the default TTL: it is cached once read
+	require.NotContains(t, db.collections.entries, "board")
+	z, err := db.GetSortedSet("board")
+	require.NoError(t, err)
+	require.Contains(t, db.collections.entries, "board")
+
+	// the readers share the cached sorted set, but modifying one doesn't modify the others
+	require.True(t, z.Add("carol", 3))
+	require.True(t, z.Remove("alice"))
+	z, err = db.GetSortedSet("board")
+	require.NoError(t, err)
+	require.Equal(t, []string{"alice", "bob"}, z.Members())
+
+	// the updates start from the cached sorted set
+	require.NoError(t, db.UpdateSortedSet("board", func(z *SortedSet) error {
+		z.Add("alice", 5)
+		return nil
+	}))
+	z, err = db.GetSortedSet("board")
+	require.NoError(t, err)
+	require.Equal(t, []ScoredMember{{Member: "bob", Score: 2}, {Member: "alice", Score: 5}}, z.RangeByRank(0, -1, false))
+
+	// every write drops the entry of its key
+	require.NoError(t, db.Rename("board", "other"))
+	require.NotContains(t, db.collections.entries, "board")
+	z, err = db.GetSortedSet("board")
+	require.NoError(t, err)
+	require.Zero(t, z.Len())
+	z, err = db.GetSortedSet("other")
+	require.NoError(t, err)
+	require.Equal(t, 2, z.Len())
+
+	require.NoError(t, db.Set("other", []byte("v")))
+	_, err = db.GetSortedSet("other")
+	require.ErrorIs(t, err, constants.ErrWrongType)
+
+	// an expired key isn't served from the cache
+	require.NoError(t, db.UpdateSortedSet("short", func(z *SortedSet) error {
+		z.Add("alice", 1)
+		return nil
+	}))
+	expiry := time.Now().Add(50 * time.Millisecond)
+	require.NoError(t, db.Expire("short", &expiry))
+	z, err = db.GetSortedSet("short")
+	require.NoError(t, err)
+	require.Equal(t, 1, z.Len())
+	require.Contains(t, db.collections.entries, "short")
+	time.Sleep(60 * time.Millisecond)
+	z, err = db.GetSortedSet("short")
+	require.NoError(t, err)
+	require.Zero(t, z.Len())
+}
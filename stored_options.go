@@ -0,0 +1,59 @@
+package KeyValor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"KeyValor/config"
+	"KeyValor/constants"
+	"KeyValor/internal/utils/fileutils"
+)
+
+// OPTIONS_FILENAME stores the options that can't change once a database (or its lists) has data
+const OPTIONS_FILENAME = "options.json"
+
+// storedOptions are persisted in the directory of a database, a namespace or their lists,
+// because data written with them can't be read back with different ones.
+type storedOptions struct {
+	Compression string `json:"compression"`
+}
+
+// loadOrStoreOptions persists the options of a new directory in its file filename,
+// or checks that they match the ones it was created with.
+func loadOrStoreOptions(cfg *config.DBCfgOpts, filename string) error {
+	optionsPath := filepath.Join(cfg.Directory, filename)
+
+	if !fileutils.FileExists(optionsPath) {
+		if cfg.ReadOnly {
+			// a directory that was never written to: nothing to check
+			return nil
+		}
+		return fileutils.AtomicReplaceFile(optionsPath, func(f *os.File) error {
+			return json.NewEncoder(f).Encode(storedOptions{
+				Compression: cfg.Compression.String(),
+			})
+		})
+	}
+
+	data, err := os.ReadFile(optionsPath)
+	if err != nil {
+		return fmt.Errorf("error reading options: %w", err)
+	}
+
+	var stored storedOptions
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return fmt.Errorf("error decoding options: %w", err)
+	}
+
+	compression, err := config.ParseCompression(stored.Compression)
+	if err != nil {
+		return err
+	}
+	if compression != cfg.Compression {
+		return fmt.Errorf("%w: %s was created with compression %q, can't open it with %q",
+			constants.ErrCompressionMismatch, cfg.Directory, compression, cfg.Compression)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package KeyValor
+
+import (
+	"errors"
+	"fmt"
+
+	"KeyValor/constants"
+)
+
+// TypedStore is a view of a KeyValorDatabase (or of a Namespace, through its
+// embedded KeyValorDatabase) whose values are of type T. Values are converted
+// with a Codec; values that can't be decoded are reported as a *DecodeError.
+type TypedStore[T any] struct {
+	db    *KeyValorDatabase
+	codec Codec[T]
+}
+
+// TypedValue is the typed counterpart of dbops.Value, returned by TypedStore.MGet.
+type TypedValue[T any] struct {
+	Val T
+	Err error
+}
+
+func NewTypedStore[T any](db *KeyValorDatabase, codec Codec[T]) *TypedStore[T] {
+	return &TypedStore[T]{
+		db:    db,
+		codec: codec,
+	}
+}
+
+// Get retrieves and decodes the value associated with the given key.
+// Storage errors (e.g. a missing or expired key) are returned as they are,
+// while a value that can't be decoded results in a *DecodeError.
+func (ts *TypedStore[T]) Get(key string) (T, error) {
+	data, err := ts.db.Get(key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return ts.decode(key, data)
+}
+
+// Set encodes the value and associates it with the given key.
+func (ts *TypedStore[T]) Set(key string, value T) error {
+	data, err := ts.encode(key, value)
+	if err != nil {
+		return err
+	}
+	return ts.db.Set(key, data)
+}
+
+// SetEx encodes the value and associates it with the given key, for ttlSeconds seconds.
+func (ts *TypedStore[T]) SetEx(key string, value T, ttlSeconds int64) error {
+	data, err := ts.encode(key, value)
+	if err != nil {
+		return err
+	}
+	return ts.db.SetEx(key, data, ttlSeconds)
+}
+
+// MGet retrieves and decodes the values associated with the given keys.
+// The error of each key (missing, expired, or a *DecodeError) is reported
+// in its TypedValue; the returned error is only set if the lookup itself failed.
+func (ts *TypedStore[T]) MGet(keys []string) ([]TypedValue[T], error) {
+	values, err := ts.db.MGet(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	typedValues := make([]TypedValue[T], len(values))
+	for i, value := range values {
+		if value.Err != nil {
+			typedValues[i].Err = value.Err
+			continue
+		}
+		typedValues[i].Val, typedValues[i].Err = ts.decode(keys[i], value.Val)
+	}
+	return typedValues, nil
+}
+
+// ForEach calls f for every key matching the pattern (as in KeyValorDatabase.Keys),
+// with its decoded value.
+// Keys that are deleted or expire while iterating are skipped, and so are the keys
+// holding another data type (a hash, a list, ...). Iteration stops at the first error,
+// either a *DecodeError or an error returned by f.
+func (ts *TypedStore[T]) ForEach(pattern string, f func(key string, value T) error) error {
+	keys, err := ts.db.Keys(pattern)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		value, err := ts.Get(key)
+		if errors.Is(err, constants.ErrKeyMissing) || errors.Is(err, constants.ErrKeyIsExpired) ||
+			errors.Is(err, constants.ErrWrongType) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := f(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ts *TypedStore[T]) encode(key string, value T) ([]byte, error) {
+	data, err := ts.codec.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding value of key %q: %w", key, err)
+	}
+	return data, nil
+}
+
+func (ts *TypedStore[T]) decode(key string, data []byte) (T, error) {
+	value, err := ts.codec.Unmarshal(data)
+	if err != nil {
+		var zero T
+		return zero, &DecodeError{Key: key, Err: err}
+	}
+	return value, nil
+}
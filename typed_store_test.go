@@ -0,0 +1,79 @@
+package KeyValor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"KeyValor/constants"
+)
+
+type testUser struct {
+	Name string
+	Age  int
+}
+
+func TestTypedStoreCodecs(t *testing.T) {
+	db, err := NewKeyValorDB(WithDirectory(t.TempDir()))
+	require.NoError(t, err)
+	defer db.Shutdown()
+
+	jsonUsers := NewTypedStore[testUser](db, JSONCodec[testUser]{})
+	gobUsers := NewTypedStore[testUser](db, GobCodec[testUser]{})
+	raw := NewTypedStore[[]byte](db, BytesCodec{})
+
+	require.NoError(t, jsonUsers.Set("json:1", testUser{Name: "ada", Age: 36}))
+	require.NoError(t, gobUsers.SetEx("gob:1", testUser{Name: "alan", Age: 41}, 60))
+	require.NoError(t, raw.Set("raw:1", []byte("not a user")))
+
+	user, err := jsonUsers.Get("json:1")
+	require.NoError(t, err)
+	require.Equal(t, testUser{Name: "ada", Age: 36}, user)
+
+	user, err = gobUsers.Get("gob:1")
+	require.NoError(t, err)
+	require.Equal(t, testUser{Name: "alan", Age: 41}, user)
+
+	// values written by another codec are reported as decode errors
+	_, err = jsonUsers.Get("raw:1")
+	var decodeErr *DecodeError
+	require.True(t, errors.As(err, &decodeErr))
+	require.Equal(t, "raw:1", decodeErr.Key)
+
+	_, err = jsonUsers.Get("missing")
+	require.ErrorIs(t, err, constants.ErrKeyMissing)
+
+	values, err := jsonUsers.MGet([]string{"json:1", "missing", "raw:1"})
+	require.NoError(t, err)
+	require.NoError(t, values[0].Err)
+	require.Equal(t, "ada", values[0].Val.Name)
+	require.ErrorIs(t, values[1].Err, constants.ErrKeyMissing)
+	require.True(t, errors.As(values[2].Err, &decodeErr))
+}
+
+func TestTypedStoreForEach(t *testing.T) {
+	db, err := NewKeyValorDB(WithDirectory(t.TempDir()))
+	require.NoError(t, err)
+	defer db.Shutdown()
+
+	ns, err := db.Namespace("users")
+	require.NoError(t, err)
+
+	users := NewTypedStore[testUser](ns.KeyValorDatabase, JSONCodec[testUser]{})
+	require.NoError(t, users.Set("u1", testUser{Name: "a", Age: 1}))
+	require.NoError(t, users.Set("u2", testUser{Name: "b", Age: 2}))
+	// keys of other data types are skipped
+	require.NoError(t, ns.UpdateHash("u3", func(h *Hash) error {
+		h.Set("name", []byte("c"))
+		return nil
+	}))
+
+	total := 0
+	err = users.ForEach("*", func(key string, user testUser) error {
+		total += user.Age
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, total)
+}
@@ -0,0 +1,109 @@
+package KeyValor
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Watch is an optimistic lock on some keys of a database, like Redis' WATCH: it becomes dirty
+// as soon as one of the keys is written (even with the value it had), and stays dirty.
+// Writes that fail don't make it dirty.
+type Watch struct {
+	db    *KeyValorDatabase
+	keys  []string
+	dirty atomic.Bool
+	// closed is protected by the mutex of the registry
+	closed bool
+}
+
+// watchRegistry holds the open watches of a database, by key. Its zero value is ready to use.
+type watchRegistry struct {
+	mu    sync.Mutex
+	byKey map[string]map[*Watch]struct{}
+	// count is the number of open watches, so that writes don't lock mu when there are none
+	count atomic.Int64
+}
+
+// Watch returns a watch on keys, that must be closed once it isn't needed anymore.
+func (db *KeyValorDatabase) Watch(keys ...string) *Watch {
+	w := &Watch{db: db, keys: keys}
+
+	db.watches.mu.Lock()
+	defer db.watches.mu.Unlock()
+
+	if db.watches.byKey == nil {
+		db.watches.byKey = make(map[string]map[*Watch]struct{})
+	}
+	for _, key := range keys {
+		watches, ok := db.watches.byKey[key]
+		if !ok {
+			watches = make(map[*Watch]struct{})
+			db.watches.byKey[key] = watches
+		}
+		watches[w] = struct{}{}
+	}
+	db.watches.count.Add(1)
+
+	return w
+}
+
+// Dirty returns whether one of the watched keys was written since the watch was created.
+func (w *Watch) Dirty() bool {
+	return w.dirty.Load()
+}
+
+// Close releases the watch. Closing it again does nothing.
+func (w *Watch) Close() {
+	registry := &w.db.watches
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+	for _, key := range w.keys {
+		delete(registry.byKey[key], w)
+		if len(registry.byKey[key]) == 0 {
+			delete(registry.byKey, key)
+		}
+	}
+	w.closed = true
+	registry.count.Add(-1)
+}
+
+// TouchWatches makes dirty every watch on the database, as if all its keys were written: e.g.
+// once a server swapped it with another database, under the same index.
+func (db *KeyValorDatabase) TouchWatches() {
+	db.watches.touch(nil)
+}
+
+// TouchWatchedKeys makes dirty the watches on keys, as if they were written: e.g. once the
+// background tasks deleted them because they expired (see WithExpiryListener).
+func (db *KeyValorDatabase) TouchWatchedKeys(keys []string) {
+	db.watches.touch(keys)
+}
+
+// touch makes dirty the watches on keys, or all the watches if keys is nil.
+func (wr *watchRegistry) touch(keys []string) {
+	if wr.count.Load() == 0 {
+		return
+	}
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	if keys == nil {
+		for _, watches := range wr.byKey {
+			for w := range watches {
+				w.dirty.Store(true)
+			}
+		}
+		return
+	}
+	for _, key := range keys {
+		for w := range wr.byKey[key] {
+			w.dirty.Store(true)
+		}
+	}
+}
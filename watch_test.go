@@ -0,0 +1,52 @@
+package KeyValor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatch(t *testing.T) {
+	db, err := NewKeyValorDB(WithDirectory(t.TempDir()))
+	require.NoError(t, err)
+	defer db.Shutdown()
+
+	require.NoError(t, db.Set("a", []byte("1")))
+
+	w := db.Watch("a", "b")
+	defer w.Close()
+
+	// reads, writes of other keys and failed writes don't make the watch dirty
+	_, err = db.Get("a")
+	require.NoError(t, err)
+	require.NoError(t, db.Set("c", []byte("1")))
+	require.Error(t, db.UpdateList("a", func(l *List) error { return nil }))
+	require.Error(t, db.UpdateHash("b", func(h *Hash) error { return errors.New("aborted") }))
+	require.False(t, w.Dirty())
+
+	// writing the same value does
+	require.NoError(t, db.Set("a", []byte("1")))
+	require.True(t, w.Dirty())
+
+	// a closed watch isn't updated anymore
+	closed := db.Watch("b")
+	closed.Close()
+	closed.Close()
+	require.NoError(t, db.Set("b", []byte("1")))
+	require.False(t, closed.Dirty())
+	require.EqualValues(t, 1, db.watches.count.Load())
+
+	// TouchWatchedKeys only makes dirty the watches on its keys
+	other := db.Watch("missing")
+	defer other.Close()
+	expired := db.Watch("expired")
+	defer expired.Close()
+	db.TouchWatchedKeys([]string{"expired"})
+	require.True(t, expired.Dirty())
+	require.False(t, other.Dirty())
+
+	// TouchWatches makes every watch dirty, whatever its keys
+	db.TouchWatches()
+	require.True(t, other.Dirty())
+}